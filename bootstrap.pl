@@ -21,6 +21,7 @@
 :-(op(200, xfx, **)).
 :-(op(200, xfy, ^)).
 :-(op(200, fy, [+, -, \])).
+:-(op(1150, fx, table)).
 
 % Control constructs
 
@@ -194,6 +195,10 @@ write_canonical(Term) :-
 
 write_canonical(Stream, Term) :- write_term(Stream, Term, [quoted(true), ignore_ops(true)]).
 
+portray_clause(Clause) :-
+  current_output(S),
+  portray_clause(S, Clause).
+
 % Logic and control
 
 once(P) :- P, !.
@@ -210,6 +215,18 @@ halt :- halt(0).
 
 [H|T] :- consult([H|T]).
 
+% Libraries
+
+use_module(library(clpb)) :-
+  op(500, yfx, #),
+  op(300, fy, ~).
+
+use_module(library(chr)) :-
+  op(1200, xfx, @),
+  op(1180, xfx, [==>, <=>]),
+  op(1150, fx, chr_constraint),
+  op(1100, xfx, \).
+
 % Definite clause grammar
 
 phrase(GRBody, S0) :- phrase(GRBody, S0, []).
@@ -0,0 +1,256 @@
+package prolog
+
+import (
+	"io"
+)
+
+// Capability is a named group of built-in predicates.
+type Capability string
+
+// Capability is one of these values.
+const (
+	// CapabilityPure is control constructs and predicates without side effects other than unification.
+	CapabilityPure Capability = "pure"
+
+	// CapabilityArith is arithmetic evaluation and comparison.
+	CapabilityArith Capability = "arith"
+
+	// CapabilityDatabase is predicates which modify the global state of the interpreter, e.g. assertz/1 and op/3.
+	CapabilityDatabase Capability = "database"
+
+	// CapabilityIORead is predicates which read from streams.
+	CapabilityIORead Capability = "io-read"
+
+	// CapabilityIOWrite is predicates which write to streams.
+	CapabilityIOWrite Capability = "io-write"
+
+	// CapabilityFiles is predicates which access the file system, e.g. open/4 and consult/1.
+	// If it's not allowed, Prolog texts can't load files either with directives such as include/1 and ensure_loaded/1.
+	CapabilityFiles Capability = "files"
+
+	// CapabilityDevel is development tools which run goals and report the results, i.e. profile/1 and run_tests/0,1.
+	CapabilityDevel Capability = "devel"
+
+	// CapabilityOS is predicates which interact with the host operating system. There are none at the moment.
+	CapabilityOS Capability = "os"
+
+	// CapabilityHalt is halt/0,1.
+	CapabilityHalt Capability = "halt"
+)
+
+var allCapabilities = []Capability{
+	CapabilityPure,
+	CapabilityArith,
+	CapabilityDatabase,
+	CapabilityIORead,
+	CapabilityIOWrite,
+	CapabilityFiles,
+	CapabilityDevel,
+	CapabilityOS,
+	CapabilityHalt,
+}
+
+type predicateIndicator struct {
+	name  string
+	arity int
+}
+
+// capabilityPredicates maps capabilities to the built-in predicates they consist of.
+// The predicates defined in bootstrap.pl aren't listed since they're removed along with the built-in predicates they call.
+var capabilityPredicates = map[Capability][]predicateIndicator{
+	CapabilityPure: {
+		{name: "call", arity: 1},
+		{name: "catch", arity: 3},
+		{name: "throw", arity: 1},
+		{name: "=", arity: 2},
+		{name: "unify_with_occurs_check", arity: 2},
+		{name: "subsumes_term", arity: 2},
+		{name: "var", arity: 1},
+		{name: "atom", arity: 1},
+		{name: "integer", arity: 1},
+		{name: "float", arity: 1},
+		{name: "compound", arity: 1},
+		{name: "acyclic_term", arity: 1},
+		{name: "compare", arity: 3},
+		{name: "sort", arity: 2},
+		{name: "keysort", arity: 2},
+		{name: "functor", arity: 3},
+		{name: "arg", arity: 3},
+		{name: "=..", arity: 2},
+		{name: "copy_term", arity: 2},
+		{name: "term_variables", arity: 2},
+		{name: "findall", arity: 3},
+		{name: "bagof", arity: 3},
+		{name: "setof", arity: 3},
+		{name: "current_op", arity: 3},
+		{name: "current_char_conversion", arity: 2},
+		{name: `\+`, arity: 1},
+		{name: "repeat", arity: 0},
+		{name: "call", arity: 2},
+		{name: "call", arity: 3},
+		{name: "call", arity: 4},
+		{name: "call", arity: 5},
+		{name: "call", arity: 6},
+		{name: "call", arity: 7},
+		{name: "call", arity: 8},
+		{name: "atom_length", arity: 2},
+		{name: "atom_concat", arity: 3},
+		{name: "sub_atom", arity: 5},
+		{name: "atom_chars", arity: 2},
+		{name: "atom_codes", arity: 2},
+		{name: "char_code", arity: 2},
+		{name: "number_chars", arity: 2},
+		{name: "number_codes", arity: 2},
+		{name: "current_prolog_flag", arity: 2},
+		{name: "phrase", arity: 3},
+		{name: "expand_term", arity: 2},
+		{name: "append", arity: 3},
+		{name: "length", arity: 2},
+		{name: "nth0", arity: 3},
+		{name: "nth1", arity: 3},
+		{name: "call_nth", arity: 2},
+		{name: "sat", arity: 1},
+		{name: "taut", arity: 2},
+		{name: "labeling", arity: 1},
+		{name: "sat_count", arity: 2},
+		{name: "find_chr_constraint", arity: 1},
+		{name: "get_dict", arity: 3},
+		{name: "put_dict", arity: 4},
+		{name: "dict_pairs", arity: 3},
+		{name: "message_to_codes", arity: 3},
+	},
+	CapabilityArith: {
+		{name: "is", arity: 2},
+		{name: "=:=", arity: 2},
+		{name: `=\=`, arity: 2},
+		{name: "<", arity: 2},
+		{name: "=<", arity: 2},
+		{name: ">", arity: 2},
+		{name: ">=", arity: 2},
+		{name: "between", arity: 3},
+		{name: "succ", arity: 2},
+	},
+	CapabilityDatabase: {
+		{name: "clause", arity: 2},
+		{name: "current_predicate", arity: 1},
+		{name: "predicate_property", arity: 2},
+		{name: "clause_property", arity: 2},
+		{name: "asserta", arity: 1},
+		{name: "assertz", arity: 1},
+		{name: "retract", arity: 1},
+		{name: "abolish", arity: 1},
+		{name: "abolish_all_tables", arity: 0},
+		{name: "op", arity: 3},
+		{name: "char_conversion", arity: 2},
+		{name: "set_prolog_flag", arity: 2},
+		{name: "trace", arity: 0},
+		{name: "notrace", arity: 0},
+		{name: "spy", arity: 1},
+		{name: "nospy", arity: 1},
+		{name: "leash", arity: 1},
+		{name: "visible", arity: 1},
+	},
+	CapabilityIORead: {
+		{name: "current_input", arity: 1},
+		{name: "set_input", arity: 1},
+		{name: "stream_property", arity: 2},
+		{name: "set_stream_position", arity: 2},
+		{name: "get_char", arity: 2},
+		{name: "peek_char", arity: 2},
+		{name: "get_byte", arity: 2},
+		{name: "peek_byte", arity: 2},
+		{name: "read_term", arity: 3},
+	},
+	CapabilityIOWrite: {
+		{name: "current_output", arity: 1},
+		{name: "set_output", arity: 1},
+		{name: "flush_output", arity: 1},
+		{name: "put_char", arity: 2},
+		{name: "put_byte", arity: 2},
+		{name: "write_term", arity: 3},
+		{name: "listing", arity: 0},
+		{name: "listing", arity: 1},
+		{name: "portray_clause", arity: 2},
+		{name: "print_message", arity: 2},
+	},
+	CapabilityFiles: {
+		{name: "open", arity: 4},
+		{name: "close", arity: 2},
+		{name: "consult", arity: 1},
+		{name: "make", arity: 0},
+		{name: "xref_source", arity: 1},
+	},
+	CapabilityDevel: {
+		{name: "profile", arity: 1},
+		{name: "run_tests", arity: 0},
+		{name: "run_tests", arity: 1},
+	},
+	CapabilityOS: {},
+	CapabilityHalt: {
+		{name: "halt", arity: 1},
+	},
+}
+
+// Option configures an Interpreter created by NewWithOptions.
+type Option func(*options)
+
+type options struct {
+	in    io.Reader
+	out   io.Writer
+	err   io.Writer
+	allow map[Capability]bool
+	deny  map[Capability]bool
+}
+
+// Allow allows the capabilities. If any capabilities are allowed, the other capabilities are denied.
+func Allow(cs ...Capability) Option {
+	return func(o *options) {
+		if o.allow == nil {
+			o.allow = map[Capability]bool{}
+		}
+		for _, c := range cs {
+			o.allow[c] = true
+		}
+	}
+}
+
+// Deny denies the capabilities.
+func Deny(cs ...Capability) Option {
+	return func(o *options) {
+		if o.deny == nil {
+			o.deny = map[Capability]bool{}
+		}
+		for _, c := range cs {
+			o.deny[c] = true
+		}
+	}
+}
+
+// UserInput sets user_input of the interpreter.
+func UserInput(in io.Reader) Option {
+	return func(o *options) {
+		o.in = in
+	}
+}
+
+// UserOutput sets user_output of the interpreter.
+func UserOutput(out io.Writer) Option {
+	return func(o *options) {
+		o.out = out
+	}
+}
+
+// UserError sets user_error of the interpreter.
+// Without it, user_error is os.Stderr unless CapabilityIOWrite is denied, in which case the output to user_error is discarded.
+func UserError(err io.Writer) Option {
+	return func(o *options) {
+		o.err = err
+	}
+}
+
+func (o *options) allowed(c Capability) bool {
+	if o.deny[c] {
+		return false
+	}
+	return o.allow == nil || o.allow[c]
+}
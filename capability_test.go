@@ -0,0 +1,103 @@
+package prolog
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/ichiban/prolog/engine"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewWithOptions(t *testing.T) {
+	existenceError := func(t *testing.T, err error, name string, arity int) {
+		t.Helper()
+		var e engine.Exception
+		if assert.True(t, errors.As(err, &e)) {
+			pi := engine.NewAtom("/").Apply(engine.NewAtom(name), engine.Integer(arity))
+			assert.Equal(t, engine.NewAtom("existence_error").Apply(engine.NewAtom("procedure"), pi), e.Term().(engine.Compound).Arg(0))
+		}
+	}
+
+	t.Run("all", func(t *testing.T) {
+		var out bytes.Buffer
+		p := NewWithOptions(UserOutput(&out))
+		assert.NoError(t, p.QuerySolution(`X is 1 + 2, assertz(foo(X)), foo(3), write(X).`).Err())
+		assert.Equal(t, "3", out.String())
+	})
+
+	t.Run("deny", func(t *testing.T) {
+		var out bytes.Buffer
+		p := NewWithOptions(UserOutput(&out), Deny(CapabilityHalt, CapabilityFiles))
+		assert.NoError(t, p.QuerySolution(`X is 1 + 2, write(X), nl.`).Err())
+		assert.Equal(t, "3\n", out.String())
+
+		existenceError(t, p.QuerySolution(`halt.`).Err(), "halt", 0)
+		existenceError(t, p.QuerySolution(`halt(1).`).Err(), "halt", 1)
+		existenceError(t, p.QuerySolution(`open(foo, read, _).`).Err(), "open", 3)
+		existenceError(t, p.QuerySolution(`open(foo, read, _, []).`).Err(), "open", 4)
+		existenceError(t, p.QuerySolution(`consult(foo).`).Err(), "consult", 1)
+		assert.Error(t, p.Exec(`:- ensure_loaded('interpreter.go').`))
+	})
+
+	t.Run("allow", func(t *testing.T) {
+		p := NewWithOptions(Allow(CapabilityPure))
+		assert.NoError(t, p.Exec(`foo(a). foo(b).`))
+		assert.NoError(t, p.QuerySolution(`findall(X, foo(X), Xs), Xs == [a, b], member(b, Xs), \+ foo(c), (true; fail).`).Err())
+
+		existenceError(t, p.QuerySolution(`X is 1 + 2.`).Err(), "is", 2)
+		existenceError(t, p.QuerySolution(`assertz(foo(c)).`).Err(), "assertz", 1)
+		existenceError(t, p.QuerySolution(`retractall(foo(_)).`).Err(), "retractall", 1)
+		existenceError(t, p.QuerySolution(`write(foo).`).Err(), "write", 1)
+		existenceError(t, p.QuerySolution(`read(_).`).Err(), "read", 1)
+		existenceError(t, p.QuerySolution(`halt.`).Err(), "halt", 0)
+	})
+
+	t.Run("allow and deny", func(t *testing.T) {
+		p := NewWithOptions(Allow(CapabilityPure, CapabilityArith), Deny(CapabilityArith))
+		existenceError(t, p.QuerySolution(`X is 1 + 2.`).Err(), "is", 2)
+	})
+
+	t.Run("devel", func(t *testing.T) {
+		p := NewWithOptions(Deny(CapabilityDevel))
+		assert.NoError(t, p.QuerySolution(`catch(set_stream_position(user_input, _), error(instantiation_error, _), true).`).Err())
+		existenceError(t, p.QuerySolution(`run_tests.`).Err(), "run_tests", 0)
+		existenceError(t, p.QuerySolution(`profile(true).`).Err(), "profile", 1)
+	})
+
+	t.Run("user_error", func(t *testing.T) {
+		stderr := os.Stderr
+		defer func() {
+			os.Stderr = stderr
+		}()
+
+		warnings := func(opts ...Option) string {
+			r, w, err := os.Pipe()
+			assert.NoError(t, err)
+			os.Stderr = w
+			p := NewWithOptions(opts...)
+			assert.NoError(t, p.Exec(`foo(X) :- true.`))
+			assert.NoError(t, w.Close())
+			b, err := io.ReadAll(r)
+			assert.NoError(t, err)
+			return string(b)
+		}
+
+		assert.Contains(t, warnings(), "Singleton variables [X] in foo/1")
+		assert.Empty(t, warnings(Deny(CapabilityIOWrite)))
+	})
+}
+
+func TestCapabilityPredicates(t *testing.T) {
+	seen := map[predicateIndicator]Capability{}
+	for _, c := range allCapabilities {
+		for _, pi := range capabilityPredicates[c] {
+			if d, ok := seen[pi]; ok {
+				t.Errorf("%s/%d is in both %s and %s", pi.name, pi.arity, d, c)
+			}
+			seen[pi] = c
+		}
+	}
+}
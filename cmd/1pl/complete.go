@@ -0,0 +1,256 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/ichiban/prolog/engine"
+)
+
+// scanner keeps track of quotes, comments, and brackets in a Prolog text.
+type scanner struct {
+	quote   rune // ', ", or ` if in a quoted token
+	escape  bool // if the previous rune is a backslash in a quoted token
+	comment int  // 1 for a single line comment, 2 for a block comment
+	opens   []int
+
+	// end is the index after the last end token ., or -1.
+	end int
+
+	// rest reports whether there's something other than layout text and comments after end.
+	rest bool
+
+	// symbol reports whether the previous rune is a part of a symbol token.
+	symbol bool
+}
+
+func scan(rs []rune, n int) scanner {
+	s := scanner{end: -1}
+	for i := 0; i < n; i++ {
+		r := rs[i]
+		switch {
+		case s.comment == 1:
+			if r == '\n' {
+				s.comment = 0
+			}
+		case s.comment == 2:
+			if r == '/' && i > 0 && rs[i-1] == '*' {
+				s.comment = 0
+			}
+		case s.quote != 0:
+			switch {
+			case s.escape:
+				s.escape = false
+			case r == '\\':
+				s.escape = true
+			case r == s.quote:
+				if i+1 < n && rs[i+1] == s.quote { // Doubled quote.
+					i++
+					break
+				}
+				s.quote = 0
+			}
+		default:
+			symbol := false
+			switch r {
+			case '\'', '"', '`':
+				s.rest = true
+				if r == '\'' && i > 0 && rs[i-1] == '0' && (i < 2 || !alnum(rs[i-2])) { // 0'c
+					i++
+					if i < n && rs[i] == '\\' {
+						i++
+					}
+					break
+				}
+				s.quote = r
+			case '%':
+				s.comment = 1
+			case '/':
+				if i+1 < n && rs[i+1] == '*' {
+					s.comment = 2
+					i++
+					break
+				}
+				s.rest, symbol = true, true
+			case '(', '[', '{':
+				s.rest = true
+				s.opens = append(s.opens, i)
+			case ')', ']', '}':
+				s.rest = true
+				if len(s.opens) > 0 {
+					s.opens = s.opens[:len(s.opens)-1]
+				}
+			case '.':
+				if !s.symbol && (i+1 == n || unicode.IsSpace(rs[i+1]) || rs[i+1] == '%') {
+					s.end, s.rest, s.opens = i+1, false, s.opens[:0]
+					break
+				}
+				s.rest, symbol = true, true
+			default:
+				if !unicode.IsSpace(r) {
+					s.rest, symbol = true, graphic(r)
+				}
+			}
+			s.symbol = symbol
+		}
+	}
+	return s
+}
+
+// complete reports whether the text is one or more complete clauses or queries.
+func complete(text string) bool {
+	rs := []rune(text)
+	s := scan(rs, len(rs))
+	return s.quote == 0 && s.comment != 2 && s.end >= 0 && !s.rest
+}
+
+// matchingBracket returns the index of the opening bracket which matches the closing bracket at i, or -1.
+func matchingBracket(rs []rune, i int) int {
+	if i < 0 || i >= len(rs) || !strings.ContainsRune(")]}", rs[i]) {
+		return -1
+	}
+	s := scan(rs, i)
+	if s.quote != 0 || s.comment != 0 || len(s.opens) == 0 {
+		return -1
+	}
+	o := s.opens[len(s.opens)-1]
+	if pair := map[rune]rune{')': '(', ']': '[', '}': '{'}; rs[o] != pair[rs[i]] {
+		return -1
+	}
+	return o
+}
+
+func alnum(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func graphic(r rune) bool {
+	return strings.ContainsRune(`#$&*+-./:<=>?@^~\`, r)
+}
+
+// completer completes the word before the cursor.
+type completer struct {
+	vm *engine.VM
+
+	// readDir is os.ReadDir by default.
+	readDir func(name string) ([]os.DirEntry, error)
+}
+
+// complete returns the candidates to replace rs[start:pos].
+func (c *completer) complete(rs []rune, pos int) ([]string, int) {
+	if s := scan(rs, pos); s.quote != 0 {
+		if s.quote != '\'' && s.quote != '"' {
+			return nil, pos
+		}
+		start := pos
+		for start > 0 && rs[start-1] != s.quote {
+			start--
+		}
+		return c.files(string(rs[start:pos])), start
+	} else if s.comment != 0 {
+		return nil, pos
+	}
+
+	start := pos
+	for start > 0 && alnum(rs[start-1]) {
+		start--
+	}
+	prefix := string(rs[start:pos])
+	if prefix == "" || !unicode.IsLower([]rune(prefix)[0]) {
+		return nil, pos
+	}
+
+	set := map[string]struct{}{}
+	for _, pi := range c.vm.Predicates() {
+		pi := pi.(engine.Compound)
+		name, arity := pi.Arg(0).(engine.Atom).String(), pi.Arg(1).(engine.Integer)
+		if !strings.HasPrefix(name, prefix) || strings.HasPrefix(name, "$") {
+			continue
+		}
+		if arity > 0 {
+			name += "("
+		}
+		set[name] = struct{}{}
+	}
+	for _, a := range engine.Atoms() {
+		name := a.String()
+		if !strings.HasPrefix(name, prefix) || !plainAtom(name) {
+			continue
+		}
+		if _, ok := set[name+"("]; ok {
+			continue
+		}
+		set[name] = struct{}{}
+	}
+
+	cs := make([]string, 0, len(set))
+	for name := range set {
+		cs = append(cs, name)
+	}
+	sort.Strings(cs)
+	return cs, start
+}
+
+// files returns the paths which start with prefix. Directories end with a slash.
+func (c *completer) files(prefix string) []string {
+	readDir := c.readDir
+	if readDir == nil {
+		readDir = os.ReadDir
+	}
+
+	dir, base := filepath.Split(prefix)
+	d := dir
+	if d == "" {
+		d = "."
+	}
+	es, err := readDir(d)
+	if err != nil {
+		return nil
+	}
+	var cs []string
+	for _, e := range es {
+		name := e.Name()
+		if !strings.HasPrefix(name, base) || (strings.HasPrefix(name, ".") && !strings.HasPrefix(base, ".")) {
+			continue
+		}
+		if e.IsDir() {
+			name += "/"
+		}
+		cs = append(cs, dir+name)
+	}
+	sort.Strings(cs)
+	return cs
+}
+
+// plainAtom reports whether the name is an atom which can be written without quotes starting with a small letter.
+func plainAtom(name string) bool {
+	for i, r := range name {
+		if i == 0 && !unicode.IsLower(r) {
+			return false
+		}
+		if !alnum(r) {
+			return false
+		}
+	}
+	return name != ""
+}
+
+// commonPrefix returns the longest prefix shared by ss.
+func commonPrefix(ss []string) string {
+	if len(ss) == 0 {
+		return ""
+	}
+	p := []rune(ss[0])
+	for _, s := range ss[1:] {
+		rs := []rune(s)
+		n := 0
+		for n < len(p) && n < len(rs) && p[n] == rs[n] {
+			n++
+		}
+		p = p[:n]
+	}
+	return string(p)
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ichiban/prolog/engine"
+)
+
+func TestComplete(t *testing.T) {
+	tests := []struct {
+		text     string
+		complete bool
+	}{
+		{text: "foo.", complete: true},
+		{text: "foo. ", complete: true},
+		{text: "foo.\n", complete: true},
+		{text: "foo", complete: false},
+		{text: "foo(\na).", complete: true},
+		{text: "foo(a.", complete: true},
+		{text: "foo(a.b", complete: false},
+		{text: "X = 'a.", complete: false},
+		{text: "X = 'a.'.", complete: true},
+		{text: "X = \"it''s.\"", complete: false},
+		{text: "X = 'it''s'.", complete: true},
+		{text: "X = 0'..", complete: true},
+		{text: "X = 0'(.", complete: true},
+		{text: "X =.. Y", complete: false},
+		{text: "X =.. Y.", complete: true},
+		{text: "foo. % comment", complete: true},
+		{text: "foo % comment.", complete: false},
+		{text: "foo /* comment.", complete: false},
+		{text: "foo /* comment. */.", complete: true},
+		{text: "foo. bar", complete: false},
+		{text: "foo. bar.", complete: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			assert.Equal(t, tt.complete, complete(tt.text))
+		})
+	}
+}
+
+func TestMatchingBracket(t *testing.T) {
+	tests := []struct {
+		text  string
+		i     int
+		match int
+	}{
+		{text: "f(a)", i: 3, match: 1},
+		{text: "f([a], b)", i: 4, match: 2},
+		{text: "f([a], b)", i: 8, match: 1},
+		{text: "f(a]", i: 3, match: -1},
+		{text: "f(')')", i: 4, match: -1},
+		{text: "f(')')", i: 5, match: 1},
+		{text: "f(a)", i: 2, match: -1},
+		{text: "a)", i: 1, match: -1},
+		{text: "f(a)", i: -1, match: -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			assert.Equal(t, tt.match, matchingBracket([]rune(tt.text), tt.i))
+		})
+	}
+}
+
+func TestCompleter_Complete(t *testing.T) {
+	vm := engine.VM{}
+	vm.Register2(engine.NewAtom("foo_bar"), func(_ *engine.VM, _, _ engine.Term, k engine.Cont, env *engine.Env) *engine.Promise {
+		return k(env)
+	})
+	vm.Register0(engine.NewAtom("foo_baz"), func(_ *engine.VM, k engine.Cont, env *engine.Env) *engine.Promise {
+		return k(env)
+	})
+	vm.Register0(engine.NewAtom("$foo_hidden"), func(_ *engine.VM, k engine.Cont, env *engine.Env) *engine.Promise {
+		return k(env)
+	})
+	_ = engine.NewAtom("foo_quux")
+	_ = engine.NewAtom("foo bar")
+
+	c := completer{
+		vm: &vm,
+		readDir: func(name string) ([]os.DirEntry, error) {
+			switch name {
+			case ".":
+				return []os.DirEntry{
+					dirEntry{name: "foo.pl"},
+					dirEntry{name: "foo", dir: true},
+					dirEntry{name: ".foo"},
+					dirEntry{name: "bar.pl"},
+				}, nil
+			case "foo/":
+				return []os.DirEntry{
+					dirEntry{name: "baz.pl"},
+				}, nil
+			default:
+				return nil, fs.ErrNotExist
+			}
+		},
+	}
+
+	tests := []struct {
+		title      string
+		text       string
+		candidates []string
+		start      int
+	}{
+		{title: "predicates and atoms", text: "X = foo_", candidates: []string{"foo_bar(", "foo_baz", "foo_quux"}, start: 4},
+		{title: "predicate", text: "foo_bar", candidates: []string{"foo_bar("}, start: 0},
+		{title: "no prefix", text: "X = ", candidates: nil, start: 4},
+		{title: "variable", text: "Foo", candidates: nil, start: 3},
+		{title: "comment", text: "% foo_", candidates: nil, start: 6},
+		{title: "files", text: "consult('foo", candidates: []string{"foo.pl", "foo/"}, start: 9},
+		{title: "hidden files", text: "consult('.f", candidates: []string{".foo"}, start: 9},
+		{title: "directory", text: `consult("foo/`, candidates: []string{"foo/baz.pl"}, start: 9},
+		{title: "no directory", text: "consult('bar/", candidates: nil, start: 9},
+		{title: "back quote", text: "X = `foo", candidates: nil, start: 8},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			rs := []rune(tt.text)
+			cs, start := c.complete(rs, len(rs))
+			assert.ElementsMatch(t, tt.candidates, cs)
+			assert.Equal(t, tt.start, start)
+		})
+	}
+}
+
+func TestCommonPrefix(t *testing.T) {
+	assert.Equal(t, "", commonPrefix(nil))
+	assert.Equal(t, "foo", commonPrefix([]string{"foo"}))
+	assert.Equal(t, "foo_ba", commonPrefix([]string{"foo_bar", "foo_baz"}))
+	assert.Equal(t, "", commonPrefix([]string{"foo", "bar"}))
+}
+
+type dirEntry struct {
+	name string
+	dir  bool
+}
+
+func (d dirEntry) Name() string {
+	return d.name
+}
+
+func (d dirEntry) IsDir() bool {
+	return d.dir
+}
+
+func (d dirEntry) Type() fs.FileMode {
+	if d.dir {
+		return fs.ModeDir
+	}
+	return 0
+}
+
+func (d dirEntry) Info() (fs.FileInfo, error) {
+	return nil, nil
+}
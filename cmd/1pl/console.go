@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"sync"
+)
+
+// Keys other than runes are mapped to the private use area.
+const (
+	keyCtrlA     = 0x01
+	keyCtrlB     = 0x02
+	keyCtrlC     = 0x03
+	keyCtrlD     = 0x04
+	keyCtrlE     = 0x05
+	keyCtrlF     = 0x06
+	keyTab       = 0x09
+	keyCtrlK     = 0x0b
+	keyCtrlL     = 0x0c
+	keyEnter     = 0x0d
+	keyCtrlN     = 0x0e
+	keyCtrlP     = 0x10
+	keyCtrlU     = 0x15
+	keyCtrlW     = 0x17
+	keyBackspace = 0x7f
+)
+
+const (
+	keyUp = 0xe000 + iota
+	keyDown
+	keyLeft
+	keyRight
+	keyHome
+	keyEnd
+	keyDelete
+	keyAltEnter
+	keyUnknown
+)
+
+var errInterrupted = errors.New("interrupted")
+
+// console reads keys from the terminal in raw mode.
+// Ctrl-C interrupts the running query if any. Otherwise, it's delivered as a key.
+type console struct {
+	keys chan rune
+	err  error
+
+	mu        sync.Mutex
+	cancel    context.CancelFunc
+	interrupt chan struct{}
+}
+
+func newConsole(r io.Reader) *console {
+	c := console{keys: make(chan rune, 64)}
+	go c.run(bufio.NewReader(r))
+	return &c
+}
+
+func (c *console) run(r *bufio.Reader) {
+	defer close(c.keys)
+	for {
+		k, err := readKey(r)
+		if err != nil {
+			c.err = err
+			return
+		}
+		if k == keyCtrlC && c.interruptQuery() {
+			continue
+		}
+		c.keys <- k
+	}
+}
+
+func readKey(r *bufio.Reader) (rune, error) {
+	k, _, err := r.ReadRune()
+	if err != nil {
+		return 0, err
+	}
+	switch k {
+	case '\n':
+		return keyEnter, nil
+	case 0x08:
+		return keyBackspace, nil
+	case 0x1b:
+		break
+	default:
+		return k, nil
+	}
+
+	// Escape sequences arrive at once. A lone escape is ignored.
+	if r.Buffered() == 0 {
+		return keyUnknown, nil
+	}
+	k, _, err = r.ReadRune()
+	if err != nil {
+		return 0, err
+	}
+	switch k {
+	case '\r', '\n':
+		return keyAltEnter, nil
+	case '[', 'O':
+		break
+	default:
+		return keyUnknown, nil
+	}
+
+	var seq []rune
+	for r.Buffered() > 0 {
+		k, _, err := r.ReadRune()
+		if err != nil {
+			return 0, err
+		}
+		seq = append(seq, k)
+		if k >= 0x40 && k <= 0x7e { // Final byte.
+			break
+		}
+	}
+	switch string(seq) {
+	case "A":
+		return keyUp, nil
+	case "B":
+		return keyDown, nil
+	case "C":
+		return keyRight, nil
+	case "D":
+		return keyLeft, nil
+	case "H", "1~", "7~":
+		return keyHome, nil
+	case "F", "4~", "8~":
+		return keyEnd, nil
+	case "3~":
+		return keyDelete, nil
+	default:
+		return keyUnknown, nil
+	}
+}
+
+// readKey returns the next key. It returns errInterrupted if the running query is interrupted.
+func (c *console) readKey() (rune, error) {
+	c.mu.Lock()
+	interrupt := c.interrupt
+	c.mu.Unlock()
+
+	select {
+	case k, ok := <-c.keys:
+		if !ok {
+			if c.err == nil || c.err == io.EOF {
+				return 0, io.EOF
+			}
+			return 0, c.err
+		}
+		return k, nil
+	case <-interrupt: // A nil channel blocks forever.
+		return 0, errInterrupted
+	}
+}
+
+// start returns a context for a query which is canceled by Ctrl-C, and a function to call when the query is done.
+func (c *console) start(ctx context.Context) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cancel, c.interrupt = cancel, make(chan struct{})
+	return ctx, func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		cancel()
+		c.cancel, c.interrupt = nil, nil
+	}
+}
+
+func (c *console) interruptQuery() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cancel == nil {
+		return false
+	}
+	c.cancel()
+	close(c.interrupt)
+	c.cancel = nil
+	return true
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadKey(t *testing.T) {
+	tests := []struct {
+		input string
+		keys  []rune
+	}{
+		{input: "a", keys: []rune{'a'}},
+		{input: "\r\n", keys: []rune{keyEnter, keyEnter}},
+		{input: "\x08\x7f", keys: []rune{keyBackspace, keyBackspace}},
+		{input: "\x1b[A\x1b[B\x1b[C\x1b[D", keys: []rune{keyUp, keyDown, keyRight, keyLeft}},
+		{input: "\x1bOH\x1b[F\x1b[1~\x1b[4~", keys: []rune{keyHome, keyEnd, keyHome, keyEnd}},
+		{input: "\x1b[3~", keys: []rune{keyDelete}},
+		{input: "\x1b\r", keys: []rune{keyAltEnter}},
+		{input: "\x1b[1;5C", keys: []rune{keyUnknown}},
+		{input: "\x1bx", keys: []rune{keyUnknown}},
+		{input: "\x1b", keys: []rune{keyUnknown}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			r := bufio.NewReader(strings.NewReader(tt.input))
+			var keys []rune
+			for {
+				k, err := readKey(r)
+				if err == io.EOF {
+					break
+				}
+				assert.NoError(t, err)
+				keys = append(keys, k)
+			}
+			assert.Equal(t, tt.keys, keys)
+		})
+	}
+}
+
+func TestConsole(t *testing.T) {
+	t.Run("key", func(t *testing.T) {
+		pr, pw := io.Pipe()
+		c := newConsole(pr)
+
+		_, _ = pw.Write([]byte{keyCtrlC})
+		k, err := c.readKey()
+		assert.NoError(t, err)
+		assert.Equal(t, rune(keyCtrlC), k)
+
+		assert.NoError(t, pw.Close())
+		_, err = c.readKey()
+		assert.Equal(t, io.EOF, err)
+	})
+
+	t.Run("interrupt", func(t *testing.T) {
+		pr, pw := io.Pipe()
+		c := newConsole(pr)
+
+		ctx, stop := c.start(context.Background())
+		_, _ = pw.Write([]byte{keyCtrlC})
+		<-ctx.Done()
+		_, err := c.readKey()
+		assert.Equal(t, errInterrupted, err)
+		stop()
+
+		// Ctrl-C is a key after the query.
+		_, _ = pw.Write([]byte{keyCtrlC})
+		k, err := c.readKey()
+		assert.NoError(t, err)
+		assert.Equal(t, rune(keyCtrlC), k)
+	})
+}
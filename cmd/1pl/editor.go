@@ -0,0 +1,293 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+)
+
+// editor is a line editor for terminals in raw mode.
+// It edits a text of multiple lines so that a clause or query can span lines.
+type editor struct {
+	console   *console
+	w         io.Writer
+	width     func() int
+	history   *history
+	completer *completer
+
+	prompt, contPrompt string
+	buf                []rune
+	pos                int
+
+	// cursorRow is the row of the cursor from the first row of the text on the screen.
+	cursorRow int
+}
+
+// read reads a text. Enter finishes the text if done reports true for it. Otherwise, it starts a new line.
+// Ctrl-C discards the text and returns errInterrupted. Ctrl-D on an empty text returns io.EOF.
+func (e *editor) read(prompt, contPrompt string, done func(string) bool) (string, error) {
+	e.prompt, e.contPrompt = prompt, contPrompt
+	e.buf, e.pos, e.cursorRow = e.buf[:0], 0, 0
+
+	var (
+		hist  = len(e.history.entries)
+		draft []rune
+	)
+	e.render()
+	for {
+		k, err := e.console.readKey()
+		if err != nil {
+			if err == errInterrupted {
+				e.finish("^C")
+			}
+			return "", err
+		}
+
+		switch k {
+		case keyEnter:
+			if done(string(e.buf)) {
+				e.finish("")
+				return string(e.buf), nil
+			}
+			e.insert('\n')
+		case keyAltEnter:
+			e.insert('\n')
+		case keyCtrlC:
+			e.finish("^C")
+			return "", errInterrupted
+		case keyCtrlD:
+			if len(e.buf) == 0 {
+				e.finish("")
+				return "", io.EOF
+			}
+			e.delete(e.pos, e.pos+1)
+		case keyBackspace:
+			e.delete(e.pos-1, e.pos)
+		case keyDelete:
+			e.delete(e.pos, e.pos+1)
+		case keyLeft, keyCtrlB:
+			if e.pos > 0 {
+				e.pos--
+			}
+		case keyRight, keyCtrlF:
+			if e.pos < len(e.buf) {
+				e.pos++
+			}
+		case keyHome, keyCtrlA:
+			e.pos = e.lineStart(e.pos)
+		case keyEnd, keyCtrlE:
+			e.pos = e.lineEnd(e.pos)
+		case keyCtrlK:
+			e.delete(e.pos, e.lineEnd(e.pos))
+		case keyCtrlU:
+			e.delete(e.lineStart(e.pos), e.pos)
+		case keyCtrlW:
+			i := e.pos
+			for i > 0 && unicode.IsSpace(e.buf[i-1]) {
+				i--
+			}
+			for i > 0 && !unicode.IsSpace(e.buf[i-1]) {
+				i--
+			}
+			e.delete(i, e.pos)
+		case keyCtrlL:
+			_, _ = fmt.Fprint(e.w, "\x1b[H\x1b[2J")
+			e.cursorRow = 0
+		case keyUp, keyCtrlP:
+			if s := e.lineStart(e.pos); s > 0 {
+				e.pos = e.column(e.lineStart(s-1), e.pos-s)
+				break
+			}
+			if hist == 0 {
+				break
+			}
+			if hist == len(e.history.entries) {
+				draft = append(draft[:0], e.buf...)
+			}
+			hist--
+			e.buf = []rune(e.history.entries[hist])
+			e.pos = len(e.buf)
+		case keyDown, keyCtrlN:
+			if end := e.lineEnd(e.pos); end < len(e.buf) {
+				e.pos = e.column(end+1, e.pos-e.lineStart(e.pos))
+				break
+			}
+			if hist == len(e.history.entries) {
+				break
+			}
+			hist++
+			if hist == len(e.history.entries) {
+				e.buf = append([]rune{}, draft...)
+			} else {
+				e.buf = []rune(e.history.entries[hist])
+			}
+			e.pos = len(e.buf)
+		case keyTab:
+			e.complete()
+		case keyUnknown:
+			break
+		default:
+			if unicode.IsPrint(k) {
+				e.insert(k)
+			}
+		}
+		e.render()
+	}
+}
+
+func (e *editor) insert(r rune) {
+	e.buf = append(e.buf, 0)
+	copy(e.buf[e.pos+1:], e.buf[e.pos:])
+	e.buf[e.pos] = r
+	e.pos++
+}
+
+func (e *editor) insertString(s string) {
+	for _, r := range s {
+		e.insert(r)
+	}
+}
+
+func (e *editor) delete(start, end int) {
+	if start < 0 || end > len(e.buf) || start >= end {
+		return
+	}
+	e.buf = append(e.buf[:start], e.buf[end:]...)
+	e.pos = start
+}
+
+func (e *editor) lineStart(i int) int {
+	for i > 0 && e.buf[i-1] != '\n' {
+		i--
+	}
+	return i
+}
+
+func (e *editor) lineEnd(i int) int {
+	for i < len(e.buf) && e.buf[i] != '\n' {
+		i++
+	}
+	return i
+}
+
+// column returns the position at the column col in the line starting at start.
+func (e *editor) column(start, col int) int {
+	if end := e.lineEnd(start); start+col > end {
+		return end
+	}
+	return start + col
+}
+
+func (e *editor) complete() {
+	cs, start := e.completer.complete(e.buf, e.pos)
+	switch len(cs) {
+	case 0:
+		_, _ = fmt.Fprint(e.w, "\a")
+	case 1:
+		e.delete(start, e.pos)
+		e.insertString(cs[0])
+	default:
+		if p := commonPrefix(cs); len([]rune(p)) > e.pos-start {
+			e.delete(start, e.pos)
+			e.insertString(p)
+			return
+		}
+
+		// List the candidates below the text and render the text again.
+		pos := e.pos
+		e.pos = len(e.buf)
+		e.render()
+		_, _ = fmt.Fprint(e.w, "\r\n")
+		width, col := e.width(), 0
+		for _, c := range cs {
+			n := len([]rune(c)) + 2
+			if col > 0 && col+n > width {
+				_, _ = fmt.Fprint(e.w, "\r\n")
+				col = 0
+			}
+			_, _ = fmt.Fprintf(e.w, "%s  ", c)
+			col += n
+		}
+		_, _ = fmt.Fprint(e.w, "\r\n")
+		e.pos, e.cursorRow = pos, 0
+	}
+}
+
+// finish moves the cursor to the end of the text with the mark and then to the next line.
+func (e *editor) finish(mark string) {
+	e.pos = len(e.buf)
+	e.render()
+	_, _ = fmt.Fprintf(e.w, "%s\r\n", mark)
+	e.cursorRow = 0
+}
+
+// render draws the text over the previous one and moves the cursor to the position.
+// The bracket matching the closing bracket before the cursor is highlighted.
+func (e *editor) render() {
+	var sb strings.Builder
+	if e.cursorRow > 0 {
+		_, _ = fmt.Fprintf(&sb, "\x1b[%dA", e.cursorRow)
+	}
+	_, _ = sb.WriteString("\r\x1b[J")
+
+	width := e.width()
+	if width <= 0 {
+		width = 80
+	}
+	match := matchingBracket(e.buf, e.pos-1)
+	var row, col, curRow, curCol int
+	put := func(s string, highlight bool) {
+		for _, r := range s {
+			if col == width { // The terminal wraps the line.
+				row++
+				col = 0
+			}
+			if highlight {
+				_, _ = fmt.Fprintf(&sb, "\x1b[7m%c\x1b[0m", r)
+			} else {
+				_, _ = sb.WriteRune(r)
+			}
+			col++
+		}
+	}
+	put(e.prompt, false)
+	for i, r := range e.buf {
+		if i == e.pos {
+			curRow, curCol = row, col
+		}
+		if r == '\n' {
+			_, _ = sb.WriteString("\r\n")
+			row++
+			col = 0
+			put(e.contPrompt, false)
+			continue
+		}
+		put(string(r), i == match)
+	}
+	if e.pos == len(e.buf) {
+		curRow, curCol = row, col
+	}
+
+	// Resolve the pending wraps at the right edge.
+	if col == width {
+		_, _ = sb.WriteString("\r\n")
+		row++
+		col = 0
+	}
+	if curCol == width {
+		curRow++
+		curCol = 0
+	}
+
+	if n := row - curRow; n > 0 {
+		_, _ = fmt.Fprintf(&sb, "\x1b[%dA", n)
+	}
+	_, _ = sb.WriteString("\r")
+	if curCol > 0 {
+		_, _ = fmt.Fprintf(&sb, "\x1b[%dC", curCol)
+	}
+	e.cursorRow = curRow
+
+	_, _ = io.WriteString(e.w, sb.String())
+}
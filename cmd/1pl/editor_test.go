@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ichiban/prolog/engine"
+)
+
+func TestEditor_Read(t *testing.T) {
+	vm := engine.VM{}
+	vm.Register2(engine.NewAtom("member"), func(_ *engine.VM, _, _ engine.Term, k engine.Cont, env *engine.Env) *engine.Promise {
+		return k(env)
+	})
+
+	keys := func(ks ...interface{}) []rune {
+		var rs []rune
+		for _, k := range ks {
+			switch k := k.(type) {
+			case string:
+				rs = append(rs, []rune(k)...)
+			case rune:
+				rs = append(rs, k)
+			case int:
+				rs = append(rs, rune(k))
+			}
+		}
+		return rs
+	}
+
+	tests := []struct {
+		title   string
+		history []string
+		keys    []rune
+		text    string
+		err     error
+	}{
+		{title: "enter", keys: keys("foo.", keyEnter), text: "foo."},
+		{title: "multiple lines", keys: keys("foo(", keyEnter, "a).", keyEnter), text: "foo(\na)."},
+		{title: "alt enter", keys: keys("foo.", keyAltEnter, "bar.", keyEnter), text: "foo.\nbar."},
+		{title: "backspace", keys: keys("fooo", keyBackspace, ".", keyEnter), text: "foo."},
+		{title: "delete", keys: keys("foo.x", keyLeft, keyDelete, keyEnter), text: "foo."},
+		{title: "left and right", keys: keys("fo.", keyLeft, "o", keyRight, keyEnter), text: "foo."},
+		{title: "home and end", keys: keys("oo", keyHome, "f", keyEnd, ".", keyEnter), text: "foo."},
+		{title: "ctrl-a and ctrl-e", keys: keys("oo", keyCtrlA, "f", keyCtrlE, ".", keyEnter), text: "foo."},
+		{title: "ctrl-k", keys: keys("foo.bar", keyLeft, keyLeft, keyLeft, keyCtrlK, keyEnter), text: "foo."},
+		{title: "ctrl-u", keys: keys("bar", keyCtrlU, "foo.", keyEnter), text: "foo."},
+		{title: "ctrl-w", keys: keys("foo bar", keyCtrlW, keyBackspace, ".", keyEnter), text: "foo."},
+		{title: "up and down in text", keys: keys("foo(", keyEnter, "a).", keyUp, "b", keyDown, keyEnter), text: "foob(\na)."},
+		{title: "history", history: []string{"foo.", "bar."}, keys: keys(keyUp, keyUp, keyEnter), text: "foo."},
+		{title: "history draft", history: []string{"foo."}, keys: keys("bar.", keyUp, keyDown, keyEnter), text: "bar."},
+		{title: "complete", keys: keys("memb", keyTab, "X, [a]).", keyEnter), text: "member(X, [a])."},
+		{title: "ctrl-c", keys: keys("foo", keyCtrlC), err: errInterrupted},
+		{title: "ctrl-d", keys: keys(keyCtrlD), err: io.EOF},
+		{title: "ctrl-d in text", keys: keys("foo..", keyLeft, keyCtrlD, keyEnter), text: "foo."},
+		{title: "eof", keys: keys("foo"), err: io.EOF},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			ks := make(chan rune, len(tt.keys))
+			for _, k := range tt.keys {
+				ks <- k
+			}
+			close(ks)
+
+			var buf bytes.Buffer
+			e := editor{
+				console:   &console{keys: ks},
+				w:         &buf,
+				width:     func() int { return 10 },
+				history:   &history{entries: tt.history},
+				completer: &completer{vm: &vm},
+			}
+			text, err := e.read(prompt, contPrompt, complete)
+			assert.Equal(t, tt.err, err)
+			assert.Equal(t, tt.text, text)
+		})
+	}
+}
+
+func TestEditor_Render(t *testing.T) {
+	tests := []struct {
+		title  string
+		text   string
+		pos    int
+		output string
+		row    int
+	}{
+		{title: "empty", output: "\r\x1b[J?- \r\x1b[3C"},
+		{title: "cursor", text: "foo", pos: 1, output: "\r\x1b[J?- foo\r\x1b[4C"},
+		{title: "multiple lines", text: "f(\na)", pos: 2, output: "\r\x1b[J?- f(\r\n|  a)\x1b[1A\r\x1b[5C"},
+		{title: "matching bracket", text: "f(a)", pos: 4, output: "\r\x1b[J?- f\x1b[7m(\x1b[0ma)\r\x1b[7C"},
+		{title: "wrap", text: "foo(bar, baz)", pos: 13, output: "\r\x1b[J?- foo\x1b[7m(\x1b[0mbar, baz)\r\x1b[6C", row: 1},
+		{title: "right edge", text: "foobarb", pos: 7, output: "\r\x1b[J?- foobarb\r\n\r", row: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			var buf bytes.Buffer
+			e := editor{
+				w:          &buf,
+				width:      func() int { return 10 },
+				prompt:     prompt,
+				contPrompt: contPrompt,
+				buf:        []rune(tt.text),
+				pos:        tt.pos,
+			}
+			e.render()
+			assert.Equal(t, tt.output, buf.String())
+			assert.Equal(t, tt.row, e.cursorRow)
+
+			// It redraws over the previous one.
+			buf.Reset()
+			e.render()
+			if tt.row > 0 {
+				assert.True(t, bytes.HasPrefix(buf.Bytes(), []byte("\x1b[1A\r\x1b[J")))
+			}
+		})
+	}
+}
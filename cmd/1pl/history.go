@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strings"
+)
+
+const historySize = 1000
+
+// history is the list of the entered queries which persists in a file.
+type history struct {
+	entries []string
+	file    string
+
+	// lines is the number of the lines in the file.
+	lines int
+}
+
+// loadHistory reads the history from the file. It's not an error if the file doesn't exist.
+func loadHistory(file string) (*history, error) {
+	h := history{file: file}
+	if file == "" {
+		return &h, nil
+	}
+	f, err := os.Open(file)
+	switch {
+	case os.IsNotExist(err):
+		return &h, nil
+	case err != nil:
+		return &h, err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	if err := h.read(f); err != nil {
+		return &h, err
+	}
+	return &h, nil
+}
+
+func (h *history) read(r io.Reader) error {
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		h.push(unescapeHistory(s.Text()))
+		h.lines++
+	}
+	return s.Err()
+}
+
+// add appends the entry to the history and the file.
+// If the file has more entries than historySize, it rewrites the file with the latest ones.
+func (h *history) add(entry string) error {
+	entry = strings.TrimSpace(entry)
+	if entry == "" || (len(h.entries) > 0 && h.entries[len(h.entries)-1] == entry) {
+		return nil
+	}
+	h.push(entry)
+	if h.file == "" {
+		return nil
+	}
+	if h.lines >= historySize {
+		return h.rewrite()
+	}
+	f, err := os.OpenFile(h.file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(escapeHistory(entry) + "\n"); err != nil {
+		_ = f.Close()
+		return err
+	}
+	h.lines++
+	return f.Close()
+}
+
+func (h *history) rewrite() error {
+	var sb strings.Builder
+	for _, e := range h.entries {
+		_, _ = sb.WriteString(escapeHistory(e) + "\n")
+	}
+	if err := os.WriteFile(h.file, []byte(sb.String()), 0600); err != nil {
+		return err
+	}
+	h.lines = len(h.entries)
+	return nil
+}
+
+func (h *history) push(entry string) {
+	h.entries = append(h.entries, entry)
+	if len(h.entries) > historySize {
+		h.entries = h.entries[len(h.entries)-historySize:]
+	}
+}
+
+// escapeHistory makes a multi-line entry fit in a line of the file.
+func escapeHistory(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
+
+func unescapeHistory(s string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			_ = sb.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n':
+			_ = sb.WriteByte('\n')
+		default:
+			_ = sb.WriteByte(s[i])
+		}
+	}
+	return sb.String()
+}
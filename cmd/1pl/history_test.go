@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadHistory(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "history")
+		assert.NoError(t, os.WriteFile(file, []byte("foo.\nX = f(\\na).\n"), 0600))
+
+		h, err := loadHistory(file)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"foo.", "X = f(\na)."}, h.entries)
+	})
+
+	t.Run("not exist", func(t *testing.T) {
+		h, err := loadHistory(filepath.Join(t.TempDir(), "history"))
+		assert.NoError(t, err)
+		assert.Empty(t, h.entries)
+	})
+
+	t.Run("no file", func(t *testing.T) {
+		h, err := loadHistory("")
+		assert.NoError(t, err)
+		assert.Empty(t, h.entries)
+	})
+
+	t.Run("size", func(t *testing.T) {
+		h := history{}
+		assert.NoError(t, h.read(strings.NewReader(strings.Repeat("foo.\n", historySize+1))))
+		assert.Len(t, h.entries, historySize)
+	})
+}
+
+func TestHistory_Add(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "history")
+	h, err := loadHistory(file)
+	assert.NoError(t, err)
+
+	assert.NoError(t, h.add("foo."))
+	assert.NoError(t, h.add(" foo.\n"))
+	assert.NoError(t, h.add(""))
+	assert.NoError(t, h.add("X = f(\na)."))
+	assert.NoError(t, h.add(`X = '\\'.`))
+	assert.Equal(t, []string{"foo.", "X = f(\na).", `X = '\\'.`}, h.entries)
+
+	b, err := os.ReadFile(file)
+	assert.NoError(t, err)
+	assert.Equal(t, "foo.\nX = f(\\na).\nX = '\\\\\\\\'.\n", string(b))
+
+	l, err := loadHistory(file)
+	assert.NoError(t, err)
+	assert.Equal(t, h.entries, l.entries)
+}
+
+func TestHistory_Add_truncate(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "history")
+	var sb strings.Builder
+	for i := 0; i < historySize+10; i++ {
+		_, _ = fmt.Fprintf(&sb, "foo(%d).\n", i)
+	}
+	assert.NoError(t, os.WriteFile(file, []byte(sb.String()), 0600))
+
+	h, err := loadHistory(file)
+	assert.NoError(t, err)
+	assert.NoError(t, h.add("bar."))
+	assert.NoError(t, h.add("baz."))
+
+	b, err := os.ReadFile(file)
+	assert.NoError(t, err)
+	lines := strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+	assert.Len(t, lines, historySize)
+	assert.Equal(t, "foo(12).", lines[0])
+	assert.Equal(t, []string{"bar.", "baz."}, lines[historySize-2:])
+}
@@ -4,15 +4,17 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"log"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"runtime/debug"
-	"sort"
 	"strings"
+	"unicode"
 
 	"golang.org/x/crypto/ssh/terminal"
 
@@ -22,7 +24,7 @@ import (
 
 const (
 	prompt          = "?- "
-	contPrompt      = "|- "
+	contPrompt      = "|  "
 	userInputPrompt = "|: "
 )
 
@@ -36,92 +38,341 @@ var version = func() string {
 }()
 
 func main() {
-	var verbose bool
-	flag.BoolVar(&verbose, "v", false, `verbose`)
-	flag.Parse()
+	os.Exit(run(os.Args, os.Stdin, os.Stdout, os.Stderr))
+}
 
-	fmt.Printf(`Top level for ichiban/prolog %s
-This is for testing purposes only!
-See https://github.com/ichiban/prolog for more details.
-Type Ctrl-C or 'halt.' to exit.
-`, version)
+// config is the configuration given by the command line arguments.
+type config struct {
+	verbose, quiet, watch bool
+	goals                 []string
+	toplevel              string
+	files                 []string
 
-	halt := engine.Halt
-	if terminal.IsTerminal(0) {
-		oldState, err := terminal.MakeRaw(0)
-		if err != nil {
-			log.Panicf("failed to enter raw mode: %v", err)
+	// coverprofile and lcov are the files to write the coverage of the clauses to.
+	coverprofile, lcov string
+
+	// script reports whether the first file is a script starting with #!.
+	script bool
+
+	// argv is the arguments for the program.
+	argv []string
+}
+
+// parseArgs parses the command line arguments without the command name.
+// The flags may be interleaved with the files. The arguments after -- or a script are the arguments for the program.
+func parseArgs(args []string, output io.Writer) (*config, error) {
+	var c config
+	f := flag.NewFlagSet("1pl", flag.ContinueOnError)
+	f.SetOutput(output)
+	f.Usage = func() {
+		_, _ = fmt.Fprint(output, `Usage: 1pl [-q] [-w] [-g goal]... [-t goal] [-coverprofile file] [-lcov file] [file...] [-- arg...]
+       1pl script [arg...]
+`)
+		f.PrintDefaults()
+	}
+	f.BoolVar(&c.verbose, "v", false, `verbose`)
+	f.BoolVar(&c.quiet, "q", false, `don't print the banner`)
+	f.BoolVar(&c.watch, "w", false, `reload the modified files before each query`)
+	f.Func("g", `run the goal after loading the files (repeatable)`, func(goal string) error {
+		c.goals = append(c.goals, goal)
+		return nil
+	})
+	f.StringVar(&c.toplevel, "t", "", `run the goal instead of the interactive top level`)
+	f.StringVar(&c.coverprofile, "coverprofile", "", `write the coverage of the clauses to the file in the format of go test -coverprofile`)
+	f.StringVar(&c.lcov, "lcov", "", `write the coverage of the clauses to the file in the LCOV format`)
+	for {
+		if err := f.Parse(args); err != nil {
+			return nil, err
 		}
-		restore := func() {
-			_ = terminal.Restore(0, oldState)
+
+		rest := f.Args()
+		if n := len(args) - len(rest); n > 0 && args[n-1] == "--" {
+			c.argv = rest
+			return &c, nil
+		}
+		if len(rest) == 0 {
+			return &c, nil
+		}
+		if len(c.files) == 0 && isScript(rest[0]) {
+			c.files, c.argv, c.script = rest[:1], rest[1:], true
+			return &c, nil
 		}
-		defer restore()
 
-		halt = func(vm *engine.VM, n engine.Term, k engine.Cont, env *engine.Env) *engine.Promise {
-			restore()
-			return engine.Halt(vm, n, k, env)
+		// flag stops at the first non-flag argument. Take it as a file and parse the rest again.
+		c.files = append(c.files, rest[0])
+		args = rest[1:]
+	}
+}
+
+// isScript reports whether the file starts with #!.
+func isScript(name string) bool {
+	f, err := os.Open(name)
+	if err != nil {
+		return false
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	b := make([]byte, 2)
+	_, err = io.ReadFull(f, b)
+	return err == nil && string(b) == "#!"
+}
+
+// run runs the command and returns the exit code.
+// A script runs main/0 and a -t goal runs instead of the top level. Then, it exits with 0 if it succeeds, 1 if it fails, and 2 if it raises an exception.
+// The top level is interactive only if the input is a terminal.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	c, err := parseArgs(args[1:], stderr)
+	switch {
+	case errors.Is(err, flag.ErrHelp):
+		return 0
+	case err != nil:
+		return 2
+	}
+
+	var (
+		in        input
+		out, eout = stdout, stderr
+	)
+	if f, ok := stdin.(*os.File); ok && terminal.IsTerminal(int(f.Fd())) && !c.script && c.toplevel == "" {
+		fd := int(f.Fd())
+		oldState, err := terminal.MakeRaw(fd)
+		if err != nil {
+			_, _ = fmt.Fprintf(stderr, "failed to enter raw mode: %v\n", err)
+			return 1
 		}
+		defer func() {
+			_ = terminal.Restore(fd, oldState)
+		}()
+
+		out = crlfWriter{w: stdout}
+		eout = out
+		h, err := loadHistory(historyFile())
+		if err != nil {
+			_, _ = fmt.Fprintf(out, "failed to load history: %v\n", err)
+		}
+		t := &terminalInput{editor: &editor{
+			console: newConsole(f),
+			w:       stdout,
+			width: func() int {
+				w, _, err := terminal.GetSize(1)
+				if err != nil {
+					return 80
+				}
+				return w
+			},
+			history: h,
+		}}
+		in = t
+	} else {
+		in = &plainInput{r: bufio.NewReader(stdin)}
 	}
+	log.SetOutput(eout)
 
-	t := terminal.NewTerminal(os.Stdin, prompt)
-	defer fmt.Printf("\r\n")
+	i := New(&userInput{in: in}, out)
+	i.SetUserError(engine.NewOutputTextStream(eout))
+	i.Argv = append([]string{args[0]}, c.argv...)
+
+	t, interactive := in.(*terminalInput)
+	if interactive {
+		t.completer = &completer{vm: &i.VM}
+		if !c.quiet {
+			_, _ = fmt.Fprintf(out, `Top level for ichiban/prolog %s
+See https://github.com/ichiban/prolog for more details.
+Type Ctrl-D or 'halt.' to exit. Ctrl-C interrupts the running query.
+`, version)
+		}
+	}
 
-	log.SetOutput(t)
+	if c.coverprofile == "" && c.lcov == "" {
+		return start(i, c, in, out, interactive)
+	}
 
-	i := New(&userInput{t: t}, t)
-	i.Register1(engine.NewAtom("halt"), halt)
-	i.Unknown = func(name engine.Atom, args []engine.Term, env *engine.Env) {
-		var sb strings.Builder
-		s := engine.NewOutputTextStream(&sb)
-		_, _ = engine.WriteTerm(&i.VM, s, name.Apply(args...), engine.List(engine.NewAtom("quoted").Apply(engine.NewAtom("true"))), engine.Success, env).Force(context.Background())
-		log.Printf("UNKNOWN %s", &sb)
+	var code int
+	cov := i.Cover(func() {
+		code = start(i, c, in, out, interactive)
+	})
+	if err := writeCoverage(cov, c.coverprofile, (*engine.Coverage).WriteProfile); err != nil {
+		log.Print(err)
+		return 2
 	}
+	if err := writeCoverage(cov, c.lcov, (*engine.Coverage).WriteLCOV); err != nil {
+		log.Print(err)
+		return 2
+	}
+	_, _ = fmt.Fprintf(eout, "coverage: %.1f%% of clauses and goals\n", cov.Percent())
+	return code
+}
 
+// start loads the files and runs the goals, the script, or the top level. Then, it returns the exit code.
+func start(i *prolog.Interpreter, c *config, in input, out io.Writer, interactive bool) int {
 	// Consult arguments.
-	if err := i.QuerySolution(`findall(F, (member(X, ?), atom_chars(F, X)), Fs), consult(Fs).`, flag.Args()).Err(); err != nil {
-		log.Panic(err)
+	if code := runGoal(i, `findall(F, (member(X, ?), atom_chars(F, X)), Fs), consult(Fs).`, c.files); code != 0 && !interactive {
+		return code
 	}
 
-	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
-	defer stop()
+	for _, g := range c.goals {
+		if code := runGoal(i, g); code != 0 {
+			return code
+		}
+	}
+
+	switch {
+	case c.script:
+		return runGoal(i, `main`)
+	case c.toplevel != "":
+		return runGoal(i, c.toplevel)
+	default:
+		return toplevel(i, in, out, c.watch)
+	}
+}
+
+// writeCoverage writes the coverage to the file by write unless the name is empty.
+func writeCoverage(cov *engine.Coverage, name string, write func(*engine.Coverage, io.Writer) error) error {
+	if name == "" {
+		return nil
+	}
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if err := write(cov, f); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// runGoal runs the goal once and returns the exit code.
+func runGoal(p *prolog.Interpreter, goal string, args ...interface{}) int {
+	query := strings.TrimSpace(goal)
+	if !strings.HasSuffix(query, ".") {
+		query += "."
+	}
+	err := p.QuerySolution(query, args...).Err()
+	if err == nil {
+		return 0
+	}
+
+	var (
+		h *engine.HaltError
+		e engine.Exception
+	)
+	switch {
+	case errors.As(err, &h):
+		return h.Code
+	case errors.Is(err, prolog.ErrNoSolutions):
+		printMessage(p, engine.NewAtom("warning"), engine.NewAtom("format").Apply(engine.NewAtom("Goal failed: ~a"), engine.List(engine.NewAtom(goal))))
+		return 1
+	case errors.As(err, &e):
+		printError(p, e)
+		return 2
+	default:
+		log.Print(err)
+		return 2
+	}
+}
+
+func printMessage(p *prolog.Interpreter, kind engine.Atom, term engine.Term) {
+	if _, err := engine.PrintMessage(&p.VM, kind, term, engine.Success, nil).Force(context.Background()); err != nil {
+		log.Print(err)
+	}
+}
+
+func printError(p *prolog.Interpreter, e engine.Exception) {
+	if err := p.PrintError(context.Background(), e); err != nil {
+		log.Print(err)
+	}
+}
 
-	var buf strings.Builder
-	keys := bufio.NewReader(os.Stdin)
+// toplevel reads and runs queries until the end of the input and returns the exit code.
+// If watch is true, it reloads the modified files before running each query.
+// If the input is not a terminal, a query which can't be parsed makes the exit code 2.
+func toplevel(p *prolog.Interpreter, in input, out io.Writer, watch bool) int {
+	_, interactive := in.(*terminalInput)
+	var code int
+	vars := map[string]engine.Term{}
 	for {
-		switch err := handleLine(ctx, &buf, i, t, keys); err {
-		case nil:
+		query, err := in.read(prompt, contPrompt, func(text string) bool {
+			return strings.TrimSpace(text) == "" || complete(text)
+		})
+		switch {
+		case err == nil:
 			break
-		case io.EOF:
-			return
+		case errors.Is(err, errInterrupted):
+			continue
+		case errors.Is(err, io.EOF):
+			return code
 		default:
-			log.Panic(err)
+			log.Print(err)
+			return 1
+		}
+		if strings.TrimSpace(query) == "" {
+			continue
+		}
+		in.add(query)
+
+		if watch {
+			reload(p)
+		}
+
+		if err := handleQuery(context.Background(), p, in, out, query, vars); err != nil {
+			if errors.Is(err, errQuery) {
+				log.Print(err)
+				if !interactive {
+					code = 2
+				}
+				continue
+			}
+			// halt/1 unwinds the query with *engine.HaltError. Then, we exit with its code.
+			var h *engine.HaltError
+			if errors.As(err, &h) {
+				return h.Code
+			}
+			log.Print(err)
+			return 1
 		}
 	}
 }
 
-func handleLine(ctx context.Context, buf *strings.Builder, p *prolog.Interpreter, t *terminal.Terminal, keys *bufio.Reader) (err error) {
-	line, err := t.ReadLine()
+// reload reloads the modified files and reports the errors.
+func reload(p *prolog.Interpreter) {
+	if _, err := p.Make(context.Background()); err != nil {
+		var e engine.Exception
+		if errors.As(err, &e) {
+			printError(p, e)
+			return
+		}
+		log.Print(err)
+	}
+}
+
+// historyFile returns ~/.1pl_history.
+func historyFile() string {
+	home, err := os.UserHomeDir()
 	if err != nil {
-		return err
+		return ""
 	}
-	_, _ = buf.WriteString(line)
-	_, _ = buf.WriteString("\n")
-
-	sols, err := p.QueryContext(ctx, buf.String())
-	switch err {
-	case nil:
-		buf.Reset()
-		t.SetPrompt(prompt)
-	case io.EOF:
-		// Returns without resetting buf.
-		t.SetPrompt(contPrompt)
-		return nil
-	default:
-		log.Printf("failed to query: %v", err)
-		buf.Reset()
-		t.SetPrompt(prompt)
+	return filepath.Join(home, ".1pl_history")
+}
+
+var errQuery = errors.New("failed to query")
+
+// handleQuery runs the query and shows the answers. $X in the query refers to the value of X in the previous answers.
+func handleQuery(ctx context.Context, p *prolog.Interpreter, in input, out io.Writer, query string, vars map[string]engine.Term) error {
+	query, args, err := expandToplevelVariables(query, vars)
+	if err != nil {
+		printMessage(p, engine.NewAtom("error"), engine.NewAtom("format").Apply(engine.NewAtom("Unknown toplevel variable: ~a"), engine.List(engine.NewAtom(err.Error()))))
 		return nil
 	}
+
+	ctx, stop := in.start(ctx)
+	defer stop()
+
+	sols, err := p.QueryContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errQuery, err)
+	}
 	defer func() {
 		_ = sols.Close()
 	}()
@@ -130,32 +381,33 @@ func handleLine(ctx context.Context, buf *strings.Builder, p *prolog.Interpreter
 	for sols.Next() {
 		exists = true
 
-		m := map[string]prolog.TermString{}
-		_ = sols.Scan(m)
-
 		var buf bytes.Buffer
-		if len(m) == 0 {
-			_, _ = fmt.Fprintf(&buf, "%t", true)
-		} else {
-			ls := make([]string, 0, len(m))
-			for v, t := range m {
-				ls = append(ls, fmt.Sprintf("%s = %s", v, t))
-			}
-			sort.Strings(ls)
-			_, _ = fmt.Fprint(&buf, strings.Join(ls, ",\n"))
+		if err := sols.WriteAnswer(&buf); err != nil {
+			return err
 		}
-		if _, err := t.Write(buf.Bytes()); err != nil {
+		if _, err := out.Write(buf.Bytes()); err != nil {
 			return err
 		}
 
-		r, _, err := keys.ReadRune()
-		if err != nil {
+		m := map[string]termValue{}
+		_ = sols.Scan(m)
+		for n, v := range m {
+			if _, ok := v.Term.(engine.Variable); !ok {
+				vars[n] = v.Term
+			}
+		}
+
+		r, err := in.readKey()
+		switch {
+		case errors.Is(err, errInterrupted):
+			r = '.'
+		case err != nil:
 			return err
 		}
 		if r != ';' {
 			r = '.'
 		}
-		if _, err := fmt.Fprintf(t, "%s\n", string(r)); err != nil {
+		if _, err := fmt.Fprintf(out, "%s\n", string(r)); err != nil {
 			return err
 		}
 		if r == '.' {
@@ -164,12 +416,24 @@ func handleLine(ctx context.Context, buf *strings.Builder, p *prolog.Interpreter
 	}
 
 	if err := sols.Err(); err != nil {
-		log.Print(err)
+		var h *engine.HaltError
+		if errors.As(err, &h) {
+			return err
+		}
+		var e engine.Exception
+		switch {
+		case errors.As(err, &e):
+			printError(p, e)
+		case errors.Is(err, context.Canceled):
+			printMessage(p, engine.NewAtom("informational"), engine.NewAtom("format").Apply(engine.NewAtom("Interrupted"), engine.List()))
+		default:
+			log.Print(err)
+		}
 		return nil
 	}
 
 	if !exists {
-		if _, err := fmt.Fprintf(t, "%t.\n", false); err != nil {
+		if _, err := fmt.Fprintf(out, "%t.\n", false); err != nil {
 			return err
 		}
 	}
@@ -177,25 +441,151 @@ func handleLine(ctx context.Context, buf *strings.Builder, p *prolog.Interpreter
 	return nil
 }
 
+// termValue is a term in an answer which is kept for the following queries.
+type termValue struct {
+	engine.Term
+}
+
+func (t *termValue) Scan(_ *engine.VM, term engine.Term, env *engine.Env) error {
+	t.Term = env.Simplify(term)
+	return nil
+}
+
+// errUnknownToplevelVariable is an error for $X which has no value. Its message is the name of the variable.
+type errUnknownToplevelVariable string
+
+func (e errUnknownToplevelVariable) Error() string {
+	return string(e)
+}
+
+// expandToplevelVariables replaces $X in the query with a placeholder for the value of X.
+func expandToplevelVariables(query string, vars map[string]engine.Term) (string, []interface{}, error) {
+	rs := []rune(query)
+	var (
+		sb   strings.Builder
+		args []interface{}
+	)
+	for i := 0; i < len(rs); i++ {
+		if rs[i] != '$' || i+1 == len(rs) || !(unicode.IsUpper(rs[i+1]) || rs[i+1] == '_') {
+			_, _ = sb.WriteRune(rs[i])
+			continue
+		}
+		if s := scan(rs, i); s.quote != 0 || s.comment != 0 {
+			_, _ = sb.WriteRune(rs[i])
+			continue
+		}
+		j := i + 1
+		for j < len(rs) && alnum(rs[j]) {
+			j++
+		}
+		name := string(rs[i+1 : j])
+		t, ok := vars[name]
+		if !ok {
+			return "", nil, errUnknownToplevelVariable("$" + name)
+		}
+		_, _ = sb.WriteString("(?)")
+		args = append(args, t)
+		i = j - 1
+	}
+	return sb.String(), args, nil
+}
+
+// input reads queries and answers to the top level from the user.
+type input interface {
+	// read reads a text until done reports true for it.
+	read(prompt, contPrompt string, done func(string) bool) (string, error)
+
+	// readKey reads a key to decide whether to show the next solution.
+	readKey() (rune, error)
+
+	// add records the query.
+	add(query string)
+
+	// start returns a context for a query which the user can interrupt, and a function to call when the query is done.
+	start(ctx context.Context) (context.Context, func())
+}
+
+// terminalInput is an input from a terminal in raw mode.
+type terminalInput struct {
+	*editor
+}
+
+func (t *terminalInput) readKey() (rune, error) {
+	return t.console.readKey()
+}
+
+func (t *terminalInput) add(query string) {
+	if err := t.history.add(query); err != nil {
+		log.Printf("failed to save history: %v", err)
+	}
+}
+
+func (t *terminalInput) start(ctx context.Context) (context.Context, func()) {
+	return t.console.start(ctx)
+}
+
+// plainInput is an input from a pipe or a file. It doesn't prompt and shows only the first solution of each query.
+type plainInput struct {
+	r *bufio.Reader
+}
+
+func (p *plainInput) read(_, _ string, done func(string) bool) (string, error) {
+	var sb strings.Builder
+	for {
+		line, err := p.r.ReadString('\n')
+		_, _ = sb.WriteString(line)
+		if err != nil {
+			if sb.Len() > 0 {
+				return sb.String(), nil
+			}
+			return "", err
+		}
+		if done(sb.String()) {
+			return sb.String(), nil
+		}
+	}
+}
+
+func (p *plainInput) readKey() (rune, error) {
+	return '.', nil
+}
+
+func (p *plainInput) add(string) {}
+
+func (p *plainInput) start(ctx context.Context) (context.Context, func()) {
+	return signal.NotifyContext(ctx, os.Interrupt)
+}
+
+// userInput is user_input which reads lines from the input.
 type userInput struct {
-	t   *terminal.Terminal
+	in  input
 	buf bytes.Buffer
 }
 
 func (u *userInput) Read(p []byte) (n int, err error) {
 	if u.buf.Len() == 0 {
-		u.t.SetPrompt(userInputPrompt)
-		defer u.t.SetPrompt(prompt)
-		line, err := u.t.ReadLine()
+		line, err := u.in.read(userInputPrompt, userInputPrompt, func(string) bool { return true })
 		if err != nil {
 			return 0, err
 		}
-		u.buf.WriteString(line + "\n")
+		// The input from a pipe or a file keeps the newline while the terminal doesn't.
+		if !strings.HasSuffix(line, "\n") {
+			line += "\n"
+		}
+		u.buf.WriteString(line)
 	}
 
 	return u.buf.Read(p)
 }
 
-func (u *userInput) Write(b []byte) (n int, err error) {
-	return 0, nil
+// crlfWriter writes CR LF for LF since the terminal in raw mode doesn't.
+type crlfWriter struct {
+	w io.Writer
+}
+
+func (c crlfWriter) Write(p []byte) (int, error) {
+	if _, err := c.w.Write(bytes.ReplaceAll(p, []byte("\n"), []byte("\r\n"))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
 }
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ichiban/prolog/engine"
+)
+
+func TestParseArgs(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "script.pl")
+	assert.NoError(t, os.WriteFile(script, []byte("#!/usr/bin/env 1pl\nmain.\n"), 0600))
+	file := filepath.Join(dir, "file.pl")
+	assert.NoError(t, os.WriteFile(file, []byte("foo.\n"), 0600))
+
+	tests := []struct {
+		title  string
+		args   []string
+		config *config
+		err    bool
+	}{
+		{title: "empty", args: nil, config: &config{}},
+		{title: "files", args: []string{file, "foo.pl"}, config: &config{files: []string{file, "foo.pl"}}},
+		{title: "goals", args: []string{"-q", "-g", "foo", "-g", "bar", "-t", "halt", file}, config: &config{quiet: true, goals: []string{"foo", "bar"}, toplevel: "halt", files: []string{file}}},
+		{title: "watch", args: []string{"-w", file}, config: &config{watch: true, files: []string{file}}},
+		{title: "coverage", args: []string{"-coverprofile", "c.out", "-lcov", "lcov.info", file}, config: &config{coverprofile: "c.out", lcov: "lcov.info", files: []string{file}}},
+		{title: "flags after files", args: []string{file, "-g", "foo", "foo.pl", "-q"}, config: &config{quiet: true, goals: []string{"foo"}, files: []string{file, "foo.pl"}}},
+		{title: "argv", args: []string{file, "--", "-g", "foo"}, config: &config{files: []string{file}, argv: []string{"-g", "foo"}}},
+		{title: "argv without files", args: []string{"-q", "--", "foo", "--"}, config: &config{quiet: true, argv: []string{"foo", "--"}}},
+		{title: "script", args: []string{script, "-g", "foo", "--", "bar"}, config: &config{files: []string{script}, script: true, argv: []string{"-g", "foo", "--", "bar"}}},
+		{title: "script not first", args: []string{file, script}, config: &config{files: []string{file, script}}},
+		{title: "unknown flag", args: []string{"-x"}, err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			c, err := parseArgs(tt.args, io.Discard)
+			assert.Equal(t, tt.err, err != nil)
+			assert.Equal(t, tt.config, c)
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "script.pl")
+	assert.NoError(t, os.WriteFile(script, []byte(`#!/usr/bin/env 1pl
+main :-
+  current_prolog_flag(argv, [_|Args]),
+  write(Args), nl,
+  (  Args = [fail|_] -> fail
+  ;  Args = [halt|_] -> halt(3)
+  ;  Args = [throw|_] -> throw(error(foo, _))
+  ;  true
+  ).
+`), 0600))
+	file := filepath.Join(dir, "file.pl")
+	assert.NoError(t, os.WriteFile(file, []byte("foo(a).\nfoo(b).\n"), 0600))
+	watched := filepath.Join(dir, "watched.pl")
+	assert.NoError(t, os.WriteFile(watched, []byte("foo(y).\n"), 0600))
+
+	tests := []struct {
+		title          string
+		args           []string
+		input          string
+		code           int
+		output, errors string
+	}{
+		{title: "script", args: []string{script, "a", "b"}, output: "[a,b]\n"},
+		{title: "script: fail", args: []string{script, "fail"}, code: 1, output: "[fail]\n", errors: "Warning: Goal failed: main\n"},
+		{title: "script: halt", args: []string{script, "halt"}, code: 3, output: "[halt]\n"},
+		{title: "script: exception", args: []string{script, "throw"}, code: 2, output: "[throw]\n", errors: "ERROR: Unknown error term: foo\n"},
+		{title: "goals", args: []string{"-g", "foo(X), write(X), nl", "-g", "write(b), nl", "-t", "halt", file}, output: "a\nb\n"},
+		{title: "goals after files", args: []string{file, "-g", "foo(X), write(X), nl", "-t", "halt"}, output: "a\n"},
+		{title: "goal: fail", args: []string{"-g", "foo(c)", "-g", "write(b)", file}, code: 1, errors: "Warning: Goal failed: foo(c)\n"},
+		{title: "toplevel", args: []string{"-t", "foo(c)", file}, code: 1, errors: "Warning: Goal failed: foo(c)\n"},
+		{title: "argv", args: []string{"-t", "current_prolog_flag(argv, X), write(X)", "--", "a"}, output: "[1pl,a]"},
+		{title: "consult: exception", args: []string{filepath.Join(dir, "nothing.pl")}, code: 2, errors: "ERROR: "},
+		{
+			title: "queries",
+			args:  []string{file},
+			input: "foo(X).\nfoo(c).\nread(X).\nbar.\nX = f(\na).\nX = Y.\nY = g($X).\n",
+			output: `X = a.
+false.
+X = bar.
+X = f(a).
+X = Y.
+Y = g(f(a)).
+`,
+		},
+		{
+			title:  "queries: watch",
+			args:   []string{"-w", watched},
+			input:  fmt.Sprintf("\\+ \\+ (open('%s', write, S), write(S, 'foo(z).'), close(S)).\nfoo(X).\n", watched),
+			output: "true.\nX = z.\n",
+			errors: "% Reloaded " + watched + "\n",
+		},
+		{title: "queries: halt", input: "halt(4).\nfoo.\n", code: 4},
+		{title: "queries: exception", input: "foo.\n", errors: "ERROR: Unknown procedure: foo/0\n"},
+		{title: "queries: user_input", input: "get_char(A), get_char(B), get_char(C), get_char(D).\nab\ncd\n", output: "A = a,\nB = b,\nC = '\\n',\nD = c.\n"},
+		{title: "queries: syntax error", input: "foo(.\nX = a.\n", output: "X = a.\n", code: 2, errors: "failed to query: "},
+		{title: "queries: unknown toplevel variable", input: "X = $Y.\n", errors: "ERROR: Unknown toplevel variable: $Y\n"},
+		{title: "usage", args: []string{"-h"}, errors: "Usage: 1pl"},
+		{title: "unknown flag", args: []string{"-x"}, code: 2, errors: "flag provided but not defined: -x"},
+		{title: "coverage", args: []string{"-coverprofile", filepath.Join(dir, "c.out"), "-lcov", filepath.Join(dir, "lcov.info"), "-t", "foo(a)", file}, errors: "coverage: 50.0% of clauses and goals\n"},
+		{title: "coverage: goal failed", args: []string{"-coverprofile", filepath.Join(dir, "failed.out"), "-t", "foo(c)", file}, code: 1, errors: "coverage: 0.0% of clauses and goals\n"},
+		{title: "coverage: unwritable", args: []string{"-coverprofile", dir, "-t", "foo(a)", file}, code: 2, errors: dir},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			code := run(append([]string{"1pl"}, tt.args...), strings.NewReader(tt.input), &stdout, &stderr)
+			assert.Equal(t, tt.code, code)
+			assert.Equal(t, tt.output, stdout.String())
+			if tt.errors == "" {
+				assert.Empty(t, stderr.String())
+			} else {
+				assert.Contains(t, stderr.String(), tt.errors)
+			}
+		})
+	}
+
+	t.Run("coverage files", func(t *testing.T) {
+		b, err := os.ReadFile(filepath.Join(dir, "c.out"))
+		assert.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf("mode: count\n%[1]s:1.1,1.7 1 1\n%[1]s:2.1,2.7 1 0\n", file), string(b))
+
+		b, err = os.ReadFile(filepath.Join(dir, "lcov.info"))
+		assert.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf("TN:\nSF:%s\nFN:1,foo/1\nFNDA:1,foo/1\nFNF:1\nFNH:1\nDA:1,1\nDA:2,0\nLF:2\nLH:1\nend_of_record\n", file), string(b))
+	})
+}
+
+func TestExpandToplevelVariables(t *testing.T) {
+	x, y := engine.NewAtom("x"), engine.NewAtom("y")
+	vars := map[string]engine.Term{"X": x, "Y": y}
+
+	tests := []struct {
+		query string
+		out   string
+		args  []interface{}
+		err   error
+	}{
+		{query: "X = a.", out: "X = a."},
+		{query: "Z = $X.", out: "Z = (?).", args: []interface{}{x}},
+		{query: "Z = f($X, $Y, $X).", out: "Z = f((?), (?), (?)).", args: []interface{}{x, y, x}},
+		{query: "Z = $X-$Y.", out: "Z = (?)-(?).", args: []interface{}{x, y}},
+		{query: "Z = '$X'.", out: "Z = '$X'."},
+		{query: "Z = $x.", out: "Z = $x."},
+		{query: "Z = a. % $X", out: "Z = a. % $X"},
+		{query: "Z = $W.", err: errUnknownToplevelVariable("$W")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			out, args, err := expandToplevelVariables(tt.query, vars)
+			assert.Equal(t, tt.err, err)
+			assert.Equal(t, tt.out, out)
+			assert.Equal(t, tt.args, args)
+		})
+	}
+}
@@ -0,0 +1,72 @@
+// Command prolog-fmt formats Prolog texts.
+// Without files, it formats the standard input and writes the result to the standard output.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ichiban/prolog"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run formats the files given by args and returns the exit code.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	var list, write bool
+	f := flag.NewFlagSet("prolog-fmt", flag.ContinueOnError)
+	f.SetOutput(stderr)
+	f.Usage = func() {
+		_, _ = fmt.Fprint(stderr, "Usage: prolog-fmt [-l] [-w] [file...]\n")
+		f.PrintDefaults()
+	}
+	f.BoolVar(&list, "l", false, `list files whose formatting differs from prolog-fmt's`)
+	f.BoolVar(&write, "w", false, `write the result to the source file instead of the standard output`)
+	if err := f.Parse(args); err != nil {
+		return 2
+	}
+
+	p := prolog.New(nil, nil)
+	if f.NArg() == 0 {
+		if err := p.Format(stdin, stdout); err != nil {
+			_, _ = fmt.Fprintf(stderr, "<standard input>: %v\n", err)
+			return 2
+		}
+		return 0
+	}
+
+	code := 0
+	for _, name := range f.Args() {
+		src, err := os.ReadFile(name)
+		if err != nil {
+			_, _ = fmt.Fprintln(stderr, err)
+			code = 2
+			continue
+		}
+		var buf bytes.Buffer
+		if err := p.Format(bytes.NewReader(src), &buf); err != nil {
+			_, _ = fmt.Fprintf(stderr, "%s: %v\n", name, err)
+			code = 2
+			continue
+		}
+		changed := !bytes.Equal(src, buf.Bytes())
+		if list && changed {
+			_, _ = fmt.Fprintln(stdout, name)
+		}
+		if write && changed {
+			if err := os.WriteFile(name, buf.Bytes(), 0644); err != nil {
+				_, _ = fmt.Fprintln(stderr, err)
+				code = 2
+			}
+		}
+		if !list && !write {
+			_, _ = stdout.Write(buf.Bytes())
+		}
+	}
+	return code
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRun(t *testing.T) {
+	const (
+		unformatted = "foo(X):-bar(X),baz.\n"
+		formatted   = "foo(X) :-\n    bar(X),\n    baz.\n"
+	)
+
+	t.Run("stdin", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		assert.Equal(t, 0, run(nil, strings.NewReader(unformatted), &stdout, &stderr))
+		assert.Equal(t, formatted, stdout.String())
+		assert.Empty(t, stderr.String())
+	})
+
+	t.Run("stdin with a syntax error", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		assert.Equal(t, 2, run(nil, strings.NewReader("foo :- bar"), &stdout, &stderr))
+		assert.Empty(t, stdout.String())
+		assert.Equal(t, "<standard input>: 1:8: unexpected EOF\n", stderr.String())
+	})
+
+	t.Run("files", func(t *testing.T) {
+		dir := t.TempDir()
+		a, b := filepath.Join(dir, "a.pl"), filepath.Join(dir, "b.pl")
+		assert.NoError(t, os.WriteFile(a, []byte(unformatted), 0644))
+		assert.NoError(t, os.WriteFile(b, []byte(formatted), 0644))
+
+		var stdout, stderr bytes.Buffer
+		assert.Equal(t, 0, run([]string{a, b}, nil, &stdout, &stderr))
+		assert.Equal(t, formatted+formatted, stdout.String())
+
+		stdout.Reset()
+		assert.Equal(t, 0, run([]string{"-l", a, b}, nil, &stdout, &stderr))
+		assert.Equal(t, a+"\n", stdout.String())
+
+		stdout.Reset()
+		assert.Equal(t, 0, run([]string{"-w", a, b}, nil, &stdout, &stderr))
+		assert.Empty(t, stdout.String())
+		got, err := os.ReadFile(a)
+		assert.NoError(t, err)
+		assert.Equal(t, formatted, string(got))
+		assert.Empty(t, stderr.String())
+	})
+
+	t.Run("file not found", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		assert.Equal(t, 2, run([]string{filepath.Join(t.TempDir(), "missing.pl")}, nil, &stdout, &stderr))
+		assert.Contains(t, stderr.String(), "missing.pl")
+	})
+
+	t.Run("unknown flag", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		assert.Equal(t, 2, run([]string{"-x"}, nil, &stdout, &stderr))
+		assert.Contains(t, stderr.String(), "Usage: prolog-fmt [-l] [-w] [file...]")
+	})
+}
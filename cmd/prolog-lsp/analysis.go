@@ -0,0 +1,643 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ichiban/prolog/engine"
+)
+
+var (
+	atomColonMinus         = engine.NewAtom(":-")
+	atomArrow              = engine.NewAtom("-->")
+	atomSlash              = engine.NewAtom("/")
+	atomSlashSlash         = engine.NewAtom("//")
+	atomComma              = engine.NewAtom(",")
+	atomCaret              = engine.NewAtom("^")
+	atomCurly              = engine.NewAtom("{}")
+	atomDot                = engine.NewAtom(".")
+	atomEmptyList          = engine.NewAtom("[]")
+	atomCall               = engine.NewAtom("call")
+	atomSingletons         = engine.NewAtom("singletons")
+	atomUndefinedProcedure = engine.NewAtom("undefined_procedure")
+)
+
+// predicate is a predicate indicator Name/Arity.
+type predicate struct {
+	name  engine.Atom
+	arity int
+}
+
+func (p predicate) String() string {
+	return fmt.Sprintf("%s/%d", p.name, p.arity)
+}
+
+func (p predicate) term() engine.Term {
+	return atomSlash.Apply(p.name, engine.Integer(p.arity))
+}
+
+// predicateOf returns the predicate of the callable term.
+func predicateOf(t engine.Term) (predicate, bool) {
+	switch t := t.(type) {
+	case engine.Atom:
+		return predicate{name: t}, true
+	case engine.Compound:
+		return predicate{name: t.Functor(), arity: t.Arity()}, true
+	default:
+		return predicate{}, false
+	}
+}
+
+// token is a token in a document with where it starts and ends.
+type token struct {
+	engine.Token
+	start, end engine.Position
+}
+
+// occurrence is a name token which refers to a predicate.
+type occurrence struct {
+	pred predicate
+	tok  token
+}
+
+// clause is a clause or a directive in a document.
+type clause struct {
+	term       engine.Term
+	directive  bool
+	start, end engine.Position
+	tokens     []token
+
+	// pred is the predicate which the clause defines and head is its name token if any.
+	pred predicate
+	head *token
+
+	// calls are the occurrences of the predicates which the clause calls.
+	calls []occurrence
+}
+
+// diagnostic is a problem found in a document.
+type diagnostic struct {
+	start, end engine.Position
+	severity   int
+	message    string
+}
+
+// document is an analyzed Prolog text.
+type document struct {
+	path string
+	text string
+
+	clauses     []*clause
+	diagnostics []diagnostic
+
+	// declared is the predicates declared by dynamic/1, multifile/1, discontiguous/1, or table/1.
+	declared map[predicate]struct{}
+
+	// deps is the documents loaded by ensure_loaded/1, consult/1, or include/1.
+	deps []*document
+
+	// vm is the VM which analyzed the document, and syntax is its operators and flags after the document is loaded.
+	vm     *engine.VM
+	syntax engine.Snapshot
+}
+
+// defines reports whether the document defines or declares the predicate.
+func (d *document) defines(p predicate) bool {
+	if _, ok := d.declared[p]; ok {
+		return true
+	}
+	for _, c := range d.clauses {
+		if !c.directive && c.pred == p {
+			return true
+		}
+	}
+	return false
+}
+
+// walk calls f for the document and the documents it loads, each only once.
+func (d *document) walk(f func(*document)) {
+	visited := map[*document]struct{}{}
+	var walk func(*document)
+	walk = func(d *document) {
+		if _, ok := visited[d]; ok {
+			return
+		}
+		visited[d] = struct{}{}
+		f(d)
+		for _, dep := range d.deps {
+			walk(dep)
+		}
+	}
+	walk(d)
+}
+
+// clauseAt returns the clause at the offset.
+func (d *document) clauseAt(offset int) *clause {
+	for _, c := range d.clauses {
+		if c.start.Offset <= offset && offset <= c.end.Offset {
+			return c
+		}
+	}
+	return nil
+}
+
+// predicateAt returns the predicate which the name token at the offset refers to.
+func (d *document) predicateAt(offset int) (predicate, token, bool) {
+	c := d.clauseAt(offset)
+	if c == nil {
+		return predicate{}, token{}, false
+	}
+	for i, t := range c.tokens {
+		if offset < t.start.Offset || t.end.Offset < offset {
+			continue
+		}
+		name, ok := t.Name()
+		if !ok {
+			continue
+		}
+		if c.head != nil && *c.head == t {
+			return c.pred, t, true
+		}
+		for _, o := range c.calls {
+			if o.tok == t {
+				return o.pred, t, true
+			}
+		}
+		return predicate{name: name, arity: tokenArity(c.tokens, i)}, t, true
+	}
+	return predicate{}, token{}, false
+}
+
+// analyzer analyzes Prolog texts.
+type analyzer struct {
+	vm *engine.VM
+
+	// readFile returns the content of the file.
+	readFile func(path string) (string, error)
+
+	docs map[string]*document
+}
+
+// analyze analyzes the Prolog text of the path and the files it loads.
+// The directives which change the syntax, op/3, char_conversion/2, set_prolog_flag/2, and use_module/1, are executed so that the rest of the text is read as the engine reads it.
+// The other directives are not executed.
+func (a *analyzer) analyze(path, text string) *document {
+	if a.docs == nil {
+		a.docs = map[string]*document{}
+	}
+	d := document{path: path, text: text, declared: map[predicate]struct{}{}, vm: a.vm}
+	a.docs[path] = &d
+
+	for offset, base := 0, (engine.Position{Line: 1, Column: 1}); offset < len(text); {
+		toks, n, err := lex(a.vm, text[offset:], base)
+		if len(toks) == 0 {
+			break
+		}
+		c := clause{start: toks[0].start, end: toks[len(toks)-1].end, tokens: toks}
+		switch {
+		case errors.Is(err, io.EOF):
+			t := toks[len(toks)-1]
+			d.diagnostics = append(d.diagnostics, diagnostic{start: t.start, end: t.end, severity: severityError, message: "unexpected end of file"})
+		case err != nil:
+			d.diagnostics = append(d.diagnostics, diagnostic{start: c.start, end: c.end, severity: severityError, message: err.Error()})
+		default:
+			a.clause(&d, &c, text[offset:offset+n], base)
+		}
+		d.clauses = append(d.clauses, &c)
+		offset += n
+		base = c.end
+	}
+	d.syntax = a.vm.Snapshot()
+	return &d
+}
+
+// lex reads the tokens of a clause from s which starts at base.
+// It returns the tokens, the number of bytes read, and io.EOF if s ends before the end token.
+func lex(vm *engine.VM, s string, base engine.Position) ([]token, int, error) {
+	l := engine.NewLexer(vm, strings.NewReader(s))
+	var toks []token
+	for {
+		t, err := l.Token()
+		if err != nil {
+			return toks, len(s), err
+		}
+		start := relocate(l.Pos(), base)
+		end := start
+		for _, r := range t.Val() {
+			end = advance(end, r)
+		}
+		toks = append(toks, token{Token: t, start: start, end: end})
+		if t.Kind() == engine.TokenEnd {
+			return toks, end.Offset - base.Offset, nil
+		}
+	}
+}
+
+// relocate converts pos relative to base to the absolute position.
+func relocate(pos, base engine.Position) engine.Position {
+	pos.Offset += base.Offset
+	if pos.Line == 1 {
+		pos.Column += base.Column - 1
+	}
+	pos.Line += base.Line - 1
+	return pos
+}
+
+func advance(pos engine.Position, r rune) engine.Position {
+	pos.Offset += utf8.RuneLen(r)
+	if r == '\n' {
+		pos.Line++
+		pos.Column = 1
+		return pos
+	}
+	pos.Column++
+	return pos
+}
+
+func (a *analyzer) clause(d *document, c *clause, s string, base engine.Position) {
+	p := engine.NewParser(a.vm, strings.NewReader(s))
+	t, err := p.Term()
+	if err != nil {
+		var e interface{ Pos() engine.Position }
+		if !errors.As(err, &e) {
+			d.diagnostics = append(d.diagnostics, diagnostic{start: c.start, end: c.end, severity: severityError, message: err.Error()})
+			return
+		}
+		pos := relocate(e.Pos(), base)
+		for _, t := range c.tokens {
+			if t.start == pos {
+				d.diagnostics = append(d.diagnostics, diagnostic{start: t.start, end: t.end, severity: severityError, message: fmt.Sprintf("unexpected token: %s", t.Token)})
+				return
+			}
+		}
+		d.diagnostics = append(d.diagnostics, diagnostic{start: pos, end: pos, severity: severityError, message: err.Error()})
+		return
+	}
+	c.term = t
+
+	var (
+		head, body engine.Term
+		dcg        bool
+	)
+	if t, ok := t.(engine.Compound); ok {
+		switch {
+		case t.Functor() == atomColonMinus && t.Arity() == 1:
+			c.directive = true
+			a.directive(d, c, t.Arg(0))
+			return
+		case t.Functor() == atomColonMinus && t.Arity() == 2:
+			head, body = t.Arg(0), t.Arg(1)
+		case t.Functor() == atomArrow && t.Arity() == 2:
+			head, body, dcg = t.Arg(0), t.Arg(1), true
+		}
+	}
+	if head == nil {
+		head = t
+	}
+
+	pred, ok := predicateOf(head)
+	if !ok {
+		d.diagnostics = append(d.diagnostics, diagnostic{start: c.start, end: c.end, severity: severityError, message: fmt.Sprintf("not callable: %s", c.tokens[0].Val())})
+		return
+	}
+	if dcg {
+		pred.arity += 2
+	}
+	c.pred = pred
+	if name, ok := c.tokens[0].Name(); ok && name == pred.name {
+		c.head = &c.tokens[0]
+	}
+
+	if body != nil {
+		calls := map[predicate]predicate{}
+		if dcg {
+			nonterminals(body, calls)
+		} else {
+			goals(body, 0, calls)
+		}
+		c.calls = occurrences(c, calls)
+	}
+
+	for _, v := range p.Vars {
+		if v.Count != 1 || strings.HasPrefix(v.Name.String(), "_") {
+			continue
+		}
+		for _, t := range c.tokens {
+			if t.Kind() == engine.TokenVariable && t.Val() == v.Name.String() {
+				d.diagnostics = append(d.diagnostics, diagnostic{start: t.start, end: t.end, severity: severityWarning, message: engine.Warning{Term: atomSingletons.Apply(pred.term(), engine.List(v.Name))}.String()})
+				break
+			}
+		}
+	}
+}
+
+func (a *analyzer) directive(d *document, c *clause, goal engine.Term) {
+	g, ok := goal.(engine.Compound)
+	if !ok {
+		return
+	}
+	switch name := g.Functor().String(); name {
+	case "op", "char_conversion", "set_prolog_flag", "use_module":
+		if _, err := engine.Call(a.vm, g, engine.Success, nil).Force(context.Background()); err != nil {
+			d.diagnostics = append(d.diagnostics, diagnostic{start: c.start, end: c.end, severity: severityError, message: err.Error()})
+		}
+	case "dynamic", "multifile", "discontiguous", "table":
+		for _, p := range declarations(g.Arg(0)) {
+			d.declared[p] = struct{}{}
+		}
+	case "ensure_loaded", "consult", "include":
+		for _, f := range files(g.Arg(0)) {
+			if dep := a.load(d, f); dep != nil {
+				d.deps = append(d.deps, dep)
+			}
+		}
+	case "initialization":
+		calls := map[predicate]predicate{}
+		goals(g.Arg(0), 0, calls)
+		c.calls = occurrences(c, calls)
+	}
+}
+
+// load analyzes the file loaded from the document d.
+func (a *analyzer) load(d *document, file string) *document {
+	if !filepath.IsAbs(file) {
+		file = filepath.Join(filepath.Dir(d.path), file)
+	}
+	for _, f := range []string{file, file + ".pl"} {
+		if dep, ok := a.docs[f]; ok {
+			return dep
+		}
+		s, err := a.readFile(f)
+		if err != nil {
+			continue
+		}
+		return a.analyze(f, s)
+	}
+	return nil
+}
+
+// declarations returns the predicates in PI, (PI, PI, ...), or [PI, PI, ...].
+func declarations(t engine.Term) []predicate {
+	var ps []predicate
+	var iter func(engine.Term)
+	iter = func(t engine.Term) {
+		c, ok := t.(engine.Compound)
+		if !ok {
+			return
+		}
+		switch {
+		case c.Functor() == atomComma && c.Arity() == 2:
+			iter(c.Arg(0))
+			iter(c.Arg(1))
+		case c.Functor() == atomDot && c.Arity() == 2:
+			iter(c.Arg(0))
+			iter(c.Arg(1))
+		case (c.Functor() == atomSlash || c.Functor() == atomSlashSlash) && c.Arity() == 2:
+			name, ok := c.Arg(0).(engine.Atom)
+			arity, ok2 := c.Arg(1).(engine.Integer)
+			if !ok || !ok2 {
+				return
+			}
+			p := predicate{name: name, arity: int(arity)}
+			if c.Functor() == atomSlashSlash {
+				p.arity += 2
+			}
+			ps = append(ps, p)
+		}
+	}
+	iter(t)
+	return ps
+}
+
+// files returns the file names in F or [F, F, ...].
+func files(t engine.Term) []string {
+	switch t := t.(type) {
+	case engine.Atom:
+		if t == atomEmptyList {
+			return nil
+		}
+		return []string{t.String()}
+	case engine.Compound:
+		if t.Functor() != atomDot || t.Arity() != 2 {
+			return nil
+		}
+		return append(files(t.Arg(0)), files(t.Arg(1))...)
+	default:
+		return nil
+	}
+}
+
+// metaArgs is the arguments of the control constructs and the built-in predicates which are goals.
+var metaArgs = map[predicate][]int{
+	{name: atomComma, arity: 2}:                 {0, 1},
+	{name: engine.NewAtom(";"), arity: 2}:       {0, 1},
+	{name: engine.NewAtom("->"), arity: 2}:      {0, 1},
+	{name: engine.NewAtom(`\+`), arity: 1}:      {0},
+	{name: engine.NewAtom("once"), arity: 1}:    {0},
+	{name: engine.NewAtom("ignore"), arity: 1}:  {0},
+	{name: engine.NewAtom("forall"), arity: 2}:  {0, 1},
+	{name: engine.NewAtom("findall"), arity: 3}: {1},
+	{name: engine.NewAtom("findall"), arity: 4}: {1},
+	{name: engine.NewAtom("bagof"), arity: 3}:   {1},
+	{name: engine.NewAtom("setof"), arity: 3}:   {1},
+	{name: engine.NewAtom("catch"), arity: 3}:   {0, 2},
+}
+
+// goals adds the predicates called by the goal to calls. extra is the number of the arguments added by call/N.
+// The keys of calls are the predicates as they appear in the text and the values are the predicates actually called.
+func goals(goal engine.Term, extra int, calls map[predicate]predicate) {
+	p, ok := predicateOf(goal)
+	if !ok {
+		return
+	}
+	called := p
+	called.arity += extra
+	calls[p] = called
+	if extra > 0 {
+		return
+	}
+
+	c, ok := goal.(engine.Compound)
+	if !ok {
+		return
+	}
+	if p.name == atomCall {
+		goals(c.Arg(0), p.arity-1, calls)
+		return
+	}
+	for _, i := range metaArgs[p] {
+		arg := c.Arg(i)
+		if p.name == engine.NewAtom("bagof") || p.name == engine.NewAtom("setof") {
+			for {
+				c, ok := arg.(engine.Compound)
+				if !ok || c.Functor() != atomCaret || c.Arity() != 2 {
+					break
+				}
+				arg = c.Arg(1)
+			}
+		}
+		goals(arg, 0, calls)
+	}
+}
+
+// nonterminals adds the predicates called by the grammar rule body to calls.
+func nonterminals(body engine.Term, calls map[predicate]predicate) {
+	p, ok := predicateOf(body)
+	if !ok {
+		return
+	}
+	switch c, _ := body.(engine.Compound); {
+	case p.name == atomEmptyList, p.name == engine.NewAtom("!") && p.arity == 0:
+		return
+	case p.name == atomDot && p.arity == 2:
+		return
+	case p.name == atomCurly && p.arity == 1:
+		goals(c.Arg(0), 0, calls)
+		return
+	case p.name == atomCall:
+		return
+	case p.arity == 2 && (p.name == atomComma || p.name == engine.NewAtom(";") || p.name == engine.NewAtom("|") || p.name == engine.NewAtom("->")):
+		nonterminals(c.Arg(0), calls)
+		nonterminals(c.Arg(1), calls)
+		return
+	case p.arity == 1 && p.name == engine.NewAtom(`\+`):
+		nonterminals(c.Arg(0), calls)
+		return
+	}
+	called := p
+	called.arity += 2
+	calls[p] = called
+}
+
+// occurrences finds the name tokens in the clause body which refer to the predicates in calls.
+// A predicate written as an operator is matched by its name if it's not written in the functional notation anywhere.
+func occurrences(c *clause, calls map[predicate]predicate) []occurrence {
+	var (
+		os    []occurrence
+		found = map[predicate]struct{}{}
+	)
+	for i, t := range c.tokens {
+		if c.head != nil && *c.head == t {
+			continue
+		}
+		name, ok := t.Name()
+		if !ok {
+			continue
+		}
+		p := predicate{name: name, arity: tokenArity(c.tokens, i)}
+		if called, ok := calls[p]; ok {
+			os = append(os, occurrence{pred: called, tok: t})
+			found[p] = struct{}{}
+		}
+	}
+	for i, t := range c.tokens {
+		name, ok := t.Name()
+		if !ok || tokenArity(c.tokens, i) != 0 || (c.head != nil && *c.head == t) {
+			continue
+		}
+		for p, called := range calls {
+			if _, ok := found[p]; ok || p.name != name || p.arity == 0 {
+				continue
+			}
+			os = append(os, occurrence{pred: called, tok: t})
+		}
+	}
+	sort.SliceStable(os, func(i, j int) bool {
+		return os[i].tok.start.Offset < os[j].tok.start.Offset
+	})
+	return os
+}
+
+// tokenArity returns the number of the arguments if tokens[i] is followed by an open ct, or 0 otherwise.
+func tokenArity(tokens []token, i int) int {
+	if i+1 >= len(tokens) || tokens[i+1].Kind() != engine.TokenOpenCT {
+		return 0
+	}
+	arity, depth := 1, 0
+	for _, t := range tokens[i+1:] {
+		switch t.Kind() {
+		case engine.TokenOpen, engine.TokenOpenCT, engine.TokenOpenList, engine.TokenOpenCurly, engine.TokenOpenDict:
+			depth++
+		case engine.TokenClose, engine.TokenCloseList, engine.TokenCloseCurly:
+			depth--
+			if depth == 0 {
+				return arity
+			}
+		case engine.TokenComma:
+			if depth == 1 {
+				arity++
+			}
+		}
+	}
+	return arity
+}
+
+// closeOf returns the index of the token which closes the arguments of tokens[i], or i if it has no arguments.
+func closeOf(tokens []token, i int) int {
+	if i+1 >= len(tokens) || tokens[i+1].Kind() != engine.TokenOpenCT {
+		return i
+	}
+	depth := 0
+	for j := i + 1; j < len(tokens); j++ {
+		switch tokens[j].Kind() {
+		case engine.TokenOpen, engine.TokenOpenCT, engine.TokenOpenList, engine.TokenOpenCurly, engine.TokenOpenDict:
+			depth++
+		case engine.TokenClose, engine.TokenCloseList, engine.TokenCloseCurly:
+			depth--
+			if depth == 0 {
+				return j
+			}
+		}
+	}
+	return len(tokens) - 1
+}
+
+// undefined returns the diagnostics for the calls to the predicates which are neither built-in nor defined in the document or the documents it loads.
+// known reports whether the predicate is defined elsewhere.
+func (d *document) undefined(known func(predicate) bool) []diagnostic {
+	defined := map[predicate]struct{}{}
+	for _, p := range builtins(d.vm) {
+		defined[p] = struct{}{}
+	}
+	d.walk(func(d *document) {
+		for p := range d.declared {
+			defined[p] = struct{}{}
+		}
+		for _, c := range d.clauses {
+			if !c.directive && c.term != nil {
+				defined[c.pred] = struct{}{}
+			}
+		}
+	})
+
+	var ds []diagnostic
+	for _, c := range d.clauses {
+		if c.directive {
+			continue
+		}
+		for _, o := range c.calls {
+			if _, ok := defined[o.pred]; ok || known(o.pred) {
+				continue
+			}
+			ds = append(ds, diagnostic{start: o.tok.start, end: o.tok.end, severity: severityWarning, message: engine.Warning{Term: atomUndefinedProcedure.Apply(o.pred.term(), c.pred.term())}.String()})
+		}
+	}
+	return ds
+}
+
+// builtins returns the predicates in the VM.
+func builtins(vm *engine.VM) []predicate {
+	pis := vm.Predicates()
+	ps := make([]predicate, 0, len(pis))
+	for _, pi := range pis {
+		pi := pi.(engine.Compound)
+		ps = append(ps, predicate{name: pi.Arg(0).(engine.Atom), arity: int(pi.Arg(1).(engine.Integer))})
+	}
+	return ps
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ichiban/prolog"
+	"github.com/ichiban/prolog/engine"
+)
+
+func newAnalyzer(files map[string]string) *analyzer {
+	return &analyzer{
+		vm: &prolog.New(nil, nil).VM,
+		readFile: func(path string) (string, error) {
+			s, ok := files[path]
+			if !ok {
+				return "", fs.ErrNotExist
+			}
+			return s, nil
+		},
+	}
+}
+
+func TestAnalyzer_Analyze(t *testing.T) {
+	t.Run("clauses", func(t *testing.T) {
+		d := newAnalyzer(nil).analyze("/a.pl", `foo(X) :- bar(X), call(baz, X).
+bar(1).
+greeting --> [hello], name, {bar(_)}.
+`)
+		assert.Empty(t, d.diagnostics)
+		assert.Len(t, d.clauses, 3)
+
+		foo := d.clauses[0]
+		assert.Equal(t, predicate{name: engine.NewAtom("foo"), arity: 1}, foo.pred)
+		assert.Equal(t, "foo", foo.head.Val())
+		assert.Equal(t, engine.Position{Offset: 0, Line: 1, Column: 1}, foo.start)
+		assert.Equal(t, engine.Position{Offset: 31, Line: 1, Column: 32}, foo.end)
+		var calls []string
+		for _, o := range foo.calls {
+			calls = append(calls, o.pred.String()+"@"+o.tok.start.String())
+		}
+		assert.ElementsMatch(t, []string{"bar/1@1:11", "call/2@1:19", "baz/1@1:24"}, calls)
+
+		greeting := d.clauses[2]
+		assert.Equal(t, predicate{name: engine.NewAtom("greeting"), arity: 2}, greeting.pred)
+		calls = nil
+		for _, o := range greeting.calls {
+			calls = append(calls, o.pred.String()+"@"+o.tok.start.String())
+		}
+		assert.ElementsMatch(t, []string{"name/2@3:23", "bar/1@3:30"}, calls)
+	})
+
+	t.Run("syntax", func(t *testing.T) {
+		d := newAnalyzer(nil).analyze("/a.pl", `:- op(700, xfx, ===>).
+:- set_prolog_flag(char_conversion, on).
+:- char_conversion('&', ',').
+foo(X, Y) :- X ===> Y & true.
+`)
+		assert.Empty(t, d.diagnostics)
+		body := d.clauses[3].term.(engine.Compound).Arg(1).(engine.Compound)
+		assert.Equal(t, engine.NewAtom(","), body.Functor())
+		assert.Equal(t, engine.NewAtom("===>"), body.Arg(0).(engine.Compound).Functor())
+	})
+
+	t.Run("use_module", func(t *testing.T) {
+		d := newAnalyzer(nil).analyze("/a.pl", `:- use_module(library(clpb)).
+foo(X, Y) :- sat(X # ~Y).
+`)
+		assert.Empty(t, d.diagnostics)
+	})
+
+	t.Run("diagnostics", func(t *testing.T) {
+		d := newAnalyzer(nil).analyze("/a.pl", `foo(X, Y) :- bar(X).
+broken( :- true.
+baz(1).
+qux(
+`)
+		assert.Equal(t, []diagnostic{
+			{start: engine.Position{Offset: 7, Line: 1, Column: 8}, end: engine.Position{Offset: 8, Line: 1, Column: 9}, severity: severityWarning, message: "Singleton variables [Y] in foo/2"},
+			{start: engine.Position{Offset: 29, Line: 2, Column: 9}, end: engine.Position{Offset: 31, Line: 2, Column: 11}, severity: severityError, message: "unexpected token: graphic(:-)"},
+			{start: engine.Position{Offset: 49, Line: 4, Column: 4}, end: engine.Position{Offset: 50, Line: 4, Column: 5}, severity: severityError, message: "unexpected end of file"},
+		}, d.diagnostics)
+		assert.Equal(t, predicate{name: engine.NewAtom("baz"), arity: 1}, d.clauses[2].pred)
+	})
+
+	t.Run("loaded files", func(t *testing.T) {
+		a := newAnalyzer(map[string]string{
+			"/lib/ops.pl": `:- op(700, xfx, ===>).
+op_user(X, Y) :- X ===> Y.
+`,
+		})
+		d := a.analyze("/lib/main.pl", `:- ensure_loaded(ops).
+:- dynamic(counter/1).
+foo(X, Y) :- X ===> Y, op_user(X, Y), counter(X), undefined(Y).
+`)
+		assert.Empty(t, d.diagnostics)
+		assert.Len(t, d.deps, 1)
+		assert.Equal(t, "/lib/ops.pl", d.deps[0].path)
+		assert.True(t, d.deps[0].defines(predicate{name: engine.NewAtom("op_user"), arity: 2}))
+		assert.True(t, d.defines(predicate{name: engine.NewAtom("counter"), arity: 1}))
+
+		assert.Equal(t, []diagnostic{
+			{start: engine.Position{Offset: 61, Line: 3, Column: 16}, end: engine.Position{Offset: 65, Line: 3, Column: 20}, severity: severityWarning, message: "Undefined procedure ===> /2 called from foo/2"},
+			{start: engine.Position{Offset: 96, Line: 3, Column: 51}, end: engine.Position{Offset: 105, Line: 3, Column: 60}, severity: severityWarning, message: "Undefined procedure undefined/1 called from foo/2"},
+		}, d.undefined(func(predicate) bool { return false }))
+		assert.Equal(t, []diagnostic{
+			{start: engine.Position{Offset: 61, Line: 3, Column: 16}, end: engine.Position{Offset: 65, Line: 3, Column: 20}, severity: severityWarning, message: "Undefined procedure ===> /2 called from foo/2"},
+		}, d.undefined(func(p predicate) bool { return p.name == engine.NewAtom("undefined") }))
+	})
+
+	t.Run("file not found", func(t *testing.T) {
+		a := newAnalyzer(nil)
+		a.readFile = func(string) (string, error) {
+			return "", errors.New("failed")
+		}
+		d := a.analyze("/a.pl", `:- ensure_loaded(b).`)
+		assert.Empty(t, d.deps)
+	})
+}
+
+func TestDocument_PredicateAt(t *testing.T) {
+	d := newAnalyzer(nil).analyze("/a.pl", `foo(X) :- bar(X, a), X = "str".
+bar(_, _).
+`)
+
+	tests := []struct {
+		offset int
+		pred   predicate
+		ok     bool
+	}{
+		{offset: 0, pred: predicate{name: engine.NewAtom("foo"), arity: 1}, ok: true},
+		{offset: 3, pred: predicate{name: engine.NewAtom("foo"), arity: 1}, ok: true},
+		{offset: 11, pred: predicate{name: engine.NewAtom("bar"), arity: 2}, ok: true},
+		{offset: 17, pred: predicate{name: engine.NewAtom("a")}, ok: true},
+		{offset: 5},
+		{offset: 27},
+		{offset: 100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pred.String(), func(t *testing.T) {
+			p, _, ok := d.predicateAt(tt.offset)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.pred, p)
+		})
+	}
+}
+
+func TestTokenArity(t *testing.T) {
+	toks, _, err := lex(&prolog.New(nil, nil).VM, `foo(a, [b, c], f(d, e), {g, h}) :- bar, baz (x, y).`, engine.Position{Line: 1, Column: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, 4, tokenArity(toks, 0))
+	assert.Equal(t, 22, closeOf(toks, 0))
+	assert.Equal(t, 0, tokenArity(toks, 24))
+	assert.Equal(t, 24, closeOf(toks, 24))
+	assert.Equal(t, 0, tokenArity(toks, 26))
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConn_Read(t *testing.T) {
+	id := json.RawMessage(`1`)
+
+	tests := []struct {
+		title   string
+		input   string
+		message *message
+		err     string
+	}{
+		{title: "request", input: "Content-Length: 52\r\n\r\n" + `{"jsonrpc":"2.0","id":1,"method":"foo","params":[1]}`, message: &message{JSONRPC: "2.0", ID: &id, Method: "foo", Params: json.RawMessage(`[1]`)}},
+		{title: "content type", input: "Content-Type: application/vscode-jsonrpc; charset=utf-8\r\nContent-Length: 30\r\n\r\n" + `{"jsonrpc":"2.0","method":"x"}`, message: &message{JSONRPC: "2.0", Method: "x"}},
+		{title: "eof", input: "", err: "EOF"},
+		{title: "no content length", input: "Foo: bar\r\n\r\n", err: `invalid Content-Length: strconv.Atoi: parsing "": invalid syntax`},
+		{title: "short content", input: "Content-Length: 10\r\n\r\n{}", err: "unexpected EOF"},
+		{title: "invalid json", input: "Content-Length: 2\r\n\r\n{]", err: "invalid character ']' looking for beginning of object key string"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			m, err := newConn(strings.NewReader(tt.input), io.Discard).read()
+			assert.Equal(t, tt.message, m)
+			if tt.err == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestConn_Write(t *testing.T) {
+	var buf bytes.Buffer
+	c := newConn(strings.NewReader(""), &buf)
+	id := json.RawMessage(`"a"`)
+	assert.NoError(t, c.reply(&id, []int{1}))
+	assert.NoError(t, c.replyError(&id, &responseError{Code: codeMethodNotFound, Message: "not found"}))
+	assert.NoError(t, c.notify("foo", nil))
+	assert.Equal(t, "Content-Length: 39\r\n\r\n"+`{"jsonrpc":"2.0","id":"a","result":[1]}`+
+		"Content-Length: 72\r\n\r\n"+`{"jsonrpc":"2.0","id":"a","error":{"code":-32601,"message":"not found"}}`+
+		"Content-Length: 46\r\n\r\n"+`{"jsonrpc":"2.0","method":"foo","params":null}`, buf.String())
+}
@@ -0,0 +1,36 @@
+// Command prolog-lsp is a Language Server Protocol server for Prolog texts.
+// It talks JSON-RPC over stdin and stdout, and reads Prolog texts with the same lexer and parser as the engine.
+package main
+
+import (
+	"io"
+	"log"
+	"os"
+	"runtime/debug"
+
+	"github.com/ichiban/prolog"
+)
+
+var version = func() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+
+	return info.Main.Version
+}()
+
+func main() {
+	os.Exit(run(os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run serves the client until it exits and returns the exit code.
+func run(stdin io.Reader, stdout, stderr io.Writer) int {
+	log.SetOutput(stderr)
+	s := server{
+		conn:     newConn(stdin, stdout),
+		vm:       &prolog.New(nil, nil).VM,
+		readFile: os.ReadFile,
+	}
+	return s.serve()
+}
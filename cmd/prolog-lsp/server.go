@@ -0,0 +1,573 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/ichiban/prolog/engine"
+)
+
+// server is a Language Server Protocol server for Prolog texts.
+type server struct {
+	conn *conn
+
+	// vm analyzes the documents. Before analyzing each document, its operators and flags are restored to initial.
+	vm      *engine.VM
+	initial *engine.Snapshot
+
+	// readFile returns the content of a file which is not open in the editor.
+	readFile func(path string) ([]byte, error)
+
+	// texts and docs are the open documents and their analyses by URI.
+	texts map[string]string
+	docs  map[string]*document
+
+	shutdown bool
+}
+
+// serve handles the messages until exit and returns the exit code.
+func (s *server) serve() int {
+	for {
+		m, err := s.conn.read()
+		if err != nil {
+			var e *responseError
+			if errors.As(err, &e) {
+				if err := s.conn.replyError(nil, e); err != nil {
+					log.Print(err)
+					return 1
+				}
+				continue
+			}
+			if !errors.Is(err, io.EOF) {
+				log.Print(err)
+			}
+			return 1
+		}
+
+		if m.Method == "exit" {
+			if s.shutdown {
+				return 0
+			}
+			return 1
+		}
+
+		result, err := s.handle(m)
+		if m.ID == nil {
+			if err != nil {
+				log.Print(err)
+			}
+			continue
+		}
+		if err != nil {
+			var e *responseError
+			if !errors.As(err, &e) {
+				e = &responseError{Code: codeInternalError, Message: err.Error()}
+			}
+			err = s.conn.replyError(m.ID, e)
+		} else {
+			err = s.conn.reply(m.ID, result)
+		}
+		if err != nil {
+			log.Print(err)
+			return 1
+		}
+	}
+}
+
+func (s *server) handle(m *message) (interface{}, error) {
+	switch m.Method {
+	case "initialize":
+		return initializeResult{
+			Capabilities: serverCapabilities{
+				TextDocumentSync:       textDocumentSyncFull,
+				DefinitionProvider:     true,
+				ReferencesProvider:     true,
+				HoverProvider:          true,
+				DocumentSymbolProvider: true,
+				CompletionProvider:     completionOptions{},
+			},
+			ServerInfo: serverInfo{Name: "prolog-lsp", Version: version},
+		}, nil
+	case "initialized":
+		return nil, nil
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+	case "textDocument/didOpen":
+		var params didOpenTextDocumentParams
+		if err := unmarshalParams(m, &params); err != nil {
+			return nil, err
+		}
+		return nil, s.update(params.TextDocument.URI, params.TextDocument.Text)
+	case "textDocument/didChange":
+		var params didChangeTextDocumentParams
+		if err := unmarshalParams(m, &params); err != nil {
+			return nil, err
+		}
+		if len(params.ContentChanges) == 0 {
+			return nil, nil
+		}
+		return nil, s.update(params.TextDocument.URI, params.ContentChanges[len(params.ContentChanges)-1].Text)
+	case "textDocument/didClose":
+		var params didCloseTextDocumentParams
+		if err := unmarshalParams(m, &params); err != nil {
+			return nil, err
+		}
+		delete(s.texts, params.TextDocument.URI)
+		delete(s.docs, params.TextDocument.URI)
+		if err := s.conn.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{URI: params.TextDocument.URI, Diagnostics: []lspDiagnostic{}}); err != nil {
+			return nil, err
+		}
+		return nil, s.publish()
+	case "textDocument/definition":
+		var params textDocumentPositionParams
+		if err := unmarshalParams(m, &params); err != nil {
+			return nil, err
+		}
+		return s.definition(params), nil
+	case "textDocument/references":
+		var params referenceParams
+		if err := unmarshalParams(m, &params); err != nil {
+			return nil, err
+		}
+		return s.references(params), nil
+	case "textDocument/hover":
+		var params textDocumentPositionParams
+		if err := unmarshalParams(m, &params); err != nil {
+			return nil, err
+		}
+		return s.hover(params), nil
+	case "textDocument/documentSymbol":
+		var params documentSymbolParams
+		if err := unmarshalParams(m, &params); err != nil {
+			return nil, err
+		}
+		return s.documentSymbols(params), nil
+	case "textDocument/completion":
+		var params textDocumentPositionParams
+		if err := unmarshalParams(m, &params); err != nil {
+			return nil, err
+		}
+		return s.completion(params), nil
+	default:
+		if m.ID == nil {
+			return nil, nil
+		}
+		return nil, &responseError{Code: codeMethodNotFound, Message: fmt.Sprintf("method not found: %s", m.Method)}
+	}
+}
+
+func unmarshalParams(m *message, v interface{}) error {
+	if err := json.Unmarshal(m.Params, v); err != nil {
+		return &responseError{Code: codeInvalidParams, Message: err.Error()}
+	}
+	return nil
+}
+
+// update analyzes the document and publishes the diagnostics.
+func (s *server) update(uri, text string) error {
+	if s.texts == nil {
+		s.texts = map[string]string{}
+	}
+	if s.docs == nil {
+		s.docs = map[string]*document{}
+	}
+	if s.initial == nil {
+		initial := s.vm.Snapshot()
+		s.initial = &initial
+	}
+	s.texts[uri] = text
+	s.vm.Restore(*s.initial)
+	a := analyzer{vm: s.vm, readFile: s.read}
+	s.docs[uri] = a.analyze(pathOf(uri), text)
+	return s.publish()
+}
+
+// publish publishes the diagnostics of the open documents.
+// Since a document may define the predicates called from the others, the diagnostics of all of them are published again.
+func (s *server) publish() error {
+	uris := make([]string, 0, len(s.docs))
+	for uri := range s.docs {
+		uris = append(uris, uri)
+	}
+	sort.Strings(uris)
+
+	for _, uri := range uris {
+		d := s.docs[uri]
+		ds := append([]diagnostic{}, d.diagnostics...)
+		ds = append(ds, d.undefined(func(p predicate) bool {
+			for u, o := range s.docs {
+				if u != uri && o.defines(p) {
+					return true
+				}
+			}
+			return false
+		})...)
+		sort.SliceStable(ds, func(i, j int) bool {
+			return ds[i].start.Offset < ds[j].start.Offset
+		})
+		params := publishDiagnosticsParams{URI: uri, Diagnostics: make([]lspDiagnostic, len(ds))}
+		for i, diag := range ds {
+			params.Diagnostics[i] = lspDiagnostic{
+				Range:    rangeOf(s.texts[uri], diag.start, diag.end),
+				Severity: diag.severity,
+				Source:   "prolog",
+				Message:  diag.message,
+			}
+		}
+		if err := s.conn.notify("textDocument/publishDiagnostics", params); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// read returns the text of the file from the editor if it's open, or from the file system otherwise.
+func (s *server) read(path string) (string, error) {
+	if t, ok := s.texts[uriOf(path)]; ok {
+		return t, nil
+	}
+	b, err := s.readFile(path)
+	return string(b), err
+}
+
+// definitionOf is a clause which defines a predicate.
+type definitionOf struct {
+	doc    *document
+	clause *clause
+}
+
+// scope calls f for the documents which the document d can see, the document itself, the documents it loads, and the other open documents.
+// Each file is visited only once.
+func (s *server) scope(d *document, f func(*document)) {
+	visited := map[string]struct{}{}
+	visit := func(d *document) {
+		d.walk(func(d *document) {
+			if _, ok := visited[d.path]; ok {
+				return
+			}
+			visited[d.path] = struct{}{}
+			f(d)
+		})
+	}
+	visit(d)
+	uris := make([]string, 0, len(s.docs))
+	for u := range s.docs {
+		uris = append(uris, u)
+	}
+	sort.Strings(uris)
+	for _, u := range uris {
+		visit(s.docs[u])
+	}
+}
+
+func (s *server) definitions(d *document, p predicate) []definitionOf {
+	var defs []definitionOf
+	s.scope(d, func(d *document) {
+		for _, c := range d.clauses {
+			if !c.directive && c.term != nil && c.pred == p {
+				defs = append(defs, definitionOf{doc: d, clause: c})
+			}
+		}
+	})
+	return defs
+}
+
+// at returns the document and the predicate at the position.
+func (s *server) at(params textDocumentPositionParams) (*document, predicate, token, bool) {
+	d, ok := s.docs[params.TextDocument.URI]
+	if !ok {
+		return nil, predicate{}, token{}, false
+	}
+	p, t, ok := d.predicateAt(offsetOf(d.text, params.Position))
+	return d, p, t, ok
+}
+
+func (s *server) definition(params textDocumentPositionParams) []location {
+	d, p, _, ok := s.at(params)
+	if !ok {
+		return nil
+	}
+	var ls []location
+	for _, def := range s.definitions(d, p) {
+		ls = append(ls, headLocation(def.doc, def.clause))
+	}
+	return ls
+}
+
+func (s *server) references(params referenceParams) []location {
+	d, p, _, ok := s.at(params.textDocumentPositionParams)
+	if !ok {
+		return nil
+	}
+	var ls []location
+	s.scope(d, func(d *document) {
+		for _, c := range d.clauses {
+			if params.Context.IncludeDeclaration && !c.directive && c.term != nil && c.pred == p {
+				ls = append(ls, headLocation(d, c))
+			}
+			for _, o := range c.calls {
+				if o.pred == p {
+					ls = append(ls, location{URI: uriOf(d.path), Range: rangeOf(d.text, o.tok.start, o.tok.end)})
+				}
+			}
+		}
+	})
+	return ls
+}
+
+// headLocation returns the location of the name of the clause head, or the whole clause if it's not found.
+func headLocation(d *document, c *clause) location {
+	start, end := c.start, c.end
+	if c.head != nil {
+		start, end = c.head.start, c.head.end
+	}
+	return location{URI: uriOf(d.path), Range: rangeOf(d.text, start, end)}
+}
+
+func (s *server) hover(params textDocumentPositionParams) *hover {
+	d, p, t, ok := s.at(params)
+	if !ok {
+		return nil
+	}
+
+	var sb strings.Builder
+	if defs := s.definitions(d, p); len(defs) > 0 {
+		_, _ = sb.WriteString("```prolog\n")
+		seen := map[string]struct{}{}
+		for _, def := range defs {
+			h := headText(def.doc, def.clause)
+			if _, ok := seen[h]; ok {
+				continue
+			}
+			seen[h] = struct{}{}
+			_, _ = fmt.Fprintf(&sb, "%s\n", h)
+		}
+		_, _ = sb.WriteString("```")
+		if c := comment(defs[0].doc.text, defs[0].clause.start); c != "" {
+			_, _ = fmt.Fprintf(&sb, "\n\n%s", c)
+		}
+	} else if builtin(d.vm, p) {
+		_, _ = fmt.Fprintf(&sb, "```prolog\n%s\n```\n\nBuilt-in predicate.", p)
+	} else {
+		return nil
+	}
+
+	r := rangeOf(d.text, t.start, t.end)
+	return &hover{Contents: markupContent{Kind: "markdown", Value: sb.String()}, Range: &r}
+}
+
+// headText returns the source text of the clause head.
+func headText(d *document, c *clause) string {
+	if c.head == nil {
+		return c.pred.String()
+	}
+	i := closeOf(c.tokens, 0)
+	return d.text[c.tokens[0].start.Offset:c.tokens[i].end.Offset]
+}
+
+// comment returns the lines of the % comments right before the clause which starts at pos.
+func comment(text string, pos engine.Position) string {
+	lines := strings.Split(text[:pos.Offset-(pos.Column-1)], "\n")
+	lines = lines[:len(lines)-1]
+	var cs []string
+	for i := len(lines) - 1; i >= 0; i-- {
+		l := strings.TrimSpace(lines[i])
+		if !strings.HasPrefix(l, "%") {
+			break
+		}
+		cs = append([]string{strings.TrimSpace(strings.TrimLeft(l, "%"))}, cs...)
+	}
+	return strings.Join(cs, "\n")
+}
+
+func builtin(vm *engine.VM, p predicate) bool {
+	for _, b := range builtins(vm) {
+		if b == p {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *server) documentSymbols(params documentSymbolParams) []documentSymbol {
+	d, ok := s.docs[params.TextDocument.URI]
+	if !ok {
+		return nil
+	}
+	var (
+		syms  []documentSymbol
+		index = map[predicate]int{}
+	)
+	for _, c := range d.clauses {
+		if c.directive || c.term == nil {
+			continue
+		}
+		if i, ok := index[c.pred]; ok {
+			syms[i].Range.End = rangeOf(d.text, c.end, c.end).End
+			continue
+		}
+		index[c.pred] = len(syms)
+		syms = append(syms, documentSymbol{
+			Name:           c.pred.String(),
+			Kind:           symbolKindFunction,
+			Range:          rangeOf(d.text, c.start, c.end),
+			SelectionRange: headLocation(d, c).Range,
+		})
+	}
+	return syms
+}
+
+func (s *server) completion(params textDocumentPositionParams) []completionItem {
+	d, ok := s.docs[params.TextDocument.URI]
+	if !ok {
+		return nil
+	}
+	offset := offsetOf(d.text, params.Position)
+	start := offset
+	for start > 0 {
+		r, n := utf8.DecodeLastRuneInString(d.text[:start])
+		if r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			break
+		}
+		start -= n
+	}
+	prefix := d.text[start:offset]
+	if prefix == "" {
+		return nil
+	}
+
+	set := map[completionItem]struct{}{}
+	add := func(p predicate) {
+		name := p.name.String()
+		if strings.HasPrefix(name, prefix) && !strings.HasPrefix(name, "$") {
+			set[completionItem{Label: name, Kind: completionItemKindFunction, Detail: p.String()}] = struct{}{}
+		}
+	}
+	for _, p := range builtins(d.vm) {
+		add(p)
+	}
+	s.scope(d, func(d *document) {
+		for _, c := range d.clauses {
+			if !c.directive && c.term != nil {
+				add(c.pred)
+			}
+		}
+	})
+	d.vm.Restore(d.syntax)
+	for _, o := range operators(d.vm) {
+		if strings.HasPrefix(o.name, prefix) {
+			set[completionItem{Label: o.name, Kind: completionItemKindOperator, Detail: fmt.Sprintf("op(%d, %s, %s)", o.priority, o.specifier, o.name)}] = struct{}{}
+		}
+	}
+
+	items := make([]completionItem, 0, len(set))
+	for i := range set {
+		items = append(items, i)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Label != items[j].Label {
+			return items[i].Label < items[j].Label
+		}
+		return items[i].Detail < items[j].Detail
+	})
+	return items
+}
+
+type operator struct {
+	priority  int
+	specifier string
+	name      string
+}
+
+// operators returns the operators defined in the VM.
+func operators(vm *engine.VM) []operator {
+	var (
+		ops     []operator
+		p, s, n = engine.NewVariable(), engine.NewVariable(), engine.NewVariable()
+	)
+	_, _ = engine.CurrentOp(vm, p, s, n, func(env *engine.Env) *engine.Promise {
+		ops = append(ops, operator{
+			priority:  int(env.Resolve(p).(engine.Integer)),
+			specifier: env.Resolve(s).(engine.Atom).String(),
+			name:      env.Resolve(n).(engine.Atom).String(),
+		})
+		return engine.Bool(false)
+	}, nil).Force(context.Background())
+	return ops
+}
+
+// pathOf returns the file path of the URI.
+func pathOf(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return uri
+	}
+	return filepath.FromSlash(u.Path)
+}
+
+// uriOf returns the file URI of the path.
+func uriOf(path string) string {
+	if !filepath.IsAbs(path) {
+		return path
+	}
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()
+}
+
+// rangeOf returns the LSP range from start to end in the text.
+func rangeOf(text string, start, end engine.Position) textRange {
+	return textRange{Start: positionOf(text, start), End: positionOf(text, end)}
+}
+
+// positionOf returns the LSP position of pos in the text. LSP counts characters in UTF-16 code units.
+func positionOf(text string, pos engine.Position) position {
+	offset := pos.Offset
+	if offset > len(text) {
+		offset = len(text)
+	}
+	lineStart := strings.LastIndexByte(text[:offset], '\n') + 1
+	return position{Line: pos.Line - 1, Character: utf16Len(text[lineStart:offset])}
+}
+
+// offsetOf returns the byte offset of the LSP position in the text.
+func offsetOf(text string, pos position) int {
+	offset := 0
+	for i := 0; i < pos.Line; i++ {
+		n := strings.IndexByte(text[offset:], '\n')
+		if n < 0 {
+			return len(text)
+		}
+		offset += n + 1
+	}
+	for c := 0; offset < len(text) && c < pos.Character; {
+		r, n := utf8.DecodeRuneInString(text[offset:])
+		if r == '\n' {
+			break
+		}
+		c += utf16Len(string(r))
+		offset += n
+	}
+	return offset
+}
+
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		if r >= 0x10000 {
+			n += 2
+		} else {
+			n++
+		}
+	}
+	return n
+}
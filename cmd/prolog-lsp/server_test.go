@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ichiban/prolog"
+	"github.com/ichiban/prolog/engine"
+)
+
+func TestRun(t *testing.T) {
+	var in bytes.Buffer
+	for _, m := range []string{
+		`{"jsonrpc": "2.0", "id": 1, "method": "initialize", "params": {}}`,
+		`{"jsonrpc": "2.0", "method": "initialized", "params": {}}`,
+		`{"jsonrpc": "2.0", "method": "textDocument/didOpen", "params": {"textDocument": {"uri": "file:///a.pl", "languageId": "prolog", "version": 1, "text": "foo :- bar."}}}`,
+		`{"jsonrpc": "2.0", "id": 2, "method": "textDocument/definition", "params": {"textDocument": {"uri": "file:///a.pl"}, "position": {"line": 0, "character": 1}}}`,
+		`{"jsonrpc": "2.0", "id": 3, "method": "workspace/unknown", "params": {}}`,
+		`{"jsonrpc": "2.0", "id": 4, "method": "textDocument/hover", "params": 1}`,
+		`{"jsonrpc": "2.0", "method": "$/cancelRequest", "params": {"id": 1}}`,
+		`{"jsonrpc": "2.0", "id": 5, "method": "shutdown"}`,
+		`{"jsonrpc": "2.0", "method": "exit"}`,
+	} {
+		_, _ = fmt.Fprintf(&in, "Content-Length: %d\r\n\r\n%s", len(m), m)
+	}
+
+	var out, errOut bytes.Buffer
+	assert.Equal(t, 0, run(&in, &out, &errOut))
+	assert.Empty(t, errOut.String())
+
+	var frames []string
+	for rest := out.String(); rest != ""; {
+		var n int
+		_, err := fmt.Sscanf(rest, "Content-Length: %d\r\n\r\n", &n)
+		assert.NoError(t, err)
+		i := strings.Index(rest, "\r\n\r\n") + 4
+		frames = append(frames, rest[i:i+n])
+		rest = rest[i+n:]
+	}
+	assert.Len(t, frames, 6)
+	assert.JSONEq(t, fmt.Sprintf(`{"jsonrpc": "2.0", "id": 1, "result": {"capabilities": {
+"textDocumentSync": 1,
+"definitionProvider": true,
+"referencesProvider": true,
+"hoverProvider": true,
+"documentSymbolProvider": true,
+"completionProvider": {}
+}, "serverInfo": {"name": "prolog-lsp", "version": %q}}}`, version), frames[0])
+	assert.JSONEq(t, `{"jsonrpc": "2.0", "method": "textDocument/publishDiagnostics", "params": {"uri": "file:///a.pl", "diagnostics": [
+{"range": {"start": {"line": 0, "character": 7}, "end": {"line": 0, "character": 10}}, "severity": 2, "source": "prolog", "message": "Undefined procedure bar/0 called from foo/0"}
+]}}`, frames[1])
+	assert.JSONEq(t, `{"jsonrpc": "2.0", "id": 2, "result": [{"uri": "file:///a.pl", "range": {"start": {"line": 0, "character": 0}, "end": {"line": 0, "character": 3}}}]}`, frames[2])
+	assert.JSONEq(t, `{"jsonrpc": "2.0", "id": 3, "error": {"code": -32601, "message": "method not found: workspace/unknown"}}`, frames[3])
+	assert.JSONEq(t, `{"jsonrpc": "2.0", "id": 4, "error": {"code": -32602, "message": "json: cannot unmarshal number into Go value of type main.textDocumentPositionParams"}}`, frames[4])
+	assert.JSONEq(t, `{"jsonrpc": "2.0", "id": 5, "result": null}`, frames[5])
+}
+
+func TestRun_exitWithoutShutdown(t *testing.T) {
+	m := `{"jsonrpc": "2.0", "method": "exit"}`
+	assert.Equal(t, 1, run(strings.NewReader(fmt.Sprintf("Content-Length: %d\r\n\r\n%s", len(m), m)), io.Discard, io.Discard))
+	assert.Equal(t, 1, run(strings.NewReader(""), io.Discard, io.Discard))
+}
+
+func TestServer(t *testing.T) {
+	const (
+		a = "file:///work/a.pl"
+		b = "file:///work/b.pl"
+	)
+
+	var out bytes.Buffer
+	s := server{
+		conn: newConn(strings.NewReader(""), &out),
+		vm:   &prolog.New(nil, nil).VM,
+		readFile: func(path string) ([]byte, error) {
+			return nil, fmt.Errorf("not found: %s", path)
+		},
+	}
+	assert.NoError(t, s.update(b, "% Says hello.\n% Name is an atom.\ngreet(Name) :- write(hello(Name)).\n"))
+	assert.NoError(t, s.update(a, "main :- greet(world),\n  greet('𝒳'), X = Y, foo, 1 =:= 3 mod 2.\n"))
+
+	t.Run("diagnostics", func(t *testing.T) {
+		c := newConn(&out, io.Discard)
+		m, err := c.read()
+		assert.NoError(t, err)
+		assert.Equal(t, "textDocument/publishDiagnostics", m.Method)
+		assert.JSONEq(t, `{"uri": "file:///work/b.pl", "diagnostics": []}`, string(m.Params))
+
+		m, err = c.read()
+		assert.NoError(t, err)
+		assert.Equal(t, "textDocument/publishDiagnostics", m.Method)
+		assert.JSONEq(t, `{"uri": "file:///work/a.pl", "diagnostics": [
+{"range": {"start": {"line": 1, "character": 15}, "end": {"line": 1, "character": 16}}, "severity": 2, "source": "prolog", "message": "Singleton variables [X] in main/0"},
+{"range": {"start": {"line": 1, "character": 19}, "end": {"line": 1, "character": 20}}, "severity": 2, "source": "prolog", "message": "Singleton variables [Y] in main/0"},
+{"range": {"start": {"line": 1, "character": 22}, "end": {"line": 1, "character": 25}}, "severity": 2, "source": "prolog", "message": "Undefined procedure foo/0 called from main/0"}
+]}`, string(m.Params))
+
+		m, err = c.read()
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{"uri": "file:///work/b.pl", "diagnostics": []}`, string(m.Params))
+	})
+
+	t.Run("definition", func(t *testing.T) {
+		assert.Equal(t, []location{
+			{URI: b, Range: textRange{Start: position{Line: 2, Character: 0}, End: position{Line: 2, Character: 5}}},
+		}, s.definition(textDocumentPositionParams{TextDocument: textDocumentIdentifier{URI: a}, Position: position{Line: 1, Character: 4}}))
+		assert.Empty(t, s.definition(textDocumentPositionParams{TextDocument: textDocumentIdentifier{URI: a}, Position: position{Line: 1, Character: 23}}))
+		assert.Empty(t, s.definition(textDocumentPositionParams{TextDocument: textDocumentIdentifier{URI: "file:///work/c.pl"}}))
+	})
+
+	t.Run("references", func(t *testing.T) {
+		var params referenceParams
+		params.TextDocument.URI = b
+		params.Position = position{Line: 2, Character: 1}
+		assert.Equal(t, []location{
+			{URI: a, Range: textRange{Start: position{Line: 0, Character: 8}, End: position{Line: 0, Character: 13}}},
+			{URI: a, Range: textRange{Start: position{Line: 1, Character: 2}, End: position{Line: 1, Character: 7}}},
+		}, s.references(params))
+
+		params.Context.IncludeDeclaration = true
+		assert.Equal(t, []location{
+			{URI: b, Range: textRange{Start: position{Line: 2, Character: 0}, End: position{Line: 2, Character: 5}}},
+			{URI: a, Range: textRange{Start: position{Line: 0, Character: 8}, End: position{Line: 0, Character: 13}}},
+			{URI: a, Range: textRange{Start: position{Line: 1, Character: 2}, End: position{Line: 1, Character: 7}}},
+		}, s.references(params))
+	})
+
+	t.Run("hover", func(t *testing.T) {
+		assert.Equal(t, &hover{
+			Contents: markupContent{Kind: "markdown", Value: "```prolog\ngreet(Name)\n```\n\nSays hello.\nName is an atom."},
+			Range:    &textRange{Start: position{Line: 0, Character: 8}, End: position{Line: 0, Character: 13}},
+		}, s.hover(textDocumentPositionParams{TextDocument: textDocumentIdentifier{URI: a}, Position: position{Line: 0, Character: 10}}))
+		assert.Equal(t, &hover{
+			Contents: markupContent{Kind: "markdown", Value: "```prolog\nwrite/1\n```\n\nBuilt-in predicate."},
+			Range:    &textRange{Start: position{Line: 2, Character: 15}, End: position{Line: 2, Character: 20}},
+		}, s.hover(textDocumentPositionParams{TextDocument: textDocumentIdentifier{URI: b}, Position: position{Line: 2, Character: 16}}))
+		assert.Nil(t, s.hover(textDocumentPositionParams{TextDocument: textDocumentIdentifier{URI: a}, Position: position{Line: 1, Character: 23}}))
+	})
+
+	t.Run("document symbols", func(t *testing.T) {
+		assert.Equal(t, []documentSymbol{
+			{
+				Name:           "greet/1",
+				Kind:           symbolKindFunction,
+				Range:          textRange{Start: position{Line: 2, Character: 0}, End: position{Line: 2, Character: 34}},
+				SelectionRange: textRange{Start: position{Line: 2, Character: 0}, End: position{Line: 2, Character: 5}},
+			},
+		}, s.documentSymbols(documentSymbolParams{TextDocument: textDocumentIdentifier{URI: b}}))
+	})
+
+	t.Run("completion", func(t *testing.T) {
+		items := s.completion(textDocumentPositionParams{TextDocument: textDocumentIdentifier{URI: a}, Position: position{Line: 1, Character: 4}})
+		assert.Contains(t, items, completionItem{Label: "greet", Kind: completionItemKindFunction, Detail: "greet/1"})
+		assert.Contains(t, items, completionItem{Label: "ground", Kind: completionItemKindFunction, Detail: "ground/1"})
+		for _, i := range items {
+			assert.True(t, strings.HasPrefix(i.Label, "gr"))
+		}
+
+		items = s.completion(textDocumentPositionParams{TextDocument: textDocumentIdentifier{URI: a}, Position: position{Line: 1, Character: 37}})
+		assert.Contains(t, items, completionItem{Label: "mod", Kind: completionItemKindOperator, Detail: "op(400, yfx, mod)"})
+	})
+}
+
+func TestServer_update(t *testing.T) {
+	const (
+		a = "file:///work/a.pl"
+		b = "file:///work/b.pl"
+	)
+
+	var out bytes.Buffer
+	vm := &prolog.New(nil, nil).VM
+	s := server{
+		conn: newConn(strings.NewReader(""), &out),
+		vm:   vm,
+		readFile: func(path string) ([]byte, error) {
+			return nil, fmt.Errorf("not found: %s", path)
+		},
+	}
+	assert.NoError(t, s.update(a, "main :- foo.\n"))
+	assert.NoError(t, s.update(b, ":- op(700, xfx, greater).\nfoo.\n"))
+
+	c := newConn(&out, io.Discard)
+	var uris []string
+	var params []publishDiagnosticsParams
+	for {
+		m, err := c.read()
+		if err != nil {
+			break
+		}
+		var p publishDiagnosticsParams
+		assert.NoError(t, json.Unmarshal(m.Params, &p))
+		uris = append(uris, p.URI)
+		params = append(params, p)
+	}
+	assert.Equal(t, []string{a, a, b}, uris)
+	assert.Len(t, params[0].Diagnostics, 1)
+	assert.Empty(t, params[1].Diagnostics)
+	assert.Empty(t, params[2].Diagnostics)
+
+	t.Run("operators", func(t *testing.T) {
+		assert.NotContains(t, s.completion(textDocumentPositionParams{TextDocument: textDocumentIdentifier{URI: a}, Position: position{Line: 0, Character: 10}}), completionItem{Label: "greater", Kind: completionItemKindOperator, Detail: "op(700, xfx, greater)"})
+		assert.Contains(t, s.completion(textDocumentPositionParams{TextDocument: textDocumentIdentifier{URI: b}, Position: position{Line: 0, Character: 18}}), completionItem{Label: "greater", Kind: completionItemKindOperator, Detail: "op(700, xfx, greater)"})
+
+		assert.NoError(t, s.update(a, "main :- foo.\n"))
+		ok, err := engine.CurrentOp(vm, engine.NewVariable(), engine.NewVariable(), engine.NewAtom("greater"), engine.Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.False(t, ok)
+	})
+}
+
+func TestOffsetOf(t *testing.T) {
+	text := "a𝒳b\nc"
+	assert.Equal(t, 0, offsetOf(text, position{Line: 0, Character: 0}))
+	assert.Equal(t, 1, offsetOf(text, position{Line: 0, Character: 1}))
+	assert.Equal(t, 5, offsetOf(text, position{Line: 0, Character: 3}))
+	assert.Equal(t, 6, offsetOf(text, position{Line: 0, Character: 10}))
+	assert.Equal(t, 8, offsetOf(text, position{Line: 1, Character: 1}))
+	assert.Equal(t, 8, offsetOf(text, position{Line: 5, Character: 0}))
+}
@@ -0,0 +1,65 @@
+// Command prolog-xref reports undefined, unused, and arity-mismatched procedures in Prolog texts.
+// With -dot, it writes the call graph in the DOT language of Graphviz instead.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ichiban/prolog"
+	"github.com/ichiban/prolog/engine"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run loads the files given by args, reports on them, and returns the exit code.
+// The exit code is 1 if there are any problems, or 2 if the files can't be loaded.
+func run(args []string, stdout, stderr io.Writer) int {
+	var dot bool
+	f := flag.NewFlagSet("prolog-xref", flag.ContinueOnError)
+	f.SetOutput(stderr)
+	f.Usage = func() {
+		_, _ = fmt.Fprint(stderr, "Usage: prolog-xref [-dot] file...\n")
+		f.PrintDefaults()
+	}
+	f.BoolVar(&dot, "dot", false, "write the call graph in the DOT language")
+	if err := f.Parse(args); err != nil {
+		return 2
+	}
+	if f.NArg() == 0 {
+		f.Usage()
+		return 2
+	}
+
+	p := prolog.New(nil, nil)
+	p.OnWarning = func(engine.Warning) {}
+	p.SkipInitialization = true
+	for _, name := range f.Args() {
+		if err := p.Exec(`:- consult(?).`, engine.NewAtom(name)); err != nil {
+			_, _ = fmt.Fprintf(stderr, "%s: %v\n", name, err)
+			return 2
+		}
+	}
+
+	x := p.Xref()
+	if dot {
+		if err := x.WriteDOT(stdout); err != nil {
+			_, _ = fmt.Fprintln(stderr, err)
+			return 2
+		}
+		return 0
+	}
+
+	ws := x.Warnings()
+	for _, w := range ws {
+		_, _ = fmt.Fprintln(stdout, w)
+	}
+	if len(ws) > 0 {
+		return 1
+	}
+	return 0
+}
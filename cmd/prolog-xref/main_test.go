@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	bad, good := filepath.Join(dir, "bad.pl"), filepath.Join(dir, "good.pl")
+	assert.NoError(t, os.WriteFile(bad, []byte(`:- initialization(main).
+main :- foo(1), bar.
+foo(X, Y) :- X = Y.
+unused.
+`), 0644))
+	assert.NoError(t, os.WriteFile(good, []byte(`:- initialization(main).
+main :- foo(1).
+foo(X) :- write(X), nl.
+`), 0644))
+
+	t.Run("problems", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		assert.Equal(t, 1, run([]string{bad}, &stdout, &stderr))
+		assert.Equal(t, bad+`:2:1: Undefined procedure bar/0 called from main/0
+`+bad+`:2:1: Undefined procedure foo/1 called from main/0; defined with other arities: [foo/2]
+`+bad+`:3:1: foo/2 is not called
+`+bad+`:4:1: unused/0 is not called
+`, stdout.String())
+		assert.Empty(t, stderr.String())
+	})
+
+	t.Run("no problems", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		assert.Equal(t, 0, run([]string{good}, &stdout, &stderr))
+		assert.Empty(t, stdout.String())
+		assert.Empty(t, stderr.String())
+	})
+
+	t.Run("dot", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		assert.Equal(t, 0, run([]string{"-dot", good}, &stdout, &stderr))
+		assert.Equal(t, `digraph xref {
+	"foo/1";
+	"main/0";
+	"main/0" -> "foo/1";
+}
+`, stdout.String())
+		assert.Empty(t, stderr.String())
+	})
+
+	t.Run("file not found", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		assert.Equal(t, 2, run([]string{filepath.Join(dir, "missing.pl")}, &stdout, &stderr))
+		assert.Contains(t, stderr.String(), "missing.pl")
+	})
+
+	t.Run("no files", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		assert.Equal(t, 2, run(nil, &stdout, &stderr))
+		assert.Contains(t, stderr.String(), "Usage: prolog-xref [-dot] file...")
+	})
+
+	t.Run("unknown flag", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		assert.Equal(t, 2, run([]string{"-x", good}, &stdout, &stderr))
+		assert.Contains(t, stderr.String(), "Usage: prolog-xref [-dot] file...")
+	})
+}
@@ -0,0 +1,167 @@
+package engine
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// WriteAnswer writes the solution for the variables in the query in the way the top level shows it.
+// The variables bound to the same term are grouped like X = Y, Y = f(_A), and the other variables are named _A, _B, ...
+// or _ if they occur only once. The residual goals of the constraints follow the bindings.
+// If there's nothing to show, it writes true.
+// The terms are written with the options of current_prolog_flag(answer_write_options, Options).
+func (vm *VM) WriteAnswer(w io.Writer, vars []ParsedVariable, env *Env) error {
+	opts, err := vm.answerWriteOptionsOf(vm.answerWriteOptionsFlag(), env)
+	if err != nil {
+		return err
+	}
+
+	type group struct {
+		names []Atom
+		value Term
+	}
+	var groups []*group
+vars:
+	for _, v := range vars {
+		value := env.Resolve(v.Variable)
+		for _, g := range groups {
+			if value.Compare(g.value, env) == 0 {
+				g.names = append(g.names, v.Name)
+				continue vars
+			}
+		}
+		groups = append(groups, &group{names: []Atom{v.Name}, value: value})
+	}
+
+	// A variable bound to a query variable is written as the query variable.
+	if opts.variableNames == nil {
+		opts.variableNames = map[Variable]Atom{}
+	}
+	for _, g := range groups {
+		if v, ok := g.value.(Variable); ok {
+			opts.variableNames[v] = g.names[len(g.names)-1]
+		}
+	}
+
+	var terms []Term
+	for _, g := range groups {
+		if _, ok := g.value.(Variable); !ok {
+			terms = append(terms, g.value)
+		}
+	}
+	residuals := residualGoals(env)
+	terms = append(terms, residuals...)
+	nameVariables(opts.variableNames, terms, env)
+
+	var answers []string
+	write := func(t Term, priority Integer) string {
+		var buf bytes.Buffer
+		_ = t.WriteTerm(&buf, opts.withPriority(priority), env)
+		return buf.String()
+	}
+	for _, g := range groups {
+		for i := 0; i < len(g.names)-1; i++ {
+			answers = append(answers, fmt.Sprintf("%s = %s", g.names[i], g.names[i+1]))
+		}
+		if _, ok := g.value.(Variable); !ok {
+			answers = append(answers, fmt.Sprintf("%s = %s", g.names[len(g.names)-1], write(g.value, 699)))
+		}
+	}
+	for _, r := range residuals {
+		answers = append(answers, write(r, 999))
+	}
+
+	if len(answers) == 0 {
+		answers = append(answers, "true")
+	}
+	_, err = io.WriteString(w, strings.Join(answers, ",\n"))
+	return err
+}
+
+// nameVariables names the unnamed variables in terms _A, _B, ... in the order of appearance, or _ if they occur only once.
+func nameVariables(names map[Variable]Atom, terms []Term, env *Env) {
+	var (
+		order []Variable
+		count = map[Variable]int{}
+		path  = map[termID]struct{}{} // to stop at cycles
+	)
+	var walk func(Term)
+	walk = func(t Term) {
+		switch t := env.Resolve(t).(type) {
+		case Variable:
+			if _, ok := names[t]; ok {
+				return
+			}
+			if count[t] == 0 {
+				order = append(order, t)
+			}
+			count[t]++
+		case Compound:
+			if _, ok := path[id(t)]; ok {
+				return
+			}
+			path[id(t)] = struct{}{}
+			for i := 0; i < t.Arity(); i++ {
+				walk(t.Arg(i))
+			}
+			delete(path, id(t))
+		}
+	}
+	for _, t := range terms {
+		walk(t)
+	}
+
+	var n int
+	for _, v := range order {
+		if count[v] == 1 {
+			names[v] = atomUnderscore
+			continue
+		}
+		name := fmt.Sprintf("_%c", 'A'+n%26)
+		if n >= 26 {
+			name += fmt.Sprint(n / 26)
+		}
+		names[v] = NewAtom(name)
+		n++
+	}
+}
+
+// residualGoals returns the goals which represent the constraints on the variables.
+func residualGoals(env *Env) []Term {
+	var goals []Term
+	for _, c := range chrStoreOf(env).constraints {
+		goals = append(goals, c.term)
+	}
+	if s, ok := clpbStore(newBDDBuilder(), env); ok && s != bddTrue {
+		goals = append(goals, atomSat.Apply(s.formula()))
+	}
+	return goals
+}
+
+// formula returns a Boolean expression which is equivalent to the bdd.
+func (n *bdd) formula() Term {
+	switch n {
+	case bddFalse:
+		return Integer(0)
+	case bddTrue:
+		return Integer(1)
+	}
+	switch {
+	case n.lo == bddFalse && n.hi == bddTrue:
+		return n.v
+	case n.lo == bddTrue && n.hi == bddFalse:
+		return atomTilde.Apply(n.v)
+	case n.lo == bddFalse:
+		return atomAsterisk.Apply(n.v, n.hi.formula())
+	case n.hi == bddFalse:
+		return atomAsterisk.Apply(atomTilde.Apply(n.v), n.lo.formula())
+	case n.hi == bddTrue:
+		return atomPlus.Apply(n.v, n.lo.formula())
+	case n.lo == bddTrue:
+		return atomPlus.Apply(atomTilde.Apply(n.v), n.hi.formula())
+	default:
+		return atomPlus.Apply(atomAsterisk.Apply(n.v, n.hi.formula()), atomAsterisk.Apply(atomTilde.Apply(n.v), n.lo.formula()))
+	}
+}
@@ -0,0 +1,91 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVM_WriteAnswer(t *testing.T) {
+	x, y, z := NewVariable(), NewVariable(), NewVariable()
+	a, b := NewVariable(), NewVariable()
+	vars := []ParsedVariable{
+		{Name: NewAtom("X"), Variable: x},
+		{Name: NewAtom("Y"), Variable: y},
+		{Name: NewAtom("Z"), Variable: z},
+	}
+
+	var vm VM
+	var sat *Env
+	ok, err := Sat(&vm, atomPlus.Apply(x, y), func(env *Env) *Promise {
+		sat = env
+		return Bool(true)
+	}, nil).Force(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	tests := []struct {
+		title   string
+		options Term
+		env     *Env
+		output  string
+	}{
+		{title: "nothing", env: nil, output: "true"},
+		{title: "bound", env: NewEnv().bind(x, NewAtom("f").Apply(NewAtom("a"))), output: "X = f(a)"},
+		{title: "quoted", env: NewEnv().bind(x, NewAtom("a b")), output: "X = 'a b'"},
+		{title: "aliased", env: NewEnv().bind(x, y), output: "X = Y"},
+		{title: "aliased: three", env: NewEnv().bind(x, y).bind(y, z), output: "X = Y,\nY = Z"},
+		{title: "bound to the same term", env: NewEnv().bind(x, NewAtom("a")).bind(y, NewAtom("a")), output: "X = Y,\nY = a"},
+		{title: "query variable", env: NewEnv().bind(x, NewAtom("f").Apply(y)), output: "X = f(Y)"},
+		{title: "aliased query variable", env: NewEnv().bind(x, NewAtom("f").Apply(y)).bind(y, z), output: "X = f(Z),\nY = Z"},
+		{title: "fresh variables", env: NewEnv().bind(x, NewAtom("f").Apply(a, b, a)).bind(y, NewAtom("g").Apply(b)), output: "X = f(_A,_B,_A),\nY = g(_B)"},
+		{title: "singleton", env: NewEnv().bind(x, NewAtom("f").Apply(a)), output: "X = f(_)"},
+		{title: "answer_write_options", options: List(atomMaxDepth.Apply(Integer(2))), env: NewEnv().bind(x, List(Integer(1), Integer(2), Integer(3))).bind(y, NewAtom("a b")), output: "X = [1,2|...],\nY = a b"},
+		{title: "clpb", env: sat, output: "sat(+(X,Y))"},
+		{title: "chr", env: NewEnv().bind(varCHR, &chrStore{constraints: []chrConstraint{{id: 1, term: NewAtom("leq").Apply(x, a)}}}), output: "leq(X,_)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			vm := VM{answerWriteOptions: tt.options}
+			var buf bytes.Buffer
+			assert.NoError(t, vm.WriteAnswer(&buf, vars, tt.env))
+			assert.Equal(t, tt.output, buf.String())
+		})
+	}
+}
+
+func TestBDD_Formula(t *testing.T) {
+	x, y := NewVariable(), NewVariable()
+	b := newBDDBuilder()
+	vx, vy := b.variable(x), b.variable(y)
+
+	tests := []struct {
+		title   string
+		bdd     *bdd
+		formula Term
+	}{
+		{title: "false", bdd: bddFalse, formula: Integer(0)},
+		{title: "true", bdd: bddTrue, formula: Integer(1)},
+		{title: "variable", bdd: vx, formula: x},
+		{title: "not", bdd: b.not(vx), formula: atomTilde.Apply(x)},
+		{title: "and", bdd: b.apply(bddOpAnd, vx, vy), formula: atomAsterisk.Apply(x, y)},
+		{title: "and not", bdd: b.apply(bddOpAnd, b.not(vx), vy), formula: atomAsterisk.Apply(atomTilde.Apply(x), y)},
+		{title: "or", bdd: b.apply(bddOpOr, vx, vy), formula: atomPlus.Apply(x, y)},
+		{title: "imply", bdd: b.apply(bddOpImply, vx, vy), formula: atomPlus.Apply(atomTilde.Apply(x), y)},
+		{title: "xor", bdd: b.apply(bddOpXor, vx, vy), formula: atomPlus.Apply(atomAsterisk.Apply(x, atomTilde.Apply(y)), atomAsterisk.Apply(atomTilde.Apply(x), y))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			assert.Equal(t, tt.formula, tt.bdd.formula())
+
+			// The formula is equivalent to the bdd.
+			f, err := b.formula(tt.formula, nil)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.bdd, f)
+		})
+	}
+}
@@ -53,21 +53,46 @@ var (
 	atomBitwiseAnd        = NewAtom(`/\`)
 	atomBitwiseOr         = NewAtom(`\/`)
 	atomElipsis           = NewAtom(`...`)
+	atomTilde             = NewAtom(`~`)
+	atomUseModule         = NewAtom("use_module")
+	atomSharp             = NewAtom(`#`)
+	atomEqualColonEqual   = NewAtom(`=:=`)
+	atomEqualEqual        = NewAtom(`==`)
+	atomNotEqual          = NewAtom(`=\=`)
+	atomEqualLessThan     = NewAtom(`=<`)
+	atomGreaterThanEqual  = NewAtom(`>=`)
+	atomAtSign            = NewAtom(`@`)
+	atomPropagate         = NewAtom(`==>`)
+	atomSimplify          = NewAtom(`<=>`)
+	atomCHRRule           = NewAtom(`$chr_rule`)
+	atomColon             = NewAtom(`:`)
+	atomUnderscore        = NewAtom(`_`)
 
 	atomAbs                     = NewAtom("abs")
 	atomAccess                  = NewAtom("access")
 	atomAcos                    = NewAtom("acos")
 	atomAlias                   = NewAtom("alias")
+	atomAll                     = NewAtom("all")
+	atomAnsi                    = NewAtom("ansi")
+	atomAnswerWriteOptions      = NewAtom("answer_write_options")
 	atomAppend                  = NewAtom("append")
+	atomArgv                    = NewAtom("argv")
+	atomArityMismatch           = NewAtom("arity_mismatch")
 	atomAsin                    = NewAtom("asin")
 	atomAt                      = NewAtom("at")
 	atomAtan                    = NewAtom("atan")
 	atomAtan2                   = NewAtom("atan2")
 	atomAtom                    = NewAtom("atom")
 	atomAtomic                  = NewAtom("atomic")
+	atomBeginTests              = NewAtom("begin_tests")
 	atomBinary                  = NewAtom("binary")
+	atomBindings                = NewAtom("bindings")
+	atomBlocked                 = NewAtom("blocked")
+	atomBoolean                 = NewAtom("boolean")
+	atomBooleanExpression       = NewAtom("boolean_expression")
 	atomBinaryStream            = NewAtom("binary_stream")
 	atomBounded                 = NewAtom("bounded")
+	atomBuiltIn                 = NewAtom("built_in")
 	atomByte                    = NewAtom("byte")
 	atomCall                    = NewAtom("call")
 	atomCallable                = NewAtom("callable")
@@ -76,33 +101,47 @@ var (
 	atomCharacter               = NewAtom("character")
 	atomCharacterCode           = NewAtom("character_code")
 	atomCharacterCodeList       = NewAtom("character_code_list")
+	atomCHR                     = NewAtom("chr")
+	atomCHRConstraint           = NewAtom("chr_constraint")
 	atomChars                   = NewAtom("chars")
+	atomCleanup                 = NewAtom("cleanup")
 	atomCloseOption             = NewAtom("close_option")
 	atomCodes                   = NewAtom("codes")
 	atomCompound                = NewAtom("compound")
+	atomContext                 = NewAtom("context")
 	atomCos                     = NewAtom("cos")
 	atomCreate                  = NewAtom("create")
 	atomDebug                   = NewAtom("debug")
+	atomDefined                 = NewAtom("defined")
+	atomDepth                   = NewAtom("depth")
+	atomDict                    = NewAtom("dict")
+	atomDictFunctor             = reservedAtom("dict")
 	atomDiscontiguous           = NewAtom("discontiguous")
 	atomDiv                     = NewAtom("div")
 	atomDomainError             = NewAtom("domain_error")
 	atomDoubleQuotes            = NewAtom("double_quotes")
+	atomDuplicateKey            = NewAtom("duplicate_key")
 	atomDynamic                 = NewAtom("dynamic")
 	atomE                       = NewAtom("E")
 	atomEOFAction               = NewAtom("eof_action")
 	atomEOFCode                 = NewAtom("eof_code")
+	atomEndTests                = NewAtom("end_tests")
 	atomEndOfFile               = NewAtom("end_of_file")
 	atomEndOfStream             = NewAtom("end_of_stream")
 	atomEnsureLoaded            = NewAtom("ensure_loaded")
 	atomError                   = NewAtom("error")
 	atomEvaluable               = NewAtom("evaluable")
 	atomEvaluationError         = NewAtom("evaluation_error")
+	atomException               = NewAtom("exception")
 	atomExistenceError          = NewAtom("existence_error")
+	atomExit                    = NewAtom("exit")
 	atomExp                     = NewAtom("exp")
 	atomFX                      = NewAtom("fx")
 	atomFY                      = NewAtom("fy")
 	atomFail                    = NewAtom("fail")
+	atomFailed                  = NewAtom("failed")
 	atomFalse                   = NewAtom("false")
+	atomFile                    = NewAtom("file")
 	atomFileName                = NewAtom("file_name")
 	atomFiniteMemory            = NewAtom("finite_memory")
 	atomFlag                    = NewAtom("flag")
@@ -112,19 +151,27 @@ var (
 	atomFloatIntegerPart        = NewAtom("float_integer_part")
 	atomFloatOverflow           = NewAtom("float_overflow")
 	atomFloor                   = NewAtom("floor")
+	atomForall                  = NewAtom("forall")
 	atomForce                   = NewAtom("force")
+	atomFormat                  = NewAtom("format")
 	atomIOMode                  = NewAtom("io_mode")
 	atomIgnoreOps               = NewAtom("ignore_ops")
 	atomInByte                  = NewAtom("in_byte")
 	atomInCharacter             = NewAtom("in_character")
 	atomInCharacterCode         = NewAtom("in_character_code")
 	atomInclude                 = NewAtom("include")
+	atomInferences              = NewAtom("inferences")
+	atomInformational           = NewAtom("informational")
 	atomInitialization          = NewAtom("initialization")
 	atomInput                   = NewAtom("input")
 	atomInstantiationError      = NewAtom("instantiation_error")
 	atomIntOverflow             = NewAtom("int_overflow")
 	atomInteger                 = NewAtom("integer")
 	atomIntegerRoundingFunction = NewAtom("integer_rounding_function")
+	atomKey                     = NewAtom("key")
+	atomLattice                 = NewAtom("lattice")
+	atomLibrary                 = NewAtom("library")
+	atomLineCount               = NewAtom("line_count")
 	atomList                    = NewAtom("list")
 	atomLog                     = NewAtom("log")
 	atomMax                     = NewAtom("max")
@@ -132,19 +179,27 @@ var (
 	atomMaxDepth                = NewAtom("max_depth")
 	atomMaxInteger              = NewAtom("max_integer")
 	atomMemory                  = NewAtom("memory")
+	atomMessage                 = NewAtom("message")
+	atomMessageHook             = NewAtom("message_hook")
 	atomMin                     = NewAtom("min")
 	atomMinInteger              = NewAtom("min_integer")
 	atomMod                     = NewAtom("mod")
 	atomMode                    = NewAtom("mode")
 	atomModify                  = NewAtom("modify")
 	atomMultifile               = NewAtom("multifile")
+	atomNl                      = NewAtom("nl")
+	atomNoException             = NewAtom("no_exception")
+	atomNondet                  = NewAtom("nondet")
 	atomNonEmptyList            = NewAtom("non_empty_list")
+	atomNone                    = NewAtom("none")
 	atomNot                     = NewAtom("not")
 	atomNotLessThanZero         = NewAtom("not_less_than_zero")
 	atomNumber                  = NewAtom("number")
+	atomNumberOfClauses         = NewAtom("number_of_clauses")
 	atomNumberVars              = NewAtom("numbervars")
 	atomOff                     = NewAtom("off")
 	atomOn                      = NewAtom("on")
+	atomOp                      = NewAtom("op")
 	atomOpen                    = NewAtom("open")
 	atomOperator                = NewAtom("operator")
 	atomOperatorPriority        = NewAtom("operator_priority")
@@ -157,37 +212,63 @@ var (
 	atomPermissionError         = NewAtom("permission_error")
 	atomPhrase                  = NewAtom("phrase")
 	atomPi                      = NewAtom("pi")
+	atomPort                    = NewAtom("port")
 	atomPosition                = NewAtom("position")
+	atomPredicate               = NewAtom("predicate")
 	atomPredicateIndicator      = NewAtom("predicate_indicator")
 	atomPrivateProcedure        = NewAtom("private_procedure")
 	atomProcedure               = NewAtom("procedure")
+	atomProlog                  = NewAtom("prolog")
 	atomPrologFlag              = NewAtom("prolog_flag")
+	atomPromiseStack            = NewAtom("promise_stack")
 	atomQuoted                  = NewAtom("quoted")
 	atomRead                    = NewAtom("read")
 	atomReadOption              = NewAtom("read_option")
+	atomRedo                    = NewAtom("redo")
+	atomRedefineBuiltIn         = NewAtom("redefine_built_in")
+	atomReloaded                = NewAtom("reloaded")
 	atomRem                     = NewAtom("rem")
 	atomReposition              = NewAtom("reposition")
 	atomRepresentationError     = NewAtom("representation_error")
 	atomReset                   = NewAtom("reset")
 	atomResourceError           = NewAtom("resource_error")
 	atomRound                   = NewAtom("round")
+	atomSat                     = NewAtom("sat")
+	atomSetup                   = NewAtom("setup")
+	atomSetupFailed             = NewAtom("setup_failed")
 	atomSign                    = NewAtom("sign")
+	atomSilent                  = NewAtom("silent")
 	atomSin                     = NewAtom("sin")
 	atomSingletons              = NewAtom("singletons")
 	atomSmallE                  = NewAtom("e")
 	atomSourceSink              = NewAtom("source_sink")
 	atomSqrt                    = NewAtom("sqrt")
+	atomStatic                  = NewAtom("static")
 	atomStaticProcedure         = NewAtom("static_procedure")
 	atomStream                  = NewAtom("stream")
 	atomStreamOption            = NewAtom("stream_option")
 	atomStreamOrAlias           = NewAtom("stream_or_alias")
 	atomStreamPosition          = NewAtom("stream_position")
 	atomStreamProperty          = NewAtom("stream_property")
+	atomSucceeded               = NewAtom("succeeded")
 	atomSyntaxError             = NewAtom("syntax_error")
+	atomSystemError             = NewAtom("system_error")
+	atomTableDirective          = NewAtom("table")
+	atomTableMode               = NewAtom("table_mode")
+	atomTabled                  = NewAtom("tabled")
 	atomTan                     = NewAtom("tan")
 	atomTermExpansion           = NewAtom("term_expansion")
+	atomTermSize                = NewAtom("term_size")
+	atomTest                    = NewAtom("test")
+	atomTestBlocked             = NewAtom("test_blocked")
+	atomTestFailed              = NewAtom("test_failed")
+	atomTestNondet              = NewAtom("test_nondet")
+	atomTestOption              = NewAtom("test_option")
+	atomTestsFailed             = NewAtom("tests_failed")
+	atomTestsPassed             = NewAtom("tests_passed")
 	atomText                    = NewAtom("text")
 	atomTextStream              = NewAtom("text_stream")
+	atomThrows                  = NewAtom("throws")
 	atomTowardZero              = NewAtom("toward_zero")
 	atomTrue                    = NewAtom("true")
 	atomTruncate                = NewAtom("truncate")
@@ -195,8 +276,13 @@ var (
 	atomTypeError               = NewAtom("type_error")
 	atomUnbounded               = NewAtom("unbounded")
 	atomUndefined               = NewAtom("undefined")
+	atomUndefinedProcedure      = NewAtom("undefined_procedure")
 	atomUnderflow               = NewAtom("underflow")
+	atomUnit                    = NewAtom("unit")
+	atomUnused                  = NewAtom("unused")
 	atomUnknown                 = NewAtom("unknown")
+	atomUser                    = NewAtom("user")
+	atomUserError               = NewAtom("user_error")
 	atomUserInput               = NewAtom("user_input")
 	atomUserOutput              = NewAtom("user_output")
 	atomVar                     = NewAtom("$VAR")
@@ -205,6 +291,8 @@ var (
 	atomWarning                 = NewAtom("warning")
 	atomWrite                   = NewAtom("write")
 	atomWriteOption             = NewAtom("write_option")
+	atomWrongAnswer             = NewAtom("wrong_answer")
+	atomWrongException          = NewAtom("wrong_exception")
 	atomXF                      = NewAtom("xf")
 	atomXFX                     = NewAtom("xfx")
 	atomXFY                     = NewAtom("xfy")
@@ -238,6 +326,32 @@ func NewAtom(name string) Atom {
 	return a
 }
 
+// reservedAtom creates an atom which NewAtom never returns even for the same name.
+// Since reading a text only results in atoms by NewAtom, user code can't write a reserved atom.
+func reservedAtom(name string) Atom {
+	atomTable.Lock()
+	defer atomTable.Unlock()
+
+	a := Atom(len(atomTable.names) + (utf8.MaxRune + 1))
+	atomTable.names = append(atomTable.names, name)
+	return a
+}
+
+// Atoms returns the atoms of more than one character created so far in the order of creation.
+func Atoms() []Atom {
+	atomTable.RLock()
+	defer atomTable.RUnlock()
+	as := make([]Atom, 0, len(atomTable.names))
+	for i, name := range atomTable.names {
+		a := Atom(i + (utf8.MaxRune + 1))
+		if atomTable.atoms[name] != a { // Reserved.
+			continue
+		}
+		as = append(as, a)
+	}
+	return as
+}
+
 // WriteTerm outputs the Atom to an io.Writer.
 func (a Atom) WriteTerm(w io.Writer, opts *WriteOptions, _ *Env) error {
 	ew := errWriter{w: w}
@@ -287,6 +401,10 @@ func (a Atom) Compare(t Term, env *Env) int {
 			return 1
 		case d < 0:
 			return -1
+		case a > t: // A reserved atom and the atom of the same name.
+			return 1
+		case a < t:
+			return -1
 		default:
 			return 0
 		}
@@ -310,6 +428,9 @@ func (a Atom) Apply(args ...Term) Term {
 	if len(args) == 0 {
 		return a
 	}
+	if a == atomDictFunctor && len(args)%2 == 1 {
+		return &dict{compound: compound{functor: a, args: args}}
+	}
 	return &compound{
 		functor: a,
 		args:    args,
@@ -57,6 +57,8 @@ func TestAtom_Compare(t *testing.T) {
 		{title: `a = a`, a: NewAtom("a"), t: NewAtom("a"), o: 0},
 		{title: `a < b`, a: NewAtom("a"), t: NewAtom("b"), o: -1},
 		{title: `a < f(a)`, a: NewAtom("a"), t: NewAtom("f").Apply(NewAtom("a")), o: -1},
+		{title: `reserved dict > dict`, a: atomDictFunctor, t: atomDict, o: 1},
+		{title: `dict < reserved dict`, a: atomDict, t: atomDictFunctor, o: -1},
 	}
 
 	for _, tt := range tests {
@@ -65,3 +67,12 @@ func TestAtom_Compare(t *testing.T) {
 		})
 	}
 }
+
+func TestAtoms(t *testing.T) {
+	a := NewAtom("an atom for TestAtoms")
+	as := Atoms()
+	assert.Contains(t, as, a)
+	assert.Contains(t, as, atomEmptyList)
+	assert.NotContains(t, as, NewAtom("a"))
+	assert.NotContains(t, as, atomDictFunctor)
+}
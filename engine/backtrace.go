@@ -0,0 +1,109 @@
+package engine
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"unsafe"
+)
+
+var varBacktrace = NewVariable()
+
+// Frame is a procedure call which was active when an Exception was created.
+type Frame struct {
+	// Goal is a copy of the goal at the time of the exception.
+	Goal Term
+
+	// File and Pos are the source location of the clause being executed. They're empty for built-in predicates.
+	File string
+	Pos  Position
+}
+
+func (f Frame) String() string {
+	var buf bytes.Buffer
+	_ = f.Goal.WriteTerm(&buf, &defaultWriteOptions, nil)
+	switch {
+	case f.File != "":
+		_, _ = fmt.Fprintf(&buf, " at %s:%s", f.File, f.Pos)
+	case f.Pos.Line > 0:
+		_, _ = fmt.Fprintf(&buf, " at %s", f.Pos)
+	}
+	return buf.String()
+}
+
+// callFrame is an element of the call stack recorded in Env while backtraces are enabled.
+type callFrame struct {
+	pi     procedureIndicator
+	args   []Term
+	clause *clause
+	parent *callFrame
+
+	// limit is the maximum number of frames in a backtrace.
+	limit int
+}
+
+// WriteTerm outputs the callFrame to an io.Writer.
+func (f *callFrame) WriteTerm(w io.Writer, _ *WriteOptions, _ *Env) error {
+	_, err := w.Write([]byte("<frame>"))
+	return err
+}
+
+// Compare compares the callFrame with a Term.
+func (f *callFrame) Compare(t Term, env *Env) int {
+	return CompareAtomic[*callFrame](f, t, func(a, b *callFrame) int {
+		switch x, y := uintptr(unsafe.Pointer(a)), uintptr(unsafe.Pointer(b)); {
+		case x > y:
+			return 1
+		case x < y:
+			return -1
+		default:
+			return 0
+		}
+	}, env)
+}
+
+func callFrameOf(env *Env) *callFrame {
+	t, ok := env.lookup(varBacktrace)
+	if !ok {
+		return nil
+	}
+	f, _ := t.(*callFrame)
+	return f
+}
+
+// pushFrame records the call of pi in env and returns a continuation which restores the caller's frame.
+func (vm *VM) pushFrame(pi procedureIndicator, args []Term, k Cont, env *Env) (Cont, *Env) {
+	parent := callFrameOf(env)
+	f := callFrame{pi: pi, args: args, parent: parent, limit: vm.BacktraceDepth}
+	return func(env *Env) *Promise {
+		return k(env.bind(varBacktrace, parent))
+	}, env.bind(varBacktrace, &f)
+}
+
+// enterClause records the clause being executed in the current frame.
+func enterClause(c *clause, env *Env) *Env {
+	f := callFrameOf(env)
+	if f == nil {
+		return env
+	}
+	cf := *f
+	cf.clause = c
+	return env.bind(varBacktrace, &cf)
+}
+
+// backtrace returns the frames from the innermost.
+func backtrace(copied map[termID]Term, env *Env) []Frame {
+	var fs []Frame
+	for f := callFrameOf(env); f != nil && len(fs) < f.limit; f = f.parent {
+		g, err := renamedCopy(f.pi.name.Apply(f.args...), copied, env)
+		if err != nil {
+			g = f.pi.Term()
+		}
+		fr := Frame{Goal: g}
+		if f.clause != nil {
+			fr.File, fr.Pos = f.clause.file, f.clause.pos
+		}
+		fs = append(fs, fr)
+	}
+	return fs
+}
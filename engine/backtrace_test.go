@@ -0,0 +1,119 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestException_Backtrace(t *testing.T) {
+	foo, bar, baz := NewAtom("foo"), NewAtom("bar"), NewAtom("baz")
+
+	newVM := func(depth int) *VM {
+		vm := VM{BacktraceDepth: depth}
+		vm.Register2(NewAtom("is"), Is)
+		vm.Register1(NewAtom("throw"), Throw)
+		assert.NoError(t, vm.Compile(context.Background(), `
+:-(foo(X), bar(X)).
+:-(bar(X), is(_, +(X, 1))).
+q.
+:-(baz, ','(q, bar(a))).
+:-(qux, throw(error(e, _))).
+`))
+		return &vm
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		vm := newVM(10)
+		_, err := Call(vm, foo.Apply(NewAtom("a")), Success, nil).Force(context.Background())
+		e, ok := err.(Exception)
+		assert.True(t, ok)
+
+		assert.Equal(t, atomSlash.Apply(NewAtom("is"), Integer(2)), e.Term().(Compound).Arg(1))
+
+		fs := e.Backtrace()
+		assert.Len(t, fs, 3)
+		assert.Equal(t, NewAtom("is"), fs[0].Goal.(Compound).Functor())
+		assert.Equal(t, Position{}, fs[0].Pos)
+		assert.Equal(t, bar.Apply(NewAtom("a")), fs[1].Goal)
+		assert.Equal(t, Position{Offset: 21, Line: 3, Column: 1}, fs[1].Pos)
+		assert.Equal(t, foo.Apply(NewAtom("a")), fs[2].Goal)
+		assert.Equal(t, Position{Offset: 1, Line: 2, Column: 1}, fs[2].Pos)
+		assert.Equal(t, "bar(a) at 3:1", fs[1].String())
+	})
+
+	t.Run("returned calls are not included", func(t *testing.T) {
+		vm := newVM(10)
+		_, err := Call(vm, baz, Success, nil).Force(context.Background())
+		e, ok := err.(Exception)
+		assert.True(t, ok)
+
+		var goals []Term
+		for _, f := range e.Backtrace() {
+			goals = append(goals, f.Goal)
+		}
+		assert.Len(t, goals, 3)
+		assert.Equal(t, []Term{bar.Apply(NewAtom("a")), baz}, goals[1:])
+	})
+
+	t.Run("comparable", func(t *testing.T) {
+		vm := newVM(10)
+		_, err := Call(vm, foo.Apply(NewAtom("a")), Success, nil).Force(context.Background())
+		e, ok := err.(Exception)
+		assert.True(t, ok)
+		assert.True(t, errors.Is(err, e))
+	})
+
+	t.Run("message", func(t *testing.T) {
+		var lines []string
+		vm := newVM(10)
+		vm.OnMessage = func(m Message) {
+			lines = m.Lines
+		}
+		_, err := Call(vm, foo.Apply(NewAtom("a")), Success, nil).Force(context.Background())
+		e, ok := err.(Exception)
+		assert.True(t, ok)
+		assert.NoError(t, vm.PrintError(context.Background(), e))
+		if assert.Len(t, lines, 4) {
+			assert.Equal(t, "is/2: Type error: `evaluable' expected, found `a/0'", lines[0])
+			assert.Contains(t, lines[1], "  is(")
+			assert.Equal(t, []string{
+				"  bar(a) at 3:1",
+				"  foo(a) at 2:1",
+			}, lines[2:])
+		}
+	})
+
+	t.Run("thrown", func(t *testing.T) {
+		vm := newVM(10)
+		_, err := Call(vm, NewAtom("qux"), Success, nil).Force(context.Background())
+		e, ok := err.(Exception)
+		assert.True(t, ok)
+		assert.Empty(t, e.Backtrace())
+		_, ok = e.Term().(Compound).Arg(1).(Variable)
+		assert.True(t, ok)
+	})
+
+	t.Run("depth-limited", func(t *testing.T) {
+		vm := newVM(2)
+		_, err := Call(vm, foo.Apply(NewAtom("a")), Success, nil).Force(context.Background())
+		e, ok := err.(Exception)
+		assert.True(t, ok)
+		assert.Len(t, e.Backtrace(), 2)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		vm := newVM(0)
+		_, err := Call(vm, foo.Apply(NewAtom("a")), Success, nil).Force(context.Background())
+		e, ok := err.(Exception)
+		assert.True(t, ok)
+		assert.Empty(t, e.Backtrace())
+	})
+}
+
+func TestFrame_String(t *testing.T) {
+	assert.Equal(t, "foo(a)", Frame{Goal: NewAtom("foo").Apply(NewAtom("a"))}.String())
+	assert.Equal(t, "foo(a) at foo.pl:2:1", Frame{Goal: NewAtom("foo").Apply(NewAtom("a")), File: "foo.pl", Pos: Position{Offset: 8, Line: 2, Column: 1}}.String())
+}
@@ -0,0 +1,95 @@
+package engine
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"unsafe"
+)
+
+// Blob is an opaque term which wraps an arbitrary Go value such as a DB handle or a struct pointer.
+// Blobs are atomic and 2 blobs are identical iff they wrap the same pointer, map, or channel.
+// A blob of any other value has its own identity given by NewBlob.
+type Blob struct {
+	Value interface{}
+
+	// id is a pointer to a copy of Value if it's not a reference so that the blob is identified by it.
+	id *interface{}
+}
+
+// NewBlob creates a new Blob which wraps v.
+func NewBlob(v interface{}) *Blob {
+	b := Blob{Value: v}
+	if !isRef(reflect.ValueOf(v)) {
+		c := v
+		b.id = &c
+	}
+	return &b
+}
+
+// WriteTerm outputs the Blob to an io.Writer.
+func (b *Blob) WriteTerm(w io.Writer, _ *WriteOptions, _ *Env) error {
+	_, err := fmt.Fprintf(w, "<go:%T:%#x>", b.Value, b.addr())
+	return err
+}
+
+// Compare compares the Blob with a Term.
+func (b *Blob) Compare(t Term, env *Env) int {
+	return CompareAtomic[*Blob](b, t, func(a, b *Blob) int {
+		if a.sameRef(b) {
+			return 0
+		}
+		switch x, y := a.addr(), b.addr(); {
+		case x > y:
+			return 1
+		case x < y:
+			return -1
+		}
+		switch x, y := uintptr(unsafe.Pointer(a)), uintptr(unsafe.Pointer(b)); {
+		case x > y:
+			return 1
+		case x < y:
+			return -1
+		default:
+			return 0
+		}
+	}, env)
+}
+
+// sameRef reports whether a and b wrap the same reference of the same type.
+// Funcs are excluded since the closures of the same function share the address.
+func (b *Blob) sameRef(o *Blob) bool {
+	x, y := reflect.ValueOf(b.Value), reflect.ValueOf(o.Value)
+	if !x.IsValid() || !y.IsValid() || x.Type() != y.Type() {
+		return false
+	}
+	switch x.Kind() {
+	case reflect.Pointer, reflect.Map, reflect.Chan, reflect.UnsafePointer:
+		return x.Pointer() == y.Pointer()
+	default:
+		return b.id != nil && b.id == o.id
+	}
+}
+
+// addr returns the address of the wrapped value if it's a reference, the address of its copy if it's given by NewBlob,
+// or the address of the Blob itself.
+func (b *Blob) addr() uintptr {
+	switch v := reflect.ValueOf(b.Value); {
+	case isRef(v):
+		return v.Pointer()
+	case b.id != nil:
+		return uintptr(unsafe.Pointer(b.id))
+	default:
+		return uintptr(unsafe.Pointer(b))
+	}
+}
+
+// isRef checks if v is a reference which has an address.
+func isRef(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Map, reflect.Slice, reflect.Chan, reflect.Func, reflect.UnsafePointer:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,88 @@
+package engine
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBlob_WriteTerm(t *testing.T) {
+	type handle struct{ name string }
+	h := &handle{}
+
+	tests := []struct {
+		title  string
+		b      *Blob
+		output string
+	}{
+		{title: "pointer", b: NewBlob(h), output: regexp.QuoteMeta(fmt.Sprintf(`<go:*engine.handle:%p>`, h))},
+		{title: "value", b: NewBlob(handle{}), output: `^<go:engine\.handle:0x[[:xdigit:]]+>$`},
+		{title: "nil", b: NewBlob(nil), output: `^<go:<nil>:0x[[:xdigit:]]+>$`},
+	}
+
+	var buf bytes.Buffer
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			buf.Reset()
+			assert.NoError(t, tt.b.WriteTerm(&buf, &WriteOptions{}, nil))
+			assert.Regexp(t, tt.output, buf.String())
+		})
+	}
+}
+
+func TestBlob_Compare(t *testing.T) {
+	x := NewVariable()
+	var hs [3]int
+	bs := [3]*Blob{NewBlob(&hs[0]), NewBlob(&hs[1]), NewBlob(&hs[2])}
+
+	tests := []struct {
+		title string
+		b     *Blob
+		t     Term
+		o     int
+	}{
+		{title: `b > X`, b: bs[1], t: x, o: 1},
+		{title: `b > 1.0`, b: bs[1], t: Float(1), o: 1},
+		{title: `b > 1`, b: bs[1], t: Integer(2), o: 1},
+		{title: `b > a`, b: bs[1], t: NewAtom("a"), o: 1},
+		{title: `b > b`, b: bs[1], t: bs[0], o: 1},
+		{title: `b = b`, b: bs[1], t: bs[1], o: 0},
+		{title: `b < b`, b: bs[1], t: bs[2], o: -1},
+		{title: `b < f(a)`, b: bs[1], t: NewAtom("f").Apply(NewAtom("a")), o: -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			assert.Equal(t, tt.o, tt.b.Compare(tt.t, nil))
+		})
+	}
+
+	t.Run("same reference", func(t *testing.T) {
+		b1, b2 := NewBlob(&hs[0]), NewBlob(&hs[0])
+		assert.Zero(t, b1.Compare(b2, nil))
+
+		env, ok := NewEnv().Unify(b1, b2)
+		assert.True(t, ok)
+		assert.Equal(t, NewEnv(), env)
+	})
+
+	t.Run("same value", func(t *testing.T) {
+		b1, b2 := NewBlob(hs[0]), NewBlob(hs[0])
+		assert.NotZero(t, b1.Compare(b2, nil))
+		assert.Equal(t, -b1.Compare(b2, nil), b2.Compare(b1, nil))
+
+		b3 := *b1
+		assert.Zero(t, b1.Compare(&b3, nil))
+	})
+
+	t.Run("same address of different types", func(t *testing.T) {
+		type wrapper struct{ n int }
+		w := &wrapper{}
+		b1, b2 := NewBlob(w), NewBlob(&w.n)
+		assert.NotZero(t, b1.Compare(b2, nil))
+		assert.Equal(t, -b1.Compare(b2, nil), b2.Compare(b1, nil))
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"io"
 	"io/fs"
 	"os"
@@ -177,7 +178,7 @@ func SubsumesTerm(_ *VM, general, specific Term, k Cont, env *Env) *Promise {
 		return Bool(false)
 	}
 
-	if d := theta.simplify(general).Compare(specific, env); d != 0 {
+	if d := theta.Simplify(general).Compare(specific, env); d != 0 {
 		return Bool(false)
 	}
 
@@ -295,6 +296,8 @@ func Functor(vm *VM, t, name, arity Term, k Cont, env *Env) *Promise {
 		default:
 			return Error(typeError(validTypeInteger, arity, env))
 		}
+	case *dict:
+		return Error(typeError(validTypeCompound, t, env))
 	case Compound:
 		return Unify(vm, tuple(name, arity), tuple(t.Functor(), Integer(t.Arity())), k, env)
 	default: // atomic
@@ -307,6 +310,8 @@ func Arg(vm *VM, nth, t, arg Term, k Cont, env *Env) *Promise {
 	switch c := env.Resolve(t).(type) {
 	case Variable:
 		return Error(InstantiationError(env))
+	case *dict:
+		return Error(typeError(validTypeCompound, c, env))
 	case Compound:
 		switch n := env.Resolve(nth).(type) {
 		case Variable:
@@ -357,6 +362,8 @@ func Univ(vm *VM, t, list Term, k Cont, env *Env) *Promise {
 				return Error(typeError(validTypeAtom, e, env))
 			}
 		}
+	case *dict:
+		return Error(typeError(validTypeCompound, t, env))
 	case Compound:
 		iter := ListIterator{List: list, Env: env, AllowPartial: true}
 		for iter.Next() {
@@ -434,6 +441,22 @@ func renamedCopy(t Term, copied map[termID]Term, env *Env) (Term, error) {
 		tail := cp
 		p.tail = &tail
 		return &p, nil
+	case *dict:
+		args, err := makeSlice(len(t.args))
+		if err != nil {
+			return nil, resourceError(resourceMemory, env)
+		}
+		var d dict
+		d.functor, d.args = t.functor, args
+		copied[id(t)] = &d
+		for i, a := range t.args {
+			cp, err := renamedCopy(a, copied, env)
+			if err != nil {
+				return nil, err
+			}
+			d.args[i] = cp
+		}
+		return &d, nil
 	case Compound:
 		args, err := makeSlice(t.Arity())
 		if err != nil {
@@ -720,6 +743,7 @@ func assertMerge(vm *VM, t Term, merge func([]clause, []clause) []clause, env *E
 	}
 
 	u.clauses = merge(u.clauses, added)
+	vm.invalidateTables()
 	return nil
 }
 
@@ -1024,13 +1048,18 @@ func Throw(_ *VM, ball Term, _ Cont, env *Env) *Promise {
 	case Variable:
 		return Error(InstantiationError(env))
 	default:
-		return Error(NewException(b, env))
+		// Unlike the errors raised by the system, a thrown ball doesn't come with a backtrace.
+		return Error(newException(b, map[termID]Term{}, env))
 	}
 }
 
 // Catch calls goal. If an exception is thrown and unifies with catcher, it calls recover.
 func Catch(vm *VM, goal, catcher, recover Term, k Cont, env *Env) *Promise {
 	return catch(func(err error) *Promise {
+		if _, ok := err.(*HaltError); ok {
+			return nil
+		}
+
 		e, ok := err.(Exception)
 		if !ok {
 			e = Exception{term: atomError.Apply(NewAtom("system_error"), NewAtom(err.Error()))}
@@ -1111,6 +1140,7 @@ func Retract(vm *VM, t Term, k Cont, env *Env) *Promise {
 				j := i - deleted
 				u.clauses, u.clauses[len(u.clauses)-1] = append(u.clauses[:j], u.clauses[j+1:]...), clause{}
 				deleted++
+				vm.invalidateTables()
 				return k(env)
 			}, env)
 		}
@@ -1146,6 +1176,7 @@ func Abolish(vm *VM, pi Term, k Cont, env *Env) *Promise {
 					return Error(permissionError(operationModify, permissionTypeStaticProcedure, key.Term(), env))
 				}
 				delete(vm.procedures, key)
+				vm.invalidateTables()
 				return k(env)
 			default:
 				return Error(typeError(validTypeInteger, arity, env))
@@ -1225,8 +1256,6 @@ func stream(vm *VM, streamOrAlias Term, env *Env) (*Stream, error) {
 	}
 }
 
-var openFile = os.OpenFile
-
 // Open opens SourceSink in mode and unifies with stream.
 func Open(vm *VM, sourceSink, mode, stream, options Term, k Cont, env *Env) *Promise {
 	var name string
@@ -1262,18 +1291,23 @@ func Open(vm *VM, sourceSink, mode, stream, options Term, k Cont, env *Env) *Pro
 	}
 
 	s := Stream{vm: vm, mode: streamMode}
-	switch f, err := openFile(name, int(s.mode), 0644); {
+	switch f, err := vm.openFile(name, int(s.mode), 0644); {
 	case err == nil:
 		if s.mode == ioModeRead {
 			s.source = f
 			s.initRead()
 		} else {
-			s.sink = f
+			w, ok := f.(io.Writer)
+			if !ok {
+				_ = f.Close()
+				return Error(permissionError(operationOpen, permissionTypeSourceSink, sourceSink, env))
+			}
+			s.sink = w
 		}
 		if fi, err := f.Stat(); err == nil {
 			s.reposition = fi.Mode()&fs.ModeType == 0
 		}
-	case os.IsNotExist(err):
+	case os.IsNotExist(err), errors.Is(err, fs.ErrInvalid):
 		return Error(existenceError(objectTypeSourceSink, sourceSink, env))
 	case os.IsPermission(err):
 		return Error(permissionError(operationOpen, permissionTypeSourceSink, sourceSink, env))
@@ -1750,6 +1784,7 @@ func ReadTerm(vm *VM, streamOrAlias, out, options Term, k Cont, env *Env) *Promi
 	case errPastEndOfStream:
 		return Error(permissionError(operationInput, permissionTypePastEndOfStream, streamOrAlias, env))
 	default:
+		p.skip()
 		return Error(syntaxError(err, env))
 	}
 
@@ -1953,16 +1988,23 @@ func PeekChar(vm *VM, streamOrAlias, char Term, k Cont, env *Env) *Promise {
 	}
 }
 
-var osExit = os.Exit
+// HaltError is an error which halt/1 results in. It can't be caught by catch/3.
+// It's up to the host program whether to exit the process with Code.
+type HaltError struct {
+	Code int
+}
 
-// Halt exits the process with exit code of n.
+func (e *HaltError) Error() string {
+	return fmt.Sprintf("halt(%d)", e.Code)
+}
+
+// Halt stops the execution with exit code of n. It unwinds the query with *HaltError instead of exiting the process.
 func Halt(_ *VM, n Term, k Cont, env *Env) *Promise {
 	switch code := env.Resolve(n).(type) {
 	case Variable:
 		return Error(InstantiationError(env))
 	case Integer:
-		osExit(int(code))
-		return k(env)
+		return Error(&HaltError{Code: int(code)})
 	default:
 		return Error(typeError(validTypeInteger, n, env))
 	}
@@ -2006,6 +2048,117 @@ func Clause(vm *VM, head, body Term, k Cont, env *Env) *Promise {
 	return Delay(ks...)
 }
 
+// ClauseProperty succeeds iff clause unifies with a clause which has property.
+// The properties are predicate(PI), file(File) and line_count(Line).
+func ClauseProperty(vm *VM, clause, property Term, k Cont, env *Env) *Promise {
+	t := rulify(clause, env)
+	pi, _, err := piArg(t.(Compound).Arg(0), env)
+	if err != nil {
+		return Error(err)
+	}
+
+	u, ok := vm.procedures[pi].(*userDefined)
+	if !ok {
+		return Bool(false)
+	}
+
+	var ks []func(context.Context) *Promise
+	for _, c := range u.clauses {
+		cp, err := renamedCopy(c.raw, nil, env)
+		if err != nil {
+			return Error(err)
+		}
+		r := rulify(cp, env)
+		for _, p := range c.properties() {
+			p := p
+			ks = append(ks, func(context.Context) *Promise {
+				return Unify(vm, tuple(t, property), tuple(r, p), k, env)
+			})
+		}
+	}
+	return Delay(ks...)
+}
+
+// PredicateProperty succeeds iff the procedure of head has property.
+// The properties are built_in, defined, dynamic, static, multifile, discontiguous, tabled, number_of_clauses(N), file(File) and line_count(Line).
+// File and Line are of the first clause.
+func PredicateProperty(vm *VM, head, property Term, k Cont, env *Env) *Promise {
+	var pis []procedureIndicator
+	switch h := env.Resolve(head).(type) {
+	case Variable:
+		for pi := range vm.procedures {
+			pis = append(pis, pi)
+		}
+		sort.Slice(pis, func(i, j int) bool {
+			return pis[i].Compare(pis[j], nil) < 0
+		})
+	case Atom, Compound:
+		pi, _, err := piArg(h, env)
+		if err != nil {
+			return Error(err)
+		}
+		if _, ok := vm.procedures[pi]; !ok {
+			return Bool(false)
+		}
+		pis = []procedureIndicator{pi}
+	default:
+		return Error(typeError(validTypeCallable, head, env))
+	}
+
+	var ks []func(context.Context) *Promise
+	for _, pi := range pis {
+		args := make([]Term, pi.arity)
+		for i := range args {
+			args[i] = NewVariable()
+		}
+		h := pi.name.Apply(args...)
+		for _, p := range procedureProperties(vm.procedures[pi]) {
+			p := p
+			ks = append(ks, func(context.Context) *Promise {
+				return Unify(vm, tuple(head, property), tuple(h, p), k, env)
+			})
+		}
+	}
+	return Delay(ks...)
+}
+
+func procedureProperties(p procedure) []Term {
+	u, ok := p.(*userDefined)
+	if !ok {
+		return []Term{atomBuiltIn, atomDefined, atomStatic}
+	}
+
+	ps := []Term{atomDefined}
+	if u.builtIn {
+		ps = append(ps, atomBuiltIn)
+	}
+	if u.dynamic {
+		ps = append(ps, atomDynamic)
+	} else {
+		ps = append(ps, atomStatic)
+	}
+	if u.multifile {
+		ps = append(ps, atomMultifile)
+	}
+	if u.discontiguous {
+		ps = append(ps, atomDiscontiguous)
+	}
+	if u.tabling != nil {
+		ps = append(ps, atomTabled)
+	}
+	ps = append(ps, atomNumberOfClauses.Apply(Integer(len(u.clauses))))
+	if len(u.clauses) > 0 {
+		c := u.clauses[0]
+		if c.file != "" {
+			ps = append(ps, atomFile.Apply(NewAtom(c.file)))
+		}
+		if c.pos.Line > 0 {
+			ps = append(ps, atomLineCount.Apply(Integer(c.pos.Line)))
+		}
+	}
+	return ps
+}
+
 func rulify(t Term, env *Env) Term {
 	t = env.Resolve(t)
 	if c, ok := t.(Compound); ok && c.Functor() == atomIf && c.Arity() == 2 {
@@ -2611,12 +2764,20 @@ func SetPrologFlag(vm *VM, flag, value Term, k Cont, env *Env) *Promise {
 	case Atom:
 		var modify func(vm *VM, value Atom) error
 		switch f {
-		case atomBounded, atomMaxInteger, atomMinInteger, atomIntegerRoundingFunction, atomMaxArity:
+		case atomBounded, atomMaxInteger, atomMinInteger, atomIntegerRoundingFunction, atomMaxArity, atomArgv:
 			return Error(permissionError(operationModify, permissionTypeFlag, f, env))
+		case atomAnswerWriteOptions:
+			if _, err := vm.answerWriteOptionsOf(value, env); err != nil {
+				return Error(err)
+			}
+			vm.answerWriteOptions = env.Simplify(value)
+			return k(env)
 		case atomCharConversion:
 			modify = modifyCharConversion
 		case atomDebug:
 			modify = modifyDebug
+		case atomDiscontiguous:
+			modify = modifyDiscontiguous
 		case atomUnknown:
 			modify = modifyUnknown
 		case atomDoubleQuotes:
@@ -2656,15 +2817,27 @@ func modifyCharConversion(vm *VM, value Atom) error {
 func modifyDebug(vm *VM, value Atom) error {
 	switch value {
 	case atomOn:
-		vm.debug = true
+		vm.features |= featureDebug
 	case atomOff:
-		vm.debug = false
+		vm.features &^= featureDebug
 	default:
 		return domainError(validDomainFlagValue, atomPlus.Apply(atomDebug, value), nil)
 	}
 	return nil
 }
 
+func modifyDiscontiguous(vm *VM, value Atom) error {
+	switch value {
+	case atomError:
+		vm.discontiguousWarning = false
+	case atomWarning:
+		vm.discontiguousWarning = true
+	default:
+		return domainError(validDomainFlagValue, atomPlus.Apply(atomDiscontiguous, value), nil)
+	}
+	return nil
+}
+
 func modifyUnknown(vm *VM, value Atom) error {
 	switch value {
 	case atomError:
@@ -2700,7 +2873,7 @@ func CurrentPrologFlag(vm *VM, flag, value Term, k Cont, env *Env) *Promise {
 		break
 	case Atom:
 		switch f {
-		case atomBounded, atomMaxInteger, atomMinInteger, atomIntegerRoundingFunction, atomCharConversion, atomDebug, atomMaxArity, atomUnknown, atomDoubleQuotes:
+		case atomBounded, atomMaxInteger, atomMinInteger, atomIntegerRoundingFunction, atomCharConversion, atomDebug, atomDiscontiguous, atomMaxArity, atomUnknown, atomDoubleQuotes, atomArgv, atomAnswerWriteOptions:
 			break
 		default:
 			return Error(domainError(validDomainPrologFlag, f, env))
@@ -2716,10 +2889,13 @@ func CurrentPrologFlag(vm *VM, flag, value Term, k Cont, env *Env) *Promise {
 		tuple(atomMinInteger, minInt),
 		tuple(atomIntegerRoundingFunction, atomTowardZero),
 		tuple(atomCharConversion, onOff(vm.charConvEnabled)),
-		tuple(atomDebug, onOff(vm.debug)),
+		tuple(atomDebug, onOff(vm.features.has(featureDebug))),
+		tuple(atomDiscontiguous, discontiguousFlag(vm.discontiguousWarning)),
 		tuple(atomMaxArity, atomUnbounded),
 		tuple(atomUnknown, NewAtom(vm.unknown.String())),
 		tuple(atomDoubleQuotes, NewAtom(vm.doubleQuotes.String())),
+		tuple(atomArgv, argvList(vm.Argv)),
+		tuple(atomAnswerWriteOptions, vm.answerWriteOptionsFlag()),
 	}
 	ks := make([]func(context.Context) *Promise, len(flags))
 	for i := range flags {
@@ -2731,6 +2907,49 @@ func CurrentPrologFlag(vm *VM, flag, value Term, k Cont, env *Env) *Promise {
 	return Delay(ks...)
 }
 
+// defaultAnswerWriteOptions is the initial value of answer_write_options.
+var defaultAnswerWriteOptions = List(atomQuoted.Apply(atomTrue), atomMaxDepth.Apply(Integer(10)))
+
+func (vm *VM) answerWriteOptionsFlag() Term {
+	if vm.answerWriteOptions == nil {
+		return defaultAnswerWriteOptions
+	}
+	return vm.answerWriteOptions
+}
+
+// answerWriteOptionsOf returns the write options for answers given by the list of write options.
+func (vm *VM) answerWriteOptionsOf(options Term, env *Env) (*WriteOptions, error) {
+	opts := WriteOptions{
+		ops:      vm.operators,
+		priority: 1200,
+	}
+	iter := ListIterator{List: options, Env: env}
+	for iter.Next() {
+		if err := writeTermOption(&opts, iter.Current(), env); err != nil {
+			return nil, err
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+	return &opts, nil
+}
+
+func argvList(argv []string) Term {
+	args := make([]Term, len(argv))
+	for i, a := range argv {
+		args[i] = NewAtom(a)
+	}
+	return List(args...)
+}
+
+func discontiguousFlag(warning bool) Atom {
+	if warning {
+		return atomWarning
+	}
+	return atomError
+}
+
 func onOff(b bool) Atom {
 	if b {
 		return atomOn
@@ -2740,22 +2959,24 @@ func onOff(b bool) Atom {
 
 // ExpandTerm transforms term1 according to term_expansion/2 and DCG rules then unifies with term2.
 func ExpandTerm(vm *VM, term1, term2 Term, k Cont, env *Env) *Promise {
-	t, err := expand(vm, term1, env)
-	if err != nil {
-		return Error(err)
-	}
+	return Delay(func(ctx context.Context) *Promise {
+		t, err := expand(ctx, vm, term1, env)
+		if err != nil {
+			return Error(err)
+		}
 
-	return Unify(vm, t, term2, k, env)
+		return Unify(vm, t, term2, k, env)
+	})
 }
 
-func expand(vm *VM, term Term, env *Env) (Term, error) {
+func expand(ctx context.Context, vm *VM, term Term, env *Env) (Term, error) {
 	if _, ok := vm.procedures[procedureIndicator{name: atomTermExpansion, arity: 2}]; ok {
 		var ret Term
 		v := NewVariable()
 		ok, err := Call(vm, atomTermExpansion.Apply(term, v), func(env *Env) *Promise {
-			ret = env.simplify(v)
+			ret = env.Simplify(v)
 			return Bool(true)
-		}, env).Force(context.Background())
+		}, env).Force(ctx)
 		if err != nil {
 			return nil, err
 		}
@@ -2764,6 +2985,12 @@ func expand(vm *VM, term Term, env *Env) (Term, error) {
 		}
 	}
 
+	if vm.chrEnabled {
+		if t, ok := expandCHR(term, env); ok {
+			return t, nil
+		}
+	}
+
 	t, err := expandDCG(term, env)
 	if err != nil {
 		return term, nil
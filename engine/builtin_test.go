@@ -602,6 +602,7 @@ func TestFunctor(t *testing.T) {
 	a, b := NewVariable(), NewVariable()
 	n := NewVariable()
 	f := NewVariable()
+	d := &dict{compound: compound{functor: atomDictFunctor, args: []Term{NewAtom("t"), NewAtom("a"), Integer(1)}}}
 
 	tests := []struct {
 		title             string
@@ -650,6 +651,8 @@ func TestFunctor(t *testing.T) {
 
 		// https://github.com/ichiban/prolog/issues/226
 		{title: `functor(F, f, max_int).`, term: f, name: NewAtom("f"), arity: maxInt, err: resourceError(resourceMemory, nil)},
+
+		{title: `functor(t{a: 1}, N, A).`, term: d, name: n, arity: NewVariable(), err: typeError(validTypeCompound, d, nil)},
 	}
 
 	for _, tt := range tests {
@@ -681,6 +684,13 @@ func TestArg(t *testing.T) {
 		assert.False(t, ok)
 	})
 
+	t.Run("term is a dict", func(t *testing.T) {
+		d := &dict{compound: compound{functor: atomDictFunctor, args: []Term{NewAtom("t"), NewAtom("a"), Integer(1)}}}
+		ok, err := Arg(nil, Integer(1), d, NewVariable(), Success, nil).Force(context.Background())
+		assert.Equal(t, typeError(validTypeCompound, d, nil), err)
+		assert.False(t, ok)
+	})
+
 	t.Run("nth is a variable", func(t *testing.T) {
 		nth := NewVariable()
 		_, err := Arg(nil, nth, &compound{
@@ -755,6 +765,7 @@ func TestUniv(t *testing.T) {
 	l := NewVariable()
 	a, as := NewVariable(), NewVariable()
 	foo := NewVariable()
+	d := &dict{compound: compound{functor: atomDictFunctor, args: []Term{NewAtom("t"), NewAtom("a"), Integer(1)}}}
 
 	tests := []struct {
 		title      string
@@ -806,6 +817,8 @@ func TestUniv(t *testing.T) {
 			a:  NewAtom("c"),
 			as: List(),
 		}},
+
+		{title: "term is a dict", term: d, list: l, err: typeError(validTypeCompound, d, nil)},
 	}
 
 	for _, tt := range tests {
@@ -3267,7 +3280,7 @@ func TestSetOutput(t *testing.T) {
 }
 
 func TestOpen(t *testing.T) {
-	var vm VM
+	vm := VM{FS: OSFS{}}
 
 	t.Run("read", func(t *testing.T) {
 		f, err := os.CreateTemp("", "open_test_read")
@@ -3565,14 +3578,14 @@ func TestOpen(t *testing.T) {
 	})
 
 	t.Run("sourceSink is a variable", func(t *testing.T) {
-		var vm VM
+		vm := VM{FS: OSFS{}}
 		ok, err := Open(&vm, NewVariable(), atomRead, NewVariable(), List(), Success, nil).Force(context.Background())
 		assert.Equal(t, InstantiationError(nil), err)
 		assert.False(t, ok)
 	})
 
 	t.Run("mode is a variable", func(t *testing.T) {
-		var vm VM
+		vm := VM{FS: OSFS{}}
 		ok, err := Open(&vm, NewAtom("/dev/null"), NewVariable(), NewVariable(), List(), Success, nil).Force(context.Background())
 		assert.Equal(t, InstantiationError(nil), err)
 		assert.False(t, ok)
@@ -3580,7 +3593,7 @@ func TestOpen(t *testing.T) {
 
 	t.Run("options is a partial list or a list with an element E which is a variable", func(t *testing.T) {
 		t.Run("partial list", func(t *testing.T) {
-			var vm VM
+			vm := VM{FS: OSFS{}}
 			ok, err := Open(&vm, NewAtom("/dev/null"), atomRead, NewVariable(), PartialList(NewVariable(),
 				atomType.Apply(atomText),
 				atomAlias.Apply(NewAtom("foo")),
@@ -3590,7 +3603,7 @@ func TestOpen(t *testing.T) {
 		})
 
 		t.Run("variable element", func(t *testing.T) {
-			var vm VM
+			vm := VM{FS: OSFS{}}
 			ok, err := Open(&vm, NewAtom("/dev/null"), atomRead, NewVariable(), List(
 				NewVariable(),
 				&compound{functor: atomType, args: []Term{atomText}},
@@ -3602,42 +3615,42 @@ func TestOpen(t *testing.T) {
 	})
 
 	t.Run("mode is neither a variable nor an atom", func(t *testing.T) {
-		var vm VM
+		vm := VM{FS: OSFS{}}
 		ok, err := Open(&vm, NewAtom("/dev/null"), Integer(0), NewVariable(), List(), Success, nil).Force(context.Background())
 		assert.Equal(t, typeError(validTypeAtom, Integer(0), nil), err)
 		assert.False(t, ok)
 	})
 
 	t.Run("options is neither a partial list nor a list", func(t *testing.T) {
-		var vm VM
+		vm := VM{FS: OSFS{}}
 		ok, err := Open(&vm, NewAtom("/dev/null"), atomRead, NewVariable(), NewAtom("list"), Success, nil).Force(context.Background())
 		assert.Equal(t, typeError(validTypeList, NewAtom("list"), nil), err)
 		assert.False(t, ok)
 	})
 
 	t.Run("stream is not a variable", func(t *testing.T) {
-		var vm VM
+		vm := VM{FS: OSFS{}}
 		ok, err := Open(&vm, NewAtom("/dev/null"), atomRead, NewAtom("stream"), List(), Success, nil).Force(context.Background())
 		assert.Equal(t, InstantiationError(nil), err)
 		assert.False(t, ok)
 	})
 
 	t.Run("sourceSink is neither a variable nor a source/sink", func(t *testing.T) {
-		var vm VM
+		vm := VM{FS: OSFS{}}
 		ok, err := Open(&vm, Integer(0), atomRead, NewVariable(), List(), Success, nil).Force(context.Background())
 		assert.Equal(t, domainError(validDomainSourceSink, Integer(0), nil), err)
 		assert.False(t, ok)
 	})
 
 	t.Run("mode is an atom but not an input/output mode", func(t *testing.T) {
-		var vm VM
+		vm := VM{FS: OSFS{}}
 		ok, err := Open(&vm, NewAtom("/dev/null"), NewAtom("foo"), NewVariable(), List(), Success, nil).Force(context.Background())
 		assert.Equal(t, domainError(validDomainIOMode, NewAtom("foo"), nil), err)
 		assert.False(t, ok)
 	})
 
 	t.Run("an element E of the options list is neither a variable nor a stream-option", func(t *testing.T) {
-		var vm VM
+		vm := VM{FS: OSFS{}}
 		for _, o := range []Term{
 			NewAtom("foo"),
 			&compound{functor: NewAtom("foo"), args: []Term{NewAtom("bar")}},
@@ -3654,7 +3667,7 @@ func TestOpen(t *testing.T) {
 
 	// Derived from 5.5.12 Options in Cor.3
 	t.Run("a component of an element E of the options list is a variable", func(t *testing.T) {
-		var vm VM
+		vm := VM{FS: OSFS{}}
 		for _, o := range []Term{
 			NewVariable(),
 			&compound{functor: atomAlias, args: []Term{NewVariable()}},
@@ -3673,7 +3686,7 @@ func TestOpen(t *testing.T) {
 		assert.NoError(t, err)
 		assert.NoError(t, os.Remove(f.Name()))
 
-		var vm VM
+		vm := VM{FS: OSFS{}}
 		ok, err := Open(&vm, NewAtom(f.Name()), atomRead, NewVariable(), List(), Success, nil).Force(context.Background())
 		assert.Equal(t, existenceError(objectTypeSourceSink, NewAtom(f.Name()), nil), err)
 		assert.False(t, ok)
@@ -3688,7 +3701,7 @@ func TestOpen(t *testing.T) {
 
 		assert.NoError(t, f.Chmod(0200))
 
-		var vm VM
+		vm := VM{FS: OSFS{}}
 		ok, err := Open(&vm, NewAtom(f.Name()), atomRead, NewVariable(), List(), Success, nil).Force(context.Background())
 		assert.Equal(t, permissionError(operationOpen, permissionTypeSourceSink, NewAtom(f.Name()), nil), err)
 		assert.False(t, ok)
@@ -3701,7 +3714,7 @@ func TestOpen(t *testing.T) {
 			assert.NoError(t, os.Remove(f.Name()))
 		}()
 
-		var vm VM
+		vm := VM{FS: OSFS{}}
 		vm.streams.add(&Stream{alias: NewAtom("foo")})
 		ok, err := Open(&vm, NewAtom(f.Name()), atomRead, NewVariable(), List(&compound{
 			functor: atomAlias,
@@ -3722,7 +3735,7 @@ func TestOpen(t *testing.T) {
 			openFile = os.OpenFile
 		}()
 
-		var vm VM
+		vm := VM{FS: OSFS{}}
 		_, err := Open(&vm, NewAtom("foo"), atomRead, NewVariable(), List(), Success, nil).Force(context.Background())
 		assert.Equal(t, errors.New("failed"), err)
 	})
@@ -4663,7 +4676,7 @@ func TestReadTerm(t *testing.T) {
 
 			var vm VM
 			ok, err := ReadTerm(&vm, s, NewVariable(), List(), Success, nil).Force(context.Background())
-			assert.Equal(t, syntaxError(unexpectedTokenError{actual: Token{kind: tokenLetterDigit, val: "bar"}}, nil), err)
+			assert.Equal(t, syntaxError(unexpectedTokenError{actual: Token{kind: TokenLetterDigit, val: "bar"}, pos: Position{Offset: 4, Line: 1, Column: 5}, line: "foo bar "}, nil), err)
 			assert.False(t, ok)
 		})
 
@@ -4699,9 +4712,27 @@ func TestReadTerm(t *testing.T) {
 
 		var vm VM
 		ok, err := ReadTerm(&vm, s, NewVariable(), List(), Success, nil).Force(context.Background())
-		assert.Equal(t, syntaxError(unexpectedTokenError{actual: Token{kind: tokenGraphic, val: "="}}, nil), err)
+		assert.Equal(t, syntaxError(unexpectedTokenError{actual: Token{kind: TokenGraphic, val: "="}, pos: Position{Offset: 2, Line: 1, Column: 3}, line: "X = "}, nil), err)
 		assert.False(t, ok)
 	})
+
+	t.Run("the rest of the line is left for the next read", func(t *testing.T) {
+		s := &Stream{source: strings.NewReader("a b. c.\nd.\n"), mode: ioModeRead}
+
+		var vm VM
+		_, err := ReadTerm(&vm, s, NewVariable(), List(), Success, nil).Force(context.Background())
+		assert.Equal(t, syntaxError(unexpectedTokenError{actual: Token{kind: TokenLetterDigit, val: "b"}, pos: Position{Offset: 2, Line: 1, Column: 3}, line: "a b."}, nil), err)
+
+		for _, want := range []Term{NewAtom("c"), NewAtom("d"), atomEndOfFile} {
+			out := NewVariable()
+			ok, err := ReadTerm(&vm, s, out, List(), func(env *Env) *Promise {
+				assert.Equal(t, want, env.Resolve(out))
+				return Bool(true)
+			}, nil).Force(context.Background())
+			assert.NoError(t, err)
+			assert.True(t, ok)
+		}
+	})
 }
 
 func TestGetByte(t *testing.T) {
@@ -5361,20 +5392,17 @@ func TestPeekChar(t *testing.T) {
 
 func Test_Halt(t *testing.T) {
 	t.Run("ok", func(t *testing.T) {
-		var exitCalled bool
-		osExit = func(code int) {
-			assert.Equal(t, 2, code)
-			exitCalled = true
-		}
-		defer func() {
-			osExit = os.Exit
-		}()
-
 		ok, err := Halt(nil, Integer(2), Success, nil).Force(context.Background())
-		assert.NoError(t, err)
-		assert.True(t, ok)
+		assert.Equal(t, &HaltError{Code: 2}, err)
+		assert.False(t, ok)
+	})
 
-		assert.True(t, exitCalled)
+	t.Run("uncatchable", func(t *testing.T) {
+		var vm VM
+		vm.Register1(NewAtom("halt"), Halt)
+		ok, err := Catch(&vm, NewAtom("halt").Apply(Integer(1)), NewVariable(), NewAtom("halt").Apply(Integer(0)), Success, nil).Force(context.Background())
+		assert.Equal(t, &HaltError{Code: 1}, err)
+		assert.False(t, ok)
 	})
 
 	t.Run("n is a variable", func(t *testing.T) {
@@ -5500,6 +5528,131 @@ func TestClause(t *testing.T) {
 	})
 }
 
+func TestClauseProperty(t *testing.T) {
+	foo := NewAtom("foo")
+	vm := VM{
+		procedures: map[procedureIndicator]procedure{
+			{name: foo, arity: 1}: &userDefined{clauses: []clause{
+				{pi: procedureIndicator{name: foo, arity: 1}, raw: foo.Apply(NewAtom("a")), file: "foo.pl", pos: Position{Offset: 0, Line: 1, Column: 1}},
+				{pi: procedureIndicator{name: foo, arity: 1}, raw: atomIf.Apply(foo.Apply(NewAtom("b")), atomTrue)},
+			}},
+			{name: NewAtom("bar"), arity: 0}: Predicate0(func(_ *VM, k Cont, env *Env) *Promise {
+				return k(env)
+			}),
+		},
+	}
+
+	t.Run("properties", func(t *testing.T) {
+		var ps []Term
+		prop := NewVariable()
+		ok, err := ClauseProperty(&vm, foo.Apply(NewAtom("a")), prop, func(env *Env) *Promise {
+			ps = append(ps, env.Resolve(prop))
+			return Bool(false)
+		}, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.False(t, ok)
+		assert.Equal(t, []Term{
+			atomPredicate.Apply(atomSlash.Apply(foo, Integer(1))),
+			atomFile.Apply(NewAtom("foo.pl")),
+			atomLineCount.Apply(Integer(1)),
+		}, ps)
+	})
+
+	t.Run("rule", func(t *testing.T) {
+		file := NewVariable()
+		ok, err := ClauseProperty(&vm, atomIf.Apply(foo.Apply(NewVariable()), atomTrue), atomFile.Apply(file), func(env *Env) *Promise {
+			assert.Equal(t, NewAtom("foo.pl"), env.Resolve(file))
+			return Bool(true)
+		}, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("no location", func(t *testing.T) {
+		ok, err := ClauseProperty(&vm, foo.Apply(NewAtom("b")), atomFile.Apply(NewVariable()), Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.False(t, ok)
+	})
+
+	t.Run("built-in", func(t *testing.T) {
+		ok, err := ClauseProperty(&vm, NewAtom("bar"), NewVariable(), Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.False(t, ok)
+	})
+
+	t.Run("variable", func(t *testing.T) {
+		_, err := ClauseProperty(&vm, NewVariable(), NewVariable(), Success, nil).Force(context.Background())
+		assert.Equal(t, InstantiationError(nil), err)
+	})
+}
+
+func TestPredicateProperty(t *testing.T) {
+	foo := NewAtom("foo")
+	vm := VM{
+		procedures: map[procedureIndicator]procedure{
+			{name: foo, arity: 1}: &userDefined{dynamic: true, multifile: true, clauses: []clause{
+				{pi: procedureIndicator{name: foo, arity: 1}, raw: foo.Apply(NewAtom("a")), file: "foo.pl", pos: Position{Offset: 10, Line: 2, Column: 1}},
+				{pi: procedureIndicator{name: foo, arity: 1}, raw: foo.Apply(NewAtom("b"))},
+			}},
+			{name: NewAtom("bar"), arity: 0}: Predicate0(func(_ *VM, k Cont, env *Env) *Promise {
+				return k(env)
+			}),
+		},
+	}
+
+	collect := func(head Term) ([]Term, error) {
+		var ps []Term
+		prop := NewVariable()
+		_, err := PredicateProperty(&vm, head, prop, func(env *Env) *Promise {
+			ps = append(ps, env.Resolve(prop))
+			return Bool(false)
+		}, nil).Force(context.Background())
+		return ps, err
+	}
+
+	t.Run("user-defined", func(t *testing.T) {
+		ps, err := collect(foo.Apply(NewVariable()))
+		assert.NoError(t, err)
+		assert.Equal(t, []Term{
+			atomDefined,
+			atomDynamic,
+			atomMultifile,
+			atomNumberOfClauses.Apply(Integer(2)),
+			atomFile.Apply(NewAtom("foo.pl")),
+			atomLineCount.Apply(Integer(2)),
+		}, ps)
+	})
+
+	t.Run("built-in", func(t *testing.T) {
+		ps, err := collect(NewAtom("bar"))
+		assert.NoError(t, err)
+		assert.Equal(t, []Term{atomBuiltIn, atomDefined, atomStatic}, ps)
+	})
+
+	t.Run("unknown", func(t *testing.T) {
+		ps, err := collect(NewAtom("baz"))
+		assert.NoError(t, err)
+		assert.Empty(t, ps)
+	})
+
+	t.Run("enumerate", func(t *testing.T) {
+		var heads []Term
+		head := NewVariable()
+		_, err := PredicateProperty(&vm, head, atomDefined, func(env *Env) *Promise {
+			heads = append(heads, env.Resolve(head))
+			return Bool(false)
+		}, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.Len(t, heads, 2)
+		assert.Equal(t, NewAtom("bar"), heads[0])
+	})
+
+	t.Run("not callable", func(t *testing.T) {
+		_, err := collect(Integer(0))
+		assert.Equal(t, typeError(validTypeCallable, Integer(0), nil), err)
+	})
+}
+
 func TestAtomLength(t *testing.T) {
 	n := NewVariable()
 
@@ -6469,25 +6622,50 @@ func TestSetPrologFlag(t *testing.T) {
 			ok, err := SetPrologFlag(&vm, atomDebug, atomOn, Success, nil).Force(context.Background())
 			assert.NoError(t, err)
 			assert.True(t, ok)
-			assert.True(t, vm.debug)
+			assert.True(t, vm.features.has(featureDebug))
 		})
 
 		t.Run("off", func(t *testing.T) {
-			vm := VM{debug: true}
+			vm := VM{features: featureDebug}
 			ok, err := SetPrologFlag(&vm, atomDebug, atomOff, Success, nil).Force(context.Background())
 			assert.NoError(t, err)
 			assert.True(t, ok)
-			assert.False(t, vm.debug)
+			assert.False(t, vm.features.has(featureDebug))
 		})
 
 		t.Run("unknown", func(t *testing.T) {
-			vm := VM{debug: true}
+			vm := VM{features: featureDebug}
 			ok, err := SetPrologFlag(&vm, atomDebug, NewAtom("foo"), Success, nil).Force(context.Background())
 			assert.Error(t, err)
 			assert.False(t, ok)
 		})
 	})
 
+	t.Run("discontiguous", func(t *testing.T) {
+		t.Run("warning", func(t *testing.T) {
+			var vm VM
+			ok, err := SetPrologFlag(&vm, atomDiscontiguous, atomWarning, Success, nil).Force(context.Background())
+			assert.NoError(t, err)
+			assert.True(t, ok)
+			assert.True(t, vm.discontiguousWarning)
+		})
+
+		t.Run("error", func(t *testing.T) {
+			vm := VM{discontiguousWarning: true}
+			ok, err := SetPrologFlag(&vm, atomDiscontiguous, atomError, Success, nil).Force(context.Background())
+			assert.NoError(t, err)
+			assert.True(t, ok)
+			assert.False(t, vm.discontiguousWarning)
+		})
+
+		t.Run("unknown", func(t *testing.T) {
+			var vm VM
+			ok, err := SetPrologFlag(&vm, atomDiscontiguous, NewAtom("foo"), Success, nil).Force(context.Background())
+			assert.Error(t, err)
+			assert.False(t, ok)
+		})
+	})
+
 	t.Run("max_arity", func(t *testing.T) {
 		var vm VM
 		ok, err := SetPrologFlag(&vm, atomMaxArity, NewVariable(), Success, nil).Force(context.Background())
@@ -6495,6 +6673,38 @@ func TestSetPrologFlag(t *testing.T) {
 		assert.False(t, ok)
 	})
 
+	t.Run("argv", func(t *testing.T) {
+		var vm VM
+		ok, err := SetPrologFlag(&vm, atomArgv, List(), Success, nil).Force(context.Background())
+		assert.Equal(t, permissionError(operationModify, permissionTypeFlag, atomArgv, nil), err)
+		assert.False(t, ok)
+	})
+
+	t.Run("answer_write_options", func(t *testing.T) {
+		t.Run("ok", func(t *testing.T) {
+			var vm VM
+			ok, err := SetPrologFlag(&vm, atomAnswerWriteOptions, List(atomQuoted.Apply(atomFalse)), Success, nil).Force(context.Background())
+			assert.NoError(t, err)
+			assert.True(t, ok)
+			assert.Equal(t, List(atomQuoted.Apply(atomFalse)), vm.answerWriteOptionsFlag())
+		})
+
+		t.Run("invalid option", func(t *testing.T) {
+			var vm VM
+			ok, err := SetPrologFlag(&vm, atomAnswerWriteOptions, List(NewAtom("foo")), Success, nil).Force(context.Background())
+			assert.Equal(t, domainError(validDomainWriteOption, NewAtom("foo"), nil), err)
+			assert.False(t, ok)
+			assert.Equal(t, defaultAnswerWriteOptions, vm.answerWriteOptionsFlag())
+		})
+
+		t.Run("partial list", func(t *testing.T) {
+			var vm VM
+			ok, err := SetPrologFlag(&vm, atomAnswerWriteOptions, PartialList(NewVariable(), atomQuoted.Apply(atomFalse)), Success, nil).Force(context.Background())
+			assert.Equal(t, InstantiationError(nil), err)
+			assert.False(t, ok)
+		})
+	})
+
 	t.Run("unknown", func(t *testing.T) {
 		t.Run("error", func(t *testing.T) {
 			vm := VM{unknown: unknownFail}
@@ -6608,7 +6818,7 @@ func TestSetPrologFlag(t *testing.T) {
 }
 
 func TestCurrentPrologFlag(t *testing.T) {
-	var vm VM
+	vm := VM{Argv: []string{"1pl", "foo"}}
 
 	t.Run("specified", func(t *testing.T) {
 		ok, err := CurrentPrologFlag(&vm, atomBounded, atomTrue, Success, nil).Force(context.Background())
@@ -6635,6 +6845,10 @@ func TestCurrentPrologFlag(t *testing.T) {
 		assert.NoError(t, err)
 		assert.True(t, ok)
 
+		ok, err = CurrentPrologFlag(&vm, atomDiscontiguous, atomError, Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+
 		ok, err = CurrentPrologFlag(&vm, atomMaxArity, atomUnbounded, Success, nil).Force(context.Background())
 		assert.NoError(t, err)
 		assert.True(t, ok)
@@ -6642,6 +6856,10 @@ func TestCurrentPrologFlag(t *testing.T) {
 		ok, err = CurrentPrologFlag(&vm, atomUnknown, atomError, Success, nil).Force(context.Background())
 		assert.NoError(t, err)
 		assert.True(t, ok)
+
+		ok, err = CurrentPrologFlag(&vm, atomArgv, List(NewAtom("1pl"), NewAtom("foo")), Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
 	})
 
 	t.Run("not specified", func(t *testing.T) {
@@ -6668,14 +6886,23 @@ func TestCurrentPrologFlag(t *testing.T) {
 				assert.Equal(t, atomDebug, env.Resolve(flag))
 				assert.Equal(t, atomOff, env.Resolve(value))
 			case 6:
+				assert.Equal(t, atomDiscontiguous, env.Resolve(flag))
+				assert.Equal(t, atomError, env.Resolve(value))
+			case 7:
 				assert.Equal(t, atomMaxArity, env.Resolve(flag))
 				assert.Equal(t, atomUnbounded, env.Resolve(value))
-			case 7:
+			case 8:
 				assert.Equal(t, atomUnknown, env.Resolve(flag))
 				assert.Equal(t, NewAtom(vm.unknown.String()), env.Resolve(value))
-			case 8:
+			case 9:
 				assert.Equal(t, atomDoubleQuotes, env.Resolve(flag))
 				assert.Equal(t, NewAtom(vm.doubleQuotes.String()), env.Resolve(value))
+			case 10:
+				assert.Equal(t, atomArgv, env.Resolve(flag))
+				assert.Equal(t, List(NewAtom("1pl"), NewAtom("foo")), env.Resolve(value))
+			case 11:
+				assert.Equal(t, atomAnswerWriteOptions, env.Resolve(flag))
+				assert.Equal(t, defaultAnswerWriteOptions, env.Resolve(value))
 			default:
 				assert.Fail(t, "unreachable")
 			}
@@ -6684,7 +6911,7 @@ func TestCurrentPrologFlag(t *testing.T) {
 		}, nil).Force(context.Background())
 		assert.NoError(t, err)
 		assert.False(t, ok)
-		assert.Equal(t, 9, c)
+		assert.Equal(t, 12, c)
 	})
 
 	t.Run("flag is neither a variable nor an atom", func(t *testing.T) {
@@ -6747,6 +6974,17 @@ term_expansion(f(X), g(X)).
 			},
 			ok: true,
 		},
+		{
+			title: "terminal sequence: qualified head",
+			in:    atomArrow.Apply(atomColon.Apply(NewAtom("prolog"), atomMessage.Apply(a)), List(b)),
+			out: func() Term {
+				return atomIf.Apply(
+					atomMessage.Apply(a, lastVariable()+1, lastVariable()+3),
+					atomEqual.Apply(lastVariable()+1, PartialList(lastVariable()+3, b)),
+				)
+			},
+			ok: true,
+		},
 		{
 			title: "terminal sequence: variable in head",
 			in:    atomArrow.Apply(x, List(b)),
@@ -0,0 +1,449 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"io"
+)
+
+// varCHR is a special variable bound to the CHR constraint store.
+// Since Env is persistent, backtracking restores the previous constraint store for free.
+var varCHR = NewVariable()
+
+// chrRule is a compiled CHR rule.
+// Simplification rules have only removed heads, propagation rules have only kept heads,
+// and simpagation rules have both.
+type chrRule struct {
+	raw Term // '$chr_rule'(Kept, Removed, Guard, Body)
+
+	// pis is the predicate indicators of the heads so that a constraint tries only the rules which can match it.
+	pis []procedureIndicator
+}
+
+func (r chrRule) mentions(pi procedureIndicator) bool {
+	for _, p := range r.pis {
+		if p == pi {
+			return true
+		}
+	}
+	return false
+}
+
+// chrStore is a set of active CHR constraints along with the propagation history.
+type chrStore struct {
+	next        Integer
+	constraints []chrConstraint
+	history     *chrHistory
+}
+
+type chrConstraint struct {
+	id   Integer
+	term Term
+
+	// key identifies the watch on the variables of term.
+	key Variable
+}
+
+// WriteTerm outputs the chrStore to an io.Writer.
+func (s *chrStore) WriteTerm(w io.Writer, _ *WriteOptions, _ *Env) error {
+	_, err := w.Write([]byte("<chr>"))
+	return err
+}
+
+// Compare compares the chrStore with a Term.
+func (s *chrStore) Compare(t Term, env *Env) int {
+	return CompareAtomic[*chrStore](s, t, func(a, b *chrStore) int {
+		switch {
+		case a == b:
+			return 0
+		case a.next < b.next:
+			return -1
+		default:
+			return 1
+		}
+	}, env)
+}
+
+func chrStoreOf(env *Env) *chrStore {
+	s, ok := env.Resolve(varCHR).(*chrStore)
+	if !ok {
+		return &chrStore{}
+	}
+	return s
+}
+
+func (s *chrStore) add(t Term) (*chrStore, Integer) {
+	ret := *s
+	ret.constraints = make([]chrConstraint, len(s.constraints), len(s.constraints)+1)
+	copy(ret.constraints, s.constraints)
+	ret.next++
+	ret.constraints = append(ret.constraints, chrConstraint{id: ret.next, term: t, key: NewVariable()})
+	return &ret, ret.next
+}
+
+func (s *chrStore) lookup(id Integer) (chrConstraint, bool) {
+	for _, c := range s.constraints {
+		if c.id == id {
+			return c, true
+		}
+	}
+	return chrConstraint{}, false
+}
+
+func (s *chrStore) remove(ids []Integer) *chrStore {
+	ret := *s
+	ret.constraints = make([]chrConstraint, 0, len(s.constraints))
+	for _, c := range s.constraints {
+		removed := false
+		for _, id := range ids {
+			if c.id == id {
+				removed = true
+				break
+			}
+		}
+		if !removed {
+			ret.constraints = append(ret.constraints, c)
+		}
+	}
+	return &ret
+}
+
+func (s *chrStore) fired(key string) bool {
+	return s.history.has(chrHash(key), key)
+}
+
+func (s *chrStore) record(key string) *chrStore {
+	ret := *s
+	ret.history = s.history.with(chrHash(key), key)
+	return &ret
+}
+
+// chrHistory is a persistent binary search tree of the propagation rule applications keyed by their hashes.
+// Since the hashes are scattered, the tree stays shallow without rebalancing and recording one copies only a path.
+type chrHistory struct {
+	hash        uint64
+	key         string
+	left, right *chrHistory
+}
+
+func chrHash(key string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(key))
+	return h.Sum64()
+}
+
+func (h *chrHistory) has(hash uint64, key string) bool {
+	for h != nil {
+		switch {
+		case hash < h.hash:
+			h = h.left
+		case hash > h.hash, key != h.key:
+			h = h.right
+		default:
+			return true
+		}
+	}
+	return false
+}
+
+func (h *chrHistory) with(hash uint64, key string) *chrHistory {
+	if h == nil {
+		return &chrHistory{hash: hash, key: key}
+	}
+	ret := *h
+	if hash < h.hash {
+		ret.left = h.left.with(hash, key)
+	} else {
+		ret.right = h.right.with(hash, key)
+	}
+	return &ret
+}
+
+// chrProcedure is a procedure for a CHR constraint declared by chr_constraint/1.
+// A constraint is activated when it is added and reactivated when any of its variables gets bound.
+type chrProcedure struct {
+	pi procedureIndicator
+}
+
+func (p chrProcedure) call(vm *VM, args []Term, k Cont, env *Env) *Promise {
+	t, err := p.pi.Apply(args...)
+	if err != nil {
+		return Error(err)
+	}
+	s, id := chrStoreOf(env).add(env.Simplify(t))
+	return vm.chrActivate(id, k, env.bind(varCHR, s))
+}
+
+// chrActivate tries the rules for the active constraint identified by id until it's removed or no rules are applicable.
+// Then, the constraint is suspended until any of its variables gets bound.
+func (vm *VM) chrActivate(id Integer, k Cont, env *Env) *Promise {
+	return Delay(func(ctx context.Context) *Promise {
+		s := chrStoreOf(env)
+		c, ok := s.lookup(id)
+		if !ok {
+			return k(env)
+		}
+		pi, _, err := piArg(c.term, env)
+		if err != nil {
+			return Error(err)
+		}
+
+		for i, r := range vm.chrRules {
+			if !r.mentions(pi) {
+				continue
+			}
+
+			f, err := vm.chrTry(ctx, i, r, c, s, env)
+			if err != nil {
+				return Error(err)
+			}
+			if f == nil {
+				continue
+			}
+
+			env := f.env
+			for _, id := range f.removed {
+				c, _ := s.lookup(id)
+				env = vm.watch(c.key, nil, nil, env)
+			}
+			s = s.remove(f.removed)
+			if f.history != "" {
+				s = s.record(f.history)
+			}
+			return Call(vm, f.body, func(env *Env) *Promise {
+				return vm.chrActivate(id, k, env)
+			}, env.bind(varCHR, s))
+		}
+
+		return k(vm.watch(c.key, env.freeVariables(c.term), func(vm *VM, k Cont, env *Env) *Promise {
+			return vm.chrActivate(id, k, env)
+		}, env))
+	})
+}
+
+// chrFiring is a rule application which heads matched and guard succeeded.
+type chrFiring struct {
+	env     *Env
+	removed []Integer
+	history string
+	body    Term
+}
+
+func (vm *VM) chrTry(ctx context.Context, i int, r chrRule, active chrConstraint, s *chrStore, env *Env) (*chrFiring, error) {
+	raw, err := renamedCopy(r.raw, nil, env)
+	if err != nil {
+		return nil, err
+	}
+	rule := raw.(Compound)
+	kept, err := slice(rule.Arg(0), env)
+	if err != nil {
+		return nil, err
+	}
+	removed, err := slice(rule.Arg(1), env)
+	if err != nil {
+		return nil, err
+	}
+	heads := append(kept, removed...)
+
+	// Occurrences are tried from right to left so that removed heads come before kept ones.
+	for j := len(heads) - 1; j >= 0; j-- {
+		env, ok := chrMatch(heads[j], active.term, env)
+		if !ok {
+			continue
+		}
+
+		ids := make([]Integer, len(heads))
+		ids[j] = active.id
+		history := -1
+		if len(removed) == 0 {
+			history = i
+		}
+		f, err := vm.chrPartners(ctx, rule, history, heads, ids, 0, s, env)
+		if err != nil {
+			return nil, err
+		}
+		if f == nil {
+			continue
+		}
+		f.removed = ids[len(kept):]
+		return f, nil
+	}
+	return nil, nil
+}
+
+// chrPartners finds constraints in the store for the heads which are not matched yet and checks the guard.
+// If history is not negative, it's the index of a propagation rule and combinations which already fired are skipped.
+func (vm *VM) chrPartners(ctx context.Context, rule Compound, history int, heads []Term, ids []Integer, n int, s *chrStore, env *Env) (*chrFiring, error) {
+	if n == len(heads) {
+		var key string
+		if history >= 0 {
+			key = fmt.Sprint(history, ids)
+			if s.fired(key) {
+				return nil, nil
+			}
+		}
+		var f *chrFiring
+		ok, err := Call(vm, rule.Arg(2), func(env *Env) *Promise {
+			f = &chrFiring{env: env, history: key, body: rule.Arg(3)}
+			return Bool(true)
+		}, env).Force(ctx)
+		if err != nil || !ok {
+			return nil, err
+		}
+		return f, nil
+	}
+
+	if ids[n] != 0 { // Already matched with the active constraint.
+		return vm.chrPartners(ctx, rule, history, heads, ids, n+1, s, env)
+	}
+
+constraints:
+	for _, c := range s.constraints {
+		for _, id := range ids {
+			if id == c.id {
+				continue constraints
+			}
+		}
+
+		env, ok := chrMatch(heads[n], c.term, env)
+		if !ok {
+			continue
+		}
+		ids[n] = c.id
+		f, err := vm.chrPartners(ctx, rule, history, heads, ids, n+1, s, env)
+		if err != nil || f != nil {
+			return f, err
+		}
+		ids[n] = 0
+	}
+	return nil, nil
+}
+
+// chrMatch matches head with t without instantiating variables in t.
+func chrMatch(head, t Term, env *Env) (*Env, bool) {
+	fvs := env.freeVariables(t)
+	ret, ok := env.Unify(head, t)
+	if !ok {
+		return nil, false
+	}
+	seen := make(map[Variable]struct{}, len(fvs))
+	for _, v := range fvs {
+		r, ok := ret.Resolve(v).(Variable)
+		if !ok {
+			return nil, false
+		}
+		if _, ok := seen[r]; ok {
+			return nil, false
+		}
+		seen[r] = struct{}{}
+	}
+	return ret, true
+}
+
+// FindCHRConstraint succeeds if constraint unifies with a constraint in the CHR constraint store.
+func FindCHRConstraint(vm *VM, constraint Term, k Cont, env *Env) *Promise {
+	s := chrStoreOf(env)
+	ks := make([]func(context.Context) *Promise, len(s.constraints))
+	for i := range s.constraints {
+		c := s.constraints[i]
+		ks[i] = func(context.Context) *Promise {
+			return Unify(vm, constraint, c.term, k, env)
+		}
+	}
+	return Delay(ks...)
+}
+
+// chrConstraints declares CHR constraints indicated by pis.
+func (vm *VM) chrConstraints(pis Term, env *Env) error {
+	vm.chrEnabled = true
+	if vm.procedures == nil {
+		vm.procedures = map[procedureIndicator]procedure{}
+	}
+	iter := anyIterator{Any: pis, Env: env}
+	for iter.Next() {
+		switch pi := env.Resolve(iter.Current()).(type) {
+		case Variable:
+			return InstantiationError(env)
+		case Compound:
+			if pi.Functor() != atomSlash || pi.Arity() != 2 {
+				return typeError(validTypePredicateIndicator, pi, env)
+			}
+			n, ok := env.Resolve(pi.Arg(0)).(Atom)
+			if !ok {
+				return typeError(validTypePredicateIndicator, pi, env)
+			}
+			a, ok := env.Resolve(pi.Arg(1)).(Integer)
+			if !ok {
+				return typeError(validTypePredicateIndicator, pi, env)
+			}
+			key := procedureIndicator{name: n, arity: a}
+			vm.procedures[key] = chrProcedure{pi: key}
+		default:
+			return typeError(validTypePredicateIndicator, pi, env)
+		}
+	}
+	return iter.Err()
+}
+
+// expandCHR translates a CHR rule into a '$chr_rule'/4 directive. If term is not a CHR rule, it reports false.
+func expandCHR(term Term, env *Env) (Term, bool) {
+	rule, ok := env.Resolve(term).(Compound)
+	if !ok || rule.Arity() != 2 {
+		return nil, false
+	}
+	if rule.Functor() == atomAtSign { // Name @ Rule
+		return expandCHR(rule.Arg(1), env)
+	}
+
+	var kept, removed Term
+	switch rule.Functor() {
+	case atomPropagate:
+		kept, removed = rule.Arg(0), atomTrue
+	case atomSimplify:
+		kept, removed = atomTrue, rule.Arg(0)
+		if h, ok := env.Resolve(rule.Arg(0)).(Compound); ok && h.Functor() == atomBackSlash && h.Arity() == 2 {
+			kept, removed = h.Arg(0), h.Arg(1)
+		}
+	default:
+		return nil, false
+	}
+
+	guard, body := Term(atomTrue), rule.Arg(1)
+	if b, ok := env.Resolve(body).(Compound); ok && b.Functor() == atomBar && b.Arity() == 2 {
+		guard, body = b.Arg(0), b.Arg(1)
+	}
+
+	return atomIf.Apply(atomCHRRule.Apply(chrHeads(kept, env), chrHeads(removed, env), guard, body)), true
+}
+
+func chrHeads(t Term, env *Env) Term {
+	if t == atomTrue {
+		return atomEmptyList
+	}
+	var heads []Term
+	iter := seqIterator{Seq: t, Env: env}
+	for iter.Next() {
+		heads = append(heads, iter.Current())
+	}
+	return List(heads...)
+}
+
+func (vm *VM) chrRule(kept, removed, guard, body Term, env *Env) error {
+	var pis []procedureIndicator
+	for _, heads := range []Term{kept, removed} {
+		iter := ListIterator{List: heads, Env: env}
+		for iter.Next() {
+			pi, _, err := piArg(iter.Current(), env)
+			if err != nil {
+				return err
+			}
+			pis = append(pis, pi)
+		}
+		if err := iter.Err(); err != nil {
+			return err
+		}
+	}
+	vm.chrRules = append(vm.chrRules, chrRule{raw: env.Simplify(atomCHRRule.Apply(kept, removed, guard, body)), pis: pis})
+	return nil
+}
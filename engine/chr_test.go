@@ -0,0 +1,187 @@
+package engine
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpandCHR(t *testing.T) {
+	a, b, c, d := NewAtom("a"), NewAtom("b"), NewAtom("c"), NewAtom("d")
+	g := NewAtom("g")
+
+	tests := []struct {
+		title string
+		in    Term
+		out   Term
+		ok    bool
+	}{
+		{
+			title: "simplification",
+			in:    atomSimplify.Apply(atomComma.Apply(a, b), c),
+			out:   atomIf.Apply(atomCHRRule.Apply(List(), List(a, b), atomTrue, c)),
+			ok:    true,
+		},
+		{
+			title: "propagation",
+			in:    atomPropagate.Apply(a, c),
+			out:   atomIf.Apply(atomCHRRule.Apply(List(a), List(), atomTrue, c)),
+			ok:    true,
+		},
+		{
+			title: "simpagation",
+			in:    atomSimplify.Apply(atomBackSlash.Apply(a, b), c),
+			out:   atomIf.Apply(atomCHRRule.Apply(List(a), List(b), atomTrue, c)),
+			ok:    true,
+		},
+		{
+			title: "guard",
+			in:    atomSimplify.Apply(a, atomBar.Apply(g, c)),
+			out:   atomIf.Apply(atomCHRRule.Apply(List(), List(a), g, c)),
+			ok:    true,
+		},
+		{
+			title: "named",
+			in:    atomAtSign.Apply(NewAtom("rule"), atomPropagate.Apply(atomComma.Apply(a, b), atomComma.Apply(c, d))),
+			out:   atomIf.Apply(atomCHRRule.Apply(List(a, b), List(), atomTrue, atomComma.Apply(c, d))),
+			ok:    true,
+		},
+		{title: "not applicable", in: atomIf.Apply(a, b)},
+		{title: "atom", in: a},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			out, ok := expandCHR(tt.in, nil)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.out, out)
+		})
+	}
+}
+
+func TestVM_CHR(t *testing.T) {
+	gcd := NewAtom("gcd")
+	n, m, l := NewVariable(), NewVariable(), NewVariable()
+
+	var vm VM
+	vm.Register0(atomTrue, func(_ *VM, k Cont, env *Env) *Promise {
+		return k(env)
+	})
+	vm.Register1(NewAtom("find_chr_constraint"), FindCHRConstraint)
+	vm.Register2(NewAtom("is"), Is)
+	vm.Register2(atomEqualLessThan, LessThanOrEqual)
+	vm.Register2(atomEqual, Unify)
+	assert.NoError(t, vm.chrConstraints(atomSlash.Apply(gcd, Integer(1)), nil))
+
+	// gcd(0) <=> true.
+	assert.NoError(t, vm.chrRule(List(), List(gcd.Apply(Integer(0))), atomTrue, atomTrue, nil))
+	// gcd(N) \ gcd(M) <=> N =< M | L is M mod N, gcd(L).
+	assert.NoError(t, vm.chrRule(
+		List(gcd.Apply(n)),
+		List(gcd.Apply(m)),
+		atomEqualLessThan.Apply(n, m),
+		atomComma.Apply(NewAtom("is").Apply(l, atomMod.Apply(m, n)), gcd.Apply(l)),
+		nil,
+	))
+
+	t.Run("simpagation", func(t *testing.T) {
+		x := NewVariable()
+		var found []Term
+		ok, err := Call(&vm, seq(atomComma, gcd.Apply(Integer(9)), gcd.Apply(Integer(6)), NewAtom("find_chr_constraint").Apply(gcd.Apply(x))), func(env *Env) *Promise {
+			found = append(found, env.Resolve(x))
+			return Bool(false)
+		}, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.False(t, ok)
+		assert.Equal(t, []Term{Integer(3)}, found)
+	})
+
+	t.Run("woken by unification", func(t *testing.T) {
+		x := NewVariable()
+		ok, err := Call(&vm, seq(atomComma, gcd.Apply(x), atomEqual.Apply(x, Integer(0)), NewAtom("find_chr_constraint").Apply(gcd.Apply(NewVariable()))), Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.False(t, ok)
+
+		ok, err = Call(&vm, seq(atomComma, gcd.Apply(x), atomEqual.Apply(x, Integer(1)), NewAtom("find_chr_constraint").Apply(gcd.Apply(Integer(1)))), Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("propagation", func(t *testing.T) {
+		var vm VM
+		vm.Register0(atomTrue, func(_ *VM, k Cont, env *Env) *Promise {
+			return k(env)
+		})
+		vm.Register1(NewAtom("find_chr_constraint"), FindCHRConstraint)
+		edge, path := NewAtom("edge"), NewAtom("path")
+		x, y, z := NewVariable(), NewVariable(), NewVariable()
+		assert.NoError(t, vm.chrConstraints(List(atomSlash.Apply(edge, Integer(2)), atomSlash.Apply(path, Integer(2))), nil))
+		// path(X, Y) \ path(X, Y) <=> true.
+		assert.NoError(t, vm.chrRule(List(path.Apply(x, y)), List(path.Apply(x, y)), atomTrue, atomTrue, nil))
+		// edge(X, Y) ==> path(X, Y).
+		assert.NoError(t, vm.chrRule(List(edge.Apply(x, y)), List(), atomTrue, path.Apply(x, y), nil))
+		// edge(X, Y), path(Y, Z) ==> path(X, Z).
+		assert.NoError(t, vm.chrRule(List(edge.Apply(x, y), path.Apply(y, z)), List(), atomTrue, path.Apply(x, z), nil))
+
+		a, b, c := NewAtom("a"), NewAtom("b"), NewAtom("c")
+		p, q := NewVariable(), NewVariable()
+		var found [][2]Term
+		ok, err := Call(&vm, seq(atomComma,
+			edge.Apply(a, b),
+			edge.Apply(b, c),
+			edge.Apply(c, a),
+			NewAtom("find_chr_constraint").Apply(path.Apply(p, q)),
+		), func(env *Env) *Promise {
+			found = append(found, [2]Term{env.Resolve(p), env.Resolve(q)})
+			return Bool(false)
+		}, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.False(t, ok)
+		assert.Len(t, found, 9)
+	})
+}
+
+func TestChrHistory(t *testing.T) {
+	var h *chrHistory
+	for _, k := range []string{"0 [1 2]", "0 [2 3]", "1 [1 2]"} {
+		h = h.with(chrHash(k), k)
+	}
+	h2 := h.with(chrHash("0 [1 2]"), "collision")
+
+	assert.True(t, h.has(chrHash("0 [2 3]"), "0 [2 3]"))
+	assert.False(t, h.has(chrHash("1 [2 3]"), "1 [2 3]"))
+	assert.False(t, h.has(chrHash("0 [1 2]"), "collision"))
+	assert.True(t, h2.has(chrHash("0 [1 2]"), "collision"))
+	assert.True(t, h2.has(chrHash("0 [1 2]"), "0 [1 2]"))
+}
+
+func TestVM_chrEnabled(t *testing.T) {
+	var vm VM
+	assert.NoError(t, vm.Compile(context.Background(), `
+<=>(a, b).
+`))
+	_, ok := vm.procedures[procedureIndicator{name: atomSimplify, arity: 2}]
+	assert.True(t, ok)
+	assert.Empty(t, vm.chrRules)
+
+	assert.NoError(t, vm.Compile(context.Background(), `
+:-(chr_constraint('/'(c, 0))).
+<=>(c, true).
+`))
+	assert.Len(t, vm.chrRules, 1)
+}
+
+func TestVM_chrConstraints(t *testing.T) {
+	var vm VM
+	assert.Equal(t, InstantiationError(nil), vm.chrConstraints(NewVariable(), nil))
+	assert.Equal(t, typeError(validTypePredicateIndicator, NewAtom("foo"), nil), vm.chrConstraints(NewAtom("foo"), nil))
+	assert.Equal(t, typeError(validTypePredicateIndicator, atomSlash.Apply(Integer(0), Integer(1)), nil), vm.chrConstraints(atomSlash.Apply(Integer(0), Integer(1)), nil))
+}
+
+func TestVM_chrRule(t *testing.T) {
+	var vm VM
+	assert.Equal(t, InstantiationError(nil), vm.chrRule(List(NewVariable()), List(), atomTrue, atomTrue, nil))
+	assert.Equal(t, typeError(validTypeCallable, Integer(0), nil), vm.chrRule(List(), List(Integer(0)), atomTrue, atomTrue, nil))
+	assert.Empty(t, vm.chrRules)
+}
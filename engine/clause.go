@@ -10,26 +10,56 @@ type userDefined struct {
 	dynamic       bool
 	multifile     bool
 	discontiguous bool
+	tabling       *tabling
+
+	// builtIn is true if the procedure is a part of the system, e.g. defined in the bootstrap program.
+	builtIn bool
+
+	// file is the file which defined the procedure.
+	file string
 
 	// 7.4.3 says "If no clauses are defined for a procedure indicated by a directive ... then the procedure shall exist but have no clauses."
 	clauses
 }
 
+// calls checks if any of the clauses directly calls one of the procedures in pis.
+func (u *userDefined) calls(pis map[procedureIndicator]struct{}) bool {
+	for _, c := range u.clauses {
+		for _, op := range c.bytecode {
+			if op.opcode != opCall {
+				continue
+			}
+			if _, ok := pis[op.operand.(procedureIndicator)]; ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 type clauses []clause
 
 func (cs clauses) call(vm *VM, args []Term, k Cont, env *Env) *Promise {
 	var p *Promise
 	ks := make([]func(context.Context) *Promise, len(cs))
 	for i := range cs {
-		i, c := i, cs[i]
+		// Capture only what's needed rather than the whole clause, which is too big to be captured without an allocation.
+		i, bytecode, n := i, cs[i].bytecode, len(cs[i].vars)
 		ks[i] = func(context.Context) *Promise {
-			vars := make([]Variable, len(c.vars))
+			vars := make([]Variable, n)
 			for i := range vars {
 				vars[i] = NewVariable()
 			}
-			return vm.exec(c.bytecode, vars, k, args, nil, env, p)
+			env := env
+			if vm.BacktraceDepth > 0 {
+				env = enterClause(&cs[i], env)
+			}
+			return vm.exec(bytecode, vars, k, args, nil, env, p)
 		}
 	}
+	if vm.profiler != nil && len(cs) > 1 {
+		vm.profiler.choicePoint(cs[0].pi)
+	}
 	p = Delay(ks...)
 	return p
 }
@@ -52,7 +82,7 @@ func compile(t Term, env *Env) (clauses, error) {
 	}
 
 	c, err := compileClause(t, nil, env)
-	c.raw = env.simplify(t)
+	c.raw = env.Simplify(t)
 	return []clause{c}, err
 }
 
@@ -61,6 +91,26 @@ type clause struct {
 	raw      Term
 	vars     []Variable
 	bytecode bytecode
+
+	// Source location
+	file string
+	pos  Position
+	end  Position
+
+	// goals is where the body goals start if known.
+	goals []Position
+}
+
+// properties returns the properties of the clause for clause_property/2.
+func (c *clause) properties() []Term {
+	ps := []Term{atomPredicate.Apply(c.pi.Term())}
+	if c.file != "" {
+		ps = append(ps, atomFile.Apply(NewAtom(c.file)))
+	}
+	if c.pos.Line > 0 {
+		ps = append(ps, atomLineCount.Apply(Integer(c.pos.Line)))
+	}
+	return ps
 }
 
 func compileClause(head Term, body Term, env *Env) (clause, error) {
@@ -76,7 +126,7 @@ func compileClause(head Term, body Term, env *Env) (clause, error) {
 }
 
 func (c *clause) compileHead(head Term, env *Env) {
-	switch head := env.Resolve(head).(type) {
+	switch head := env.Resolve(unqualify(head, 0, env)).(type) {
 	case Atom:
 		c.pi = procedureIndicator{name: head, arity: 0}
 	case Compound:
@@ -87,6 +137,34 @@ func (c *clause) compileHead(head Term, env *Env) {
 	}
 }
 
+// unqualify strips the module qualification of the hooks prolog:message//1 and user:message_hook/3.
+// Since there are no modules, they define message//1 and message_hook/3.
+// Other heads Module:Head are left intact and define (:)/2.
+// extra is the number of the arguments to be added to head, e.g. 2 for a DCG non-terminal.
+func unqualify(head Term, extra Integer, env *Env) Term {
+	c, ok := env.Resolve(head).(Compound)
+	if !ok || c.Functor() != atomColon || c.Arity() != 2 {
+		return head
+	}
+	m, ok := env.Resolve(c.Arg(0)).(Atom)
+	if !ok {
+		return head
+	}
+	pi, _, err := piArg(c.Arg(1), env)
+	if err != nil {
+		return head
+	}
+	pi.arity += extra
+	switch {
+	case m == atomProlog && pi == procedureIndicator{name: atomMessage, arity: 3}:
+		return c.Arg(1)
+	case m == atomUser && pi == procedureIndicator{name: atomMessageHook, arity: 3}:
+		return c.Arg(1)
+	default:
+		return head
+	}
+}
+
 func (c *clause) compileBody(body Term, env *Env) error {
 	c.bytecode = append(c.bytecode, instruction{opcode: opEnter})
 	iter := seqIterator{Seq: body, Env: env}
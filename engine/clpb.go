@@ -0,0 +1,501 @@
+package engine
+
+import (
+	"context"
+	"io"
+	"math/big"
+	"sort"
+)
+
+// varCLPB is a special variable bound to the conjunction of Boolean constraints posted so far.
+// Since Env is persistent, backtracking restores the previous constraint store for free.
+var varCLPB = NewVariable()
+
+// bdd is a node of a reduced ordered binary decision diagram. Variables are ordered by their ids.
+type bdd struct {
+	v      Variable
+	lo, hi *bdd
+}
+
+var (
+	bddFalse = &bdd{}
+	bddTrue  = &bdd{}
+)
+
+func (n *bdd) terminal() bool {
+	return n == bddFalse || n == bddTrue
+}
+
+// WriteTerm outputs the bdd to an io.Writer.
+func (n *bdd) WriteTerm(w io.Writer, _ *WriteOptions, _ *Env) error {
+	_, err := w.Write([]byte("<clpb>"))
+	return err
+}
+
+// Compare compares the bdd with a Term.
+func (n *bdd) Compare(t Term, env *Env) int {
+	return CompareAtomic[*bdd](n, t, func(a, b *bdd) int {
+		switch {
+		case a == b:
+			return 0
+		case a.v < b.v:
+			return -1
+		default:
+			return 1
+		}
+	}, env)
+}
+
+func (n *bdd) variables() []Variable {
+	var (
+		vs      []Variable
+		visited = map[*bdd]struct{}{}
+		seen    = map[Variable]struct{}{}
+		stack   = []*bdd{n}
+	)
+	for len(stack) > 0 {
+		var m *bdd
+		m, stack = stack[len(stack)-1], stack[:len(stack)-1]
+		if m.terminal() {
+			continue
+		}
+		if _, ok := visited[m]; ok {
+			continue
+		}
+		visited[m] = struct{}{}
+		if _, ok := seen[m.v]; !ok {
+			seen[m.v] = struct{}{}
+			vs = append(vs, m.v)
+		}
+		stack = append(stack, m.lo, m.hi)
+	}
+	sort.Slice(vs, func(i, j int) bool {
+		return vs[i] < vs[j]
+	})
+	return vs
+}
+
+type bddOp uint8
+
+const (
+	bddOpAnd bddOp = iota
+	bddOpOr
+	bddOpXor
+	bddOpEq
+	bddOpImply
+)
+
+func (o bddOp) eval(x, y bool) bool {
+	switch o {
+	case bddOpAnd:
+		return x && y
+	case bddOpOr:
+		return x || y
+	case bddOpXor:
+		return x != y
+	case bddOpEq:
+		return x == y
+	default:
+		return !x || y
+	}
+}
+
+// bddBuilder builds BDDs with a shared unique table so that equivalent nodes are shared.
+type bddBuilder struct {
+	unique map[bdd]*bdd
+	memo   map[bddMemoKey]*bdd
+}
+
+type bddMemoKey struct {
+	op   bddOp
+	x, y *bdd
+}
+
+func newBDDBuilder() *bddBuilder {
+	return &bddBuilder{
+		unique: map[bdd]*bdd{},
+		memo:   map[bddMemoKey]*bdd{},
+	}
+}
+
+func (b *bddBuilder) mk(v Variable, lo, hi *bdd) *bdd {
+	if lo == hi {
+		return lo
+	}
+	k := bdd{v: v, lo: lo, hi: hi}
+	if n, ok := b.unique[k]; ok {
+		return n
+	}
+	n := &k
+	b.unique[k] = n
+	return n
+}
+
+func (b *bddBuilder) variable(v Variable) *bdd {
+	return b.mk(v, bddFalse, bddTrue)
+}
+
+func (b *bddBuilder) apply(op bddOp, x, y *bdd) *bdd {
+	if x.terminal() && y.terminal() {
+		if op.eval(x == bddTrue, y == bddTrue) {
+			return bddTrue
+		}
+		return bddFalse
+	}
+
+	k := bddMemoKey{op: op, x: x, y: y}
+	if n, ok := b.memo[k]; ok {
+		return n
+	}
+
+	var (
+		v                  Variable
+		xlo, xhi, ylo, yhi = x, x, y, y
+	)
+	switch {
+	case x.terminal():
+		v = y.v
+	case y.terminal():
+		v = x.v
+	case x.v < y.v:
+		v = x.v
+	default:
+		v = y.v
+	}
+	if !x.terminal() && x.v == v {
+		xlo, xhi = x.lo, x.hi
+	}
+	if !y.terminal() && y.v == v {
+		ylo, yhi = y.lo, y.hi
+	}
+
+	n := b.mk(v, b.apply(op, xlo, ylo), b.apply(op, xhi, yhi))
+	b.memo[k] = n
+	return n
+}
+
+func (b *bddBuilder) not(x *bdd) *bdd {
+	return b.apply(bddOpXor, x, bddTrue)
+}
+
+// restrict fixes the variable v to val in x.
+func (b *bddBuilder) restrict(x *bdd, v Variable, val bool) *bdd {
+	memo := map[*bdd]*bdd{}
+	var restrict func(*bdd) *bdd
+	restrict = func(x *bdd) *bdd {
+		if x.terminal() || x.v > v {
+			return x
+		}
+		if n, ok := memo[x]; ok {
+			return n
+		}
+		var n *bdd
+		switch {
+		case x.v == v && val:
+			n = x.hi
+		case x.v == v:
+			n = x.lo
+		default:
+			n = b.mk(x.v, restrict(x.lo), restrict(x.hi))
+		}
+		memo[x] = n
+		return n
+	}
+	return restrict(x)
+}
+
+// formula compiles a Boolean expression into a BDD.
+func (b *bddBuilder) formula(t Term, env *Env) (*bdd, error) {
+	switch t := env.Resolve(t).(type) {
+	case Variable:
+		return b.variable(t), nil
+	case Integer:
+		switch t {
+		case 0:
+			return bddFalse, nil
+		case 1:
+			return bddTrue, nil
+		}
+	case Compound:
+		switch t.Arity() {
+		case 1:
+			if t.Functor() != atomTilde {
+				break
+			}
+			x, err := b.formula(t.Arg(0), env)
+			if err != nil {
+				return nil, err
+			}
+			return b.not(x), nil
+		case 2:
+			var (
+				op  bddOp
+				neg bool
+				rev bool
+			)
+			switch t.Functor() {
+			case atomAsterisk:
+				op = bddOpAnd
+			case atomPlus:
+				op = bddOpOr
+			case atomSharp, atomNotEqual:
+				op = bddOpXor
+			case atomEqualColonEqual:
+				op = bddOpEq
+			case atomEqualLessThan:
+				op = bddOpImply
+			case atomGreaterThanEqual:
+				op, rev = bddOpImply, true
+			case atomLessThan: // X < Y iff ~(Y =< X)
+				op, rev, neg = bddOpImply, true, true
+			case atomGreaterThan: // X > Y iff ~(X =< Y)
+				op, neg = bddOpImply, true
+			default:
+				return nil, TypeError(atomBooleanExpression, t, env)
+			}
+			x, err := b.formula(t.Arg(0), env)
+			if err != nil {
+				return nil, err
+			}
+			y, err := b.formula(t.Arg(1), env)
+			if err != nil {
+				return nil, err
+			}
+			if rev {
+				x, y = y, x
+			}
+			n := b.apply(op, x, y)
+			if neg {
+				n = b.not(n)
+			}
+			return n, nil
+		}
+	}
+	return nil, TypeError(atomBooleanExpression, t, env)
+}
+
+// clpbStore returns the current constraint store with the bindings made after posting the constraints taken into account.
+func clpbStore(b *bddBuilder, env *Env) (*bdd, bool) {
+	s, ok := env.Resolve(varCLPB).(*bdd)
+	if !ok {
+		return bddTrue, true
+	}
+	s = b.copy(s)
+	for _, v := range s.variables() {
+		switch t := env.Resolve(v).(type) {
+		case Variable:
+			if t != v { // Aliased with another variable.
+				s = b.apply(bddOpAnd, s, b.apply(bddOpEq, b.variable(v), b.variable(t)))
+			}
+		case Integer:
+			switch t {
+			case 0:
+				s = b.restrict(s, v, false)
+			case 1:
+				s = b.restrict(s, v, true)
+			default:
+				return nil, false
+			}
+		default:
+			return nil, false
+		}
+	}
+	return s, s != bddFalse
+}
+
+// copy rebuilds x with the builder's unique table so that nodes of x are shared with the new ones.
+func (b *bddBuilder) copy(x *bdd) *bdd {
+	memo := map[*bdd]*bdd{}
+	var copy func(*bdd) *bdd
+	copy = func(x *bdd) *bdd {
+		if x.terminal() {
+			return x
+		}
+		if n, ok := memo[x]; ok {
+			return n
+		}
+		n := b.mk(x.v, copy(x.lo), copy(x.hi))
+		memo[x] = n
+		return n
+	}
+	return copy(x)
+}
+
+// Sat posts the Boolean constraint expr. It fails if the constraints become unsatisfiable.
+// Variables which are forced to a single value by the constraints are bound to 0 or 1.
+// When a constrained variable is bound afterwards, the constraints are checked again as sat(1).
+func Sat(vm *VM, expr Term, k Cont, env *Env) *Promise {
+	b := newBDDBuilder()
+	f, err := b.formula(expr, env)
+	if err != nil {
+		return Error(err)
+	}
+
+	s, ok := clpbStore(b, env)
+	if !ok {
+		return Bool(false)
+	}
+
+	s = b.apply(bddOpAnd, s, f)
+	if s == bddFalse {
+		return Bool(false)
+	}
+
+	// Bind the variables which have only one possible value.
+	for _, v := range s.variables() {
+		r, ok := env.Resolve(v).(Variable)
+		if !ok {
+			continue
+		}
+		switch {
+		case b.restrict(s, v, false) == bddFalse:
+			env = env.bind(r, Integer(1))
+			s = b.restrict(s, v, true)
+		case b.restrict(s, v, true) == bddFalse:
+			env = env.bind(r, Integer(0))
+			s = b.restrict(s, v, false)
+		}
+	}
+
+	env = vm.watch(varCLPB, s.variables(), clpbWake, env)
+	return k(env.bind(varCLPB, s))
+}
+
+// clpbWake checks the constraints again with the new bindings.
+func clpbWake(vm *VM, k Cont, env *Env) *Promise {
+	return Sat(vm, Integer(1), k, env)
+}
+
+// Taut succeeds with t = 1 if expr is entailed by the constraints, or t = 0 if its negation is entailed. Otherwise, fails.
+func Taut(vm *VM, expr, t Term, k Cont, env *Env) *Promise {
+	b := newBDDBuilder()
+	f, err := b.formula(expr, env)
+	if err != nil {
+		return Error(err)
+	}
+
+	s, ok := clpbStore(b, env)
+	if !ok {
+		return Bool(false)
+	}
+
+	switch {
+	case b.apply(bddOpAnd, s, b.not(f)) == bddFalse:
+		return Unify(vm, t, Integer(1), k, env)
+	case b.apply(bddOpAnd, s, f) == bddFalse:
+		return Unify(vm, t, Integer(0), k, env)
+	default:
+		return Bool(false)
+	}
+}
+
+// Labeling assigns 0 or 1 to each variable in vs so that all the constraints are satisfied.
+func Labeling(vm *VM, vs Term, k Cont, env *Env) *Promise {
+	var vars []Term
+	iter := ListIterator{List: vs, Env: env}
+	for iter.Next() {
+		switch v := env.Resolve(iter.Current()).(type) {
+		case Variable:
+			vars = append(vars, v)
+		case Integer:
+			if v != 0 && v != 1 {
+				return Error(TypeError(atomBoolean, v, env))
+			}
+		default:
+			return Error(TypeError(atomBoolean, v, env))
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return Error(err)
+	}
+
+	return labeling(vm, vars, k, env)
+}
+
+func labeling(vm *VM, vs []Term, k Cont, env *Env) *Promise {
+	if len(vs) == 0 {
+		return k(env)
+	}
+
+	v, rest := vs[0], vs[1:]
+	if _, ok := env.Resolve(v).(Variable); !ok {
+		return labeling(vm, rest, k, env)
+	}
+
+	next := func(env *Env) *Promise {
+		return labeling(vm, rest, k, env)
+	}
+	return Delay(func(context.Context) *Promise {
+		return Sat(vm, atomEqualColonEqual.Apply(v, Integer(0)), next, env)
+	}, func(context.Context) *Promise {
+		return Sat(vm, atomEqualColonEqual.Apply(v, Integer(1)), next, env)
+	})
+}
+
+// SatCount unifies n with the number of the solutions of expr together with the constraints.
+// The solutions are counted over the unbound variables in expr and the constraints.
+func SatCount(vm *VM, expr, n Term, k Cont, env *Env) *Promise {
+	b := newBDDBuilder()
+	f, err := b.formula(expr, env)
+	if err != nil {
+		return Error(err)
+	}
+
+	s, ok := clpbStore(b, env)
+	if !ok {
+		return Unify(vm, n, Integer(0), k, env)
+	}
+	s = b.apply(bddOpAnd, s, f)
+
+	vs := s.variables()
+	for _, v := range env.freeVariables(expr) {
+		i := sort.Search(len(vs), func(i int) bool {
+			return vs[i] >= v
+		})
+		if i == len(vs) || vs[i] != v {
+			vs = append(vs, 0)
+			copy(vs[i+1:], vs[i:])
+			vs[i] = v
+		}
+	}
+
+	c := bddCount(s, vs)
+	if !c.IsInt64() {
+		return Error(representationError(flagMaxInteger, env))
+	}
+	return Unify(vm, n, Integer(c.Int64()), k, env)
+}
+
+// bddCount counts the satisfying assignments of x over the sorted variables vs.
+func bddCount(x *bdd, vs []Variable) *big.Int {
+	level := func(n *bdd) int {
+		if n.terminal() {
+			return len(vs)
+		}
+		return sort.Search(len(vs), func(i int) bool {
+			return vs[i] >= n.v
+		})
+	}
+
+	memo := map[*bdd]*big.Int{}
+	var count func(*bdd) *big.Int // the number of assignments to the variables from level(n).
+	count = func(n *bdd) *big.Int {
+		switch n {
+		case bddFalse:
+			return big.NewInt(0)
+		case bddTrue:
+			return big.NewInt(1)
+		}
+		if c, ok := memo[n]; ok {
+			return c
+		}
+		l := level(n)
+		lo := new(big.Int).Lsh(count(n.lo), uint(level(n.lo)-l-1))
+		hi := new(big.Int).Lsh(count(n.hi), uint(level(n.hi)-l-1))
+		c := lo.Add(lo, hi)
+		memo[n] = c
+		return c
+	}
+
+	return new(big.Int).Lsh(count(x), uint(level(x)))
+}
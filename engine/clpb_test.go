@@ -0,0 +1,187 @@
+package engine
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSat(t *testing.T) {
+	var vm VM
+	x, y, z := NewVariable(), NewVariable(), NewVariable()
+
+	tests := []struct {
+		title string
+		expr  Term
+		ok    bool
+		err   error
+		env   map[Variable]Term
+	}{
+		{title: "true", expr: Integer(1), ok: true},
+		{title: "false", expr: Integer(0), ok: false},
+		{title: "variable", expr: x, ok: true, env: map[Variable]Term{x: Integer(1)}},
+		{title: "and", expr: atomAsterisk.Apply(x, y), ok: true, env: map[Variable]Term{x: Integer(1), y: Integer(1)}},
+		{title: "or", expr: atomPlus.Apply(x, y), ok: true, env: map[Variable]Term{x: x, y: y}},
+		{title: "not", expr: atomTilde.Apply(x), ok: true, env: map[Variable]Term{x: Integer(0)}},
+		{title: "contradiction", expr: atomAsterisk.Apply(x, atomTilde.Apply(x)), ok: false},
+		{title: "xor", expr: atomSharp.Apply(x, Integer(1)), ok: true, env: map[Variable]Term{x: Integer(0)}},
+		{title: "less than", expr: atomLessThan.Apply(x, y), ok: true, env: map[Variable]Term{x: Integer(0), y: Integer(1)}},
+		{title: "greater than", expr: atomGreaterThan.Apply(x, y), ok: true, env: map[Variable]Term{x: Integer(1), y: Integer(0)}},
+		{title: "implication", expr: atomEqualLessThan.Apply(Integer(1), z), ok: true, env: map[Variable]Term{z: Integer(1)}},
+		{title: "not a boolean", expr: Integer(2), err: TypeError(atomBooleanExpression, Integer(2), nil)},
+		{title: "unknown connective", expr: NewAtom("foo").Apply(Integer(1), Integer(0)), err: TypeError(atomBooleanExpression, NewAtom("foo").Apply(Integer(1), Integer(0)), nil)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			ok, err := Sat(&vm, tt.expr, func(env *Env) *Promise {
+				for v, e := range tt.env {
+					assert.Equal(t, e, env.Resolve(v))
+				}
+				return Bool(true)
+			}, nil).Force(context.Background())
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.err, err)
+		})
+	}
+
+	t.Run("accumulated", func(t *testing.T) {
+		ok, err := Sat(&vm, atomPlus.Apply(x, y), func(env *Env) *Promise {
+			return Sat(&vm, atomTilde.Apply(x), func(env *Env) *Promise {
+				assert.Equal(t, Integer(0), env.Resolve(x))
+				assert.Equal(t, Integer(1), env.Resolve(y))
+				return Bool(true)
+			}, env)
+		}, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("bound by unification", func(t *testing.T) {
+		ok, err := Sat(&vm, atomPlus.Apply(x, y), func(env *Env) *Promise {
+			env = env.bind(x, Integer(0))
+			env = env.bind(y, Integer(0))
+			return Sat(&vm, Integer(1), Success, env)
+		}, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.False(t, ok)
+	})
+
+	t.Run("woken by unification", func(t *testing.T) {
+		var vm VM
+		vm.Register1(NewAtom("sat"), Sat)
+		vm.Register2(atomEqual, Unify)
+		x, y := NewVariable(), NewVariable()
+
+		ok, err := Call(&vm, atomComma.Apply(NewAtom("sat").Apply(atomPlus.Apply(x, y)), atomComma.Apply(atomEqual.Apply(x, Integer(0)), atomEqual.Apply(y, Integer(0)))), Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.False(t, ok)
+
+		ok, err = Call(&vm, atomComma.Apply(NewAtom("sat").Apply(atomPlus.Apply(x, y)), atomEqual.Apply(x, Integer(0))), func(env *Env) *Promise {
+			assert.Equal(t, Integer(1), env.Resolve(y))
+			return Bool(true)
+		}, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+
+		ok, err = Call(&vm, atomComma.Apply(NewAtom("sat").Apply(atomSharp.Apply(x, y)), atomEqual.Apply(x, y)), Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.False(t, ok)
+	})
+}
+
+func TestTaut(t *testing.T) {
+	var vm VM
+	x, y := NewVariable(), NewVariable()
+
+	tests := []struct {
+		title      string
+		constraint Term
+		expr       Term
+		ok         bool
+		t          Term
+	}{
+		{title: "tautology", constraint: Integer(1), expr: atomPlus.Apply(x, atomTilde.Apply(x)), ok: true, t: Integer(1)},
+		{title: "contradiction", constraint: Integer(1), expr: atomAsterisk.Apply(x, atomTilde.Apply(x)), ok: true, t: Integer(0)},
+		{title: "entailed", constraint: atomEqualColonEqual.Apply(x, y), expr: atomEqualLessThan.Apply(x, y), ok: true, t: Integer(1)},
+		{title: "neither", constraint: Integer(1), expr: atomPlus.Apply(x, y), ok: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			v := NewVariable()
+			ok, err := Sat(&vm, tt.constraint, func(env *Env) *Promise {
+				return Taut(&vm, tt.expr, v, func(env *Env) *Promise {
+					assert.Equal(t, tt.t, env.Resolve(v))
+					return Bool(true)
+				}, env)
+			}, nil).Force(context.Background())
+			assert.NoError(t, err)
+			assert.Equal(t, tt.ok, ok)
+		})
+	}
+}
+
+func TestLabeling(t *testing.T) {
+	var vm VM
+	x, y := NewVariable(), NewVariable()
+
+	var solutions [][2]Term
+	ok, err := Sat(&vm, atomSharp.Apply(x, y), func(env *Env) *Promise {
+		return Labeling(&vm, List(x, y), func(env *Env) *Promise {
+			solutions = append(solutions, [2]Term{env.Resolve(x), env.Resolve(y)})
+			return Bool(false)
+		}, env)
+	}, nil).Force(context.Background())
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, [][2]Term{
+		{Integer(0), Integer(1)},
+		{Integer(1), Integer(0)},
+	}, solutions)
+
+	t.Run("not a boolean", func(t *testing.T) {
+		ok, err := Labeling(&vm, List(NewAtom("foo")), Success, nil).Force(context.Background())
+		assert.Equal(t, TypeError(atomBoolean, NewAtom("foo"), nil), err)
+		assert.False(t, ok)
+	})
+
+	t.Run("partial list", func(t *testing.T) {
+		ok, err := Labeling(&vm, PartialList(NewVariable(), x), Success, nil).Force(context.Background())
+		assert.Equal(t, InstantiationError(nil), err)
+		assert.False(t, ok)
+	})
+}
+
+func TestSatCount(t *testing.T) {
+	var vm VM
+	x, y, z := NewVariable(), NewVariable(), NewVariable()
+
+	tests := []struct {
+		title      string
+		constraint Term
+		expr       Term
+		n          Integer
+	}{
+		{title: "or", constraint: Integer(1), expr: atomPlus.Apply(x, y), n: 3},
+		{title: "and", constraint: Integer(1), expr: atomAsterisk.Apply(x, y), n: 1},
+		{title: "skipped variable", constraint: Integer(1), expr: atomPlus.Apply(x, atomAsterisk.Apply(z, atomTilde.Apply(z))), n: 2},
+		{title: "with constraints", constraint: atomSharp.Apply(x, y), expr: atomPlus.Apply(y, z), n: 3},
+		{title: "unsatisfiable", constraint: Integer(1), expr: atomAsterisk.Apply(x, atomTilde.Apply(x)), n: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			n := NewVariable()
+			ok, err := Sat(&vm, tt.constraint, func(env *Env) *Promise {
+				return SatCount(&vm, tt.expr, n, func(env *Env) *Promise {
+					assert.Equal(t, tt.n, env.Resolve(n))
+					return Bool(true)
+				}, env)
+			}, nil).Force(context.Background())
+			assert.NoError(t, err)
+			assert.True(t, ok)
+		})
+	}
+}
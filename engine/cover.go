@@ -0,0 +1,300 @@
+package engine
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+)
+
+// Coverage is the result of coverage measurement.
+type Coverage struct {
+	// Blocks are the clauses loaded from files and their body goals in the order of file and position.
+	Blocks []CoverageBlock
+}
+
+// CoverageBlock is the source range of either the head of a clause or a goal in its body.
+type CoverageBlock struct {
+	File       string
+	Start, End Position
+
+	// Name and Arity are of the procedure which the clause belongs to.
+	Name  Atom
+	Arity int
+
+	// Goal is false for the head of a clause and true for a body goal.
+	Goal bool
+
+	// Count is the number of times the head of the clause was unified or the goal was called.
+	Count int
+}
+
+// Cover calls f while counting how many times each clause is entered and each body goal is called, and returns the result.
+// The result covers all the clauses loaded from files including the ones never entered.
+func (vm *VM) Cover(f func()) *Coverage {
+	c := coverage{counts: map[*instruction]int{}}
+	prev := vm.coverage
+	vm.coverage = &c
+	f()
+	vm.coverage = prev
+	return c.coverage(vm)
+}
+
+// Percent returns the percentage of the blocks which are covered.
+func (c *Coverage) Percent() float64 {
+	if len(c.Blocks) == 0 {
+		return 0
+	}
+	var n int
+	for _, b := range c.Blocks {
+		if b.Count > 0 {
+			n++
+		}
+	}
+	return 100 * float64(n) / float64(len(c.Blocks))
+}
+
+// WriteProfile writes the coverage in the format of `go test -coverprofile` so that it can be processed by the tools for Go.
+// Each block is a statement.
+func (c *Coverage) WriteProfile(w io.Writer) error {
+	ew := errWriter{w: w}
+	_, _ = fmt.Fprint(&ew, "mode: count\n")
+	for _, b := range c.Blocks {
+		_, _ = fmt.Fprintf(&ew, "%s:%d.%d,%d.%d 1 %d\n", b.File, b.Start.Line, b.Start.Column, b.End.Line, b.End.Column, b.Count)
+	}
+	return ew.err
+}
+
+// WriteLCOV writes the coverage in the LCOV tracefile format.
+// Procedures are functions and a line is covered if any block starting on the line is covered.
+func (c *Coverage) WriteLCOV(w io.Writer) error {
+	ew := errWriter{w: w}
+	for i := 0; i < len(c.Blocks); {
+		file := c.Blocks[i].File
+		j := i
+		for j < len(c.Blocks) && c.Blocks[j].File == file {
+			j++
+		}
+		writeLCOVFile(&ew, file, c.Blocks[i:j])
+		i = j
+	}
+	return ew.err
+}
+
+func writeLCOVFile(w io.Writer, file string, blocks []CoverageBlock) {
+	_, _ = fmt.Fprintf(w, "TN:\nSF:%s\n", file)
+
+	var (
+		pis     []procedureIndicator
+		first   = map[procedureIndicator]CoverageBlock{}
+		entered = map[procedureIndicator]int{}
+	)
+	for _, b := range blocks {
+		if b.Goal {
+			continue
+		}
+		pi := procedureIndicator{name: b.Name, arity: Integer(b.Arity)}
+		// A call is counted for each clause whose head it unifies with.
+		entered[pi] += b.Count
+		if _, ok := first[pi]; ok {
+			continue
+		}
+		pis = append(pis, pi)
+		first[pi] = b
+	}
+	var hit int
+	for _, pi := range pis {
+		_, _ = fmt.Fprintf(w, "FN:%d,%s\n", first[pi].Start.Line, pi)
+	}
+	for _, pi := range pis {
+		n := entered[pi]
+		if n > 0 {
+			hit++
+		}
+		_, _ = fmt.Fprintf(w, "FNDA:%d,%s\n", n, pi)
+	}
+	_, _ = fmt.Fprintf(w, "FNF:%d\nFNH:%d\n", len(pis), hit)
+
+	var (
+		lines  []int
+		counts = map[int]int{}
+	)
+	for _, b := range blocks {
+		n, ok := counts[b.Start.Line]
+		if !ok {
+			lines = append(lines, b.Start.Line)
+		}
+		if !ok || b.Count > n {
+			counts[b.Start.Line] = b.Count
+		}
+	}
+	sort.Ints(lines)
+	hit = 0
+	for _, l := range lines {
+		if counts[l] > 0 {
+			hit++
+		}
+		_, _ = fmt.Fprintf(w, "DA:%d,%d\n", l, counts[l])
+	}
+	_, _ = fmt.Fprintf(w, "LF:%d\nLH:%d\nend_of_record\n", len(lines), hit)
+}
+
+type coverage struct {
+	mu sync.Mutex
+
+	// counts is keyed by the instruction right after the head of a clause or the instruction of a body goal.
+	// The instructions are shared among the copies of the clause.
+	counts map[*instruction]int
+}
+
+// covered checks if the instructions of opcode are counted.
+// opEnter and opExit are reached only after the head of the clause is unified.
+func covered(opcode opcode) bool {
+	switch opcode {
+	case opEnter, opExit, opCall, opCut:
+		return true
+	default:
+		return false
+	}
+}
+
+// entry returns the index of the instruction reached when the head of the clause is unified.
+func (cl *clause) entry() int {
+	for i, op := range cl.bytecode {
+		if op.opcode == opEnter || op.opcode == opExit {
+			return i
+		}
+	}
+	return 0
+}
+
+func (c *coverage) hit(i *instruction) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.counts[i]++
+}
+
+func (c *coverage) coverage(vm *VM) *Coverage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var ret Coverage
+	for pi, p := range vm.procedures {
+		u, ok := p.(*userDefined)
+		if !ok || u.builtIn {
+			continue
+		}
+		for i := range u.clauses {
+			if u.clauses[i].file == "" {
+				continue
+			}
+			ret.Blocks = append(ret.Blocks, c.blocks(pi, &u.clauses[i])...)
+		}
+	}
+	sort.SliceStable(ret.Blocks, func(i, j int) bool {
+		bi, bj := ret.Blocks[i], ret.Blocks[j]
+		switch {
+		case bi.File != bj.File:
+			return bi.File < bj.File
+		case bi.Start.Offset != bj.Start.Offset:
+			return bi.Start.Offset < bj.Start.Offset
+		case bi.Goal != bj.Goal:
+			return !bi.Goal
+		default:
+			return bi.End.Offset < bj.End.Offset
+		}
+	})
+	return &ret
+}
+
+// blocks returns the head and the body goals of the clause.
+// If the positions of the goals are unknown, e.g. the clause is made by term expansion, each block spans the whole clause.
+func (c *coverage) blocks(pi procedureIndicator, cl *clause) []CoverageBlock {
+	var goals []int
+	for i, op := range cl.bytecode {
+		if op.opcode == opCall || op.opcode == opCut {
+			goals = append(goals, i)
+		}
+	}
+
+	block := CoverageBlock{
+		File:  cl.file,
+		Start: cl.pos,
+		End:   cl.end,
+		Name:  pi.name,
+		Arity: int(pi.arity),
+	}
+	bs := make([]CoverageBlock, 1, len(goals)+1)
+	bs[0] = block
+	bs[0].Count = c.counts[&cl.bytecode[cl.entry()]]
+	known := len(cl.goals) == len(goals)
+	for i, g := range goals {
+		b := block
+		b.Goal = true
+		b.Count = c.counts[&cl.bytecode[g]]
+		if known {
+			b.Start = cl.goals[i]
+			if i+1 < len(goals) {
+				b.End = cl.goals[i+1]
+			}
+			if i == 0 {
+				bs[0].End = b.Start
+			}
+		}
+		bs = append(bs, b)
+	}
+	return bs
+}
+
+// goalPositions returns where the body goals start for each clause compiled from t in the same order as compile(t, nil).
+// argPos is the positions of the arguments of the operator terms recorded by Parser.
+// If t is not read by Parser, e.g. it's made by term expansion, it returns nil.
+func goalPositions(t Term, argPos map[Term][]Position) [][]Position {
+	c, ok := t.(Compound)
+	if !ok || c.Functor() != atomIf || c.Arity() != 2 {
+		return [][]Position{nil}
+	}
+	ps, ok := argPos[c]
+	if !ok || len(ps) != 2 {
+		return nil
+	}
+	body, pos := c.Arg(1), ps[1]
+	var ret [][]Position
+	for {
+		a, ok := body.(Compound)
+		if !ok || a.Functor() != atomSemiColon || a.Arity() != 2 {
+			return append(ret, seqPositions(body, pos, argPos))
+		}
+		if c, ok := a.Arg(0).(Compound); ok && c.Functor() == atomThen && c.Arity() == 2 {
+			return append(ret, seqPositions(body, pos, argPos))
+		}
+		ps := argPositions(a, pos, argPos)
+		ret = append(ret, seqPositions(a.Arg(0), ps[0], argPos))
+		body, pos = a.Arg(1), ps[1]
+	}
+}
+
+func seqPositions(seq Term, pos Position, argPos map[Term][]Position) []Position {
+	var ret []Position
+	for {
+		c, ok := seq.(Compound)
+		if !ok || c.Functor() != atomComma || c.Arity() != 2 {
+			return append(ret, pos)
+		}
+		ps := argPositions(c, pos, argPos)
+		ret = append(ret, ps[0])
+		seq, pos = c.Arg(1), ps[1]
+	}
+}
+
+// argPositions returns where the arguments of t start. If they're unknown, they're at pos.
+func argPositions(t Compound, pos Position, argPos map[Term][]Position) []Position {
+	if ps, ok := argPos[t]; ok && len(ps) == t.Arity() {
+		return ps
+	}
+	ps := make([]Position, t.Arity())
+	for i := range ps {
+		ps[i] = pos
+	}
+	return ps
+}
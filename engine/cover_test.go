@@ -0,0 +1,145 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestVM_Cover(t *testing.T) {
+	vm := VM{
+		FS: fstest.MapFS{
+			"a.pl": &fstest.MapFile{Data: []byte(`foo(X) :- bar(X), !, baz.
+foo(_).
+bar(a).
+bar(b) :-
+    baz ; qux.
+baz.
+qux.
+`)},
+		},
+	}
+	vm.operators.define(1200, operatorSpecifierXFX, atomIf)
+	vm.operators.define(1200, operatorSpecifierFX, atomIf)
+	vm.operators.define(1100, operatorSpecifierXFY, atomSemiColon)
+	vm.operators.define(1000, operatorSpecifierXFY, atomComma)
+	assert.NoError(t, vm.Compile(context.Background(), `
+:- ensure_loaded(a).
+not_in_file :- foo(b).
+`))
+
+	c := vm.Cover(func() {
+		ok, err := Call(&vm, NewAtom("foo").Apply(NewAtom("b")), Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+	assert.Nil(t, vm.coverage)
+
+	foo, bar, baz, qux := NewAtom("foo"), NewAtom("bar"), NewAtom("baz"), NewAtom("qux")
+	pos := func(offset, line, column int) Position {
+		return Position{Offset: offset, Line: line, Column: column}
+	}
+	assert.Equal(t, &Coverage{Blocks: []CoverageBlock{
+		{File: "a.pl", Start: pos(0, 1, 1), End: pos(10, 1, 11), Name: foo, Arity: 1, Count: 1},
+		{File: "a.pl", Start: pos(10, 1, 11), End: pos(18, 1, 19), Name: foo, Arity: 1, Goal: true, Count: 1},
+		{File: "a.pl", Start: pos(18, 1, 19), End: pos(21, 1, 22), Name: foo, Arity: 1, Goal: true, Count: 1},
+		{File: "a.pl", Start: pos(21, 1, 22), End: pos(24, 1, 25), Name: foo, Arity: 1, Goal: true, Count: 1},
+		{File: "a.pl", Start: pos(26, 2, 1), End: pos(32, 2, 7), Name: foo, Arity: 1},
+		{File: "a.pl", Start: pos(34, 3, 1), End: pos(40, 3, 7), Name: bar, Arity: 1},
+		{File: "a.pl", Start: pos(42, 4, 1), End: pos(56, 5, 5), Name: bar, Arity: 1, Count: 1},
+		{File: "a.pl", Start: pos(42, 4, 1), End: pos(62, 5, 11), Name: bar, Arity: 1},
+		{File: "a.pl", Start: pos(56, 5, 5), End: pos(65, 5, 14), Name: bar, Arity: 1, Goal: true, Count: 1},
+		{File: "a.pl", Start: pos(62, 5, 11), End: pos(65, 5, 14), Name: bar, Arity: 1, Goal: true},
+		{File: "a.pl", Start: pos(67, 6, 1), End: pos(70, 6, 4), Name: baz, Arity: 0, Count: 2},
+		{File: "a.pl", Start: pos(72, 7, 1), End: pos(75, 7, 4), Name: qux, Arity: 0},
+	}}, c)
+	assert.InDelta(t, 58.3, c.Percent(), 0.1)
+
+	t.Run("profile", func(t *testing.T) {
+		var buf bytes.Buffer
+		assert.NoError(t, c.WriteProfile(&buf))
+		assert.Equal(t, `mode: count
+a.pl:1.1,1.11 1 1
+a.pl:1.11,1.19 1 1
+a.pl:1.19,1.22 1 1
+a.pl:1.22,1.25 1 1
+a.pl:2.1,2.7 1 0
+a.pl:3.1,3.7 1 0
+a.pl:4.1,5.5 1 1
+a.pl:4.1,5.11 1 0
+a.pl:5.5,5.14 1 1
+a.pl:5.11,5.14 1 0
+a.pl:6.1,6.4 1 2
+a.pl:7.1,7.4 1 0
+`, buf.String())
+	})
+
+	t.Run("lcov", func(t *testing.T) {
+		var buf bytes.Buffer
+		assert.NoError(t, c.WriteLCOV(&buf))
+		assert.Equal(t, `TN:
+SF:a.pl
+FN:1,foo/1
+FN:3,bar/1
+FN:6,baz/0
+FN:7,qux/0
+FNDA:1,foo/1
+FNDA:1,bar/1
+FNDA:2,baz/0
+FNDA:0,qux/0
+FNF:4
+FNH:3
+DA:1,1
+DA:2,0
+DA:3,0
+DA:4,1
+DA:5,1
+DA:6,2
+DA:7,0
+LF:7
+LH:4
+end_of_record
+`, buf.String())
+	})
+
+	t.Run("write error", func(t *testing.T) {
+		var m mockWriter
+		m.On("Write", mock.Anything).Return(0, errors.New("failed"))
+		assert.Error(t, c.WriteProfile(&m))
+		assert.Error(t, c.WriteLCOV(&m))
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		var c Coverage
+		assert.Equal(t, 0.0, c.Percent())
+	})
+}
+
+func TestVM_Cover_expanded(t *testing.T) {
+	vm := VM{
+		FS: fstest.MapFS{
+			"a.pl": &fstest.MapFile{Data: []byte(`foo --> [a], bar.
+`)},
+		},
+	}
+	vm.operators.define(1200, operatorSpecifierXFX, atomArrow)
+	vm.operators.define(1200, operatorSpecifierFX, atomIf)
+	vm.operators.define(1000, operatorSpecifierXFY, atomComma)
+	assert.NoError(t, vm.Compile(context.Background(), `
+:- ensure_loaded(a).
+`))
+
+	c := vm.Cover(func() {})
+	var buf bytes.Buffer
+	assert.NoError(t, c.WriteProfile(&buf))
+	assert.Equal(t, `mode: count
+a.pl:1.1,1.17 1 0
+a.pl:1.1,1.17 1 0
+a.pl:1.1,1.17 1 0
+`, buf.String())
+}
@@ -56,7 +56,7 @@ func expandDCG(term Term, env *Env) (Term, error) {
 }
 
 func dcgNonTerminal(nonTerminal, list, rest Term, env *Env) (Term, error) {
-	pi, arg, err := piArg(nonTerminal, env)
+	pi, arg, err := piArg(unqualify(nonTerminal, 2, env), env)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,259 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// dict is an associative term Tag{Key1: Value1, Key2: Value2, ...}.
+// It's a compound of which functor is a reserved atom dict and arguments are Tag followed by keys and values ordered by keys.
+type dict struct {
+	compound
+}
+
+// NewDict creates a dict from tag and pairs of keys and values. Keys must be atoms or integers without duplicates.
+func NewDict(tag Term, pairs map[Term]Term) (Term, error) {
+	keys := make([]Term, 0, len(pairs))
+	values := make([]Term, 0, len(pairs))
+	for k, v := range pairs {
+		keys = append(keys, k)
+		values = append(values, v)
+	}
+	d, err := newDict(tag, keys, values, nil)
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func newDict(tag Term, keys, values []Term, env *Env) (*dict, error) {
+	idx := make([]int, len(keys))
+	for i, k := range keys {
+		k, err := dictKey(k, env)
+		if err != nil {
+			return nil, err
+		}
+		keys[i] = k
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(i, j int) bool {
+		return keys[idx[i]].Compare(keys[idx[j]], env) < 0
+	})
+
+	args := make([]Term, 1, 1+2*len(keys))
+	args[0] = tag
+	for n, i := range idx {
+		if n > 0 && keys[idx[n-1]] == keys[i] {
+			return nil, duplicateKeyError(keys[i], env)
+		}
+		args = append(args, keys[i], values[i])
+	}
+	return &dict{compound: compound{functor: atomDictFunctor, args: args}}, nil
+}
+
+func dictKey(k Term, env *Env) (Term, error) {
+	switch k := env.Resolve(k).(type) {
+	case Variable:
+		return nil, InstantiationError(env)
+	case Atom, Integer:
+		return k, nil
+	default:
+		return nil, typeError(validTypeKey, k, env)
+	}
+}
+
+func duplicateKeyError(key Term, env *Env) Exception {
+	return NewException(atomError.Apply(atomDuplicateKey.Apply(key), varContext), env)
+}
+
+// WriteTerm outputs the dict to an io.Writer.
+func (d *dict) WriteTerm(w io.Writer, opts *WriteOptions, env *Env) error {
+	ok, err := writeCompoundVisit(w, d, opts)
+	if err != nil || ok {
+		return err
+	}
+	opts = opts.withVisited(d).withPriority(999).withLeft(operator{}).withRight(operator{})
+
+	ew := errWriter{w: w}
+	_ = d.tag().WriteTerm(&ew, opts, env)
+	_, _ = fmt.Fprint(&ew, "{")
+	for i := 0; i < d.len(); i++ {
+		if i > 0 {
+			_, _ = fmt.Fprint(&ew, ",")
+		}
+		_ = d.key(i).WriteTerm(&ew, opts, env)
+		_, _ = fmt.Fprint(&ew, ":")
+		_ = d.value(i).WriteTerm(&ew, opts, env)
+	}
+	_, _ = fmt.Fprint(&ew, "}")
+	return ew.err
+}
+
+// GoString returns a string representation of the dict.
+func (d *dict) GoString() string {
+	return fmt.Sprintf(`&engine.dict{compound:engine.compound{functor:%#v, args:%#v}}`, d.functor, d.args)
+}
+
+func (d *dict) tag() Term {
+	return d.args[0]
+}
+
+func (d *dict) len() int {
+	return (len(d.args) - 1) / 2
+}
+
+func (d *dict) key(i int) Term {
+	return d.args[1+2*i]
+}
+
+func (d *dict) value(i int) Term {
+	return d.args[2+2*i]
+}
+
+func (d *dict) lookup(key Term, env *Env) (Term, bool) {
+	for i := 0; i < d.len(); i++ {
+		if env.Resolve(d.key(i)) == env.Resolve(key) {
+			return d.value(i), true
+		}
+	}
+	return nil, false
+}
+
+// put returns a new dict which has the key-value pairs of both d and the given keys and values.
+// Values for the existing keys are replaced.
+func (d *dict) put(keys, values []Term, env *Env) (*dict, error) {
+	m := make(map[Term]int, d.len()+len(keys))
+	var ks, vs []Term
+	for i := 0; i < d.len(); i++ {
+		k, err := dictKey(d.key(i), env)
+		if err != nil {
+			return nil, err
+		}
+		m[k] = len(ks)
+		ks = append(ks, k)
+		vs = append(vs, d.value(i))
+	}
+	for i, k := range keys {
+		k, err := dictKey(k, env)
+		if err != nil {
+			return nil, err
+		}
+		if j, ok := m[k]; ok {
+			vs[j] = values[i]
+			continue
+		}
+		m[k] = len(ks)
+		ks = append(ks, k)
+		vs = append(vs, values[i])
+	}
+	return newDict(d.tag(), ks, vs, env)
+}
+
+// GetDict succeeds iff dict has an entry of key and value.
+// If key is unbound, it enumerates the entries on backtracking.
+func GetDict(vm *VM, key, dict, value Term, k Cont, env *Env) *Promise {
+	d, err := dictOf(dict, env)
+	if err != nil {
+		return Error(err)
+	}
+
+	switch key := env.Resolve(key).(type) {
+	case Variable:
+		ks := make([]func(context.Context) *Promise, d.len())
+		for i := range ks {
+			i := i
+			ks[i] = func(context.Context) *Promise {
+				return Unify(vm, tuple(key, value), tuple(d.key(i), d.value(i)), k, env)
+			}
+		}
+		return Delay(ks...)
+	case Atom, Integer:
+		v, ok := d.lookup(key, env)
+		if !ok {
+			return Bool(false)
+		}
+		return Unify(vm, value, v, k, env)
+	default:
+		return Error(typeError(validTypeKey, key, env))
+	}
+}
+
+// PutDict succeeds iff dictOut is dictIn with an entry of key and value added or replaced.
+func PutDict(vm *VM, key, dictIn, value, dictOut Term, k Cont, env *Env) *Promise {
+	d, err := dictOf(dictIn, env)
+	if err != nil {
+		return Error(err)
+	}
+	ret, err := d.put([]Term{key}, []Term{value}, env)
+	if err != nil {
+		return Error(err)
+	}
+	return Unify(vm, dictOut, ret, k, env)
+}
+
+// DictPairs succeeds iff d is a dict of tag and pairs, an ordered list of Key-Value.
+// If d is unbound, it creates a dict from tag and pairs.
+func DictPairs(vm *VM, d, tag, pairs Term, k Cont, env *Env) *Promise {
+	switch d := env.Resolve(d).(type) {
+	case Variable:
+		keys, values, err := dictPairs(pairs, env)
+		if err != nil {
+			return Error(err)
+		}
+		ret, err := newDict(tag, keys, values, env)
+		if err != nil {
+			return Error(err)
+		}
+		return Unify(vm, d, ret, k, env)
+	case *dict:
+		ps := make([]Term, d.len())
+		for i := range ps {
+			ps[i] = pair(d.key(i), d.value(i))
+		}
+		return Unify(vm, tuple(tag, pairs), tuple(d.tag(), List(ps...)), k, env)
+	default:
+		return Error(typeError(validTypeDict, d, env))
+	}
+}
+
+func dictOf(t Term, env *Env) (*dict, error) {
+	switch t := env.Resolve(t).(type) {
+	case Variable:
+		return nil, InstantiationError(env)
+	case *dict:
+		return t, nil
+	default:
+		return nil, typeError(validTypeDict, t, env)
+	}
+}
+
+// dictPairs converts a list of Key-Value, Key=Value, Key:Value, or Key(Value) into keys and values.
+func dictPairs(pairs Term, env *Env) ([]Term, []Term, error) {
+	var keys, values []Term
+	iter := ListIterator{List: pairs, Env: env}
+	for iter.Next() {
+		switch p := env.Resolve(iter.Current()).(type) {
+		case Variable:
+			return nil, nil, InstantiationError(env)
+		case Compound:
+			switch {
+			case p.Arity() == 2 && (p.Functor() == atomMinus || p.Functor() == atomEqual || p.Functor() == atomColon):
+				keys = append(keys, p.Arg(0))
+				values = append(values, p.Arg(1))
+			case p.Arity() == 1:
+				keys = append(keys, p.Functor())
+				values = append(values, p.Arg(0))
+			default:
+				return nil, nil, typeError(validTypePair, p, env)
+			}
+		default:
+			return nil, nil, typeError(validTypePair, p, env)
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return nil, nil, err
+	}
+	return keys, values, nil
+}
@@ -0,0 +1,173 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDict_WriteTerm(t *testing.T) {
+	d, err := newDict(NewAtom("point"), []Term{NewAtom("y"), NewAtom("x")}, []Term{Integer(2), atomPlus.Apply(Integer(1), Integer(1))}, nil)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		title  string
+		term   Term
+		opts   WriteOptions
+		output string
+	}{
+		{title: "dict", term: d, opts: WriteOptions{ops: operators{atomPlus: {operatorClassInfix: {priority: 500, specifier: operatorSpecifierYFX, name: atomPlus}}}}, output: `point{x:1+1,y:2}`},
+		{title: "empty", term: &dict{compound: compound{functor: atomDictFunctor, args: []Term{NewAtom("point")}}}, output: `point{}`},
+		{title: "quoted", term: &dict{compound: compound{functor: atomDictFunctor, args: []Term{NewAtom("a b"), NewAtom("c d"), NewAtom("e f")}}}, opts: WriteOptions{quoted: true}, output: `'a b'{'c d':'e f'}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			var buf bytes.Buffer
+			assert.NoError(t, tt.term.WriteTerm(&buf, &tt.opts, nil))
+			assert.Equal(t, tt.output, buf.String())
+		})
+	}
+}
+
+func TestNewDict(t *testing.T) {
+	d, err := NewDict(NewAtom("t"), map[Term]Term{NewAtom("b"): Integer(2), NewAtom("a"): Integer(1), Integer(0): Integer(0)})
+	assert.NoError(t, err)
+	assert.Equal(t, &dict{compound: compound{functor: atomDictFunctor, args: []Term{NewAtom("t"), Integer(0), Integer(0), NewAtom("a"), Integer(1), NewAtom("b"), Integer(2)}}}, d)
+
+	_, err = NewDict(NewAtom("t"), map[Term]Term{NewVariable(): Integer(0)})
+	assert.Equal(t, InstantiationError(nil), err)
+
+	_, err = NewDict(NewAtom("t"), map[Term]Term{Float(1): Integer(0)})
+	assert.Equal(t, typeError(validTypeKey, Float(1), nil), err)
+
+	assert.Equal(t, &dict{compound: compound{functor: atomDictFunctor, args: []Term{NewAtom("t")}}}, atomDictFunctor.Apply(NewAtom("t")))
+	assert.Equal(t, &compound{functor: atomDict, args: []Term{NewAtom("t")}}, atomDict.Apply(NewAtom("t")))
+}
+
+func TestGetDict(t *testing.T) {
+	d, err := newDict(NewAtom("t"), []Term{NewAtom("a"), NewAtom("b")}, []Term{Integer(1), Integer(2)}, nil)
+	assert.NoError(t, err)
+
+	t.Run("key", func(t *testing.T) {
+		v := NewVariable()
+		ok, err := GetDict(nil, NewAtom("b"), d, v, func(env *Env) *Promise {
+			assert.Equal(t, Integer(2), env.Resolve(v))
+			return Bool(true)
+		}, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("missing key", func(t *testing.T) {
+		ok, err := GetDict(nil, NewAtom("c"), d, NewVariable(), Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.False(t, ok)
+	})
+
+	t.Run("enumerate", func(t *testing.T) {
+		k, v := NewVariable(), NewVariable()
+		var pairs []Term
+		ok, err := GetDict(nil, k, d, v, func(env *Env) *Promise {
+			pairs = append(pairs, pair(env.Resolve(k), env.Resolve(v)))
+			return Bool(false)
+		}, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.False(t, ok)
+		assert.Equal(t, []Term{pair(NewAtom("a"), Integer(1)), pair(NewAtom("b"), Integer(2))}, pairs)
+	})
+
+	t.Run("not a dict", func(t *testing.T) {
+		_, err := GetDict(nil, NewAtom("a"), NewAtom("foo"), NewVariable(), Success, nil).Force(context.Background())
+		assert.Equal(t, typeError(validTypeDict, NewAtom("foo"), nil), err)
+	})
+
+	t.Run("dict is a variable", func(t *testing.T) {
+		_, err := GetDict(nil, NewAtom("a"), NewVariable(), NewVariable(), Success, nil).Force(context.Background())
+		assert.Equal(t, InstantiationError(nil), err)
+	})
+
+	t.Run("invalid key", func(t *testing.T) {
+		_, err := GetDict(nil, Float(1), d, NewVariable(), Success, nil).Force(context.Background())
+		assert.Equal(t, typeError(validTypeKey, Float(1), nil), err)
+	})
+}
+
+func TestPutDict(t *testing.T) {
+	d, err := newDict(NewAtom("t"), []Term{NewAtom("a"), NewAtom("c")}, []Term{Integer(1), Integer(3)}, nil)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		title string
+		key   Term
+		value Term
+		out   Term
+		err   error
+	}{
+		{title: "add", key: NewAtom("b"), value: Integer(2), out: &dict{compound: compound{functor: atomDictFunctor, args: []Term{NewAtom("t"), NewAtom("a"), Integer(1), NewAtom("b"), Integer(2), NewAtom("c"), Integer(3)}}}},
+		{title: "replace", key: NewAtom("a"), value: Integer(0), out: &dict{compound: compound{functor: atomDictFunctor, args: []Term{NewAtom("t"), NewAtom("a"), Integer(0), NewAtom("c"), Integer(3)}}}},
+		{title: "key is a variable", key: NewVariable(), value: Integer(0), err: InstantiationError(nil)},
+		{title: "invalid key", key: Float(1), value: Integer(0), err: typeError(validTypeKey, Float(1), nil)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			out := NewVariable()
+			ok, err := PutDict(nil, tt.key, d, tt.value, out, func(env *Env) *Promise {
+				assert.Equal(t, tt.out, env.Resolve(out))
+				return Bool(true)
+			}, nil).Force(context.Background())
+			assert.Equal(t, tt.err, err)
+			assert.Equal(t, tt.err == nil, ok)
+		})
+	}
+}
+
+func TestDictPairs(t *testing.T) {
+	d, err := newDict(NewAtom("t"), []Term{NewAtom("b"), NewAtom("a")}, []Term{Integer(2), Integer(1)}, nil)
+	assert.NoError(t, err)
+
+	t.Run("decompose", func(t *testing.T) {
+		tag, pairs := NewVariable(), NewVariable()
+		ok, err := DictPairs(nil, d, tag, pairs, func(env *Env) *Promise {
+			assert.Equal(t, NewAtom("t"), env.Resolve(tag))
+			assert.Equal(t, List(pair(NewAtom("a"), Integer(1)), pair(NewAtom("b"), Integer(2))), env.Resolve(pairs))
+			return Bool(true)
+		}, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("compose", func(t *testing.T) {
+		v := NewVariable()
+		ok, err := DictPairs(nil, v, NewAtom("t"), List(
+			pair(NewAtom("b"), Integer(2)),
+			atomEqual.Apply(NewAtom("a"), Integer(1)),
+		), func(env *Env) *Promise {
+			assert.Equal(t, d, env.Resolve(v))
+			return Bool(true)
+		}, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("duplicate key", func(t *testing.T) {
+		_, err := DictPairs(nil, NewVariable(), NewAtom("t"), List(
+			pair(NewAtom("a"), Integer(1)),
+			NewAtom("a").Apply(Integer(2)),
+		), Success, nil).Force(context.Background())
+		assert.Equal(t, duplicateKeyError(NewAtom("a"), nil), err)
+	})
+
+	t.Run("not a pair", func(t *testing.T) {
+		_, err := DictPairs(nil, NewVariable(), NewAtom("t"), List(NewAtom("a")), Success, nil).Force(context.Background())
+		assert.Equal(t, typeError(validTypePair, NewAtom("a"), nil), err)
+	})
+
+	t.Run("not a dict", func(t *testing.T) {
+		_, err := DictPairs(nil, NewAtom("foo"), NewVariable(), NewVariable(), Success, nil).Force(context.Background())
+		assert.Equal(t, typeError(validTypeDict, NewAtom("foo"), nil), err)
+	})
+}
@@ -26,7 +26,12 @@ const (
 // Env is a mapping from variables to terms.
 type Env struct {
 	// basically, this is Red-Black tree from Purely Functional Data Structures by Okazaki.
-	color       color
+	color color
+
+	// size is the number of bindings in the tree. It's only maintained for the root.
+	// It's next to color so that it doesn't make Env any bigger.
+	size int32
+
 	left, right *Env
 	binding
 }
@@ -42,6 +47,7 @@ var rootEnv = &Env{
 		key:   newEnvKey(varContext),
 		value: rootContext,
 	},
+	size: 1,
 }
 
 // NewEnv creates an empty environment.
@@ -80,31 +86,45 @@ func (e *Env) bind(v Variable, t Term) *Env {
 	if node == nil {
 		node = rootEnv
 	}
-	ret := *node.insert(k, t)
+	n, added := node.insert(k, t)
+	ret := *n
 	ret.color = black
+	ret.size = node.size
+	if added {
+		ret.size++
+	}
 	return &ret
 }
 
-func (e *Env) insert(k envKey, v Term) *Env {
+func (e *Env) insert(k envKey, v Term) (*Env, bool) {
 	if e == nil {
-		return &Env{color: red, binding: binding{key: k, value: v}}
+		return &Env{color: red, binding: binding{key: k, value: v}}, true
 	}
+	var added bool
 	switch {
 	case k < e.key:
 		ret := *e
-		ret.left = e.left.insert(k, v)
+		ret.left, added = e.left.insert(k, v)
 		ret.balance()
-		return &ret
+		return &ret, added
 	case k > e.key:
 		ret := *e
-		ret.right = e.right.insert(k, v)
+		ret.right, added = e.right.insert(k, v)
 		ret.balance()
-		return &ret
+		return &ret, added
 	default:
 		ret := *e
 		ret.value = v
-		return &ret
+		return &ret, false
+	}
+}
+
+// len returns the number of bindings in the environment.
+func (e *Env) len() int {
+	if e == nil {
+		return int(rootEnv.size)
 	}
+	return int(e.size)
 }
 
 func (e *Env) balance() {
@@ -190,8 +210,8 @@ func (e *Env) Resolve(t Term) Term {
 	return nil
 }
 
-// simplify trys to remove as many variables as possible from term t.
-func (e *Env) simplify(t Term) Term {
+// Simplify trys to remove as many variables as possible from term t.
+func (e *Env) Simplify(t Term) Term {
 	return simplify(t, nil, e)
 }
 
@@ -220,6 +240,15 @@ func simplify(t Term, simplified map[termID]Compound, env *Env) Term {
 		tail := simplify(*t.tail, simplified, env)
 		p.tail = &tail
 		return &p
+	case *dict:
+		var d dict
+		simplified[id(t)] = &d
+		d.functor = t.functor
+		d.args = make([]Term, len(t.args))
+		for i, a := range t.args {
+			d.args[i] = simplify(a, simplified, env)
+		}
+		return &d
 	case Compound:
 		c := compound{
 			functor: t.Functor(),
@@ -302,6 +331,13 @@ func (e *Env) unify(x, y Term, occursCheck bool) (*Env, bool) {
 		default:
 			return e, false
 		}
+	case *Blob:
+		switch y := y.(type) {
+		case Variable:
+			return e.unify(y, x, occursCheck)
+		default:
+			return e, x.Compare(y, e) == 0
+		}
 	default: // atomic
 		switch y := y.(type) {
 		case Variable:
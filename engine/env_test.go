@@ -24,6 +24,7 @@ func TestEnv_Bind(t *testing.T) {
 			key:   newEnvKey(varContext),
 			value: NewAtom("root"),
 		},
+		size: 2,
 	}, env.bind(a, NewAtom("a")))
 }
 
@@ -60,7 +61,7 @@ func TestEnv_Simplify(t *testing.T) {
 	l := NewVariable()
 	p := PartialList(l, NewAtom("a"), NewAtom("b"))
 	env := NewEnv().bind(l, p)
-	c := env.simplify(l)
+	c := env.Simplify(l)
 	iter := ListIterator{List: c, Env: env}
 	assert.True(t, iter.Next())
 	assert.Equal(t, NewAtom("a"), iter.Current())
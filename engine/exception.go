@@ -7,11 +7,26 @@ import (
 // Exception is an error represented by a prolog term.
 type Exception struct {
 	term Term
+
+	// backtrace is behind a pointer so that Exception stays comparable.
+	backtrace *[]Frame
 }
 
 // NewException creates an Exception from a copy of the given Term.
+// If VM.BacktraceDepth is positive, it also records the active procedure calls in env.
+// The term stays intact and the backtrace is only available through Backtrace.
 func NewException(term Term, env *Env) Exception {
-	c, err := renamedCopy(term, nil, env)
+	copied := map[termID]Term{}
+	e := newException(term, copied, env)
+	if fs := backtrace(copied, env); len(fs) > 0 {
+		e.backtrace = &fs
+	}
+	return e
+}
+
+// newException creates an Exception from a copy of the given Term without a backtrace.
+func newException(term Term, copied map[termID]Term, env *Env) Exception {
+	c, err := renamedCopy(term, copied, env)
 	if err != nil {
 		return err.(Exception) // Must be error(resource_error(memory), _).
 	}
@@ -23,6 +38,15 @@ func (e Exception) Term() Term {
 	return e.term
 }
 
+// Backtrace returns the procedure calls which were active when the Exception was created, from the innermost.
+// It's empty unless VM.BacktraceDepth is positive and the Exception is raised by the system rather than throw/1.
+func (e Exception) Backtrace() []Frame {
+	if e.backtrace == nil {
+		return nil
+	}
+	return *e.backtrace
+}
+
 func (e Exception) Error() string {
 	var buf bytes.Buffer
 	_ = e.term.WriteTerm(&buf, &defaultWriteOptions, nil)
@@ -53,6 +77,8 @@ const (
 	validTypePredicateIndicator
 	validTypePair
 	validTypeFloat
+	validTypeDict
+	validTypeKey
 )
 
 var validTypeAtoms = [...]Atom{
@@ -71,6 +97,8 @@ var validTypeAtoms = [...]Atom{
 	validTypePredicateIndicator: atomPredicateIndicator,
 	validTypePair:               atomPair,
 	validTypeFloat:              atomFloat,
+	validTypeDict:               atomDict,
+	validTypeKey:                atomKey,
 }
 
 // Term returns an Atom for the validType.
@@ -111,6 +139,9 @@ const (
 	validDomainWriteOption
 
 	validDomainOrder
+	validDomainTableMode
+	validDomainPort
+	validDomainTestOption
 )
 
 var validDomainAtoms = [...]Atom{
@@ -132,6 +163,9 @@ var validDomainAtoms = [...]Atom{
 	validDomainStreamProperty:    atomStreamProperty,
 	validDomainWriteOption:       atomWriteOption,
 	validDomainOrder:             atomOrder,
+	validDomainTableMode:         atomTableMode,
+	validDomainPort:              atomPort,
+	validDomainTestOption:        atomTestOption,
 }
 
 // Term returns an Atom for the validDomain.
@@ -156,12 +190,16 @@ const (
 	objectTypeProcedure objectType = iota
 	objectTypeSourceSink
 	objectTypeStream
+	objectTypeUnit
+	objectTypeTest
 )
 
 var objectTypeAtoms = [...]Atom{
 	objectTypeProcedure:  atomProcedure,
 	objectTypeSourceSink: atomSourceSink,
 	objectTypeStream:     atomStream,
+	objectTypeUnit:       atomUnit,
+	objectTypeTest:       atomTest,
 }
 
 // Term returns an Atom for the objectType.
@@ -293,11 +331,21 @@ const (
 	resourceFiniteMemory resource = iota
 
 	resourceMemory
+	resourceInferences
+	resourceDepth
+	resourcePromiseStack
+	resourceTermSize
+	resourceBindings
 )
 
 var resourceAtoms = [...]Atom{
 	resourceFiniteMemory: atomFiniteMemory,
 	resourceMemory:       atomMemory,
+	resourceInferences:   atomInferences,
+	resourceDepth:        atomDepth,
+	resourcePromiseStack: atomPromiseStack,
+	resourceTermSize:     atomTermSize,
+	resourceBindings:     atomBindings,
 }
 
 // Term returns an Atom for the resource.
@@ -0,0 +1,593 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// Format reads Prolog text from r and writes it to w in the standard layout.
+// The text is parsed with the VM's operators and the ones defined by op/3 directives in the text, but the VM itself isn't modified.
+// Clause bodies are written one goal per line indented by 4 spaces, if-then-else and disjunctions are written in blocks,
+// and operators and arguments are spaced consistently. Comments are kept in place and the other tokens are written as they are.
+func (vm *VM) Format(r io.Reader, w io.Writer) error {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	src := string(b)
+
+	f := formatter{
+		w:  errWriter{w: w},
+		vm: VM{doubleQuotes: vm.doubleQuotes, procedures: vm.procedures},
+	}
+	for name, ops := range vm.operators {
+		f.vm.operators.init()
+		f.vm.operators[name] = ops
+	}
+
+	var shebang int
+	if strings.HasPrefix(src, "#!") {
+		shebang = strings.IndexRune(src, '\n')
+		if shebang < 0 {
+			shebang = len(src)
+		}
+		f.write(src[:shebang])
+		f.newline(0)
+		f.line = 1
+		src = strings.Repeat(" ", shebang) + src[shebang:]
+	}
+
+	clauses, rest, err := f.tokens(src)
+	if err != nil {
+		return err
+	}
+
+	p := NewParser(&f.vm, strings.NewReader(src))
+	for _, toks := range clauses {
+		t, err := p.Term()
+		if errors.Is(err, io.EOF) {
+			return fmt.Errorf("%s: %w", toks[len(toks)-1].start, io.ErrUnexpectedEOF)
+		}
+		if err != nil {
+			return err
+		}
+		f.directive(t)
+
+		first := toks[0]
+		toks[0].leading = nil
+		f.comments(first.leading)
+		f.blankLine(first.start.Line)
+		f.toks, f.next = toks, 0
+		f.clause(t)
+
+		end := toks[len(toks)-1]
+		f.line = end.endLine
+		for _, c := range end.trailing {
+			f.line = c.endLine
+		}
+	}
+	f.comments(rest)
+
+	return f.w.err
+}
+
+// formatToken is a token with its location and the comments around it.
+type formatToken struct {
+	Token
+	start   Position
+	endLine int
+
+	// leading is the comments before the token on the preceding lines.
+	leading []formatToken
+
+	// trailing is the comments after the token on the same line.
+	trailing []formatToken
+}
+
+// formatNode is either a control construct which is laid out in lines or a leaf goal which is written in a line.
+type formatNode struct {
+	// functor is either ',', ';', '->', or 0 for leaf goals.
+	functor  Atom
+	op       int
+	lhs, rhs *formatNode
+
+	// start and end are the range of the tokens of a leaf goal.
+	start, end int
+}
+
+// formatRole is how a token is used in a term.
+type formatRole int
+
+const (
+	formatRoleOperand formatRole = iota
+	formatRoleFunctor
+	formatRolePrefix
+	formatRoleInfix
+	formatRolePostfix
+	formatRoleOpen
+	formatRoleClose
+	formatRoleComma
+	formatRoleBar
+)
+
+type formatter struct {
+	w  errWriter
+	vm VM
+
+	// toks is the tokens of the current clause and next is the index of the token to write next.
+	toks []formatToken
+	next int
+
+	// line is the last line of the last item in the source and wrote tells if there's any item written.
+	line  int
+	wrote bool
+
+	col       int
+	lineStart bool
+	last      string
+
+	// pending is the comments to be written at the end of the current line.
+	pending []formatToken
+}
+
+// tokens splits the text into clauses and attaches comments to the tokens. It also returns the comments at the end of the text.
+func (f *formatter) tokens(src string) ([][]formatToken, []formatToken, error) {
+	l := NewLexer(&f.vm, strings.NewReader(src))
+	l.comments = true
+
+	var (
+		clauses [][]formatToken
+		toks    []formatToken
+		leading []formatToken
+	)
+	prev := func() *formatToken {
+		if len(toks) > 0 {
+			return &toks[len(toks)-1]
+		}
+		if len(clauses) > 0 {
+			c := clauses[len(clauses)-1]
+			return &c[len(c)-1]
+		}
+		return nil
+	}
+	for {
+		t, err := l.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		ft := formatToken{Token: t, start: l.Pos(), endLine: l.Pos().Line + strings.Count(t.val, "\n")}
+
+		if t.kind == TokenComment {
+			if p := prev(); p != nil && p.endLine == ft.start.Line {
+				p.trailing = append(p.trailing, ft)
+				continue
+			}
+			leading = append(leading, ft)
+			continue
+		}
+
+		ft.leading, leading = leading, nil
+		toks = append(toks, ft)
+		if t.kind == TokenEnd {
+			clauses = append(clauses, toks)
+			toks = nil
+		}
+	}
+	if len(toks) > 0 {
+		clauses = append(clauses, toks)
+	}
+	return clauses, leading, nil
+}
+
+// directive defines the operators by op/3 and use_module/1 directives so that the following clauses are parsed with them.
+func (f *formatter) directive(t Term) {
+	c, ok := t.(Compound)
+	if !ok || c.Functor() != atomIf || c.Arity() != 1 {
+		return
+	}
+	iter := seqIterator{Seq: c.Arg(0)}
+	for iter.Next() {
+		g, ok := iter.Current().(Compound)
+		switch {
+		case !ok:
+			continue
+		case g.Functor() == atomOp && g.Arity() == 3:
+			_, _ = Op(&f.vm, g.Arg(0), g.Arg(1), g.Arg(2), Success, nil).Force(context.Background())
+		case g.Functor() == atomUseModule && g.Arity() == 1:
+			_, _ = Call(&f.vm, g, Success, nil).Force(context.Background())
+		}
+	}
+}
+
+// comments writes comments between clauses as they are.
+func (f *formatter) comments(cs []formatToken) {
+	for _, c := range cs {
+		f.blankLine(c.start.Line)
+		f.write(c.val)
+		f.newline(0)
+		f.line = c.endLine
+	}
+}
+
+// blankLine writes a blank line if there's one or more blank lines before the line in the source.
+func (f *formatter) blankLine(line int) {
+	if f.wrote && line > f.line+1 {
+		f.newline(0)
+	}
+	f.wrote = true
+}
+
+func (f *formatter) clause(t Term) {
+	end := len(f.toks) - 1
+	if c, ok := t.(Compound); ok {
+		switch {
+		case c.Arity() == 2 && (c.Functor() == atomIf || c.Functor() == atomArrow):
+			neck := f.find(c.Functor(), 0, end)
+			if neck <= 0 {
+				break
+			}
+			f.leaf(0, neck)
+			f.token(neck, " ")
+			f.newline(4)
+			f.goal(f.match(c.Arg(1), neck+1, end), 4)
+			f.token(end, "")
+			f.newline(0)
+			return
+		case c.Arity() == 1 && c.Functor() == atomIf:
+			if a, ok := f.toks[0].Name(); !ok || a != atomIf || f.toks[1].kind == TokenOpenCT {
+				break // In functional notation.
+			}
+			f.token(0, "")
+			f.write(" ")
+			f.goal(f.match(c.Arg(0), 1, end), 3)
+			f.token(end, "")
+			f.newline(0)
+			return
+		}
+	}
+	f.leaf(0, end)
+	f.token(end, "")
+	f.newline(0)
+}
+
+// match finds the tokens of control constructs in t and returns the tree of them.
+func (f *formatter) match(t Term, start, end int) *formatNode {
+	if c, ok := t.(Compound); ok && c.Arity() == 2 {
+		switch c.Functor() {
+		case atomComma, atomSemiColon, atomThen:
+			s, e := start, end
+			for e-s >= 2 && (f.toks[s].kind == TokenOpen || f.toks[s].kind == TokenOpenCT) && f.closeOf(s) == e-1 {
+				s++
+				e--
+			}
+			if op := f.find(c.Functor(), s, e); op >= 0 {
+				return &formatNode{
+					functor: c.Functor(),
+					op:      op,
+					lhs:     f.match(c.Arg(0), s, op),
+					rhs:     f.match(c.Arg(1), op+1, e),
+				}
+			}
+		}
+	}
+	return &formatNode{start: start, end: end}
+}
+
+// find returns the index of the first token of the operator name outside of parentheses, brackets, and braces.
+func (f *formatter) find(name Atom, start, end int) int {
+	var depth int
+	for i := start; i < end; i++ {
+		t := f.toks[i]
+		switch t.kind {
+		case TokenOpen, TokenOpenCT, TokenOpenList, TokenOpenCurly, TokenOpenDict:
+			depth++
+			continue
+		case TokenClose, TokenCloseList, TokenCloseCurly:
+			depth--
+			continue
+		}
+		if depth != 0 {
+			continue
+		}
+		if t.kind == TokenComma {
+			if name == atomComma {
+				return i
+			}
+			continue
+		}
+		if a, ok := t.Name(); ok && a == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// closeOf returns the index of the token which closes the token at i.
+func (f *formatter) closeOf(i int) int {
+	var depth int
+	for j := i; j < len(f.toks); j++ {
+		switch f.toks[j].kind {
+		case TokenOpen, TokenOpenCT, TokenOpenList, TokenOpenCurly, TokenOpenDict:
+			depth++
+		case TokenClose, TokenCloseList, TokenCloseCurly:
+			depth--
+			if depth == 0 {
+				return j
+			}
+		}
+	}
+	return -1
+}
+
+// goal writes n at the current column col.
+func (f *formatter) goal(n *formatNode, col int) {
+	switch n.functor {
+	case atomComma:
+		if n.lhs.functor == atomComma {
+			f.block(n.lhs, col)
+		} else {
+			f.goal(n.lhs, col)
+		}
+		f.token(n.op, "")
+		f.newline(col)
+		f.goal(n.rhs, col)
+	case atomSemiColon, atomThen:
+		f.write("(   ")
+		f.disjunction(n, col)
+		f.newline(col)
+		f.write(")")
+	default:
+		f.leaf(n.start, n.end)
+	}
+}
+
+func (f *formatter) block(n *formatNode, col int) {
+	f.write("(   ")
+	f.goal(n, col+4)
+	f.newline(col)
+	f.write(")")
+}
+
+func (f *formatter) disjunction(n *formatNode, col int) {
+	if n.functor != atomSemiColon {
+		f.ifThen(n, col)
+		return
+	}
+	f.ifThen(n.lhs, col)
+	f.newline(col)
+	f.token(n.op, "")
+	f.write("   ")
+	f.disjunction(n.rhs, col)
+}
+
+func (f *formatter) ifThen(n *formatNode, col int) {
+	if n.functor != atomThen {
+		f.goal(n, col+4)
+		return
+	}
+	f.goal(n.lhs, col+4)
+	f.newline(col)
+	f.token(n.op, "")
+	f.write("  ")
+	f.goal(n.rhs, col+4)
+}
+
+// leaf writes the tokens from start to end in a line.
+func (f *formatter) leaf(start, end int) {
+	var (
+		expect   = true
+		opens    []TokenKind
+		prevRole formatRole
+	)
+	for i := start; i < end; i++ {
+		inList := len(opens) > 0 && opens[len(opens)-1] == TokenOpenList
+		role := f.role(i, end, expect, inList)
+		var sep string
+		if i > start {
+			sep = f.spacing(f.toks[i-1].Token, prevRole, f.toks[i].Token, role)
+		}
+		f.token(i, sep)
+
+		switch role {
+		case formatRoleOpen:
+			opens = append(opens, f.toks[i].kind)
+			expect = true
+		case formatRoleClose:
+			if len(opens) > 0 {
+				opens = opens[:len(opens)-1]
+			}
+			expect = false
+		case formatRoleOperand, formatRolePostfix:
+			expect = false
+		default:
+			expect = true
+		}
+		prevRole = role
+	}
+}
+
+func (f *formatter) role(i, end int, expect, inList bool) formatRole {
+	t := f.toks[i]
+	switch t.kind {
+	case TokenOpen, TokenOpenCT, TokenOpenList, TokenOpenCurly, TokenOpenDict:
+		return formatRoleOpen
+	case TokenClose, TokenCloseList, TokenCloseCurly:
+		return formatRoleClose
+	case TokenComma:
+		return formatRoleComma
+	case TokenBar:
+		switch {
+		case inList:
+			return formatRoleBar
+		case expect:
+			return formatRoleOperand
+		default:
+			return formatRoleInfix
+		}
+	}
+
+	name, ok := t.Name()
+	if !ok {
+		return formatRoleOperand
+	}
+	if i+1 < end && f.toks[i+1].kind == TokenOpenCT {
+		return formatRoleFunctor
+	}
+	if expect {
+		if f.vm.operators.definedInClass(name, operatorClassPrefix) && i+1 < end {
+			switch f.toks[i+1].kind {
+			case TokenClose, TokenCloseList, TokenCloseCurly, TokenComma, TokenBar:
+				return formatRoleOperand
+			}
+			return formatRolePrefix
+		}
+		return formatRoleOperand
+	}
+	switch {
+	case f.vm.operators.definedInClass(name, operatorClassInfix):
+		return formatRoleInfix
+	case f.vm.operators.definedInClass(name, operatorClassPostfix):
+		return formatRolePostfix
+	default:
+		return formatRoleOperand
+	}
+}
+
+// spacing returns the separator between 2 tokens.
+// Infix operators of priority 700 or higher are surrounded by spaces and so are prefix operators followed by them.
+// Arguments and elements are separated by a comma and a space.
+func (f *formatter) spacing(prev Token, prevRole formatRole, cur Token, curRole formatRole) string {
+	switch {
+	case cur.kind == TokenOpenCT:
+		return ""
+	case cur.kind == TokenOpen && prevRole != formatRoleOpen && prevRole != formatRoleComma && prevRole != formatRoleBar:
+		return " " // Otherwise, it'd be read as a functional notation or a mismatch.
+	case prevRole == formatRoleOpen, curRole == formatRoleClose, curRole == formatRoleComma, curRole == formatRoleBar, prevRole == formatRoleBar:
+		return ""
+	case prevRole == formatRoleComma:
+		return " "
+	case curRole == formatRoleInfix:
+		if f.spaced(cur, operatorClassInfix) {
+			return " "
+		}
+		return ""
+	case prevRole == formatRoleInfix:
+		if f.spaced(prev, operatorClassInfix) {
+			return " "
+		}
+		return ""
+	case prevRole == formatRolePrefix:
+		if f.spaced(prev, operatorClassPrefix) {
+			return " "
+		}
+		return ""
+	case curRole == formatRolePostfix, prevRole == formatRoleFunctor:
+		return ""
+	default:
+		return " "
+	}
+}
+
+func (f *formatter) spaced(t Token, class operatorClass) bool {
+	if t.kind == TokenBar {
+		return true
+	}
+	name, _ := t.Name()
+	return letterDigit(name) || f.vm.operators[name][class].priority >= 700
+}
+
+// token writes the token at i after sep and the comments before it.
+func (f *formatter) token(i int, sep string) {
+	var leading []formatToken
+	for ; f.next < i; f.next++ {
+		t := f.toks[f.next]
+		leading = append(leading, t.leading...)
+		f.pending = append(f.pending, t.trailing...)
+	}
+	t := f.toks[i]
+	leading = append(leading, t.leading...)
+	for _, c := range leading {
+		inline := strings.HasPrefix(c.val, "/*") && c.start.Line == c.endLine
+		switch {
+		case f.lineStart && !(inline && c.endLine == t.start.Line):
+			f.write(c.val)
+			f.newline(f.col)
+		case inline:
+			f.separate(sep, c.val)
+			sep = " "
+		default:
+			f.pending = append(f.pending, c)
+		}
+	}
+	f.separate(sep, t.val)
+	f.pending = append(f.pending, t.trailing...)
+	f.next = i + 1
+}
+
+// separate writes s after sep or a space if s would be glued to the last token otherwise.
+func (f *formatter) separate(sep, s string) {
+	if sep == "" && glued(f.last, s) {
+		sep = " "
+	}
+	f.write(sep + s)
+}
+
+func glued(prev, next string) bool {
+	if prev == "" || next == "" {
+		return false
+	}
+	p, _ := utf8.DecodeLastRuneInString(prev)
+	n, _ := utf8.DecodeRuneInString(next)
+	graphic := func(r rune) bool {
+		return isGraphicChar(r) || r == '\\'
+	}
+	switch {
+	case isAlphanumericChar(p) && isAlphanumericChar(n):
+		return true
+	case graphic(p) && graphic(n):
+		return true
+	case isMetaChar(p) && p == n:
+		return true
+	case isDecimalDigitChar(p) && n == '\'':
+		return true
+	default:
+		return false
+	}
+}
+
+func (f *formatter) write(s string) {
+	if s == "" {
+		return
+	}
+	_, _ = f.w.Write([]byte(s))
+	f.last = s
+	f.lineStart = false
+}
+
+// newline ends the current line with the pending comments and indents the next line by col.
+// The comments which don't fit in the current line are written in their own lines indented by col.
+func (f *formatter) newline(col int) {
+	for i, c := range f.pending {
+		switch {
+		case i == 0:
+			f.write("  ")
+		case strings.HasPrefix(f.pending[i-1].val, "%"):
+			f.write("\n" + strings.Repeat(" ", col))
+		default:
+			f.write(" ")
+		}
+		f.write(c.val)
+	}
+	f.pending = f.pending[:0]
+	f.write("\n" + strings.Repeat(" ", col))
+	f.last = ""
+	f.col = col
+	f.lineStart = true
+}
@@ -0,0 +1,165 @@
+package engine
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestVM_Format(t *testing.T) {
+	var vm VM
+	for _, o := range []struct {
+		priority  Integer
+		specifier operatorSpecifier
+		name      string
+	}{
+		{priority: 1200, specifier: operatorSpecifierXFX, name: `:-`},
+		{priority: 1200, specifier: operatorSpecifierXFX, name: `-->`},
+		{priority: 1200, specifier: operatorSpecifierFX, name: `:-`},
+		{priority: 1150, specifier: operatorSpecifierFX, name: `dynamic`},
+		{priority: 1105, specifier: operatorSpecifierXFY, name: `|`},
+		{priority: 1100, specifier: operatorSpecifierXFY, name: `;`},
+		{priority: 1050, specifier: operatorSpecifierXFY, name: `->`},
+		{priority: 1000, specifier: operatorSpecifierXFY, name: `,`},
+		{priority: 900, specifier: operatorSpecifierFY, name: `\+`},
+		{priority: 700, specifier: operatorSpecifierXFX, name: `=`},
+		{priority: 700, specifier: operatorSpecifierXFX, name: `>`},
+		{priority: 700, specifier: operatorSpecifierXFX, name: `is`},
+		{priority: 500, specifier: operatorSpecifierYFX, name: `+`},
+		{priority: 500, specifier: operatorSpecifierYFX, name: `-`},
+		{priority: 400, specifier: operatorSpecifierYFX, name: `/`},
+		{priority: 400, specifier: operatorSpecifierYFX, name: `mod`},
+		{priority: 200, specifier: operatorSpecifierFY, name: `-`},
+	} {
+		vm.operators.define(o.priority, o.specifier, NewAtom(o.name))
+	}
+	vm.Register1(atomUseModule, func(vm *VM, _ Term, k Cont, env *Env) *Promise {
+		return Op(vm, Integer(500), atomYFX, atomSharp, k, env)
+	})
+
+	tests := []struct {
+		title  string
+		input  string
+		output string
+		err    string
+	}{
+		{title: "empty", input: "", output: ""},
+		{title: "fact", input: "foo( a,'b c' ,[1 , 2|T],\"str\" ,0'a).", output: "foo(a, 'b c', [1, 2|T], \"str\", 0'a).\n"},
+		{title: "rule", input: "foo(X):-X>0,Y is X mod 2+X/3,bar(Y).", output: `foo(X) :-
+    X > 0,
+    Y is X mod 2+X/3,
+    bar(Y).
+`},
+		{title: "if-then-else", input: "foo(X) :- (X = 1 -> a ; X = 2 -> (b -> c ; d) ; e), f.", output: `foo(X) :-
+    (   X = 1
+    ->  a
+    ;   X = 2
+    ->  (   b
+        ->  c
+        ;   d
+        )
+    ;   e
+    ),
+    f.
+`},
+		{title: "if-then", input: "foo :- (a -> b).", output: `foo :-
+    (   a
+    ->  b
+    ).
+`},
+		{title: "nested conjunction", input: "foo :- (a, b), c.", output: `foo :-
+    (   a,
+        b
+    ),
+    c.
+`},
+		{title: "directive", input: ":- dynamic foo/1, bar/2.\n:- a,b.", output: `:- dynamic foo/1, bar/2.
+:- a,
+   b.
+`},
+		{title: "grammar rule", input: "greeting --> [hello], ( name ; [] ), {true}.", output: `greeting -->
+    [hello],
+    (   name
+    ;   []
+    ),
+    {true}.
+`},
+		{title: "op directive", input: ":- op(700, xfx, ===>).\nfoo(X, Y) :- X===>Y.", output: `:- op(700, xfx, ===>).
+foo(X, Y) :-
+    X ===> Y.
+`},
+		{title: "use_module directive", input: ":- use_module(library(clpb)).\nfoo(X, Y) :- sat(X#Y).", output: `:- use_module(library(clpb)).
+foo(X, Y) :-
+    sat(X#Y).
+`},
+		{title: "prefix operators", input: "foo :- \\+bar, X = - 1, Y = -(1), Z = - (1), W = -X, V = a- -1.", output: `foo :-
+    \+ bar,
+    X = -1,
+    Y = -(1),
+    Z = - (1),
+    W = -X,
+    V = a- -1.
+`},
+		{title: "operators as atoms", input: "foo(-, [-], (a :- b), f(- , +)).", output: "foo(-, [-], (a :- b), f(-, +)).\n"},
+		{title: "blank lines", input: "a.\n\n\n\nb.\nc. d.\n", output: "a.\n\nb.\nc.\nd.\n"},
+		{title: "comments", input: `% Header.
+
+/* Block
+   comment. */
+foo :- % head
+  % leading
+  a, % after a
+  /* inline */ b,
+  c
+  % before the end
+  . % trailing
+% EOF`, output: `% Header.
+
+/* Block
+   comment. */
+foo :-  % head
+    % leading
+    a,  % after a
+    /* inline */ b,
+    c.  % before the end
+% trailing
+% EOF
+`},
+		{title: "shebang", input: "#!/usr/bin/env 1pl\nmain:-true.\n", output: "#!/usr/bin/env 1pl\nmain :-\n    true.\n"},
+		{title: "syntax error", input: "foo(.", err: "1:5: unexpected token: end(.)\nfoo(.\n    ^"},
+		{title: "incomplete", input: "foo :- bar", err: "1:8: unexpected EOF"},
+		{title: "unterminated quote", input: "foo('a).", err: "1:4: unexpected EOF"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := vm.Format(strings.NewReader(tt.input), &buf)
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.output, buf.String())
+
+			var again bytes.Buffer
+			assert.NoError(t, vm.Format(&buf, &again))
+			assert.Equal(t, tt.output, again.String())
+		})
+	}
+
+	t.Run("write error", func(t *testing.T) {
+		var m mockWriter
+		m.On("Write", mock.Anything).Return(0, errors.New("failed"))
+		assert.EqualError(t, vm.Format(strings.NewReader("foo."), &m), "failed")
+	})
+
+	t.Run("operators of the VM are intact", func(t *testing.T) {
+		assert.False(t, vm.operators.defined(NewAtom(`===>`)))
+		assert.False(t, vm.operators.defined(atomSharp))
+	})
+}
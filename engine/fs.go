@@ -0,0 +1,233 @@
+package engine
+
+import (
+	"bytes"
+	"io/fs"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// WritableFS is a file system which can also open files for writing.
+// If VM.FS implements WritableFS, open/3,4 in write or append mode go through OpenFile.
+type WritableFS interface {
+	fs.FS
+
+	// OpenFile opens the named file with flag (os.O_RDONLY, os.O_CREATE|os.O_WRONLY, or os.O_CREATE|os.O_WRONLY|os.O_APPEND).
+	// A file opened for writing must also implement io.Writer.
+	OpenFile(name string, flag int, perm fs.FileMode) (fs.File, error)
+}
+
+var openFile = os.OpenFile
+
+// OSFS is a WritableFS backed by the actual file system.
+// Unlike os.DirFS, it accepts any names that os.OpenFile accepts including absolute paths.
+type OSFS struct{}
+
+// Open opens the named file for reading.
+func (o OSFS) Open(name string) (fs.File, error) {
+	return o.OpenFile(name, os.O_RDONLY, 0)
+}
+
+// OpenFile opens the named file with flag.
+func (OSFS) OpenFile(name string, flag int, perm fs.FileMode) (fs.File, error) {
+	f, err := openFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// ReadOnlyFS is a WritableFS which refuses to open files for writing.
+type ReadOnlyFS struct {
+	fs.FS
+}
+
+// OpenFile opens the named file if flag is os.O_RDONLY. Otherwise, it fails with fs.ErrPermission.
+func (r ReadOnlyFS) OpenFile(name string, flag int, _ fs.FileMode) (fs.File, error) {
+	if flag != os.O_RDONLY {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrPermission}
+	}
+	return r.Open(name)
+}
+
+// MemFS is an in-memory WritableFS. The zero value for MemFS is an empty file system.
+type MemFS struct {
+	mu    sync.Mutex
+	files map[string]*memFileData
+}
+
+type memFileData struct {
+	data    []byte
+	modTime time.Time
+}
+
+// WriteFile creates or truncates the named file and writes data to it.
+func (m *MemFS) WriteFile(name string, data []byte) error {
+	if !fs.ValidPath(name) {
+		return &fs.PathError{Op: "write", Path: name, Err: fs.ErrInvalid}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.files == nil {
+		m.files = map[string]*memFileData{}
+	}
+	m.files[name] = &memFileData{data: append([]byte(nil), data...), modTime: time.Now()}
+	return nil
+}
+
+// Open opens the named file for reading.
+func (m *MemFS) Open(name string) (fs.File, error) {
+	return m.OpenFile(name, os.O_RDONLY, 0)
+}
+
+// OpenFile opens the named file with flag. Opening a file for writing without os.O_APPEND truncates it.
+func (m *MemFS) OpenFile(name string, flag int, _ fs.FileMode) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	d, ok := m.files[name]
+	switch {
+	case !ok && flag&os.O_CREATE == 0:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	case !ok:
+		if m.files == nil {
+			m.files = map[string]*memFileData{}
+		}
+		d = &memFileData{modTime: time.Now()}
+		m.files[name] = d
+	case flag&(os.O_WRONLY|os.O_RDWR) != 0 && flag&os.O_APPEND == 0:
+		d.data = nil
+		d.modTime = time.Now()
+	}
+
+	f := memFile{fs: m, name: name, data: d}
+	if flag&(os.O_WRONLY|os.O_RDWR) == 0 {
+		return &memReadFile{memFile: f, Reader: bytes.NewReader(d.data)}, nil
+	}
+	return &memWriteFile{memFile: f}, nil
+}
+
+// ReadDir reads the root directory. MemFS has no subdirectories and file names are treated as flat keys.
+func (m *MemFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if name != "." {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ret := make([]fs.DirEntry, 0, len(m.files))
+	for n, d := range m.files {
+		ret = append(ret, fs.FileInfoToDirEntry(memFileInfo{name: n, size: int64(len(d.data)), modTime: d.modTime}))
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Name() < ret[j].Name()
+	})
+	return ret, nil
+}
+
+type memFile struct {
+	fs   *MemFS
+	name string
+	data *memFileData
+}
+
+func (f *memFile) Name() string {
+	return f.name
+}
+
+func (f *memFile) Stat() (fs.FileInfo, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	return memFileInfo{name: f.name, size: int64(len(f.data.data)), modTime: f.data.modTime}, nil
+}
+
+func (f *memFile) Close() error {
+	return nil
+}
+
+type memReadFile struct {
+	memFile
+	*bytes.Reader
+}
+
+type memWriteFile struct {
+	memFile
+}
+
+func (f *memWriteFile) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: f.name, Err: fs.ErrPermission}
+}
+
+func (f *memWriteFile) Write(p []byte) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	f.data.data = append(f.data.data, p...)
+	f.data.modTime = time.Now()
+	return len(p), nil
+}
+
+type memFileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+func (i memFileInfo) Name() string {
+	return i.name
+}
+
+func (i memFileInfo) Size() int64 {
+	return i.size
+}
+
+func (i memFileInfo) Mode() fs.FileMode {
+	return 0644
+}
+
+func (i memFileInfo) ModTime() time.Time {
+	return i.modTime
+}
+
+func (i memFileInfo) IsDir() bool {
+	return false
+}
+
+func (i memFileInfo) Sys() interface{} {
+	return nil
+}
+
+// openFile opens the named file in VM.FS with flag.
+// If VM.FS doesn't implement WritableFS, it can open files only for reading.
+func (vm *VM) openFile(name string, flag int, perm fs.FileMode) (fs.File, error) {
+	switch fsys := vm.fs().(type) {
+	case WritableFS:
+		return fsys.OpenFile(name, flag, perm)
+	default:
+		if flag != os.O_RDONLY {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrPermission}
+		}
+		return fsys.Open(name)
+	}
+}
+
+// fs returns the file system of the VM. If VM.FS is nil, it's an empty file system so that a VM never touches the actual file system unless it's explicitly given.
+func (vm *VM) fs() fs.FS {
+	if vm.FS == nil {
+		return noFS{}
+	}
+	return vm.FS
+}
+
+// noFS is a file system without any files.
+type noFS struct{}
+
+func (noFS) Open(name string) (fs.File, error) {
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
@@ -0,0 +1,147 @@
+package engine
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"os"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOSFS_Open(t *testing.T) {
+	var fsys OSFS
+	f, err := fsys.Open("fs.go")
+	assert.NoError(t, err)
+	assert.NotNil(t, f)
+	assert.NoError(t, f.Close())
+
+	_, err = fsys.Open("not_found.go")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+func TestReadOnlyFS_OpenFile(t *testing.T) {
+	fsys := ReadOnlyFS{FS: fstest.MapFS{"foo": &fstest.MapFile{Data: []byte("bar")}}}
+
+	f, err := fsys.OpenFile("foo", os.O_RDONLY, 0)
+	assert.NoError(t, err)
+	b, err := io.ReadAll(f)
+	assert.NoError(t, err)
+	assert.Equal(t, "bar", string(b))
+
+	_, err = fsys.OpenFile("foo", os.O_CREATE|os.O_WRONLY, 0644)
+	assert.ErrorIs(t, err, fs.ErrPermission)
+}
+
+func TestMemFS(t *testing.T) {
+	var fsys MemFS
+	assert.NoError(t, fsys.WriteFile("foo.pl", []byte("foo.\n")))
+
+	t.Run("read", func(t *testing.T) {
+		b, err := fs.ReadFile(&fsys, "foo.pl")
+		assert.NoError(t, err)
+		assert.Equal(t, "foo.\n", string(b))
+	})
+
+	t.Run("write", func(t *testing.T) {
+		f, err := fsys.OpenFile("bar", os.O_CREATE|os.O_WRONLY, 0644)
+		assert.NoError(t, err)
+		_, err = f.(io.Writer).Write([]byte("bar"))
+		assert.NoError(t, err)
+		assert.NoError(t, f.Close())
+
+		f, err = fsys.OpenFile("bar", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		assert.NoError(t, err)
+		_, err = f.(io.Writer).Write([]byte("baz"))
+		assert.NoError(t, err)
+		assert.NoError(t, f.Close())
+
+		b, err := fs.ReadFile(&fsys, "bar")
+		assert.NoError(t, err)
+		assert.Equal(t, "barbaz", string(b))
+
+		f, err = fsys.OpenFile("bar", os.O_CREATE|os.O_WRONLY, 0644)
+		assert.NoError(t, err)
+		assert.NoError(t, f.Close())
+
+		b, err = fs.ReadFile(&fsys, "bar")
+		assert.NoError(t, err)
+		assert.Empty(t, b)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		_, err := fsys.Open("baz")
+		assert.ErrorIs(t, err, fs.ErrNotExist)
+	})
+
+	t.Run("invalid path", func(t *testing.T) {
+		_, err := fsys.Open("/etc/passwd")
+		assert.ErrorIs(t, err, fs.ErrInvalid)
+	})
+
+	t.Run("read dir", func(t *testing.T) {
+		es, err := fs.ReadDir(&fsys, ".")
+		assert.NoError(t, err)
+		var names []string
+		for _, e := range es {
+			names = append(names, e.Name())
+		}
+		assert.Equal(t, []string{"bar", "foo.pl"}, names)
+	})
+}
+
+func TestVM_openFile(t *testing.T) {
+	t.Run("mem", func(t *testing.T) {
+		var fsys MemFS
+		vm := VM{FS: &fsys}
+
+		s := NewVariable()
+		ok, err := Open(&vm, NewAtom("out.txt"), atomWrite, s, List(), func(env *Env) *Promise {
+			s := env.Resolve(s).(*Stream)
+			for _, r := range "hello" {
+				_, err := s.WriteRune(r)
+				assert.NoError(t, err)
+			}
+			assert.NoError(t, s.Close())
+			return Bool(true)
+		}, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+
+		b, err := fs.ReadFile(&fsys, "out.txt")
+		assert.NoError(t, err)
+		assert.Equal(t, "hello", string(b))
+
+		_, err = Open(&vm, NewAtom("/etc/passwd"), atomRead, NewVariable(), List(), Success, nil).Force(context.Background())
+		assert.Equal(t, existenceError(objectTypeSourceSink, NewAtom("/etc/passwd"), nil), err)
+	})
+
+	t.Run("read-only", func(t *testing.T) {
+		vm := VM{FS: ReadOnlyFS{FS: fstest.MapFS{"foo": &fstest.MapFile{Data: []byte("foo.")}}}}
+
+		ok, err := Open(&vm, NewAtom("foo"), atomRead, NewVariable(), List(), Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+
+		_, err = Open(&vm, NewAtom("foo"), atomAppend, NewVariable(), List(), Success, nil).Force(context.Background())
+		assert.Equal(t, permissionError(operationOpen, permissionTypeSourceSink, NewAtom("foo"), nil), err)
+	})
+
+	t.Run("not writable", func(t *testing.T) {
+		vm := VM{FS: fstest.MapFS{}}
+
+		_, err := Open(&vm, NewAtom("foo"), atomWrite, NewVariable(), List(), Success, nil).Force(context.Background())
+		assert.Equal(t, permissionError(operationOpen, permissionTypeSourceSink, NewAtom("foo"), nil), err)
+	})
+	t.Run("nil", func(t *testing.T) {
+		var vm VM
+
+		_, err := Open(&vm, NewAtom("fs.go"), atomRead, NewVariable(), List(), Success, nil).Force(context.Background())
+		assert.Equal(t, existenceError(objectTypeSourceSink, NewAtom("fs.go"), nil), err)
+
+		_, err = Open(&vm, NewAtom("foo"), atomWrite, NewVariable(), List(), Success, nil).Force(context.Background())
+		assert.Equal(t, permissionError(operationOpen, permissionTypeSourceSink, NewAtom("foo"), nil), err)
+	})
+}
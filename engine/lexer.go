@@ -17,12 +17,66 @@ type Lexer struct {
 
 	buf    bytes.Buffer
 	offset int
+
+	last TokenKind
+
+	// pos is where the last token starts.
+	pos Position
+
+	// comments makes Token return comments as tokens instead of skipping them as layout text.
+	comments bool
+}
+
+// Position is a location in a Prolog text.
+type Position struct {
+	// Offset is the byte offset from the beginning starting at 0.
+	Offset int
+
+	// Line is the line number starting at 1.
+	Line int
+
+	// Column is the rune offset from the beginning of the line starting at 1.
+	Column int
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
+func (p Position) advance(r rune) Position {
+	p.Offset += utf8.RuneLen(r)
+	if r == '\n' {
+		p.Line++
+		p.Column = 1
+		return p
+	}
+	p.Column++
+	return p
+}
+
+// NewLexer creates a new lexer from the current VM and io.RuneReader.
+// It converts characters by char_conversion/2 while current_prolog_flag(char_conversion, on).
+func NewLexer(vm *VM, r io.RuneReader) *Lexer {
+	l := Lexer{
+		input: newRuneRingBuffer(r),
+	}
+	if vm.charConvEnabled {
+		l.charConversions = vm.charConversions
+	}
+	return &l
+}
+
+// Pos returns where the last token read by Token starts.
+func (l *Lexer) Pos() Position {
+	return l.pos
 }
 
 // Token returns the next token.
 func (l *Lexer) Token() (Token, error) {
 	l.offset = l.buf.Len()
-	return l.layoutTextSequence(false)
+	t, err := l.layoutTextSequence(l.last == TokenComment)
+	l.last = t.kind
+	return t, err
 }
 
 func (l *Lexer) next() (rune, error) {
@@ -60,7 +114,7 @@ func (l *Lexer) chunk() string {
 
 // Token is a smallest meaningful unit of prolog program.
 type Token struct {
-	kind tokenKind
+	kind TokenKind
 	val  string
 }
 
@@ -68,113 +122,144 @@ func (t Token) String() string {
 	return fmt.Sprintf("%s(%s)", t.kind.String(), t.val)
 }
 
-// tokenKind is a type of Token.
-type tokenKind byte
+// Kind returns the kind of the token.
+func (t Token) Kind() TokenKind {
+	return t.kind
+}
+
+// Val returns the source text of the token.
+func (t Token) Val() string {
+	return t.val
+}
+
+// Name returns the atom the token denotes if it's a name token.
+func (t Token) Name() (Atom, bool) {
+	switch t.kind {
+	case TokenLetterDigit, TokenGraphic, TokenSemicolon, TokenCut:
+		return NewAtom(t.val), true
+	case TokenQuoted:
+		return NewAtom(unquote(t.val)), true
+	default:
+		return 0, false
+	}
+}
+
+// TokenKind is a type of Token.
+type TokenKind byte
 
 const (
-	// tokenInvalid represents an invalid token.
-	tokenInvalid tokenKind = iota
+	// TokenInvalid represents an invalid token.
+	TokenInvalid TokenKind = iota
 
-	// tokenLetterDigit represents a letter digit token.
-	tokenLetterDigit
+	// TokenLetterDigit represents a letter digit token.
+	TokenLetterDigit
 
-	// tokenGraphic represents a graphical token.
-	tokenGraphic
+	// TokenGraphic represents a graphical token.
+	TokenGraphic
 
-	// tokenQuoted represents a quoted token.
-	tokenQuoted
+	// TokenQuoted represents a quoted token.
+	TokenQuoted
 
-	// tokenSemicolon represents a semicolon token.
-	tokenSemicolon
+	// TokenSemicolon represents a semicolon token.
+	TokenSemicolon
 
-	// tokenCut represents a cut token.
-	tokenCut
+	// TokenCut represents a cut token.
+	TokenCut
 
-	// tokenVariable represents a variable token.
-	tokenVariable
+	// TokenVariable represents a variable token.
+	TokenVariable
 
-	// tokenInteger represents an integer token.
-	tokenInteger
+	// TokenInteger represents an integer token.
+	TokenInteger
 
-	// tokenFloatNumber represents a floating-point token.
-	tokenFloatNumber
+	// TokenFloatNumber represents a floating-point token.
+	TokenFloatNumber
 
-	// tokenDoubleQuotedList represents a double-quoted string.
-	tokenDoubleQuotedList
+	// TokenDoubleQuotedList represents a double-quoted string.
+	TokenDoubleQuotedList
 
-	// tokenOpen represents an open parenthesis.
-	tokenOpen
+	// TokenOpen represents an open parenthesis.
+	TokenOpen
 
-	// tokenOpenCT represents an open CT parenthesis.
-	tokenOpenCT
+	// TokenOpenCT represents an open CT parenthesis.
+	TokenOpenCT
 
-	// tokenClose represents a close parenthesis.
-	tokenClose
+	// TokenClose represents a close parenthesis.
+	TokenClose
 
-	// tokenOpenList represents an open bracket.
-	tokenOpenList
+	// TokenOpenList represents an open bracket.
+	TokenOpenList
 
-	// tokenCloseList represents a close bracket.
-	tokenCloseList
+	// TokenCloseList represents a close bracket.
+	TokenCloseList
 
-	// tokenOpenCurly represents an open brace.
-	tokenOpenCurly
+	// TokenOpenCurly represents an open brace.
+	TokenOpenCurly
 
-	// tokenCloseCurly represents a close brace.
-	tokenCloseCurly
+	// TokenCloseCurly represents a close brace.
+	TokenCloseCurly
 
-	// tokenBar represents a bar.
-	tokenBar
+	// TokenBar represents a bar.
+	TokenBar
 
-	// tokenComma represents a comma.
-	tokenComma
+	// TokenComma represents a comma.
+	TokenComma
 
-	// tokenEnd represents a period.
-	tokenEnd
+	// TokenEnd represents a period.
+	TokenEnd
+
+	// TokenOpenDict represents an open brace immediately after a dict tag.
+	TokenOpenDict
+
+	// TokenComment represents a single line comment or a bracketed comment.
+	TokenComment
 )
 
-// GoString returns a string representation of tokenKind.
-func (k tokenKind) GoString() string {
+// GoString returns a string representation of TokenKind.
+func (k TokenKind) GoString() string {
 	return k.String()
 }
 
-func (k tokenKind) String() string {
+// String returns the name of the kind such as "letter digit", "open ct", and "end".
+func (k TokenKind) String() string {
 	return [...]string{
-		tokenInvalid:          "invalid",
-		tokenLetterDigit:      "letter digit",
-		tokenGraphic:          "graphic",
-		tokenQuoted:           "quoted",
-		tokenSemicolon:        "semicolon",
-		tokenCut:              "cut",
-		tokenVariable:         "variable",
-		tokenInteger:          "integer",
-		tokenFloatNumber:      "float number",
-		tokenDoubleQuotedList: "double quoted list",
-		tokenOpen:             "open",
-		tokenOpenCT:           "open ct",
-		tokenClose:            "close",
-		tokenOpenList:         "open list",
-		tokenCloseList:        "close list",
-		tokenOpenCurly:        "open curly",
-		tokenCloseCurly:       "close curly",
-		tokenBar:              "bar",
-		tokenComma:            "comma",
-		tokenEnd:              "end",
+		TokenInvalid:          "invalid",
+		TokenLetterDigit:      "letter digit",
+		TokenGraphic:          "graphic",
+		TokenQuoted:           "quoted",
+		TokenSemicolon:        "semicolon",
+		TokenCut:              "cut",
+		TokenVariable:         "variable",
+		TokenInteger:          "integer",
+		TokenFloatNumber:      "float number",
+		TokenDoubleQuotedList: "double quoted list",
+		TokenOpen:             "open",
+		TokenOpenCT:           "open ct",
+		TokenClose:            "close",
+		TokenOpenList:         "open list",
+		TokenCloseList:        "close list",
+		TokenOpenCurly:        "open curly",
+		TokenCloseCurly:       "close curly",
+		TokenBar:              "bar",
+		TokenComma:            "comma",
+		TokenEnd:              "end",
+		TokenOpenDict:         "open dict",
+		TokenComment:          "comment",
 	}[k]
 }
 
 // Tokens
 
-var soloTokenKinds = [...]tokenKind{
-	';': tokenSemicolon,
-	'!': tokenCut,
-	')': tokenClose,
-	'[': tokenOpenList,
-	']': tokenCloseList,
-	'{': tokenOpenCurly,
-	'}': tokenCloseCurly,
-	'|': tokenBar,
-	',': tokenComma,
+var soloTokenKinds = [...]TokenKind{
+	';': TokenSemicolon,
+	'!': TokenCut,
+	')': TokenClose,
+	'[': TokenOpenList,
+	']': TokenCloseList,
+	'{': TokenOpenCurly,
+	'}': TokenCloseCurly,
+	'|': TokenBar,
+	',': TokenComma,
 }
 
 func (l *Lexer) token(afterLayout bool) (Token, error) {
@@ -187,7 +272,7 @@ func (l *Lexer) token(afterLayout bool) (Token, error) {
 	case r == '.':
 		l.accept(r)
 		if l.wasEndChar() {
-			return Token{kind: tokenEnd, val: l.chunk()}, nil
+			return Token{kind: TokenEnd, val: l.chunk()}, nil
 		}
 		return l.graphicToken()
 	case isGraphicChar(r), r == '\\':
@@ -207,11 +292,20 @@ func (l *Lexer) token(afterLayout bool) (Token, error) {
 	case r == '(':
 		l.accept(r)
 		if afterLayout {
-			return Token{kind: tokenOpen, val: l.chunk()}, nil
+			return Token{kind: TokenOpen, val: l.chunk()}, nil
+		}
+		return Token{kind: TokenOpenCT, val: l.chunk()}, nil
+	case r == '{':
+		l.accept(r)
+		switch l.last {
+		case TokenLetterDigit, TokenQuoted, TokenVariable:
+			if !afterLayout {
+				return Token{kind: TokenOpenDict, val: l.chunk()}, nil
+			}
 		}
-		return Token{kind: tokenOpenCT, val: l.chunk()}, nil
+		return Token{kind: TokenOpenCurly, val: l.chunk()}, nil
 	default:
-		k := tokenInvalid
+		k := TokenInvalid
 		if int(r) < len(soloTokenKinds) {
 			k = soloTokenKinds[r]
 		}
@@ -235,6 +329,7 @@ func (l *Lexer) layoutTextSequence(afterLayout bool) (Token, error) {
 	for {
 		switch r, err := l.next(); {
 		case err == io.EOF:
+			l.pos = l.input.position()
 			return l.token(afterLayout)
 		case err != nil:
 			return Token{}, err
@@ -242,11 +337,21 @@ func (l *Lexer) layoutTextSequence(afterLayout bool) (Token, error) {
 			afterLayout = true
 			continue
 		case r == '%':
+			l.backup()
+			l.pos = l.input.position()
+			_, _ = l.next()
+			if l.comments {
+				l.accept(r)
+			}
 			return l.commentText(false)
 		case r == '/':
+			l.backup()
+			l.pos = l.input.position()
+			_, _ = l.next()
 			return l.commentOpen()
 		default:
 			l.backup()
+			l.pos = l.input.position()
 			return l.token(afterLayout)
 		}
 	}
@@ -259,16 +364,33 @@ func (l *Lexer) commentText(bracketed bool) (Token, error) {
 			case err != nil:
 				return Token{}, err
 			case r == '*':
+				if l.comments {
+					l.accept(r)
+				}
 				return l.commentClose()
+			default:
+				if l.comments {
+					l.accept(r)
+				}
 			}
 		}
 	} else {
 		for {
 			switch r, err := l.next(); {
+			case err == io.EOF && l.comments:
+				return Token{kind: TokenComment, val: l.chunk()}, nil
 			case err != nil:
 				return Token{}, err
 			case r == '\n':
+				if l.comments {
+					l.backup()
+					return Token{kind: TokenComment, val: l.chunk()}, nil
+				}
 				return l.layoutTextSequence(true)
+			default:
+				if l.comments {
+					l.accept(r)
+				}
 			}
 		}
 	}
@@ -282,6 +404,10 @@ func (l *Lexer) commentOpen() (Token, error) {
 	case err != nil:
 		return Token{}, err
 	case r == '*':
+		if l.comments {
+			l.accept('/')
+			l.accept(r)
+		}
 		return l.commentText(true)
 	default:
 		l.backup()
@@ -295,8 +421,13 @@ func (l *Lexer) commentClose() (Token, error) {
 	case err != nil:
 		return Token{}, err
 	case r == '/':
+		if l.comments {
+			l.accept(r)
+			return Token{kind: TokenComment, val: l.chunk()}, nil
+		}
 		return l.layoutTextSequence(true)
 	default:
+		l.backup()
 		return l.commentText(true)
 	}
 }
@@ -307,14 +438,14 @@ func (l *Lexer) letterDigitToken() (Token, error) {
 	for {
 		switch r, err := l.next(); {
 		case err == io.EOF:
-			return Token{kind: tokenLetterDigit, val: l.chunk()}, nil
+			return Token{kind: TokenLetterDigit, val: l.chunk()}, nil
 		case err != nil:
 			return Token{}, err
 		case isAlphanumericChar(r):
 			l.accept(r)
 		default:
 			l.backup()
-			return Token{kind: tokenLetterDigit, val: l.chunk()}, nil
+			return Token{kind: TokenLetterDigit, val: l.chunk()}, nil
 		}
 	}
 }
@@ -323,14 +454,14 @@ func (l *Lexer) graphicToken() (Token, error) {
 	for {
 		switch r, err := l.next(); {
 		case err == io.EOF:
-			return Token{kind: tokenGraphic, val: l.chunk()}, nil
+			return Token{kind: TokenGraphic, val: l.chunk()}, nil
 		case err != nil:
 			return Token{}, err
 		case isGraphicChar(r), r == '\\':
 			l.accept(r)
 		default:
 			l.backup()
-			return Token{kind: tokenGraphic, val: l.chunk()}, nil
+			return Token{kind: TokenGraphic, val: l.chunk()}, nil
 		}
 	}
 }
@@ -361,10 +492,10 @@ func (l *Lexer) quotedToken() (Token, error) {
 
 			// Checks if it contains invalid octal or hexadecimal escape sequences.
 			if strings.ContainsRune(unquote(s), utf8.RuneError) {
-				return Token{kind: tokenInvalid, val: s}, nil
+				return Token{kind: TokenInvalid, val: s}, nil
 			}
 
-			return Token{kind: tokenQuoted, val: s}, nil
+			return Token{kind: TokenQuoted, val: s}, nil
 		case r == '\\':
 			l.accept(r)
 			switch r, err := l.rawNext(); {
@@ -382,7 +513,7 @@ func (l *Lexer) quotedToken() (Token, error) {
 			return l.escapeSequence(l.quotedToken)
 		default:
 			l.accept(r)
-			return Token{kind: tokenInvalid, val: l.chunk()}, nil
+			return Token{kind: TokenInvalid, val: l.chunk()}, nil
 		}
 	}
 }
@@ -402,7 +533,7 @@ func (l *Lexer) escapeSequence(cont func() (Token, error)) (Token, error) {
 		return l.hexadecimalEscapeSequence(cont)
 	default:
 		l.accept(r)
-		return Token{kind: tokenInvalid, val: l.chunk()}, nil
+		return Token{kind: TokenInvalid, val: l.chunk()}, nil
 	}
 }
 
@@ -419,7 +550,7 @@ func (l *Lexer) octalEscapeSequence(cont func() (Token, error)) (Token, error) {
 			continue
 		default:
 			l.accept(r)
-			return Token{kind: tokenInvalid, val: l.chunk()}, nil
+			return Token{kind: TokenInvalid, val: l.chunk()}, nil
 		}
 	}
 }
@@ -432,7 +563,7 @@ func (l *Lexer) hexadecimalEscapeSequence(cont func() (Token, error)) (Token, er
 		l.accept(r)
 	default:
 		l.accept(r)
-		return Token{kind: tokenInvalid, val: l.chunk()}, nil
+		return Token{kind: TokenInvalid, val: l.chunk()}, nil
 	}
 
 	for {
@@ -447,7 +578,7 @@ func (l *Lexer) hexadecimalEscapeSequence(cont func() (Token, error)) (Token, er
 			continue
 		default:
 			l.accept(r)
-			return Token{kind: tokenInvalid, val: l.chunk()}, nil
+			return Token{kind: TokenInvalid, val: l.chunk()}, nil
 		}
 	}
 }
@@ -458,14 +589,14 @@ func (l *Lexer) variableToken() (Token, error) {
 	for {
 		switch r, err := l.next(); {
 		case err == io.EOF:
-			return Token{kind: tokenVariable, val: l.chunk()}, nil
+			return Token{kind: TokenVariable, val: l.chunk()}, nil
 		case err != nil:
 			return Token{}, err
 		case isAlphanumericChar(r):
 			l.accept(r)
 		default:
 			l.backup()
-			return Token{kind: tokenVariable, val: l.chunk()}, nil
+			return Token{kind: TokenVariable, val: l.chunk()}, nil
 		}
 	}
 }
@@ -510,7 +641,7 @@ func (l *Lexer) integerTokenCharacterCode(r rune) (Token, error) {
 		case err == io.EOF:
 			l.backup()
 			l.backup()
-			return Token{kind: tokenInteger, val: l.chunk()}, nil // 0
+			return Token{kind: TokenInteger, val: l.chunk()}, nil // 0
 		case err != nil:
 			return Token{}, err
 		case r == '\'': // 0'''
@@ -520,7 +651,7 @@ func (l *Lexer) integerTokenCharacterCode(r rune) (Token, error) {
 			l.backup()
 			l.backup()
 			l.backup()
-			return Token{kind: tokenInteger, val: l.chunk()}, nil // 0
+			return Token{kind: TokenInteger, val: l.chunk()}, nil // 0
 		}
 	case r == '\\':
 		switch r, err := l.next(); {
@@ -532,7 +663,7 @@ func (l *Lexer) integerTokenCharacterCode(r rune) (Token, error) {
 			l.backup()
 			l.backup()
 			l.backup()
-			return Token{kind: tokenInteger, val: l.chunk()}, nil // 0
+			return Token{kind: TokenInteger, val: l.chunk()}, nil // 0
 		default:
 			l.backup()
 			l.backup()
@@ -548,7 +679,7 @@ func (l *Lexer) integerTokenBinary(r rune) (Token, error) {
 	switch r, err := l.next(); {
 	case err == io.EOF:
 		l.backup()
-		return Token{kind: tokenInteger, val: l.chunk()}, nil
+		return Token{kind: TokenInteger, val: l.chunk()}, nil
 	case err != nil:
 		return Token{}, err
 	case isBinaryDigitChar(r):
@@ -556,7 +687,7 @@ func (l *Lexer) integerTokenBinary(r rune) (Token, error) {
 	default:
 		l.backup()
 		l.backup()
-		return Token{kind: tokenInteger, val: l.chunk()}, nil
+		return Token{kind: TokenInteger, val: l.chunk()}, nil
 	}
 	l.accept(r)
 	return l.binaryConstant()
@@ -566,7 +697,7 @@ func (l *Lexer) integerTokenOctal(r rune) (Token, error) {
 	switch r, err := l.next(); {
 	case err == io.EOF:
 		l.backup()
-		return Token{kind: tokenInteger, val: l.chunk()}, nil
+		return Token{kind: TokenInteger, val: l.chunk()}, nil
 	case err != nil:
 		return Token{}, err
 	case isOctalDigitChar(r):
@@ -574,7 +705,7 @@ func (l *Lexer) integerTokenOctal(r rune) (Token, error) {
 	default:
 		l.backup()
 		l.backup()
-		return Token{kind: tokenInteger, val: l.chunk()}, nil
+		return Token{kind: TokenInteger, val: l.chunk()}, nil
 	}
 	l.accept(r)
 	return l.octalConstant()
@@ -584,7 +715,7 @@ func (l *Lexer) integerTokenHexadecimal(r rune) (Token, error) {
 	switch r, err := l.next(); {
 	case err == io.EOF:
 		l.backup()
-		return Token{kind: tokenInteger, val: l.chunk()}, nil
+		return Token{kind: TokenInteger, val: l.chunk()}, nil
 	case err != nil:
 		return Token{}, err
 	case isHexadecimalDigitChar(r):
@@ -592,7 +723,7 @@ func (l *Lexer) integerTokenHexadecimal(r rune) (Token, error) {
 	default:
 		l.backup()
 		l.backup()
-		return Token{kind: tokenInteger, val: l.chunk()}, nil
+		return Token{kind: TokenInteger, val: l.chunk()}, nil
 	}
 	l.accept(r)
 	return l.hexadecimalConstant()
@@ -602,7 +733,7 @@ func (l *Lexer) integerConstant() (Token, error) {
 	for {
 		switch r, err := l.next(); {
 		case err == io.EOF:
-			return Token{kind: tokenInteger, val: l.chunk()}, nil
+			return Token{kind: TokenInteger, val: l.chunk()}, nil
 		case err != nil:
 			return Token{}, err
 		case isDecimalDigitChar(r):
@@ -611,7 +742,7 @@ func (l *Lexer) integerConstant() (Token, error) {
 			switch r, err := l.next(); {
 			case err == io.EOF:
 				l.backup()
-				return Token{kind: tokenInteger, val: l.chunk()}, nil
+				return Token{kind: TokenInteger, val: l.chunk()}, nil
 			case err != nil:
 				return Token{}, err
 			case isDecimalDigitChar(r):
@@ -621,11 +752,11 @@ func (l *Lexer) integerConstant() (Token, error) {
 			default:
 				l.backup()
 				l.backup()
-				return Token{kind: tokenInteger, val: l.chunk()}, nil
+				return Token{kind: TokenInteger, val: l.chunk()}, nil
 			}
 		default:
 			l.backup()
-			return Token{kind: tokenInteger, val: l.chunk()}, nil
+			return Token{kind: TokenInteger, val: l.chunk()}, nil
 		}
 	}
 }
@@ -638,18 +769,18 @@ func (l *Lexer) characterCodeConstant() (Token, error) {
 		l.accept(r)
 		r, _ := l.next() // r == '\''
 		l.accept(r)
-		return Token{kind: tokenInteger, val: l.chunk()}, nil
+		return Token{kind: TokenInteger, val: l.chunk()}, nil
 	case r == '\\':
 		l.accept(r)
 		return l.escapeSequence(func() (Token, error) {
-			return Token{kind: tokenInteger, val: l.chunk()}, nil
+			return Token{kind: TokenInteger, val: l.chunk()}, nil
 		})
 	case isGraphicChar(r), isAlphanumericChar(r), isSoloChar(r), r == ' ':
 		l.accept(r)
-		return Token{kind: tokenInteger, val: l.chunk()}, nil
+		return Token{kind: TokenInteger, val: l.chunk()}, nil
 	default:
 		l.accept(r)
-		return Token{kind: tokenInvalid, val: l.chunk()}, nil
+		return Token{kind: TokenInvalid, val: l.chunk()}, nil
 	}
 }
 
@@ -657,14 +788,14 @@ func (l *Lexer) binaryConstant() (Token, error) {
 	for {
 		switch r, err := l.next(); {
 		case err == io.EOF:
-			return Token{kind: tokenInteger, val: l.chunk()}, nil
+			return Token{kind: TokenInteger, val: l.chunk()}, nil
 		case err != nil:
 			return Token{}, err
 		case isBinaryDigitChar(r):
 			l.accept(r)
 		default:
 			l.backup()
-			return Token{kind: tokenInteger, val: l.chunk()}, nil
+			return Token{kind: TokenInteger, val: l.chunk()}, nil
 		}
 	}
 }
@@ -673,14 +804,14 @@ func (l *Lexer) octalConstant() (Token, error) {
 	for {
 		switch r, err := l.next(); {
 		case err == io.EOF:
-			return Token{kind: tokenInteger, val: l.chunk()}, nil
+			return Token{kind: TokenInteger, val: l.chunk()}, nil
 		case err != nil:
 			return Token{}, err
 		case isOctalDigitChar(r):
 			l.accept(r)
 		default:
 			l.backup()
-			return Token{kind: tokenInteger, val: l.chunk()}, nil
+			return Token{kind: TokenInteger, val: l.chunk()}, nil
 		}
 	}
 }
@@ -689,14 +820,14 @@ func (l *Lexer) hexadecimalConstant() (Token, error) {
 	for {
 		switch r, err := l.next(); {
 		case err == io.EOF:
-			return Token{kind: tokenInteger, val: l.chunk()}, nil
+			return Token{kind: TokenInteger, val: l.chunk()}, nil
 		case err != nil:
 			return Token{}, err
 		case isHexadecimalDigitChar(r):
 			l.accept(r)
 		default:
 			l.backup()
-			return Token{kind: tokenInteger, val: l.chunk()}, nil
+			return Token{kind: TokenInteger, val: l.chunk()}, nil
 		}
 	}
 }
@@ -707,7 +838,7 @@ func (l *Lexer) fraction() (Token, error) {
 	for {
 		switch r, err := l.next(); {
 		case err == io.EOF:
-			return Token{kind: tokenFloatNumber, val: l.chunk()}, nil
+			return Token{kind: TokenFloatNumber, val: l.chunk()}, nil
 		case err != nil:
 			return Token{}, err
 		case isDecimalDigitChar(r):
@@ -717,7 +848,7 @@ func (l *Lexer) fraction() (Token, error) {
 			switch r, err := l.next(); {
 			case err == io.EOF:
 				l.backup() // for 'e' or 'E'
-				return Token{kind: tokenFloatNumber, val: l.chunk()}, nil
+				return Token{kind: TokenFloatNumber, val: l.chunk()}, nil
 			case err != nil:
 				return Token{}, err
 			case isSignChar(r):
@@ -732,7 +863,7 @@ func (l *Lexer) fraction() (Token, error) {
 					l.backup()
 				}
 				l.backup() // for 'e' or 'E'
-				return Token{kind: tokenFloatNumber, val: l.chunk()}, nil
+				return Token{kind: TokenFloatNumber, val: l.chunk()}, nil
 			case err != nil:
 				return Token{}, err
 			case isDecimalDigitChar(r):
@@ -744,7 +875,7 @@ func (l *Lexer) fraction() (Token, error) {
 					l.backup()
 				}
 				l.backup() // for 'e' or 'E'
-				return Token{kind: tokenFloatNumber, val: l.chunk()}, nil
+				return Token{kind: TokenFloatNumber, val: l.chunk()}, nil
 			}
 
 			l.accept(r) // 'e' or 'E'
@@ -754,7 +885,7 @@ func (l *Lexer) fraction() (Token, error) {
 			return l.exponent()
 		default:
 			l.backup()
-			return Token{kind: tokenFloatNumber, val: l.chunk()}, nil
+			return Token{kind: TokenFloatNumber, val: l.chunk()}, nil
 		}
 	}
 }
@@ -763,14 +894,14 @@ func (l *Lexer) exponent() (Token, error) {
 	for {
 		switch r, err := l.next(); {
 		case err == io.EOF:
-			return Token{kind: tokenFloatNumber, val: l.chunk()}, nil
+			return Token{kind: TokenFloatNumber, val: l.chunk()}, nil
 		case err != nil:
 			return Token{}, err
 		case isDecimalDigitChar(r):
 			l.accept(r)
 		default:
 			l.backup()
-			return Token{kind: tokenFloatNumber, val: l.chunk()}, nil
+			return Token{kind: TokenFloatNumber, val: l.chunk()}, nil
 		}
 	}
 }
@@ -786,14 +917,14 @@ func (l *Lexer) doubleQuotedListToken() (Token, error) {
 			l.accept(r)
 			switch r, err := l.next(); {
 			case err == io.EOF:
-				return Token{kind: tokenDoubleQuotedList, val: l.chunk()}, nil
+				return Token{kind: TokenDoubleQuotedList, val: l.chunk()}, nil
 			case err != nil:
 				return Token{}, err
 			case r == '"':
 				l.accept(r)
 			default:
 				l.backup()
-				return Token{kind: tokenDoubleQuotedList, val: l.chunk()}, nil
+				return Token{kind: TokenDoubleQuotedList, val: l.chunk()}, nil
 			}
 		case r == '\\':
 			l.accept(r)
@@ -894,11 +1025,20 @@ func isSignChar(r rune) bool {
 type runeRingBuffer struct {
 	base       io.RuneReader
 	buf        [4]rune
+	pos        [4]Position
 	start, end int
+
+	// next is the position of the next rune from base.
+	next Position
+
+	// line is the runes of the line of the last rune read from base without the newline, and lineNo is its line number.
+	// Only this line is kept to show it in syntax errors.
+	line   []rune
+	lineNo int
 }
 
 func newRuneRingBuffer(r io.RuneReader) runeRingBuffer {
-	return runeRingBuffer{base: r}
+	return runeRingBuffer{base: r, next: Position{Line: 1, Column: 1}}
 }
 
 func (b *runeRingBuffer) ReadRune() (rune, int, error) {
@@ -919,6 +1059,15 @@ func (b *runeRingBuffer) UnreadRune() error {
 
 func (b *runeRingBuffer) put(r rune) {
 	b.buf[b.end] = r
+	b.pos[b.end] = b.next
+	if b.next.Line != b.lineNo {
+		b.line = b.line[:0]
+		b.lineNo = b.next.Line
+	}
+	if r != '\n' {
+		b.line = append(b.line, r)
+	}
+	b.next = b.next.advance(r)
 	b.end++
 	b.end %= len(b.buf)
 }
@@ -930,6 +1079,51 @@ func (b *runeRingBuffer) get() rune {
 	return r
 }
 
+// position returns the position of the rune which will be read next.
+func (b *runeRingBuffer) position() Position {
+	if b.empty() {
+		return b.next
+	}
+	return b.pos[b.start]
+}
+
+// lineOf returns the line of pos if it's the line of the last rune read.
+// It never reads more runes from base since base can be an interactive stream.
+// Only if base is an in-memory text, it peeks the rest of the line without consuming it.
+func (b *runeRingBuffer) lineOf(pos Position) string {
+	if pos.Line != b.lineNo {
+		return ""
+	}
+	line := string(b.line)
+	if b.next.Line == b.lineNo { // The newline is not read yet.
+		line += b.peekLine()
+	}
+	return strings.TrimSuffix(line, "\r")
+}
+
+// peekLine returns the rest of the line in base without consuming it if base is an in-memory text.
+func (b *runeRingBuffer) peekLine() string {
+	r, ok := b.base.(*strings.Reader)
+	if !ok {
+		return ""
+	}
+	offset, err := r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return ""
+	}
+	defer func() {
+		_, _ = r.Seek(offset, io.SeekStart)
+	}()
+	var sb strings.Builder
+	for {
+		c, _, err := r.ReadRune()
+		if err != nil || c == '\n' {
+			return sb.String()
+		}
+		sb.WriteRune(c)
+	}
+}
+
 func (b *runeRingBuffer) empty() bool {
 	return b.start == b.end
 }
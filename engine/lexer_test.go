@@ -1,6 +1,7 @@
 package engine
 
 import (
+	"bufio"
 	"errors"
 	"io"
 	"strings"
@@ -19,110 +20,111 @@ func TestLexer_Token(t *testing.T) {
 		{input: ``, err: io.EOF},
 		{input: `🙈`, err: errMonkey}, // In this test, we use a see-no-evil monkey emoji to denote a non-EOF error.
 
-		{input: ".", token: Token{kind: tokenEnd, val: "."}},
-		{input: ";", token: Token{kind: tokenSemicolon, val: ";"}},
-		{input: "!", token: Token{kind: tokenCut, val: "!"}},
-		{input: "(", token: Token{kind: tokenOpenCT, val: "("}},
-		{input: " (", token: Token{kind: tokenOpen, val: "("}},
-		{input: ")", token: Token{kind: tokenClose, val: ")"}},
-		{input: "[", token: Token{kind: tokenOpenList, val: "["}},
-		{input: "]", token: Token{kind: tokenCloseList, val: "]"}},
-		{input: "{", token: Token{kind: tokenOpenCurly, val: "{"}},
-		{input: "}", token: Token{kind: tokenCloseCurly, val: "}"}},
-		{input: "|", token: Token{kind: tokenBar, val: "|"}},
-		{input: ",", token: Token{kind: tokenComma, val: ","}},
-
-		{input: "% comment\nfoo", token: Token{kind: tokenLetterDigit, val: "foo"}},
+		{input: ".", token: Token{kind: TokenEnd, val: "."}},
+		{input: ";", token: Token{kind: TokenSemicolon, val: ";"}},
+		{input: "!", token: Token{kind: TokenCut, val: "!"}},
+		{input: "(", token: Token{kind: TokenOpenCT, val: "("}},
+		{input: " (", token: Token{kind: TokenOpen, val: "("}},
+		{input: ")", token: Token{kind: TokenClose, val: ")"}},
+		{input: "[", token: Token{kind: TokenOpenList, val: "["}},
+		{input: "]", token: Token{kind: TokenCloseList, val: "]"}},
+		{input: "{", token: Token{kind: TokenOpenCurly, val: "{"}},
+		{input: "}", token: Token{kind: TokenCloseCurly, val: "}"}},
+		{input: "|", token: Token{kind: TokenBar, val: "|"}},
+		{input: ",", token: Token{kind: TokenComma, val: ","}},
+
+		{input: "% comment\nfoo", token: Token{kind: TokenLetterDigit, val: "foo"}},
 		{input: "% comment", err: io.EOF},
-		{input: "/* comment \n * also comment \n */foo", token: Token{kind: tokenLetterDigit, val: "foo"}},
+		{input: "/* comment \n * also comment \n */foo", token: Token{kind: TokenLetterDigit, val: "foo"}},
 		{input: "/* comment ", err: io.EOF},
-		{input: `/`, token: Token{kind: tokenGraphic, val: `/`}},
-		{input: `/ *`, token: Token{kind: tokenGraphic, val: `/`}},
+		{input: "/* comment **/foo", token: Token{kind: TokenLetterDigit, val: "foo"}},
+		{input: `/`, token: Token{kind: TokenGraphic, val: `/`}},
+		{input: `/ *`, token: Token{kind: TokenGraphic, val: `/`}},
 		{input: "/* comment *", err: io.EOF},
 		{input: `/🙈`, err: errMonkey},
 
-		{input: `改善`, token: Token{kind: tokenLetterDigit, val: `改善`}},
-		{input: `プロログ`, token: Token{kind: tokenLetterDigit, val: `プロログ`}},
-		{input: `ぷろろぐ`, token: Token{kind: tokenLetterDigit, val: `ぷろろぐ`}},
-		{input: `프롤로그`, token: Token{kind: tokenLetterDigit, val: `프롤로그`}},
-		{input: `برولوغ`, token: Token{kind: tokenLetterDigit, val: `برولوغ`}},
-		{input: `פרולוג`, token: Token{kind: tokenLetterDigit, val: `פרולוג`}},
-		{input: `ゴー`, token: Token{kind: tokenLetterDigit, val: `ゴー`}},
-		{input: `prolog.`, token: Token{kind: tokenLetterDigit, val: `prolog`}},
+		{input: `改善`, token: Token{kind: TokenLetterDigit, val: `改善`}},
+		{input: `プロログ`, token: Token{kind: TokenLetterDigit, val: `プロログ`}},
+		{input: `ぷろろぐ`, token: Token{kind: TokenLetterDigit, val: `ぷろろぐ`}},
+		{input: `프롤로그`, token: Token{kind: TokenLetterDigit, val: `프롤로그`}},
+		{input: `برولوغ`, token: Token{kind: TokenLetterDigit, val: `برولوغ`}},
+		{input: `פרולוג`, token: Token{kind: TokenLetterDigit, val: `פרולוג`}},
+		{input: `ゴー`, token: Token{kind: TokenLetterDigit, val: `ゴー`}},
+		{input: `prolog.`, token: Token{kind: TokenLetterDigit, val: `prolog`}},
 		{input: `prolog🙈`, err: errMonkey},
 
-		{input: `..`, token: Token{kind: tokenGraphic, val: `..`}},
-		{input: `#`, token: Token{kind: tokenGraphic, val: `#`}},
-		{input: `\`, token: Token{kind: tokenGraphic, val: `\`}},
-		{input: `∀`, token: Token{kind: tokenGraphic, val: `∀`}},
-		{input: `⨀`, token: Token{kind: tokenGraphic, val: `⨀`}},
+		{input: `..`, token: Token{kind: TokenGraphic, val: `..`}},
+		{input: `#`, token: Token{kind: TokenGraphic, val: `#`}},
+		{input: `\`, token: Token{kind: TokenGraphic, val: `\`}},
+		{input: `∀`, token: Token{kind: TokenGraphic, val: `∀`}},
+		{input: `⨀`, token: Token{kind: TokenGraphic, val: `⨀`}},
 		{input: `+🙈`, err: errMonkey},
 
-		{input: `'abc'`, token: Token{kind: tokenQuoted, val: "'abc'"}},
-		{input: `'abc'.`, token: Token{kind: tokenQuoted, val: "'abc'"}},
-		{input: `'don''t panic'`, token: Token{kind: tokenQuoted, val: "'don''t panic'"}},
+		{input: `'abc'`, token: Token{kind: TokenQuoted, val: "'abc'"}},
+		{input: `'abc'.`, token: Token{kind: TokenQuoted, val: "'abc'"}},
+		{input: `'don''t panic'`, token: Token{kind: TokenQuoted, val: "'don''t panic'"}},
 		{input: `'this is \
-a quoted ident'`, token: Token{kind: tokenQuoted, val: "'this is \\\na quoted ident'"}},
-		{input: `'\a'`, token: Token{kind: tokenQuoted, val: "'\\a'"}},
-		{input: `'\b'`, token: Token{kind: tokenQuoted, val: "'\\b'"}},
-		{input: `'\f'`, token: Token{kind: tokenQuoted, val: "'\\f'"}},
-		{input: `'\n'`, token: Token{kind: tokenQuoted, val: "'\\n'"}},
-		{input: `'\r'`, token: Token{kind: tokenQuoted, val: "'\\r'"}},
-		{input: `'\t'`, token: Token{kind: tokenQuoted, val: "'\\t'"}},
-		{input: `'\v'`, token: Token{kind: tokenQuoted, val: "'\\v'"}},
-		{input: `'\xa3\'`, token: Token{kind: tokenQuoted, val: "'\\xa3\\'"}},
-		{input: `'\xa333333333\'`, token: Token{kind: tokenInvalid, val: `'\xa333333333\'`}},
-		{input: `'\xa333333333\'.`, token: Token{kind: tokenInvalid, val: `'\xa333333333\'`}},
-		{input: `'\43333333\'`, token: Token{kind: tokenInvalid, val: `'\43333333\'`}},
-		{input: `'\\'`, token: Token{kind: tokenQuoted, val: `'\\'`}},
-		{input: `'\''`, token: Token{kind: tokenQuoted, val: `'\''`}},
-		{input: `'\"'`, token: Token{kind: tokenQuoted, val: `'\"'`}},
-		{input: "'`'", token: Token{kind: tokenQuoted, val: "'`'"}},
-		{input: "'\\`'", token: Token{kind: tokenQuoted, val: "'\\`'"}},
+a quoted ident'`, token: Token{kind: TokenQuoted, val: "'this is \\\na quoted ident'"}},
+		{input: `'\a'`, token: Token{kind: TokenQuoted, val: "'\\a'"}},
+		{input: `'\b'`, token: Token{kind: TokenQuoted, val: "'\\b'"}},
+		{input: `'\f'`, token: Token{kind: TokenQuoted, val: "'\\f'"}},
+		{input: `'\n'`, token: Token{kind: TokenQuoted, val: "'\\n'"}},
+		{input: `'\r'`, token: Token{kind: TokenQuoted, val: "'\\r'"}},
+		{input: `'\t'`, token: Token{kind: TokenQuoted, val: "'\\t'"}},
+		{input: `'\v'`, token: Token{kind: TokenQuoted, val: "'\\v'"}},
+		{input: `'\xa3\'`, token: Token{kind: TokenQuoted, val: "'\\xa3\\'"}},
+		{input: `'\xa333333333\'`, token: Token{kind: TokenInvalid, val: `'\xa333333333\'`}},
+		{input: `'\xa333333333\'.`, token: Token{kind: TokenInvalid, val: `'\xa333333333\'`}},
+		{input: `'\43333333\'`, token: Token{kind: TokenInvalid, val: `'\43333333\'`}},
+		{input: `'\\'`, token: Token{kind: TokenQuoted, val: `'\\'`}},
+		{input: `'\''`, token: Token{kind: TokenQuoted, val: `'\''`}},
+		{input: `'\"'`, token: Token{kind: TokenQuoted, val: `'\"'`}},
+		{input: "'`'", token: Token{kind: TokenQuoted, val: "'`'"}},
+		{input: "'\\`'", token: Token{kind: TokenQuoted, val: "'\\`'"}},
 		{input: `'`, err: io.EOF},
 		{input: `'\`, err: io.EOF},
 		{input: `'\x`, err: io.EOF},
-		{input: `'\xG`, token: Token{kind: tokenInvalid, val: `'\xG`}},
+		{input: `'\xG`, token: Token{kind: TokenInvalid, val: `'\xG`}},
 		{input: `'\0`, err: io.EOF},
-		{input: `'\08`, token: Token{kind: tokenInvalid, val: `'\08`}},
-		{input: "'\x01'", token: Token{kind: tokenInvalid, val: "'\x01"}},
+		{input: `'\08`, token: Token{kind: TokenInvalid, val: `'\08`}},
+		{input: "'\x01'", token: Token{kind: TokenInvalid, val: "'\x01"}},
 		{input: `'abc'🙈`, err: errMonkey},
 		{input: `'this is \🙈'`, err: errMonkey},
 
-		{input: `X`, token: Token{kind: tokenVariable, val: `X`}},
-		{input: `X.`, token: Token{kind: tokenVariable, val: `X`}},
-		{input: `_123`, token: Token{kind: tokenVariable, val: `_123`}},
+		{input: `X`, token: Token{kind: TokenVariable, val: `X`}},
+		{input: `X.`, token: Token{kind: TokenVariable, val: `X`}},
+		{input: `_123`, token: Token{kind: TokenVariable, val: `_123`}},
 		{input: `X🙈`, err: errMonkey},
 
-		{input: `012345`, token: Token{kind: tokenInteger, val: "012345"}},
-		{input: `012345,`, token: Token{kind: tokenInteger, val: "012345"}},
-		{input: `012345..`, token: Token{kind: tokenInteger, val: "012345"}},
-		{input: `0b10110101`, token: Token{kind: tokenInteger, val: "0b10110101"}},
-		{input: `0b10110101.`, token: Token{kind: tokenInteger, val: "0b10110101"}},
-		{input: `0b`, token: Token{kind: tokenInteger, val: "0"}},
-		{input: `0b.`, token: Token{kind: tokenInteger, val: "0"}},
-		{input: `0o567`, token: Token{kind: tokenInteger, val: "0o567"}},
-		{input: `0o567.`, token: Token{kind: tokenInteger, val: "0o567"}},
-		{input: `0o`, token: Token{kind: tokenInteger, val: "0"}},
-		{input: `0o.`, token: Token{kind: tokenInteger, val: "0"}},
-		{input: `0x89ABC`, token: Token{kind: tokenInteger, val: "0x89ABC"}},
-		{input: `0x89ABC.`, token: Token{kind: tokenInteger, val: "0x89ABC"}},
-		{input: `0x`, token: Token{kind: tokenInteger, val: "0"}},
-		{input: `0x.`, token: Token{kind: tokenInteger, val: "0"}},
-		{input: `0'a`, token: Token{kind: tokenInteger, val: "0'a"}},
-		{input: `0'''`, token: Token{kind: tokenInteger, val: "0'''"}},
-		{input: `0''`, token: Token{kind: tokenInteger, val: "0"}},
-		{input: `0''.`, token: Token{kind: tokenInteger, val: "0"}},
-		{input: `0'\n`, token: Token{kind: tokenInteger, val: `0'\n`}},
+		{input: `012345`, token: Token{kind: TokenInteger, val: "012345"}},
+		{input: `012345,`, token: Token{kind: TokenInteger, val: "012345"}},
+		{input: `012345..`, token: Token{kind: TokenInteger, val: "012345"}},
+		{input: `0b10110101`, token: Token{kind: TokenInteger, val: "0b10110101"}},
+		{input: `0b10110101.`, token: Token{kind: TokenInteger, val: "0b10110101"}},
+		{input: `0b`, token: Token{kind: TokenInteger, val: "0"}},
+		{input: `0b.`, token: Token{kind: TokenInteger, val: "0"}},
+		{input: `0o567`, token: Token{kind: TokenInteger, val: "0o567"}},
+		{input: `0o567.`, token: Token{kind: TokenInteger, val: "0o567"}},
+		{input: `0o`, token: Token{kind: TokenInteger, val: "0"}},
+		{input: `0o.`, token: Token{kind: TokenInteger, val: "0"}},
+		{input: `0x89ABC`, token: Token{kind: TokenInteger, val: "0x89ABC"}},
+		{input: `0x89ABC.`, token: Token{kind: TokenInteger, val: "0x89ABC"}},
+		{input: `0x`, token: Token{kind: TokenInteger, val: "0"}},
+		{input: `0x.`, token: Token{kind: TokenInteger, val: "0"}},
+		{input: `0'a`, token: Token{kind: TokenInteger, val: "0'a"}},
+		{input: `0'''`, token: Token{kind: TokenInteger, val: "0'''"}},
+		{input: `0''`, token: Token{kind: TokenInteger, val: "0"}},
+		{input: `0''.`, token: Token{kind: TokenInteger, val: "0"}},
+		{input: `0'\n`, token: Token{kind: TokenInteger, val: `0'\n`}},
 		{input: `0'\
-`, token: Token{kind: tokenInteger, val: `0`}},
+`, token: Token{kind: TokenInteger, val: `0`}},
 		{input: `0'\`, err: io.EOF},
-		{input: `0'\q`, token: Token{kind: tokenInvalid, val: `0'\q`}},
-		{input: `0'\😀`, token: Token{kind: tokenInvalid, val: `0'\😀`}},
+		{input: `0'\q`, token: Token{kind: TokenInvalid, val: `0'\q`}},
+		{input: `0'\😀`, token: Token{kind: TokenInvalid, val: `0'\😀`}},
 		{input: `0'`, err: io.EOF},
-		{input: "0'\x01", token: Token{kind: tokenInvalid, val: "0'\x01"}},
-		{input: `0`, token: Token{kind: tokenInteger, val: "0"}},
-		{input: `0.`, token: Token{kind: tokenInteger, val: "0"}},
+		{input: "0'\x01", token: Token{kind: TokenInvalid, val: "0'\x01"}},
+		{input: `0`, token: Token{kind: TokenInteger, val: "0"}},
+		{input: `0.`, token: Token{kind: TokenInteger, val: "0"}},
 		{input: `0🙈`, err: errMonkey},
 		{input: `0'🙈`, err: errMonkey},
 		{input: `0''🙈`, err: errMonkey},
@@ -136,21 +138,21 @@ a quoted ident'`, token: Token{kind: tokenQuoted, val: "'this is \\\na quoted id
 		{input: `0o567🙈`, err: errMonkey},
 		{input: `0x89ABC🙈`, err: errMonkey},
 
-		{input: `2.34`, token: Token{kind: tokenFloatNumber, val: "2.34"}},
-		{input: `2.34.`, token: Token{kind: tokenFloatNumber, val: "2.34"}},
-		{input: `2.34E5`, token: Token{kind: tokenFloatNumber, val: "2.34E5"}},
-		{input: `2.34E5.`, token: Token{kind: tokenFloatNumber, val: "2.34E5"}},
-		{input: `2.34E`, token: Token{kind: tokenFloatNumber, val: "2.34"}},
-		{input: `2.34E.`, token: Token{kind: tokenFloatNumber, val: "2.34"}},
-		{input: `2.34E+5`, token: Token{kind: tokenFloatNumber, val: "2.34E+5"}},
-		{input: `2.34E+5.`, token: Token{kind: tokenFloatNumber, val: "2.34E+5"}},
-		{input: `2.34E+`, token: Token{kind: tokenFloatNumber, val: "2.34"}},
-		{input: `2.34E+.`, token: Token{kind: tokenFloatNumber, val: "2.34"}},
-		{input: `2.34E-10`, token: Token{kind: tokenFloatNumber, val: "2.34E-10"}},
-		{input: `2.34E-10.`, token: Token{kind: tokenFloatNumber, val: "2.34E-10"}},
-		{input: `2.34E-`, token: Token{kind: tokenFloatNumber, val: "2.34"}},
-		{input: `2.34E-.`, token: Token{kind: tokenFloatNumber, val: "2.34"}},
-		{input: `0.333`, token: Token{kind: tokenFloatNumber, val: "0.333"}},
+		{input: `2.34`, token: Token{kind: TokenFloatNumber, val: "2.34"}},
+		{input: `2.34.`, token: Token{kind: TokenFloatNumber, val: "2.34"}},
+		{input: `2.34E5`, token: Token{kind: TokenFloatNumber, val: "2.34E5"}},
+		{input: `2.34E5.`, token: Token{kind: TokenFloatNumber, val: "2.34E5"}},
+		{input: `2.34E`, token: Token{kind: TokenFloatNumber, val: "2.34"}},
+		{input: `2.34E.`, token: Token{kind: TokenFloatNumber, val: "2.34"}},
+		{input: `2.34E+5`, token: Token{kind: TokenFloatNumber, val: "2.34E+5"}},
+		{input: `2.34E+5.`, token: Token{kind: TokenFloatNumber, val: "2.34E+5"}},
+		{input: `2.34E+`, token: Token{kind: TokenFloatNumber, val: "2.34"}},
+		{input: `2.34E+.`, token: Token{kind: TokenFloatNumber, val: "2.34"}},
+		{input: `2.34E-10`, token: Token{kind: TokenFloatNumber, val: "2.34E-10"}},
+		{input: `2.34E-10.`, token: Token{kind: TokenFloatNumber, val: "2.34E-10"}},
+		{input: `2.34E-`, token: Token{kind: TokenFloatNumber, val: "2.34"}},
+		{input: `2.34E-.`, token: Token{kind: TokenFloatNumber, val: "2.34"}},
+		{input: `0.333`, token: Token{kind: TokenFloatNumber, val: "0.333"}},
 		{input: `2.34🙈`, err: errMonkey},
 		{input: `2.34E🙈`, err: errMonkey},
 		{input: `2.34E+🙈`, err: errMonkey},
@@ -159,37 +161,37 @@ a quoted ident'`, token: Token{kind: tokenQuoted, val: "'this is \\\na quoted id
 		{input: `2.34E+5🙈`, err: errMonkey},
 		{input: `2.34E-10🙈`, err: errMonkey},
 
-		{input: `"abc"`, token: Token{kind: tokenDoubleQuotedList, val: `"abc"`}},
-		{input: `"abc".`, token: Token{kind: tokenDoubleQuotedList, val: `"abc"`}},
-		{input: `"don""t panic"`, token: Token{kind: tokenDoubleQuotedList, val: `"don""t panic"`}},
+		{input: `"abc"`, token: Token{kind: TokenDoubleQuotedList, val: `"abc"`}},
+		{input: `"abc".`, token: Token{kind: TokenDoubleQuotedList, val: `"abc"`}},
+		{input: `"don""t panic"`, token: Token{kind: TokenDoubleQuotedList, val: `"don""t panic"`}},
 		{input: `"this is \
-a quoted ident"`, token: Token{kind: tokenDoubleQuotedList, val: `"this is \
+a quoted ident"`, token: Token{kind: TokenDoubleQuotedList, val: `"this is \
 a quoted ident"`}},
-		{input: `"\a"`, token: Token{kind: tokenDoubleQuotedList, val: `"\a"`}},
-		{input: `"\b"`, token: Token{kind: tokenDoubleQuotedList, val: `"\b"`}},
-		{input: `"\f"`, token: Token{kind: tokenDoubleQuotedList, val: `"\f"`}},
-		{input: `"\n"`, token: Token{kind: tokenDoubleQuotedList, val: `"\n"`}},
-		{input: `"\r"`, token: Token{kind: tokenDoubleQuotedList, val: `"\r"`}},
-		{input: `"\t"`, token: Token{kind: tokenDoubleQuotedList, val: `"\t"`}},
-		{input: `"\v"`, token: Token{kind: tokenDoubleQuotedList, val: `"\v"`}},
-		{input: `"\xa3\"`, token: Token{kind: tokenDoubleQuotedList, val: `"\xa3\"`}},
+		{input: `"\a"`, token: Token{kind: TokenDoubleQuotedList, val: `"\a"`}},
+		{input: `"\b"`, token: Token{kind: TokenDoubleQuotedList, val: `"\b"`}},
+		{input: `"\f"`, token: Token{kind: TokenDoubleQuotedList, val: `"\f"`}},
+		{input: `"\n"`, token: Token{kind: TokenDoubleQuotedList, val: `"\n"`}},
+		{input: `"\r"`, token: Token{kind: TokenDoubleQuotedList, val: `"\r"`}},
+		{input: `"\t"`, token: Token{kind: TokenDoubleQuotedList, val: `"\t"`}},
+		{input: `"\v"`, token: Token{kind: TokenDoubleQuotedList, val: `"\v"`}},
+		{input: `"\xa3\"`, token: Token{kind: TokenDoubleQuotedList, val: `"\xa3\"`}},
 		{input: `"\xa3`, err: io.EOF},
-		{input: `"\xa3g`, token: Token{kind: tokenInvalid, val: `"\xa3g`}},
-		{input: `"\43\"`, token: Token{kind: tokenDoubleQuotedList, val: `"\43\"`}},
+		{input: `"\xa3g`, token: Token{kind: TokenInvalid, val: `"\xa3g`}},
+		{input: `"\43\"`, token: Token{kind: TokenDoubleQuotedList, val: `"\43\"`}},
 		{input: `"\43`, err: io.EOF},
-		{input: `"\438`, token: Token{kind: tokenInvalid, val: `"\438`}},
-		{input: `"\\"`, token: Token{kind: tokenDoubleQuotedList, val: `"\\"`}},
-		{input: `"\'"`, token: Token{kind: tokenDoubleQuotedList, val: `"\'"`}},
-		{input: `"\""`, token: Token{kind: tokenDoubleQuotedList, val: `"\""`}},
-		{input: "\"\\`\"", token: Token{kind: tokenDoubleQuotedList, val: "\"\\`\""}},
+		{input: `"\438`, token: Token{kind: TokenInvalid, val: `"\438`}},
+		{input: `"\\"`, token: Token{kind: TokenDoubleQuotedList, val: `"\\"`}},
+		{input: `"\'"`, token: Token{kind: TokenDoubleQuotedList, val: `"\'"`}},
+		{input: `"\""`, token: Token{kind: TokenDoubleQuotedList, val: `"\""`}},
+		{input: "\"\\`\"", token: Token{kind: TokenDoubleQuotedList, val: "\"\\`\""}},
 		{input: `"`, err: io.EOF},
 		{input: `"\`, err: io.EOF},
 		{input: `"abc"🙈`, err: errMonkey},
 
-		{input: "\x01", token: Token{kind: tokenInvalid, val: "\x01"}},
+		{input: "\x01", token: Token{kind: TokenInvalid, val: "\x01"}},
 
-		{input: `abc`, charConversions: map[rune]rune{'b': 'a'}, token: Token{kind: tokenLetterDigit, val: "aac"}},
-		{input: `'abc'`, charConversions: map[rune]rune{'b': 'a'}, token: Token{kind: tokenQuoted, val: "'abc'"}},
+		{input: `abc`, charConversions: map[rune]rune{'b': 'a'}, token: Token{kind: TokenLetterDigit, val: "aac"}},
+		{input: `'abc'`, charConversions: map[rune]rune{'b': 'a'}, token: Token{kind: TokenQuoted, val: "'abc'"}},
 	}
 
 	for _, tt := range tests {
@@ -203,6 +205,153 @@ a quoted ident"`}},
 	}
 }
 
+func TestLexer_pos(t *testing.T) {
+	l := Lexer{input: newRuneRingBuffer(strings.NewReader("foo(X) :-\n\t% comment\n\tbär(X).\n"))}
+
+	var ps []Position
+	for {
+		tok, err := l.Token()
+		assert.NoError(t, err)
+		ps = append(ps, l.pos)
+		if tok.kind == TokenEnd {
+			break
+		}
+	}
+	assert.Equal(t, []Position{
+		{Offset: 0, Line: 1, Column: 1},  // foo
+		{Offset: 3, Line: 1, Column: 4},  // (
+		{Offset: 4, Line: 1, Column: 5},  // X
+		{Offset: 5, Line: 1, Column: 6},  // )
+		{Offset: 7, Line: 1, Column: 8},  // :-
+		{Offset: 22, Line: 3, Column: 2}, // bär
+		{Offset: 26, Line: 3, Column: 5}, // (
+		{Offset: 27, Line: 3, Column: 6}, // X
+		{Offset: 28, Line: 3, Column: 7}, // )
+		{Offset: 29, Line: 3, Column: 8}, // .
+	}, ps)
+}
+
+func TestRuneRingBuffer_lineOf(t *testing.T) {
+	b := newRuneRingBuffer(strings.NewReader("foo(a,\r\nbar(b)).\nbaz."))
+
+	read := func(n int) string {
+		var sb strings.Builder
+		for i := 0; i < n; i++ {
+			r, _, err := b.ReadRune()
+			assert.NoError(t, err)
+			sb.WriteRune(r)
+		}
+		return sb.String()
+	}
+
+	assert.Equal(t, "foo(", read(4))
+	assert.Equal(t, "foo(a,", b.lineOf(Position{Line: 1, Column: 4}))
+	assert.Equal(t, "a,\r\nbar", read(7))
+	assert.Equal(t, "", b.lineOf(Position{Line: 1, Column: 6}))
+	assert.Equal(t, "bar(b)).", b.lineOf(Position{Line: 2, Column: 2}))
+	assert.Equal(t, "(b)).\n", read(6))
+	assert.Equal(t, "bar(b)).", b.lineOf(Position{Line: 2, Column: 8}))
+	assert.Equal(t, "", b.lineOf(Position{Line: 3, Column: 1}))
+	assert.Equal(t, "baz.", read(4))
+	assert.Equal(t, "baz.", b.lineOf(Position{Line: 3, Column: 4}))
+
+	t.Run("stream", func(t *testing.T) {
+		b := newRuneRingBuffer(bufio.NewReader(strings.NewReader("foo(a,\nbar).")))
+		for i := 0; i < 4; i++ {
+			_, _, err := b.ReadRune()
+			assert.NoError(t, err)
+		}
+		assert.Equal(t, "foo(", b.lineOf(Position{Line: 1, Column: 4}))
+		r, _, err := b.ReadRune()
+		assert.NoError(t, err)
+		assert.Equal(t, 'a', r)
+	})
+}
+
+func TestLexer_comments(t *testing.T) {
+	l := Lexer{input: newRuneRingBuffer(strings.NewReader("% head\nfoo(X) :- /* a **/ X / 2 % tail\n\t(a). % eof")), comments: true}
+
+	type token struct {
+		Token
+		pos Position
+	}
+	var ts []token
+	for {
+		tok, err := l.Token()
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(t, err)
+		ts = append(ts, token{Token: tok, pos: l.pos})
+	}
+	assert.Equal(t, []token{
+		{Token: Token{kind: TokenComment, val: "% head"}, pos: Position{Offset: 0, Line: 1, Column: 1}},
+		{Token: Token{kind: TokenLetterDigit, val: "foo"}, pos: Position{Offset: 7, Line: 2, Column: 1}},
+		{Token: Token{kind: TokenOpenCT, val: "("}, pos: Position{Offset: 10, Line: 2, Column: 4}},
+		{Token: Token{kind: TokenVariable, val: "X"}, pos: Position{Offset: 11, Line: 2, Column: 5}},
+		{Token: Token{kind: TokenClose, val: ")"}, pos: Position{Offset: 12, Line: 2, Column: 6}},
+		{Token: Token{kind: TokenGraphic, val: ":-"}, pos: Position{Offset: 14, Line: 2, Column: 8}},
+		{Token: Token{kind: TokenComment, val: "/* a **/"}, pos: Position{Offset: 17, Line: 2, Column: 11}},
+		{Token: Token{kind: TokenVariable, val: "X"}, pos: Position{Offset: 26, Line: 2, Column: 20}},
+		{Token: Token{kind: TokenGraphic, val: "/"}, pos: Position{Offset: 28, Line: 2, Column: 22}},
+		{Token: Token{kind: TokenInteger, val: "2"}, pos: Position{Offset: 30, Line: 2, Column: 24}},
+		{Token: Token{kind: TokenComment, val: "% tail"}, pos: Position{Offset: 32, Line: 2, Column: 26}},
+		{Token: Token{kind: TokenOpen, val: "("}, pos: Position{Offset: 40, Line: 3, Column: 2}},
+		{Token: Token{kind: TokenLetterDigit, val: "a"}, pos: Position{Offset: 41, Line: 3, Column: 3}},
+		{Token: Token{kind: TokenClose, val: ")"}, pos: Position{Offset: 42, Line: 3, Column: 4}},
+		{Token: Token{kind: TokenEnd, val: "."}, pos: Position{Offset: 43, Line: 3, Column: 5}},
+		{Token: Token{kind: TokenComment, val: "% eof"}, pos: Position{Offset: 45, Line: 3, Column: 7}},
+	}, ts)
+}
+
+func TestNewLexer(t *testing.T) {
+	t.Run("char conversion on", func(t *testing.T) {
+		vm := VM{charConvEnabled: true, charConversions: map[rune]rune{'b': 'a'}}
+		l := NewLexer(&vm, strings.NewReader(`abc 'abc'`))
+		tok, err := l.Token()
+		assert.NoError(t, err)
+		assert.Equal(t, Token{kind: TokenLetterDigit, val: "aac"}, tok)
+		tok, err = l.Token()
+		assert.NoError(t, err)
+		assert.Equal(t, Token{kind: TokenQuoted, val: "'abc'"}, tok)
+		assert.Equal(t, Position{Offset: 4, Line: 1, Column: 5}, l.Pos())
+	})
+
+	t.Run("char conversion off", func(t *testing.T) {
+		vm := VM{charConversions: map[rune]rune{'b': 'a'}}
+		l := NewLexer(&vm, strings.NewReader(`abc`))
+		tok, err := l.Token()
+		assert.NoError(t, err)
+		assert.Equal(t, Token{kind: TokenLetterDigit, val: "abc"}, tok)
+	})
+}
+
+func TestToken_Name(t *testing.T) {
+	tests := []struct {
+		token Token
+		name  Atom
+		ok    bool
+	}{
+		{token: Token{kind: TokenLetterDigit, val: "foo"}, name: NewAtom("foo"), ok: true},
+		{token: Token{kind: TokenGraphic, val: "=.."}, name: NewAtom("=.."), ok: true},
+		{token: Token{kind: TokenQuoted, val: `'a\nb'`}, name: NewAtom("a\nb"), ok: true},
+		{token: Token{kind: TokenSemicolon, val: ";"}, name: atomSemiColon, ok: true},
+		{token: Token{kind: TokenCut, val: "!"}, name: atomCut, ok: true},
+		{token: Token{kind: TokenVariable, val: "X"}},
+		{token: Token{kind: TokenComma, val: ","}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.token.String(), func(t *testing.T) {
+			name, ok := tt.token.Name()
+			assert.Equal(t, tt.name, name)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.token.kind, tt.token.Kind())
+			assert.Equal(t, tt.token.val, tt.token.Val())
+		})
+	}
+}
+
 var errMonkey = errors.New("monkey")
 
 type noMonkeyReader struct {
@@ -218,5 +367,5 @@ func (n noMonkeyReader) ReadRune() (rune, int, error) {
 }
 
 func TestTokenKind_GoString(t *testing.T) {
-	assert.Equal(t, "invalid", tokenInvalid.GoString())
+	assert.Equal(t, "invalid", TokenInvalid.GoString())
 }
@@ -0,0 +1,118 @@
+package engine
+
+import (
+	"context"
+)
+
+var varDepth = NewVariable()
+
+// Limits are upper bounds of resources that a query can consume. The zero value for each field means unlimited.
+// Exceeding one of them results in a resource error e.g. error(resource_error(inferences), _).
+type Limits struct {
+	// Inferences is the maximum number of predicate calls, i.e. VM.Arrive.
+	// Once it's exceeded, any further calls including the recovery of catch/3 fail with the resource error.
+	Inferences int64
+
+	// Depth is the maximum nesting level of predicate calls.
+	Depth int
+
+	// PromiseStack is the maximum size of the stack of choice points and continuations in Promise.Force.
+	PromiseStack int
+
+	// TermSize is the maximum number of nodes in an argument of a predicate call.
+	TermSize int
+
+	// Bindings is the maximum number of variable bindings.
+	Bindings int
+}
+
+// usage is the resources consumed by a query so far.
+type usage struct {
+	limits     Limits
+	inferences int64
+}
+
+type usageKey struct{}
+
+// WithLimits returns a context for a query which counts the resources consumed against vm.Limits.
+// Nested executions of Promise.Force with the context share the count.
+// If ctx is already for a query, it returns ctx as is.
+// Interpreter makes one for every query. Without it, vm.Limits are not enforced.
+func (vm *VM) WithLimits(ctx context.Context) context.Context {
+	if _, ok := usageOf(ctx); ok {
+		return ctx
+	}
+	vm.features.set(featureLimits, vm.Limits != (Limits{}))
+	return context.WithValue(ctx, usageKey{}, &usage{limits: vm.Limits})
+}
+
+func usageOf(ctx context.Context) (*usage, bool) {
+	u, ok := ctx.Value(usageKey{}).(*usage)
+	return u, ok
+}
+
+// limited invokes p after checking if the call doesn't exceed vm.Limits.
+func (vm *VM) limited(p procedure, args []Term, k Cont, env *Env) *Promise {
+	return Delay(func(ctx context.Context) *Promise {
+		u, ok := usageOf(ctx)
+		if !ok {
+			return p.call(vm, args, k, env)
+		}
+		l := u.limits
+
+		if l.Inferences > 0 {
+			u.inferences++
+			if u.inferences > l.Inferences {
+				return Error(resourceError(resourceInferences, env))
+			}
+		}
+
+		if l.Depth > 0 {
+			var d Integer
+			if t, ok := env.lookup(varDepth); ok {
+				d = t.(Integer)
+			}
+			if int(d) >= l.Depth {
+				return Error(resourceError(resourceDepth, env))
+			}
+			env = env.bind(varDepth, d+1)
+			k0 := k
+			k = func(env *Env) *Promise {
+				return k0(env.bind(varDepth, d))
+			}
+		}
+
+		if l.Bindings > 0 && env.len() > l.Bindings {
+			return Error(resourceError(resourceBindings, env))
+		}
+
+		if l.TermSize > 0 {
+			for _, a := range args {
+				if termSizeExceeds(a, l.TermSize, env) {
+					return Error(resourceError(resourceTermSize, env))
+				}
+			}
+		}
+
+		return p.call(vm, args, k, env)
+	})
+}
+
+// termSizeExceeds checks if the number of nodes in t is more than n.
+// It stops traversing as soon as it exceeds n so that it works for large or cyclic terms.
+func termSizeExceeds(t Term, n int, env *Env) bool {
+	stack := []Term{t}
+	for len(stack) > 0 {
+		t, stack = env.Resolve(stack[len(stack)-1]), stack[:len(stack)-1]
+		n--
+		if n < 0 {
+			return true
+		}
+		if c, ok := t.(Compound); ok {
+			for i := 0; i < c.Arity(); i++ {
+				stack = append(stack, c.Arg(i))
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,115 @@
+package engine
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVM_Limits(t *testing.T) {
+	tests := []struct {
+		title  string
+		limits Limits
+		text   string
+		goal   Term
+		ok     bool
+		err    error
+	}{
+		{title: "inferences", limits: Limits{Inferences: 100}, text: `
+:-(p, ','(p, p)).
+`, goal: NewAtom("p"), err: ResourceError(atomInferences, nil)},
+		{title: "inferences: within the limit", limits: Limits{Inferences: 100}, text: `
+p(0).
+:-(p(s(N)), p(N)).
+`, goal: NewAtom("p").Apply(NewAtom("s").Apply(NewAtom("s").Apply(Integer(0)))), ok: true},
+		{title: "depth", limits: Limits{Depth: 10}, text: `
+:-(p(X), p(f(X))).
+`, goal: NewAtom("p").Apply(NewVariable()), err: ResourceError(atomDepth, nil)},
+		{title: "depth: sequential calls", limits: Limits{Depth: 2}, text: `
+q.
+:-(p, ','(q, ','(q, ','(q, q)))).
+`, goal: NewAtom("p"), ok: true},
+		{title: "promise stack", limits: Limits{PromiseStack: 100}, text: `
+:-(p(X), p(f(X))).
+`, goal: NewAtom("p").Apply(NewVariable()), err: ResourceError(atomPromiseStack, nil)},
+		{title: "term size", limits: Limits{TermSize: 10}, text: `
+:-(p(X), p(f(X, X))).
+`, goal: NewAtom("p").Apply(NewAtom("a")), err: ResourceError(atomTermSize, nil)},
+		{title: "bindings", limits: Limits{Bindings: 100}, text: `
+:-(p(X), p(f(X))).
+`, goal: NewAtom("p").Apply(NewVariable()), err: ResourceError(atomBindings, nil)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			var vm VM
+			assert.NoError(t, vm.Compile(context.Background(), tt.text))
+			vm.Limits = tt.limits
+			ok, err := Call(&vm, tt.goal, Success, nil).Force(vm.WithLimits(context.Background()))
+			assert.Equal(t, tt.ok, ok)
+			if tt.err == nil {
+				assert.NoError(t, err)
+				return
+			}
+			e, ok := err.(Exception)
+			assert.True(t, ok)
+			assert.Equal(t, tt.err.(Exception).term.(Compound).Arg(0), e.term.(Compound).Arg(0))
+		})
+	}
+
+	t.Run("per query", func(t *testing.T) {
+		var vm VM
+		assert.NoError(t, vm.Compile(context.Background(), `
+p(0).
+:-(p(s(N)), p(N)).
+`))
+		vm.Limits = Limits{Inferences: 5}
+		goal := NewAtom("p").Apply(NewAtom("s").Apply(NewAtom("s").Apply(Integer(0))))
+		for i := 0; i < 3; i++ {
+			ok, err := Call(&vm, goal, Success, nil).Force(vm.WithLimits(context.Background()))
+			assert.NoError(t, err)
+			assert.True(t, ok)
+		}
+	})
+
+	t.Run("catch", func(t *testing.T) {
+		var vm VM
+		vm.Register3(NewAtom("catch"), Catch)
+		vm.Register0(atomTrue, func(_ *VM, k Cont, env *Env) *Promise {
+			return k(env)
+		})
+		assert.NoError(t, vm.Compile(context.Background(), `
+:-(p, ','(p, p)).
+`))
+		vm.Limits = Limits{Depth: 10}
+		ok, err := Call(&vm, NewAtom("catch").Apply(NewAtom("p"), atomError.Apply(atomResourceError.Apply(atomDepth), NewVariable()), atomTrue), Success, nil).Force(vm.WithLimits(context.Background()))
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("term expansion", func(t *testing.T) {
+		var vm VM
+		vm.Register2(NewAtom("expand_term"), ExpandTerm)
+		assert.NoError(t, vm.Compile(context.Background(), `
+p(0).
+:-(p(s(N)), p(N)).
+:-(term_expansion(a, b), p(s(s(s(s(0)))))).
+`))
+		vm.Limits = Limits{Inferences: 8}
+		p := NewAtom("p").Apply(NewAtom("s").Apply(NewAtom("s").Apply(NewAtom("s").Apply(NewAtom("s").Apply(Integer(0))))))
+		ok, err := Call(&vm, atomComma.Apply(p, NewAtom("expand_term").Apply(NewAtom("a"), NewVariable())), Success, nil).Force(vm.WithLimits(context.Background()))
+		assert.False(t, ok)
+		e, ok := err.(Exception)
+		assert.True(t, ok)
+		assert.Equal(t, atomResourceError.Apply(atomInferences), e.term.(Compound).Arg(0))
+	})
+}
+
+func TestTermSizeExceeds(t *testing.T) {
+	x := NewVariable()
+	f := NewAtom("f")
+	assert.False(t, termSizeExceeds(f.Apply(NewAtom("a"), NewAtom("b")), 3, nil))
+	assert.True(t, termSizeExceeds(f.Apply(NewAtom("a"), NewAtom("b")), 2, nil))
+	assert.True(t, termSizeExceeds(x, 2, NewEnv().bind(x, f.Apply(x))))
+}
@@ -0,0 +1,331 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PortrayClause writes clause to the stream as source text followed by a full stop.
+// Variables are named A, B, ... in the order of appearance and singletons are written as _.
+func PortrayClause(vm *VM, streamOrAlias, clause Term, k Cont, env *Env) *Promise {
+	s, err := stream(vm, streamOrAlias, env)
+	if err != nil {
+		return Error(err)
+	}
+
+	w, err := s.textWriter()
+	switch {
+	case errors.Is(err, errWrongIOMode):
+		return Error(permissionError(operationOutput, permissionTypeStream, streamOrAlias, env))
+	case errors.Is(err, errWrongStreamType):
+		return Error(permissionError(operationOutput, permissionTypeBinaryStream, streamOrAlias, env))
+	case err != nil:
+		return Error(err)
+	}
+
+	if err := portrayClause(w, clause, vm.operators, env); err != nil {
+		return Error(err)
+	}
+
+	return k(env)
+}
+
+// Listing writes the procedures indicated by spec to the current output.
+// spec is either a name, a predicate indicator Name/Arity, a non-terminal indicator Name//Arity, or a list of them.
+func Listing(vm *VM, spec Term, k Cont, env *Env) *Promise {
+	specs := []Term{spec}
+	if s, ok := env.Resolve(spec).(Compound); ok && s.Functor() == atomDot && s.Arity() == 2 {
+		specs = nil
+		iter := ListIterator{List: spec, Env: env}
+		for iter.Next() {
+			specs = append(specs, iter.Current())
+		}
+		if err := iter.Err(); err != nil {
+			return Error(err)
+		}
+	}
+
+	var pis []procedureIndicator
+	for _, s := range specs {
+		ps, err := vm.listingSpec(s, env)
+		if err != nil {
+			return Error(err)
+		}
+		pis = append(pis, ps...)
+	}
+
+	return Delay(func(context.Context) *Promise {
+		if err := vm.listing(pis); err != nil {
+			return Error(err)
+		}
+		return k(env)
+	})
+}
+
+// ListingAll writes all the user-defined procedures to the current output.
+func ListingAll(vm *VM, k Cont, env *Env) *Promise {
+	var pis []procedureIndicator
+	for pi, p := range vm.procedures {
+		if u, ok := p.(*userDefined); ok && !u.builtIn {
+			pis = append(pis, pi)
+		}
+	}
+	sortProcedureIndicators(pis)
+
+	return Delay(func(context.Context) *Promise {
+		if err := vm.listing(pis); err != nil {
+			return Error(err)
+		}
+		return k(env)
+	})
+}
+
+func (vm *VM) listingSpec(spec Term, env *Env) ([]procedureIndicator, error) {
+	switch s := env.Resolve(spec).(type) {
+	case Variable:
+		return nil, InstantiationError(env)
+	case Atom:
+		var pis []procedureIndicator
+		for pi := range vm.procedures {
+			if pi.name == s {
+				pis = append(pis, pi)
+			}
+		}
+		sortProcedureIndicators(pis)
+		return pis, nil
+	case Compound:
+		if (s.Functor() != atomSlash && s.Functor() != atomSlashSlash) || s.Arity() != 2 {
+			return nil, typeError(validTypePredicateIndicator, spec, env)
+		}
+		name, arity := env.Resolve(s.Arg(0)), env.Resolve(s.Arg(1))
+		switch name.(type) {
+		case Variable:
+			return nil, InstantiationError(env)
+		case Atom:
+			break
+		default:
+			return nil, typeError(validTypePredicateIndicator, spec, env)
+		}
+		switch arity.(type) {
+		case Variable:
+			return nil, InstantiationError(env)
+		case Integer:
+			break
+		default:
+			return nil, typeError(validTypePredicateIndicator, spec, env)
+		}
+		pi := procedureIndicator{name: name.(Atom), arity: arity.(Integer)}
+		if s.Functor() == atomSlashSlash {
+			pi.arity += 2
+		}
+		if _, ok := vm.procedures[pi]; !ok {
+			return nil, nil
+		}
+		return []procedureIndicator{pi}, nil
+	default:
+		return nil, typeError(validTypePredicateIndicator, spec, env)
+	}
+}
+
+func (vm *VM) listing(pis []procedureIndicator) error {
+	w, err := vm.output.textWriter()
+	if err != nil {
+		return err
+	}
+
+	ew := errWriter{w: w}
+	opts := WriteOptions{ops: vm.operators, quoted: true, priority: 999}
+	for _, pi := range pis {
+		u, ok := vm.procedures[pi].(*userDefined)
+		if !ok {
+			_, _ = fmt.Fprint(&ew, "%   Foreign: ")
+			_ = pi.WriteTerm(&ew, &opts, nil)
+			_, _ = fmt.Fprint(&ew, "\n\n")
+			continue
+		}
+
+		var decls []Atom
+		if u.dynamic {
+			decls = append(decls, atomDynamic)
+		}
+		if u.multifile {
+			decls = append(decls, atomMultifile)
+		}
+		if u.discontiguous {
+			decls = append(decls, atomDiscontiguous)
+		}
+		// The declarations are canonical since dynamic and the others aren't necessarily prefix operators.
+		for _, d := range decls {
+			_, _ = fmt.Fprintf(&ew, ":- %s(", d)
+			_ = pi.WriteTerm(&ew, &opts, nil)
+			_, _ = fmt.Fprint(&ew, ").\n")
+		}
+		if len(decls) > 0 {
+			_, _ = fmt.Fprint(&ew, "\n")
+		}
+
+		for _, c := range u.clauses {
+			// The variables in raw might be bound in the caller's environment. So we use the empty one.
+			_ = portrayClause(&ew, c.raw, vm.operators, nil)
+		}
+		_, _ = fmt.Fprint(&ew, "\n")
+	}
+	return ew.err
+}
+
+func sortProcedureIndicators(pis []procedureIndicator) {
+	sort.Slice(pis, func(i, j int) bool {
+		if pis[i].name != pis[j].name {
+			return pis[i].name.String() < pis[j].name.String()
+		}
+		return pis[i].arity < pis[j].arity
+	})
+}
+
+// portrayer writes a clause in the layout of source text.
+type portrayer struct {
+	w    errWriter
+	opts *WriteOptions
+	env  *Env
+}
+
+func portrayClause(w io.Writer, t Term, ops operators, env *Env) error {
+	p := portrayer{
+		w: errWriter{w: w},
+		opts: &WriteOptions{
+			ops:           ops,
+			quoted:        true,
+			variableNames: portrayVariableNames(t, env),
+		},
+		env: env,
+	}
+	p.clause(t)
+	return p.w.err
+}
+
+// portrayVariableNames names the variables in t A, B, ... in the order of appearance except singletons which are named _.
+func portrayVariableNames(t Term, env *Env) map[Variable]Atom {
+	var (
+		vars  []Variable
+		count = map[Variable]int{}
+		walk  func(Term)
+	)
+	walk = func(t Term) {
+		switch t := env.Resolve(t).(type) {
+		case Variable:
+			if count[t] == 0 {
+				vars = append(vars, t)
+			}
+			count[t]++
+		case Compound:
+			for i := 0; i < t.Arity(); i++ {
+				walk(t.Arg(i))
+			}
+		}
+	}
+	walk(t)
+
+	const letters = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	names := make(map[Variable]Atom, len(vars))
+	var n int
+	for _, v := range vars {
+		if count[v] == 1 {
+			names[v] = atomUnderscore
+			continue
+		}
+		name := string(letters[n%len(letters)])
+		if j := n / len(letters); j != 0 {
+			name += strconv.Itoa(j)
+		}
+		names[v] = NewAtom(name)
+		n++
+	}
+	return names
+}
+
+func (p *portrayer) clause(t Term) {
+	switch c := p.env.Resolve(t).(type) {
+	case Compound:
+		switch {
+		case c.Functor() == atomIf && c.Arity() == 2:
+			if b := p.env.Resolve(c.Arg(1)); b == atomTrue {
+				p.term(c.Arg(0), 1199)
+			} else {
+				p.term(c.Arg(0), 1199)
+				_, _ = fmt.Fprint(&p.w, " :-\n")
+				p.indent(4)
+				p.goal(b, 4)
+			}
+		case c.Functor() == atomIf && c.Arity() == 1:
+			_, _ = fmt.Fprint(&p.w, ":- ")
+			p.goal(c.Arg(0), 3)
+		default:
+			p.term(c, 1200)
+		}
+	default:
+		p.term(c, 1200)
+	}
+	_, _ = fmt.Fprint(&p.w, ".\n")
+}
+
+// goal writes t at the current column col. Conjunctions are written one goal per line and
+// control constructs are written as parenthesized blocks.
+func (p *portrayer) goal(t Term, col int) {
+	c, ok := p.env.Resolve(t).(Compound)
+	if !ok || c.Arity() != 2 {
+		p.term(t, 999)
+		return
+	}
+	switch c.Functor() {
+	case atomComma:
+		p.goal(c.Arg(0), col)
+		_, _ = fmt.Fprint(&p.w, ",\n")
+		p.indent(col)
+		p.goal(c.Arg(1), col)
+	case atomSemiColon, atomThen:
+		_, _ = fmt.Fprint(&p.w, "(   ")
+		p.disjunction(c, col)
+		_, _ = fmt.Fprint(&p.w, "\n")
+		p.indent(col)
+		_, _ = fmt.Fprint(&p.w, ")")
+	default:
+		p.term(t, 999)
+	}
+}
+
+func (p *portrayer) disjunction(t Term, col int) {
+	if c, ok := p.env.Resolve(t).(Compound); ok && c.Functor() == atomSemiColon && c.Arity() == 2 {
+		p.ifThen(c.Arg(0), col)
+		_, _ = fmt.Fprint(&p.w, "\n")
+		p.indent(col)
+		_, _ = fmt.Fprint(&p.w, ";   ")
+		p.disjunction(c.Arg(1), col)
+		return
+	}
+	p.ifThen(t, col)
+}
+
+func (p *portrayer) ifThen(t Term, col int) {
+	if c, ok := p.env.Resolve(t).(Compound); ok && c.Functor() == atomThen && c.Arity() == 2 {
+		p.goal(c.Arg(0), col+4)
+		_, _ = fmt.Fprint(&p.w, "\n")
+		p.indent(col)
+		_, _ = fmt.Fprint(&p.w, "->  ")
+		p.goal(c.Arg(1), col+4)
+		return
+	}
+	p.goal(t, col+4)
+}
+
+func (p *portrayer) term(t Term, priority Integer) {
+	_ = p.env.Resolve(t).WriteTerm(&p.w, p.opts.withPriority(priority), p.env)
+}
+
+func (p *portrayer) indent(col int) {
+	_, _ = fmt.Fprint(&p.w, strings.Repeat(" ", col))
+}
@@ -0,0 +1,166 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestPortrayClause(t *testing.T) {
+	var buf bytes.Buffer
+	w := &Stream{sink: &buf, mode: ioModeWrite}
+	r := &Stream{sink: &buf, mode: ioModeRead}
+	b := &Stream{sink: &buf, mode: ioModeWrite, streamType: streamTypeBinary}
+
+	var m mockWriter
+	m.On("Write", mock.Anything).Return(0, errors.New("failed"))
+	mw := &Stream{sink: &m, mode: ioModeWrite}
+
+	var vm VM
+	vm.operators.define(1200, operatorSpecifierXFX, atomIf)
+	vm.operators.define(1200, operatorSpecifierFX, atomIf)
+	vm.operators.define(1100, operatorSpecifierXFY, atomSemiColon)
+	vm.operators.define(1050, operatorSpecifierXFY, atomThen)
+	vm.operators.define(1000, operatorSpecifierXFY, atomComma)
+	vm.operators.define(700, operatorSpecifierXFX, atomEqual)
+	vm.operators.define(500, operatorSpecifierYFX, atomPlus)
+
+	x, y, z := NewVariable(), NewVariable(), NewVariable()
+
+	tests := []struct {
+		title        string
+		sOrA, clause Term
+		env          *Env
+		output       string
+		err          error
+	}{
+		{title: "fact", sOrA: w, clause: NewAtom("foo").Apply(x, y, x, NewAtom("a b")), output: "foo(A,_,A,'a b').\n"},
+		{title: "true body", sOrA: w, clause: atomIf.Apply(NewAtom("foo"), atomTrue), output: "foo.\n"},
+		{title: "rule", sOrA: w, clause: atomIf.Apply(NewAtom("foo").Apply(x, y), atomComma.Apply(atomEqual.Apply(y, atomPlus.Apply(x, Integer(1))), NewAtom("bar").Apply(z))), output: `foo(A,B) :-
+    B=A+1,
+    bar(_).
+`},
+		{title: "if-then-else", sOrA: w, clause: atomIf.Apply(NewAtom("foo").Apply(x), atomComma.Apply(
+			atomSemiColon.Apply(atomThen.Apply(NewAtom("a").Apply(x), atomSemiColon.Apply(atomThen.Apply(NewAtom("b"), NewAtom("c")), NewAtom("d"))), atomSemiColon.Apply(atomComma.Apply(NewAtom("e"), NewAtom("f")), NewAtom("g"))),
+			NewAtom("h"),
+		)), output: `foo(A) :-
+    (   a(A)
+    ->  (   b
+        ->  c
+        ;   d
+        )
+    ;   e,
+        f
+    ;   g
+    ),
+    h.
+`},
+		{title: "directive", sOrA: w, clause: atomIf.Apply(atomComma.Apply(NewAtom("foo"), NewAtom("bar"))), output: `:- foo,
+   bar.
+`},
+		{title: "bound", sOrA: w, clause: NewAtom("foo").Apply(x, y), env: NewEnv().bind(x, y), output: "foo(A,A).\n"},
+		{title: "variable stream", sOrA: NewVariable(), clause: NewAtom("foo"), err: InstantiationError(nil)},
+		{title: "input stream", sOrA: r, clause: NewAtom("foo"), err: permissionError(operationOutput, permissionTypeStream, r, nil)},
+		{title: "binary stream", sOrA: b, clause: NewAtom("foo"), err: permissionError(operationOutput, permissionTypeBinaryStream, b, nil)},
+		{title: "failure", sOrA: mw, clause: NewAtom("foo"), err: errors.New("failed")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			buf.Reset()
+			ok, err := PortrayClause(&vm, tt.sOrA, tt.clause, Success, tt.env).Force(context.Background())
+			assert.Equal(t, tt.err == nil, ok)
+			assert.Equal(t, tt.err, err)
+			assert.Equal(t, tt.output, buf.String())
+		})
+	}
+}
+
+func TestListing(t *testing.T) {
+	var buf bytes.Buffer
+	vm := VM{output: &Stream{sink: &buf, mode: ioModeWrite}}
+	vm.operators.define(1000, operatorSpecifierXFY, atomComma)
+	vm.operators.define(400, operatorSpecifierYFX, atomSlash)
+	vm.Register1(NewAtom("foreign"), func(_ *VM, _ Term, k Cont, env *Env) *Promise {
+		return k(env)
+	})
+	assert.NoError(t, vm.Compile(context.Background(), `
+':-'(system(X), foreign(X)).
+`))
+	vm.MarkBuiltIn()
+	assert.NoError(t, vm.Compile(context.Background(), `
+:-(dynamic(/(counter, 1))).
+counter(0).
+':-'(foo(X, Y), ','(bar(X), bar(Y))).
+bar(1).
+bar(2).
+`))
+	ok, err := Assertz(&vm, NewAtom("counter").Apply(Integer(1)), Success, nil).Force(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	tests := []struct {
+		title  string
+		spec   Term
+		output string
+		err    error
+	}{
+		{title: "all", output: `bar(1).
+bar(2).
+
+:- dynamic(counter/1).
+
+counter(0).
+counter(1).
+
+foo(A,B) :-
+    bar(A),
+    bar(B).
+
+`},
+		{title: "name", spec: NewAtom("counter"), output: `:- dynamic(counter/1).
+
+counter(0).
+counter(1).
+
+`},
+		{title: "predicate indicator", spec: atomSlash.Apply(NewAtom("bar"), Integer(1)), output: "bar(1).\nbar(2).\n\n"},
+		{title: "non-terminal indicator", spec: atomSlashSlash.Apply(NewAtom("foo"), Integer(0)), output: "foo(A,B) :-\n    bar(A),\n    bar(B).\n\n"},
+		{title: "list", spec: List(NewAtom("system"), atomSlash.Apply(NewAtom("foreign"), Integer(1))), output: "system(A) :-\n    foreign(A).\n\n%   Foreign: foreign/1\n\n"},
+		{title: "unknown", spec: atomSlash.Apply(NewAtom("baz"), Integer(0)), output: ""},
+		{title: "variable", spec: NewVariable(), err: InstantiationError(nil)},
+		{title: "variable name", spec: atomSlash.Apply(NewVariable(), Integer(0)), err: InstantiationError(nil)},
+		{title: "variable arity", spec: atomSlash.Apply(NewAtom("foo"), NewVariable()), err: InstantiationError(nil)},
+		{title: "not a name", spec: atomSlash.Apply(Integer(0), Integer(0)), err: typeError(validTypePredicateIndicator, atomSlash.Apply(Integer(0), Integer(0)), nil)},
+		{title: "not an arity", spec: atomSlash.Apply(NewAtom("foo"), NewAtom("bar")), err: typeError(validTypePredicateIndicator, atomSlash.Apply(NewAtom("foo"), NewAtom("bar")), nil)},
+		{title: "not a spec", spec: Integer(0), err: typeError(validTypePredicateIndicator, Integer(0), nil)},
+		{title: "partial list", spec: PartialList(NewVariable(), NewAtom("foo")), err: InstantiationError(nil)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			buf.Reset()
+			var p *Promise
+			if tt.spec == nil {
+				p = ListingAll(&vm, Success, nil)
+			} else {
+				p = Listing(&vm, tt.spec, Success, nil)
+			}
+			ok, err := p.Force(context.Background())
+			assert.Equal(t, tt.err == nil, ok)
+			assert.Equal(t, tt.err, err)
+			assert.Equal(t, tt.output, buf.String())
+		})
+	}
+
+	t.Run("predicate_property", func(t *testing.T) {
+		u := vm.procedures[procedureIndicator{name: NewAtom("system"), arity: 1}].(*userDefined)
+		assert.Contains(t, procedureProperties(u), atomBuiltIn)
+		u = vm.procedures[procedureIndicator{name: NewAtom("bar"), arity: 1}].(*userDefined)
+		assert.NotContains(t, procedureProperties(u), atomBuiltIn)
+	})
+}
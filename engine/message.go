@@ -0,0 +1,476 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Message is a message printed by print_message/2.
+type Message struct {
+	// Kind is the kind of the message such as error, warning, informational, and silent.
+	Kind Atom
+
+	// Term is the message term.
+	Term Term
+
+	// Lines are the text of the message translated by message//1.
+	Lines []string
+
+	// File and Pos are the source location the message is about. They're empty unless the message is a Warning or about a UnitTest.
+	File string
+	Pos  Position
+
+	// Backtrace is the backtrace of the Exception the message is about. Each frame is printed in a line after Lines.
+	Backtrace []Frame
+}
+
+// String returns the message as it's printed to user_error.
+func (m Message) String() string {
+	var (
+		sb     strings.Builder
+		prefix = messagePrefix(m.Kind)
+	)
+	for i, l := range m.Lines {
+		if i > 0 {
+			_ = sb.WriteByte('\n')
+		}
+		_, _ = sb.WriteString(prefix)
+		if i == 0 {
+			switch {
+			case m.File != "":
+				_, _ = fmt.Fprintf(&sb, "%s:%s: ", m.File, m.Pos)
+			case m.Pos.Line > 0:
+				_, _ = fmt.Fprintf(&sb, "%s: ", m.Pos)
+			}
+		}
+		_, _ = sb.WriteString(l)
+	}
+	return sb.String()
+}
+
+func messagePrefix(kind Atom) string {
+	switch kind {
+	case atomError:
+		return "ERROR: "
+	case atomWarning:
+		return "Warning: "
+	case atomInformational:
+		return "% "
+	default:
+		return ""
+	}
+}
+
+// PrintMessage prints the message term of the kind.
+// The term is translated into lines by message//1 if the user defined it, otherwise by the built-in translation.
+// Unless message_hook(Term, Kind, Lines) succeeds, the lines are passed to VM.OnMessage if it's set, or written to user_error.
+// Messages of the kind silent are not written.
+func PrintMessage(vm *VM, kind, term Term, k Cont, env *Env) *Promise {
+	var m Message
+	switch kind := env.Resolve(kind).(type) {
+	case Variable:
+		return Error(InstantiationError(env))
+	case Atom:
+		m.Kind = kind
+	default:
+		return Error(typeError(validTypeAtom, kind, env))
+	}
+	m.Term = term
+
+	return Delay(func(ctx context.Context) *Promise {
+		if err := vm.printMessage(ctx, m, env); err != nil {
+			return Error(err)
+		}
+		return k(env)
+	})
+}
+
+// MessageToCodes succeeds iff codes is the text of the message term of the kind as print_message/2 writes it to user_error, without the trailing newline.
+func MessageToCodes(vm *VM, term, kind, codes Term, k Cont, env *Env) *Promise {
+	var m Message
+	switch kind := env.Resolve(kind).(type) {
+	case Variable:
+		return Error(InstantiationError(env))
+	case Atom:
+		m.Kind = kind
+	default:
+		return Error(typeError(validTypeAtom, kind, env))
+	}
+
+	return Delay(func(ctx context.Context) *Promise {
+		lines, env, err := vm.translateMessage(ctx, term, env)
+		if err != nil {
+			return Error(err)
+		}
+		m.Lines, err = formatMessageLines(lines, vm.messageWriteOptions(), env)
+		if err != nil {
+			return Error(err)
+		}
+		return Unify(vm, codes, CodeList(m.String()), k, env)
+	})
+}
+
+// PrintError prints the uncaught Exception e as print_message(error, Term) does, followed by its backtrace.
+func (vm *VM) PrintError(ctx context.Context, e Exception) error {
+	return vm.printMessage(ctx, Message{Kind: atomError, Term: e.term, Backtrace: e.Backtrace()}, nil)
+}
+
+func (vm *VM) printMessage(ctx context.Context, m Message, env *Env) error {
+	lines, env, err := vm.translateMessage(ctx, m.Term, env)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := vm.procedures[procedureIndicator{name: atomMessageHook, arity: 3}]; ok {
+		ok, err := Call(vm, atomMessageHook.Apply(m.Term, m.Kind, lines), Success, env).Force(ctx)
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+	}
+
+	m.Term = env.Simplify(m.Term)
+	m.Lines, err = formatMessageLines(lines, vm.messageWriteOptions(), env)
+	if err != nil {
+		return err
+	}
+	for _, f := range m.Backtrace {
+		m.Lines = append(m.Lines, "  "+f.String())
+	}
+
+	if vm.OnMessage != nil {
+		vm.OnMessage(m)
+		return nil
+	}
+
+	if m.Kind == atomSilent || vm.errOutput == nil {
+		return nil
+	}
+	w, err := vm.errOutput.textWriter()
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, m.String())
+	return err
+}
+
+func (vm *VM) messageWriteOptions() WriteOptions {
+	opts := defaultWriteOptions
+	if len(vm.operators) > 0 {
+		opts.ops = vm.operators
+	}
+	opts.priority = 1200
+	return opts
+}
+
+// translateMessage returns the lines of the message term.
+// It tries message//1 defined by the user first and falls back to the built-in translation.
+func (vm *VM) translateMessage(ctx context.Context, term Term, env *Env) (Term, *Env, error) {
+	if _, ok := vm.procedures[procedureIndicator{name: atomMessage, arity: 3}]; ok {
+		lines := NewVariable()
+		var found *Env
+		ok, err := Call(vm, atomMessage.Apply(term, lines, List()), func(env *Env) *Promise {
+			found = env
+			return Bool(true)
+		}, env).Force(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+		if ok {
+			return lines, found, nil
+		}
+	}
+	return messageLines(term, env), env, nil
+}
+
+// messageLines is the built-in translation of the message term into lines.
+func messageLines(term Term, env *Env) Term {
+	line := func(format string, args ...Term) Term {
+		return List(atomMinus.Apply(NewAtom(format), List(args...)))
+	}
+
+	c, ok := env.Resolve(term).(Compound)
+	if !ok {
+		return line("Unknown message: ~p", term)
+	}
+	switch pi := (procedureIndicator{name: c.Functor(), arity: Integer(c.Arity())}); pi {
+	case procedureIndicator{name: atomError, arity: 2}:
+		return errorMessageLines(c.Arg(0), c.Arg(1), env)
+	case procedureIndicator{name: atomFormat, arity: 2}:
+		return List(atomMinus.Apply(c.Arg(0), c.Arg(1)))
+	case procedureIndicator{name: atomSingletons, arity: 2}:
+		return line("Singleton variables ~w in ~w", c.Arg(1), c.Arg(0))
+	case procedureIndicator{name: atomDiscontiguous, arity: 1}:
+		return line("Clauses of ~w are not together", c.Arg(0))
+	case procedureIndicator{name: atomRedefineBuiltIn, arity: 1}:
+		return line("Redefined built-in predicate ~w", c.Arg(0))
+	case procedureIndicator{name: atomUndefinedProcedure, arity: 2}:
+		return line("Undefined procedure ~w called from ~w", c.Arg(0), c.Arg(1))
+	case procedureIndicator{name: atomArityMismatch, arity: 3}:
+		return line("Undefined procedure ~w called from ~w; defined with other arities: ~w", c.Arg(0), c.Arg(1), c.Arg(2))
+	case procedureIndicator{name: atomUnused, arity: 1}:
+		return line("~w is not called", c.Arg(0))
+	case procedureIndicator{name: atomReloaded, arity: 1}:
+		return line("Reloaded ~w", c.Arg(0))
+	case procedureIndicator{name: atomTestFailed, arity: 2}:
+		return testFailedMessageLines(c.Arg(0), c.Arg(1), env)
+	case procedureIndicator{name: atomTestNondet, arity: 1}:
+		format, args := testMessage(c.Arg(0), env)
+		return line(format+" succeeded with a choicepoint", args...)
+	case procedureIndicator{name: atomTestBlocked, arity: 2}:
+		format, args := testMessage(c.Arg(0), env)
+		return line(format+": blocked: ~w", append(args, c.Arg(1))...)
+	case procedureIndicator{name: atomTestsPassed, arity: 1}:
+		return line("All ~d tests passed", c.Arg(0))
+	case procedureIndicator{name: atomTestsFailed, arity: 2}:
+		return line("~d of ~d tests failed", c.Arg(0), c.Arg(1))
+	default:
+		return line("Unknown message: ~p", term)
+	}
+}
+
+// testMessage returns the format and the arguments which describe the test Unit:Name or forall(Unit:Name, Generator).
+func testMessage(test Term, env *Env) (string, []Term) {
+	if c, ok := env.Resolve(test).(Compound); ok && c.Functor() == atomForall && c.Arity() == 2 {
+		return "test ~q (forall ~q)", []Term{c.Arg(0), c.Arg(1)}
+	}
+	return "test ~q", []Term{test}
+}
+
+func testFailedMessageLines(test, reason Term, env *Env) Term {
+	format, args := testMessage(test, env)
+	switch r := env.Resolve(reason).(type) {
+	case Atom:
+		switch r {
+		case atomFailed:
+			format += ": failed"
+		case atomSucceeded:
+			format += ": must fail but succeeded"
+		case atomSetupFailed:
+			format += ": setup failed"
+		default:
+			format += ": ~q"
+			args = append(args, r)
+		}
+	case Compound:
+		switch pi := (procedureIndicator{name: r.Functor(), arity: Integer(r.Arity())}); pi {
+		case procedureIndicator{name: atomWrongAnswer, arity: 1}:
+			format += ": wrong answer: ~q"
+			args = append(args, r.Arg(0))
+		case procedureIndicator{name: atomNoException, arity: 1}:
+			format += ": must raise ~q but succeeded"
+			args = append(args, r.Arg(0))
+		case procedureIndicator{name: atomWrongException, arity: 2}:
+			format += ": must raise ~q but raised ~q"
+			args = append(args, r.Arg(0), r.Arg(1))
+		case procedureIndicator{name: atomException, arity: 1}:
+			format += ": raised ~q"
+			args = append(args, r.Arg(0))
+		default:
+			format += ": ~q"
+			args = append(args, r)
+		}
+	default:
+		format += ": ~q"
+		args = append(args, r)
+	}
+	return List(atomMinus.Apply(NewAtom(format), List(args...)))
+}
+
+func errorMessageLines(formal, context Term, env *Env) Term {
+	var (
+		format string
+		args   []Term
+	)
+	if c, ok := env.Resolve(context).(Compound); ok && c.Arity() == 2 {
+		switch c.Functor() {
+		case atomSlash:
+			format, args = "~q: ", []Term{c}
+		case atomContext:
+			if _, ok := env.Resolve(c.Arg(0)).(Variable); !ok {
+				format, args = "~q: ", []Term{c.Arg(0)}
+			}
+		}
+	}
+
+	switch f := env.Resolve(formal).(type) {
+	case Atom:
+		switch f {
+		case atomInstantiationError:
+			format += "Arguments are not sufficiently instantiated"
+		default:
+			format += "Unknown error term: ~p"
+			args = append(args, f)
+		}
+	case Compound:
+		switch pi := (procedureIndicator{name: f.Functor(), arity: Integer(f.Arity())}); pi {
+		case procedureIndicator{name: atomTypeError, arity: 2}:
+			format += "Type error: `~w' expected, found `~q'"
+			args = append(args, f.Arg(0), f.Arg(1))
+		case procedureIndicator{name: atomDomainError, arity: 2}:
+			format += "Domain error: `~w' expected, found `~q'"
+			args = append(args, f.Arg(0), f.Arg(1))
+		case procedureIndicator{name: atomExistenceError, arity: 2}:
+			if env.Resolve(f.Arg(0)) == atomProcedure {
+				format += "Unknown procedure: ~q"
+				args = append(args, f.Arg(1))
+				break
+			}
+			format += "~w `~q' does not exist"
+			args = append(args, f.Arg(0), f.Arg(1))
+		case procedureIndicator{name: atomPermissionError, arity: 3}:
+			format += "No permission to ~w ~w `~q'"
+			args = append(args, f.Arg(0), f.Arg(1), f.Arg(2))
+		case procedureIndicator{name: atomRepresentationError, arity: 1}:
+			format += "Cannot represent due to `~w'"
+			args = append(args, f.Arg(0))
+		case procedureIndicator{name: atomEvaluationError, arity: 1}:
+			format += "Arithmetic: evaluation error: `~w'"
+			args = append(args, f.Arg(0))
+		case procedureIndicator{name: atomResourceError, arity: 1}:
+			format += "Not enough resources: ~w"
+			args = append(args, f.Arg(0))
+		case procedureIndicator{name: atomSyntaxError, arity: 1}:
+			format += "Syntax error: ~w"
+			args = append(args, f.Arg(0))
+		case procedureIndicator{name: atomSystemError, arity: 1}:
+			format += "System error: ~w"
+			args = append(args, f.Arg(0))
+		default:
+			format += "Unknown error term: ~p"
+			args = append(args, f)
+		}
+	default:
+		format += "Unknown error term: ~p"
+		args = append(args, f)
+	}
+	return List(atomMinus.Apply(NewAtom(format), List(args...)))
+}
+
+// formatMessageLines renders the line elements.
+// An element is one of Format-Args, ansi(Attributes, Format, Args), nl, or Format.
+// Format is an atom or a list of characters or codes with these directives: ~w, ~p, ~q, ~a, ~d, ~s, ~n, and ~~.
+func formatMessageLines(lines Term, opts WriteOptions, env *Env) ([]string, error) {
+	var sb strings.Builder
+	iter := ListIterator{List: lines, Env: env}
+	for iter.Next() {
+		format, args := iter.Current(), Term(List())
+		switch e := env.Resolve(iter.Current()).(type) {
+		case Atom:
+			if e == atomNl {
+				_ = sb.WriteByte('\n')
+				continue
+			}
+		case Compound:
+			switch {
+			case e.Functor() == atomMinus && e.Arity() == 2:
+				format, args = e.Arg(0), e.Arg(1)
+			case e.Functor() == atomAnsi && e.Arity() == 3:
+				format, args = e.Arg(1), e.Arg(2)
+			}
+		}
+		if err := formatMessage(&sb, format, args, opts, env); err != nil {
+			return nil, err
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+	return strings.Split(sb.String(), "\n"), nil
+}
+
+func formatMessage(sb *strings.Builder, format, args Term, opts WriteOptions, env *Env) error {
+	f, ok := messageText(format, env)
+	if !ok {
+		return formatMessage(sb, NewAtom("~p"), List(format), opts, env)
+	}
+
+	var as []Term
+	iter := ListIterator{List: args, Env: env}
+	for iter.Next() {
+		as = append(as, iter.Current())
+	}
+	if iter.Err() != nil {
+		as = []Term{args}
+	}
+
+	opts.numberVars = true
+	rs := []rune(f)
+	for i := 0; i < len(rs); i++ {
+		if rs[i] != '~' || i == len(rs)-1 {
+			_, _ = sb.WriteRune(rs[i])
+			continue
+		}
+		i++
+		switch d := rs[i]; d {
+		case '~':
+			_ = sb.WriteByte('~')
+		case 'n':
+			_ = sb.WriteByte('\n')
+		case 'w', 'p', 'q', 'a', 'd', 's':
+			if len(as) == 0 {
+				return domainError(validDomainNonEmptyList, args, env)
+			}
+			var a Term
+			a, as = env.Resolve(as[0]), as[1:]
+			switch d {
+			case 'w':
+				if err := a.WriteTerm(sb, opts.withQuoted(false), env); err != nil {
+					return err
+				}
+			case 'p', 'q':
+				if err := a.WriteTerm(sb, opts.withQuoted(true), env); err != nil {
+					return err
+				}
+			case 'a':
+				s, ok := a.(Atom)
+				if !ok {
+					return typeError(validTypeAtom, a, env)
+				}
+				_, _ = sb.WriteString(s.String())
+			case 'd':
+				n, ok := a.(Integer)
+				if !ok {
+					return typeError(validTypeInteger, a, env)
+				}
+				_, _ = fmt.Fprintf(sb, "%d", n)
+			case 's':
+				s, ok := messageText(a, env)
+				if !ok {
+					return typeError(validTypeList, a, env)
+				}
+				_, _ = sb.WriteString(s)
+			}
+		default:
+			_ = sb.WriteByte('~')
+			_, _ = sb.WriteRune(d)
+		}
+	}
+	return nil
+}
+
+// messageText returns the text of an atom or a list of characters or codes.
+func messageText(t Term, env *Env) (string, bool) {
+	if a, ok := env.Resolve(t).(Atom); ok && a != atomEmptyList {
+		return a.String(), true
+	}
+	var sb strings.Builder
+	iter := ListIterator{List: t, Env: env}
+	for iter.Next() {
+		switch e := env.Resolve(iter.Current()).(type) {
+		case Integer:
+			_, _ = sb.WriteRune(rune(e))
+		case Atom:
+			if len([]rune(e.String())) != 1 {
+				return "", false
+			}
+			_, _ = sb.WriteString(e.String())
+		default:
+			return "", false
+		}
+	}
+	return sb.String(), iter.Err() == nil
+}
@@ -0,0 +1,148 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrintMessage(t *testing.T) {
+	foo := NewAtom("foo")
+
+	tests := []struct {
+		title      string
+		text       string
+		kind, term Term
+		ok         bool
+		err        error
+		output     string
+	}{
+		{title: "instantiation error", kind: atomError, term: atomError.Apply(atomInstantiationError, atomSlash.Apply(foo, Integer(1))), ok: true, output: "ERROR: foo/1: Arguments are not sufficiently instantiated\n"},
+		{title: "type error", kind: atomError, term: atomError.Apply(atomTypeError.Apply(atomInteger, NewAtom("a")), NewVariable()), ok: true, output: "ERROR: Type error: `integer' expected, found `a'\n"},
+		{title: "domain error", kind: atomError, term: atomError.Apply(atomDomainError.Apply(atomNotLessThanZero, Integer(-1)), NewVariable()), ok: true, output: "ERROR: Domain error: `not_less_than_zero' expected, found `-1'\n"},
+		{title: "existence error: procedure", kind: atomError, term: atomError.Apply(atomExistenceError.Apply(atomProcedure, atomSlash.Apply(foo, Integer(0))), NewVariable()), ok: true, output: "ERROR: Unknown procedure: foo/0\n"},
+		{title: "existence error", kind: atomError, term: atomError.Apply(atomExistenceError.Apply(atomStream, foo), NewVariable()), ok: true, output: "ERROR: stream `foo' does not exist\n"},
+		{title: "permission error", kind: atomError, term: atomError.Apply(atomPermissionError.Apply(atomModify, atomStaticProcedure, atomSlash.Apply(foo, Integer(0))), NewVariable()), ok: true, output: "ERROR: No permission to modify static_procedure `foo/0'\n"},
+		{title: "representation error", kind: atomError, term: atomError.Apply(atomRepresentationError.Apply(atomMaxArity), NewVariable()), ok: true, output: "ERROR: Cannot represent due to `max_arity'\n"},
+		{title: "evaluation error", kind: atomError, term: atomError.Apply(atomEvaluationError.Apply(atomZeroDivisor), NewVariable()), ok: true, output: "ERROR: Arithmetic: evaluation error: `zero_divisor'\n"},
+		{title: "resource error", kind: atomError, term: atomError.Apply(atomResourceError.Apply(atomMemory), NewVariable()), ok: true, output: "ERROR: Not enough resources: memory\n"},
+		{title: "syntax error", kind: atomError, term: atomError.Apply(atomSyntaxError.Apply(NewAtom("unexpected_token")), NewVariable()), ok: true, output: "ERROR: Syntax error: unexpected_token\n"},
+		{title: "system error", kind: atomError, term: atomError.Apply(atomSystemError.Apply(foo), NewVariable()), ok: true, output: "ERROR: System error: foo\n"},
+		{title: "unknown error", kind: atomError, term: atomError.Apply(foo, NewAtom("bar").Apply(NewAtom("baz"))), ok: true, output: "ERROR: Unknown error term: foo\n"},
+		{title: "context", kind: atomError, term: atomError.Apply(atomInstantiationError, atomContext.Apply(atomSlash.Apply(foo, Integer(1)), NewVariable())), ok: true, output: "ERROR: foo/1: Arguments are not sufficiently instantiated\n"},
+		{title: "warning", kind: atomWarning, term: atomSingletons.Apply(atomSlash.Apply(foo, Integer(1)), List(NewAtom("X"))), ok: true, output: "Warning: Singleton variables [X] in foo/1\n"},
+		{title: "informational", kind: atomInformational, term: atomFormat.Apply(NewAtom("~a, ~q, ~w, ~d, ~s~~~n~i"), List(NewAtom("a b"), NewAtom("a b"), NewAtom("a b"), Integer(1), CodeList("str"))), ok: true, output: "% a b, 'a b', a b, 1, str~\n% ~i\n"},
+		{title: "silent", kind: atomSilent, term: foo, ok: true, output: ""},
+		{title: "other kinds", kind: NewAtom("help"), term: foo, ok: true, output: "Unknown message: foo\n"},
+		{title: "message//1", text: `
+message(hello(X), [-('Hello, ~w!', [X]), nl, ansi(bold, '~a', [bye])|T], T).
+`, kind: atomInformational, term: NewAtom("hello").Apply(NewAtom("world")), ok: true, output: "% Hello, world!\n% bye\n"},
+		{title: "message//1: qualified", text: `
+:(prolog, message(hello(X), [-('Hello, ~w!', [X])|T], T)).
+`, kind: atomInformational, term: NewAtom("hello").Apply(NewAtom("world")), ok: true, output: "% Hello, world!\n"},
+		{title: "message//1: fallback", text: `
+message(hello(X), [-('Hello, ~w!', [X])|T], T).
+`, kind: atomWarning, term: foo, ok: true, output: "Warning: Unknown message: foo\n"},
+		{title: "message_hook/3", text: `
+message_hook(foo, warning, _).
+`, kind: atomWarning, term: foo, ok: true, output: ""},
+		{title: "message_hook/3: fails", text: `
+message_hook(foo, error, _).
+`, kind: atomWarning, term: foo, ok: true, output: "Warning: Unknown message: foo\n"},
+		{title: "not enough arguments", kind: atomWarning, term: atomFormat.Apply(NewAtom("~w"), List()), err: domainError(validDomainNonEmptyList, List(), nil)},
+		{title: "kind is a variable", kind: NewVariable(), term: foo, err: InstantiationError(nil)},
+		{title: "kind is not an atom", kind: Integer(0), term: foo, err: typeError(validTypeAtom, Integer(0), nil)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			var buf bytes.Buffer
+			var vm VM
+			vm.SetUserError(NewOutputTextStream(&buf))
+			assert.NoError(t, vm.Compile(context.Background(), tt.text))
+			ok, err := PrintMessage(&vm, tt.kind, tt.term, Success, nil).Force(context.Background())
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.err, err)
+			assert.Equal(t, tt.output, buf.String())
+		})
+	}
+
+	t.Run("OnMessage", func(t *testing.T) {
+		var buf bytes.Buffer
+		var ms []Message
+		vm := VM{
+			OnMessage: func(m Message) {
+				ms = append(ms, m)
+			},
+		}
+		vm.SetUserError(NewOutputTextStream(&buf))
+		x := NewVariable()
+		ok, err := PrintMessage(&vm, atomWarning, atomFormat.Apply(NewAtom("~w~n~w"), List(x, NewAtom("b"))), Success, NewEnv().bind(x, NewAtom("a"))).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, []Message{
+			{Kind: atomWarning, Term: atomFormat.Apply(NewAtom("~w~n~w"), List(NewAtom("a"), NewAtom("b"))), Lines: []string{"a", "b"}},
+		}, ms)
+		assert.Empty(t, buf.String())
+	})
+
+	t.Run("message_hook/3 throws", func(t *testing.T) {
+		var vm VM
+		vm.Register1(NewAtom("throw"), Throw)
+		assert.NoError(t, vm.Compile(context.Background(), `
+:-(message_hook(_, _, _), throw(foo)).
+`))
+		_, err := PrintMessage(&vm, atomWarning, NewAtom("foo"), Success, nil).Force(context.Background())
+		var e Exception
+		assert.True(t, errors.As(err, &e))
+		assert.Equal(t, NewAtom("foo"), e.Term())
+	})
+}
+
+func TestMessageToCodes(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		var vm VM
+		cs := NewVariable()
+		ok, err := MessageToCodes(&vm, atomFormat.Apply(NewAtom("~a~n~a"), List(NewAtom("foo"), NewAtom("bar"))), atomWarning, cs, func(env *Env) *Promise {
+			assert.Equal(t, CodeList("Warning: foo\nWarning: bar"), env.Resolve(cs))
+			return Bool(true)
+		}, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("kind is a variable", func(t *testing.T) {
+		var vm VM
+		ok, err := MessageToCodes(&vm, NewAtom("foo"), NewVariable(), NewVariable(), Success, nil).Force(context.Background())
+		assert.Equal(t, InstantiationError(nil), err)
+		assert.False(t, ok)
+	})
+
+	t.Run("kind is not an atom", func(t *testing.T) {
+		var vm VM
+		ok, err := MessageToCodes(&vm, NewAtom("foo"), Integer(0), NewVariable(), Success, nil).Force(context.Background())
+		assert.Equal(t, typeError(validTypeAtom, Integer(0), nil), err)
+		assert.False(t, ok)
+	})
+}
+
+func TestMessage_String(t *testing.T) {
+	tests := []struct {
+		message Message
+		s       string
+	}{
+		{message: Message{Kind: atomError, Lines: []string{"foo", "bar"}}, s: "ERROR: foo\nERROR: bar"},
+		{message: Message{Kind: atomWarning, Lines: []string{"foo"}, File: "foo.pl", Pos: Position{Line: 1, Column: 2}}, s: "Warning: foo.pl:1:2: foo"},
+		{message: Message{Kind: atomInformational, Lines: []string{"foo"}, Pos: Position{Line: 1, Column: 2}}, s: "% 1:2: foo"},
+		{message: Message{Kind: NewAtom("help"), Lines: []string{"foo"}}, s: "foo"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			assert.Equal(t, tt.s, tt.message.String())
+		})
+	}
+}
@@ -30,6 +30,18 @@ type Parser struct {
 	args        []Term
 
 	buf tokenRingBuffer
+
+	// file is the name of the file being parsed, if any.
+	file string
+
+	// pos is where the last term read by Term starts.
+	pos Position
+
+	// end is where the full stop of the last term read by Term starts.
+	end Position
+
+	// argPos maps the operator terms read by Term to where their arguments start if it's not nil.
+	argPos map[Term][]Position
 }
 
 // ParsedVariable is a set of information regarding a variable in a parsed term.
@@ -45,9 +57,7 @@ func NewParser(vm *VM, r io.RuneReader) *Parser {
 		vm.operators = operators{}
 	}
 	return &Parser{
-		lexer: Lexer{
-			input: newRuneRingBuffer(r),
-		},
+		lexer:        *NewLexer(vm, r),
 		operators:    vm.operators,
 		doubleQuotes: vm.doubleQuotes,
 	}
@@ -69,6 +79,13 @@ func (p *Parser) SetPlaceholder(placeholder Atom, args ...interface{}) error {
 }
 
 func (p *Parser) termOf(o reflect.Value) (Term, error) {
+	if !o.IsValid() {
+		return nil, fmt.Errorf("can't convert to term: %v", o)
+	}
+	if t, ok := o.Interface().(Term); ok {
+		return t, nil
+	}
+
 	switch o.Kind() {
 	case reflect.Float32, reflect.Float64:
 		return Float(o.Float()), nil
@@ -94,8 +111,30 @@ func (p *Parser) termOf(o reflect.Value) (Term, error) {
 			}
 		}
 		return List(es...), nil
+	case reflect.Map:
+		if o.Type().Key().Kind() != reflect.String {
+			return NewBlob(o.Interface()), nil
+		}
+		keys := make([]Term, 0, o.Len())
+		values := make([]Term, 0, o.Len())
+		iter := o.MapRange()
+		for iter.Next() {
+			v, err := p.termOf(iter.Value())
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, NewAtom(iter.Key().String()))
+			values = append(values, v)
+		}
+		d, err := newDict(NewVariable(), keys, values, nil)
+		if err != nil {
+			return nil, err
+		}
+		return d, nil
+	case reflect.Interface:
+		return p.termOf(o.Elem())
 	default:
-		return nil, fmt.Errorf("can't convert to term: %v", o)
+		return NewBlob(o.Interface()), nil
 	}
 }
 
@@ -105,7 +144,7 @@ func (p *Parser) next() (Token, error) {
 		if err != nil {
 			return Token{}, err
 		}
-		p.buf.put(t)
+		p.buf.put(t, p.lexer.pos)
 	}
 	return p.buf.get(), nil
 }
@@ -118,24 +157,36 @@ func (p *Parser) current() Token {
 	return p.buf.current()
 }
 
+// Pos returns where the last term read by Term starts.
+func (p *Parser) Pos() Position {
+	return p.pos
+}
+
 // Term parses a term followed by a full stop.
 func (p *Parser) Term() (Term, error) {
+	if _, err := p.next(); err == nil {
+		p.backup()
+		p.pos = p.buf.position()
+	}
+
 	t, err := p.term(1201)
 	switch err {
 	case nil:
 		break
 	case errExpectation:
-		return nil, unexpectedTokenError{actual: p.current()}
+		return nil, p.unexpectedTokenError()
 	default:
 		return nil, err
 	}
 
 	switch t, _ := p.next(); t.kind {
-	case tokenEnd:
-		break
+	case TokenEnd:
+		p.backup()
+		p.end = p.buf.position()
+		_, _ = p.next()
 	default:
 		p.backup()
-		return nil, unexpectedTokenError{actual: p.current()}
+		return nil, p.unexpectedTokenError()
 	}
 
 	if len(p.args) != 0 {
@@ -156,9 +207,9 @@ func (p *Parser) number() (Number, error) {
 		return nil, err
 	}
 	switch t.kind {
-	case tokenInteger:
+	case TokenInteger:
 		n, err = integer(1, t.val)
-	case tokenFloatNumber:
+	case TokenFloatNumber:
 		n, err = float(1, t.val)
 	default:
 		p.backup()
@@ -179,9 +230,9 @@ func (p *Parser) number() (Number, error) {
 			return nil, errNotANumber
 		}
 		switch t.kind {
-		case tokenInteger:
+		case TokenInteger:
 			n, err = integer(-1, t.val)
-		case tokenFloatNumber:
+		case TokenFloatNumber:
 			n, err = float(-1, t.val)
 		default:
 			p.backup()
@@ -211,6 +262,16 @@ func (p *Parser) More() bool {
 	return true
 }
 
+// skip discards the tokens up to the end of the current clause so that the next term can be read after a syntax error.
+func (p *Parser) skip() {
+	for {
+		t, err := p.next()
+		if err != nil || t.kind == TokenEnd {
+			return
+		}
+	}
+}
+
 type operatorClass uint8
 
 const (
@@ -346,16 +407,19 @@ func (d doubleQuotes) String() string {
 
 // Loosely based on Pratt parser explained in this article: https://matklad.github.io/2020/04/13/simple-but-powerful-pratt-parsing.html
 func (p *Parser) term(maxPriority Integer) (Term, error) {
+	start := p.peekPos()
 	var lhs Term
 	switch op, err := p.prefix(maxPriority); err {
 	case nil:
 		_, rbp := op.bindingPriorities()
+		argStart := p.peekPos()
 		t, err := p.term(rbp)
 		if err != nil {
 			p.backup()
 			return p.term0(maxPriority)
 		}
 		lhs = op.name.Apply(t)
+		p.recordArgPos(lhs, argStart)
 	case errNoOp:
 		lhs, err = p.term0(maxPriority)
 		if err != nil {
@@ -373,18 +437,40 @@ func (p *Parser) term(maxPriority Integer) (Term, error) {
 		switch _, rbp := op.bindingPriorities(); {
 		case rbp > 1200:
 			lhs = op.name.Apply(lhs)
+			p.recordArgPos(lhs, start)
 		default:
+			rhsStart := p.peekPos()
 			rhs, err := p.term(rbp)
 			if err != nil {
 				return nil, err
 			}
 			lhs = op.name.Apply(lhs, rhs)
+			p.recordArgPos(lhs, start, rhsStart)
 		}
 	}
 
 	return lhs, nil
 }
 
+// peekPos returns where the next token starts if argPos is being recorded.
+func (p *Parser) peekPos() Position {
+	if p.argPos == nil {
+		return Position{}
+	}
+	if _, err := p.next(); err != nil {
+		return Position{}
+	}
+	p.backup()
+	return p.buf.position()
+}
+
+func (p *Parser) recordArgPos(t Term, pos ...Position) {
+	if p.argPos == nil {
+		return
+	}
+	p.argPos[t] = pos
+}
+
 func (p *Parser) prefix(maxPriority Integer) (operator, error) {
 	a, err := p.op(maxPriority)
 	if err != nil {
@@ -397,7 +483,7 @@ func (p *Parser) prefix(maxPriority Integer) (operator, error) {
 			return operator{}, err
 		}
 		switch t.kind {
-		case tokenInteger, tokenFloatNumber:
+		case TokenInteger, TokenFloatNumber:
 			p.backup()
 			p.backup()
 			return operator{}, errNoOp
@@ -411,7 +497,7 @@ func (p *Parser) prefix(maxPriority Integer) (operator, error) {
 		return operator{}, err
 	}
 	switch t.kind {
-	case tokenOpenCT:
+	case TokenOpenCT:
 		p.backup()
 		p.backup()
 		return operator{}, errNoOp
@@ -455,13 +541,13 @@ func (p *Parser) op(maxPriority Integer) (Atom, error) {
 		switch a {
 		case atomEmptyList:
 			p.backup()
-			if p.current().kind == tokenCloseList {
+			if p.current().kind == TokenCloseList {
 				p.backup()
 			}
 			return 0, errNoOp
 		case atomEmptyBlock:
 			p.backup()
-			if p.current().kind == tokenCloseCurly {
+			if p.current().kind == TokenCloseCurly {
 				p.backup()
 			}
 			return 0, errNoOp
@@ -475,11 +561,11 @@ func (p *Parser) op(maxPriority Integer) (Atom, error) {
 		return 0, err
 	}
 	switch t.kind {
-	case tokenComma:
+	case TokenComma:
 		if maxPriority >= 1000 {
 			return NewAtom(t.val), nil
 		}
-	case tokenBar:
+	case TokenBar:
 		return NewAtom(t.val), nil
 	}
 
@@ -493,31 +579,39 @@ func (p *Parser) term0(maxPriority Integer) (Term, error) {
 		return nil, err
 	}
 	switch t.kind {
-	case tokenOpen, tokenOpenCT:
+	case TokenOpen, TokenOpenCT:
 		return p.openClose()
-	case tokenInteger:
+	case TokenInteger:
 		return integer(1, t.val)
-	case tokenFloatNumber:
+	case TokenFloatNumber:
 		return float(1, t.val)
-	case tokenVariable:
-		return p.variable(t.val)
-	case tokenOpenList:
-		if t, _ := p.next(); t.kind == tokenCloseList {
+	case TokenVariable:
+		v, err := p.variable(t.val)
+		if err != nil {
+			return nil, err
+		}
+		if t, _ := p.next(); t.kind == TokenOpenDict {
+			return p.dict(v)
+		}
+		p.backup()
+		return v, nil
+	case TokenOpenList:
+		if t, _ := p.next(); t.kind == TokenCloseList {
 			p.backup()
 			p.backup()
 			break
 		}
 		p.backup()
 		return p.list()
-	case tokenOpenCurly:
-		if t, _ := p.next(); t.kind == tokenCloseCurly {
+	case TokenOpenCurly:
+		if t, _ := p.next(); t.kind == TokenCloseCurly {
 			p.backup()
 			p.backup()
 			break
 		}
 		p.backup()
 		return p.curlyBracketedTerm()
-	case tokenDoubleQuotedList:
+	case TokenDoubleQuotedList:
 		switch p.doubleQuotes {
 		case doubleQuotesChars:
 			return CharList(unDoubleQuote(t.val)), nil
@@ -546,9 +640,9 @@ func (p *Parser) term0Atom(maxPriority Integer) (Term, error) {
 			return nil, err
 		}
 		switch t.kind {
-		case tokenInteger:
+		case TokenInteger:
 			return integer(-1, t.val)
-		case tokenFloatNumber:
+		case TokenFloatNumber:
 			return float(-1, t.val)
 		default:
 			p.backup()
@@ -597,7 +691,7 @@ func (p *Parser) openClose() (Term, error) {
 	if err != nil {
 		return nil, err
 	}
-	if t, _ := p.next(); t.kind != tokenClose {
+	if t, _ := p.next(); t.kind != TokenClose {
 		p.backup()
 		return nil, errExpectation
 	}
@@ -614,33 +708,33 @@ func (p *Parser) atom() (Atom, error) {
 		return 0, err
 	}
 	switch t.kind {
-	case tokenOpenList:
+	case TokenOpenList:
 		t, err := p.next()
 		if err != nil {
 			return 0, err
 		}
 		switch t.kind {
-		case tokenCloseList:
+		case TokenCloseList:
 			return atomEmptyList, nil
 		default:
 			p.backup()
 			p.backup()
 			return 0, errExpectation
 		}
-	case tokenOpenCurly:
+	case TokenOpenCurly:
 		t, err := p.next()
 		if err != nil {
 			return 0, err
 		}
 		switch t.kind {
-		case tokenCloseCurly:
+		case TokenCloseCurly:
 			return atomEmptyBlock, nil
 		default:
 			p.backup()
 			p.backup()
 			return 0, errExpectation
 		}
-	case tokenDoubleQuotedList:
+	case TokenDoubleQuotedList:
 		switch p.doubleQuotes {
 		case doubleQuotesAtom:
 			return NewAtom(unDoubleQuote(t.val)), nil
@@ -659,15 +753,12 @@ func (p *Parser) name() (Atom, error) {
 	if err != nil {
 		return 0, err
 	}
-	switch t.kind {
-	case tokenLetterDigit, tokenGraphic, tokenSemicolon, tokenCut:
-		return NewAtom(t.val), nil
-	case tokenQuoted:
-		return NewAtom(unquote(t.val)), nil
-	default:
+	a, ok := t.Name()
+	if !ok {
 		p.backup()
 		return 0, errExpectation
 	}
+	return a, nil
 }
 
 func (p *Parser) list() (Term, error) {
@@ -678,20 +769,20 @@ func (p *Parser) list() (Term, error) {
 	args := []Term{arg}
 	for {
 		switch t, _ := p.next(); t.kind {
-		case tokenComma:
+		case TokenComma:
 			arg, err := p.arg()
 			if err != nil {
 				return nil, err
 			}
 			args = append(args, arg)
-		case tokenBar:
+		case TokenBar:
 			rest, err := p.arg()
 			if err != nil {
 				return nil, err
 			}
 
 			switch t, _ := p.next(); t.kind {
-			case tokenCloseList:
+			case TokenCloseList:
 				if len(args) == 1 {
 					return Cons(args[0], rest), nil
 				}
@@ -700,7 +791,7 @@ func (p *Parser) list() (Term, error) {
 				p.backup()
 				return nil, errExpectation
 			}
-		case tokenCloseList:
+		case TokenCloseList:
 			return List(args...), nil
 		default:
 			p.backup()
@@ -715,7 +806,7 @@ func (p *Parser) curlyBracketedTerm() (Term, error) {
 		return nil, err
 	}
 
-	if t, _ := p.next(); t.kind != tokenCloseCurly {
+	if t, _ := p.next(); t.kind != TokenCloseCurly {
 		p.backup()
 		return nil, errExpectation
 	}
@@ -725,7 +816,7 @@ func (p *Parser) curlyBracketedTerm() (Term, error) {
 
 func (p *Parser) functionalNotation(functor Atom) (Term, error) {
 	switch t, _ := p.next(); t.kind {
-	case tokenOpenCT:
+	case TokenOpenCT:
 		arg, err := p.arg()
 		if err != nil {
 			return nil, err
@@ -733,31 +824,85 @@ func (p *Parser) functionalNotation(functor Atom) (Term, error) {
 		args := []Term{arg}
 		for {
 			switch t, _ := p.next(); t.kind {
-			case tokenComma:
+			case TokenComma:
 				arg, err := p.arg()
 				if err != nil {
 					return nil, err
 				}
 				args = append(args, arg)
-			case tokenClose:
+			case TokenClose:
 				return functor.Apply(args...), nil
 			default:
 				p.backup()
 				return nil, errExpectation
 			}
 		}
+	case TokenOpenDict:
+		return p.dict(functor)
 	default:
 		p.backup()
 		return functor, nil
 	}
 }
 
+func (p *Parser) dict(tag Term) (Term, error) {
+	if t, _ := p.next(); t.kind == TokenCloseCurly {
+		return &dict{compound: compound{functor: atomDictFunctor, args: []Term{tag}}}, nil
+	}
+	p.backup()
+
+	var keys, values []Term
+	for {
+		var key Term
+		switch t, _ := p.next(); t.kind {
+		case TokenLetterDigit:
+			key = NewAtom(t.val)
+		case TokenQuoted:
+			key = NewAtom(unquote(t.val))
+		case TokenInteger:
+			i, err := integer(1, t.val)
+			if err != nil {
+				return nil, err
+			}
+			key = i
+		default:
+			p.backup()
+			return nil, errExpectation
+		}
+
+		if t, _ := p.next(); t.kind != TokenGraphic || t.val != ":" {
+			p.backup()
+			return nil, errExpectation
+		}
+
+		value, err := p.arg()
+		if err != nil {
+			return nil, err
+		}
+		keys, values = append(keys, key), append(values, value)
+
+		switch t, _ := p.next(); t.kind {
+		case TokenComma:
+			continue
+		case TokenCloseCurly:
+			d, err := newDict(tag, keys, values, nil)
+			if err != nil {
+				return nil, err
+			}
+			return d, nil
+		default:
+			p.backup()
+			return nil, errExpectation
+		}
+	}
+}
+
 func (p *Parser) arg() (Term, error) {
 	if arg, err := p.atom(); err == nil {
 		if p.operators.defined(arg) {
 			// Check if this atom is not followed by its own arguments.
 			switch t, _ := p.next(); t.kind {
-			case tokenComma, tokenClose, tokenBar, tokenCloseList:
+			case TokenComma, TokenClose, TokenBar, TokenCloseList:
 				p.backup()
 				return arg, nil
 			default:
@@ -765,7 +910,7 @@ func (p *Parser) arg() (Term, error) {
 			}
 		}
 		p.backup()
-		if p.current().kind == tokenCloseList || p.current().kind == tokenCloseCurly {
+		if p.current().kind == TokenCloseList || p.current().kind == TokenCloseCurly {
 			p.backup() // Unquoted [] or {} consist of 2 tokens.
 		}
 	}
@@ -911,11 +1056,13 @@ func doubleQuotedUnescape(s string) string {
 
 type tokenRingBuffer struct {
 	buf        [4]Token
+	pos        [4]Position
 	start, end int
 }
 
-func (b *tokenRingBuffer) put(t Token) {
+func (b *tokenRingBuffer) put(t Token, pos Position) {
 	b.buf[b.end] = t
+	b.pos[b.end] = pos
 	b.end++
 	b.end %= len(b.buf)
 }
@@ -931,6 +1078,11 @@ func (b *tokenRingBuffer) current() Token {
 	return b.buf[b.start]
 }
 
+// position returns where the current token starts.
+func (b *tokenRingBuffer) position() Position {
+	return b.pos[b.start]
+}
+
 func (b *tokenRingBuffer) empty() bool {
 	return b.start == b.end
 }
@@ -943,10 +1095,51 @@ func (b *tokenRingBuffer) backup() {
 	}
 }
 
+func (p *Parser) unexpectedTokenError() unexpectedTokenError {
+	pos := p.buf.position()
+	return unexpectedTokenError{
+		actual: p.current(),
+		file:   p.file,
+		pos:    pos,
+		line:   p.lexer.input.lineOf(pos),
+	}
+}
+
 type unexpectedTokenError struct {
 	actual Token
+	file   string
+	pos    Position
+
+	// line is the source text of the line where the token is.
+	line string
+}
+
+// Pos returns where the unexpected token starts.
+func (e unexpectedTokenError) Pos() Position {
+	return e.pos
 }
 
 func (e unexpectedTokenError) Error() string {
-	return fmt.Sprintf("unexpected token: %s", e.actual)
+	var sb strings.Builder
+	if e.file != "" {
+		_, _ = fmt.Fprintf(&sb, "%s:", e.file)
+	}
+	if e.pos.Line > 0 {
+		_, _ = fmt.Fprintf(&sb, "%s: ", e.pos)
+	}
+	_, _ = fmt.Fprintf(&sb, "unexpected token: %s", e.actual)
+	if e.line != "" && e.pos.Column > 0 {
+		_, _ = fmt.Fprintf(&sb, "\n%s\n", e.line)
+		for i, r := range []rune(e.line) {
+			if i >= e.pos.Column-1 {
+				break
+			}
+			if r != '\t' {
+				r = ' '
+			}
+			_, _ = sb.WriteRune(r)
+		}
+		_, _ = sb.WriteRune('^')
+	}
+	return sb.String()
 }
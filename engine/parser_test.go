@@ -27,10 +27,11 @@ func TestParser_Term(t *testing.T) {
 	}{
 		{input: ``, err: io.EOF},
 		{input: `foo`, err: io.EOF},
-		{input: `.`, err: unexpectedTokenError{actual: Token{kind: tokenEnd, val: "."}}},
+		{input: `.`, err: unexpectedTokenError{actual: Token{kind: TokenEnd, val: "."}, pos: Position{Offset: 0, Line: 1, Column: 1}, line: "."}},
 
 		{input: `(foo).`, term: NewAtom("foo")},
-		{input: `(a b).`, err: unexpectedTokenError{actual: Token{kind: tokenLetterDigit, val: "b"}}},
+		{input: "foo(.\n", err: unexpectedTokenError{actual: Token{kind: TokenEnd, val: "."}, pos: Position{Offset: 4, Line: 1, Column: 5}, line: "foo(."}},
+		{input: `(a b).`, err: unexpectedTokenError{actual: Token{kind: TokenLetterDigit, val: "b"}, pos: Position{Offset: 3, Line: 1, Column: 4}, line: "(a b)."}},
 
 		{input: `foo.`, term: NewAtom("foo")},
 		{input: `[].`, term: atomEmptyList},
@@ -88,16 +89,16 @@ func TestParser_Term(t *testing.T) {
 		{input: `foo(a, b).`, term: &compound{functor: NewAtom("foo"), args: []Term{NewAtom("a"), NewAtom("b")}}},
 		{input: `foo(-(a)).`, term: &compound{functor: NewAtom("foo"), args: []Term{&compound{functor: atomMinus, args: []Term{NewAtom("a")}}}}},
 		{input: `foo(-).`, term: &compound{functor: NewAtom("foo"), args: []Term{atomMinus}}},
-		{input: `foo((), b).`, err: unexpectedTokenError{actual: Token{kind: tokenClose, val: ")"}}},
+		{input: `foo((), b).`, err: unexpectedTokenError{actual: Token{kind: TokenClose, val: ")"}, pos: Position{Offset: 5, Line: 1, Column: 6}, line: "foo((), b)."}},
 		{input: `foo([]).`, term: &compound{functor: NewAtom("foo"), args: []Term{atomEmptyList}}},
-		{input: `foo(a, ()).`, err: unexpectedTokenError{actual: Token{kind: tokenClose, val: ")"}}},
-		{input: `foo(a b).`, err: unexpectedTokenError{actual: Token{kind: tokenLetterDigit, val: "b"}}},
+		{input: `foo(a, ()).`, err: unexpectedTokenError{actual: Token{kind: TokenClose, val: ")"}, pos: Position{Offset: 8, Line: 1, Column: 9}, line: "foo(a, ())."}},
+		{input: `foo(a b).`, err: unexpectedTokenError{actual: Token{kind: TokenLetterDigit, val: "b"}, pos: Position{Offset: 6, Line: 1, Column: 7}, line: "foo(a b)."}},
 		{input: `foo(a, b`, err: io.EOF},
 
 		{input: `[a, b].`, term: List(NewAtom("a"), NewAtom("b"))},
-		{input: `[(), b].`, err: unexpectedTokenError{actual: Token{kind: tokenClose, val: ")"}}},
-		{input: `[a, ()].`, err: unexpectedTokenError{actual: Token{kind: tokenClose, val: ")"}}},
-		{input: `[a b].`, err: unexpectedTokenError{actual: Token{kind: tokenLetterDigit, val: "b"}}},
+		{input: `[(), b].`, err: unexpectedTokenError{actual: Token{kind: TokenClose, val: ")"}, pos: Position{Offset: 2, Line: 1, Column: 3}, line: "[(), b]."}},
+		{input: `[a, ()].`, err: unexpectedTokenError{actual: Token{kind: TokenClose, val: ")"}, pos: Position{Offset: 5, Line: 1, Column: 6}, line: "[a, ()]."}},
+		{input: `[a b].`, err: unexpectedTokenError{actual: Token{kind: TokenLetterDigit, val: "b"}, pos: Position{Offset: 3, Line: 1, Column: 4}, line: "[a b]."}},
 		{input: `[a|X].`, termLazy: func() Term {
 			return Cons(NewAtom("a"), lastVariable())
 		}, vars: func() []ParsedVariable {
@@ -112,13 +113,13 @@ func TestParser_Term(t *testing.T) {
 				{Name: NewAtom("X"), Variable: lastVariable(), Count: 1},
 			}
 		}},
-		{input: `[a, b|()].`, err: unexpectedTokenError{actual: Token{kind: tokenClose, val: ")"}}},
-		{input: `[a, b|c d].`, err: unexpectedTokenError{actual: Token{kind: tokenLetterDigit, val: "d"}}},
+		{input: `[a, b|()].`, err: unexpectedTokenError{actual: Token{kind: TokenClose, val: ")"}, pos: Position{Offset: 7, Line: 1, Column: 8}, line: "[a, b|()]."}},
+		{input: `[a, b|c d].`, err: unexpectedTokenError{actual: Token{kind: TokenLetterDigit, val: "d"}, pos: Position{Offset: 8, Line: 1, Column: 9}, line: "[a, b|c d]."}},
 		{input: `[a `, err: io.EOF},
 
 		{input: `{a}.`, term: &compound{functor: atomEmptyBlock, args: []Term{NewAtom("a")}}},
-		{input: `{()}.`, err: unexpectedTokenError{actual: Token{kind: tokenClose, val: ")"}}},
-		{input: `{a b}.`, err: unexpectedTokenError{actual: Token{kind: tokenLetterDigit, val: "b"}}},
+		{input: `{()}.`, err: unexpectedTokenError{actual: Token{kind: TokenClose, val: ")"}, pos: Position{Offset: 2, Line: 1, Column: 3}, line: "{()}."}},
+		{input: `{a b}.`, err: unexpectedTokenError{actual: Token{kind: TokenLetterDigit, val: "b"}, pos: Position{Offset: 3, Line: 1, Column: 4}, line: "{a b}."}},
 
 		{input: `-a.`, term: &compound{functor: atomMinus, args: []Term{NewAtom("a")}}},
 		{input: `- .`, term: atomMinus},
@@ -126,12 +127,12 @@ func TestParser_Term(t *testing.T) {
 		{input: `a-- .`, term: &compound{functor: NewAtom(`--`), args: []Term{NewAtom(`a`)}}},
 
 		{input: `a + b.`, term: &compound{functor: atomPlus, args: []Term{NewAtom("a"), NewAtom("b")}}},
-		{input: `a + ().`, err: unexpectedTokenError{actual: Token{kind: tokenClose, val: ")"}}},
+		{input: `a + ().`, err: unexpectedTokenError{actual: Token{kind: TokenClose, val: ")"}, pos: Position{Offset: 5, Line: 1, Column: 6}, line: "a + ()."}},
 		{input: `a * b + c.`, term: &compound{functor: atomPlus, args: []Term{&compound{functor: NewAtom("*"), args: []Term{NewAtom("a"), NewAtom("b")}}, NewAtom("c")}}},
-		{input: `a [] b.`, err: unexpectedTokenError{actual: Token{kind: tokenOpenList, val: "["}}},
-		{input: `a {} b.`, err: unexpectedTokenError{actual: Token{kind: tokenOpenCurly, val: "{"}}},
+		{input: `a [] b.`, err: unexpectedTokenError{actual: Token{kind: TokenOpenList, val: "["}, pos: Position{Offset: 2, Line: 1, Column: 3}, line: "a [] b."}},
+		{input: `a {} b.`, err: unexpectedTokenError{actual: Token{kind: TokenOpenCurly, val: "{"}, pos: Position{Offset: 2, Line: 1, Column: 3}, line: "a {} b."}},
 		{input: `a, b.`, term: &compound{functor: atomComma, args: []Term{NewAtom("a"), NewAtom("b")}}},
-		{input: `+ * + .`, err: unexpectedTokenError{actual: Token{kind: tokenGraphic, val: "+"}}},
+		{input: `+ * + .`, err: unexpectedTokenError{actual: Token{kind: TokenGraphic, val: "+"}, pos: Position{Offset: 4, Line: 1, Column: 5}, line: "+ * + ."}},
 
 		{input: `"abc".`, doubleQuotes: doubleQuotesChars, term: charList("abc")},
 		{input: `"abc".`, doubleQuotes: doubleQuotesCodes, term: codeList("abc")},
@@ -155,6 +156,20 @@ func TestParser_Term(t *testing.T) {
 		// https://github.com/ichiban/prolog/issues/219#issuecomment-1200489336
 		{input: `write('[]').`, term: &compound{functor: NewAtom(`write`), args: []Term{NewAtom(`[]`)}}},
 		{input: `write('{}').`, term: &compound{functor: NewAtom(`write`), args: []Term{NewAtom(`{}`)}}},
+
+		// dicts
+		{input: `point{}.`, term: &dict{compound: compound{functor: atomDictFunctor, args: []Term{NewAtom("point")}}}},
+		{input: `point{y: 2, x: 1}.`, term: &dict{compound: compound{functor: atomDictFunctor, args: []Term{NewAtom("point"), NewAtom("x"), Integer(1), NewAtom("y"), Integer(2)}}}},
+		{input: `'p'{'a b': -1, 2: c + d}.`, term: &dict{compound: compound{functor: atomDictFunctor, args: []Term{NewAtom("p"), Integer(2), &compound{functor: atomPlus, args: []Term{NewAtom("c"), NewAtom("d")}}, NewAtom("a b"), Integer(-1)}}}},
+		{input: `X{a: X}.`, termLazy: func() Term {
+			return &dict{compound: compound{functor: atomDictFunctor, args: []Term{lastVariable(), NewAtom("a"), lastVariable()}}}
+		}, vars: func() []ParsedVariable {
+			return []ParsedVariable{{Name: NewAtom("X"), Variable: lastVariable(), Count: 2}}
+		}},
+		{input: `point{x: 1, x: 2}.`, err: duplicateKeyError(NewAtom("x"), nil)},
+		{input: `point{x 1}.`, err: unexpectedTokenError{actual: Token{kind: TokenInteger, val: "1"}, pos: Position{Offset: 8, Line: 1, Column: 9}, line: "point{x 1}."}},
+		{input: `point{f(x): 1}.`, err: unexpectedTokenError{actual: Token{kind: TokenOpenCT, val: "("}, pos: Position{Offset: 7, Line: 1, Column: 8}, line: "point{f(x): 1}."}},
+		{input: `point {x: 1}.`, err: unexpectedTokenError{actual: Token{kind: TokenOpenCurly, val: "{"}, pos: Position{Offset: 6, Line: 1, Column: 7}, line: "point {x: 1}."}},
 	}
 
 	for _, tc := range tests {
@@ -182,6 +197,43 @@ func TestParser_Term(t *testing.T) {
 	}
 }
 
+func TestUnexpectedTokenError_Error(t *testing.T) {
+	tests := []struct {
+		title string
+		err   unexpectedTokenError
+		msg   string
+	}{
+		{title: "without position", err: unexpectedTokenError{actual: Token{kind: TokenClose, val: ")"}}, msg: "unexpected token: close())"},
+		{title: "with position", err: unexpectedTokenError{actual: Token{kind: TokenClose, val: ")"}, pos: Position{Offset: 5, Line: 2, Column: 5}}, msg: "2:5: unexpected token: close())"},
+		{title: "with file", err: unexpectedTokenError{actual: Token{kind: TokenClose, val: ")"}, file: "foo.pl", pos: Position{Offset: 5, Line: 2, Column: 5}, line: "foo()"}, msg: `foo.pl:2:5: unexpected token: close())
+foo()
+    ^`},
+		{title: "with tabs", err: unexpectedTokenError{actual: Token{kind: TokenClose, val: ")"}, pos: Position{Offset: 4, Line: 2, Column: 4}, line: "\tfo)"}, msg: "2:4: unexpected token: close())\n\tfo)\n\t  ^"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			assert.Equal(t, tt.msg, tt.err.Error())
+		})
+	}
+}
+
+func TestParser_Pos(t *testing.T) {
+	vm := VM{charConvEnabled: true, charConversions: map[rune]rune{'&': ','}}
+	p := NewParser(&vm, strings.NewReader("foo.\n  bar(a & b).\nbaz(])."))
+	_, err := p.Term()
+	assert.NoError(t, err)
+	assert.Equal(t, Position{Offset: 0, Line: 1, Column: 1}, p.Pos())
+	term, err := p.Term()
+	assert.NoError(t, err)
+	assert.Equal(t, NewAtom("bar").Apply(NewAtom("a"), NewAtom("b")), term)
+	assert.Equal(t, Position{Offset: 7, Line: 2, Column: 3}, p.Pos())
+	_, err = p.Term()
+	var e interface{ Pos() Position }
+	assert.True(t, errors.As(err, &e))
+	assert.Equal(t, Position{Offset: 23, Line: 3, Column: 5}, e.Pos())
+}
+
 func TestParser_Replace(t *testing.T) {
 	tests := []struct {
 		title        string
@@ -232,6 +284,49 @@ func TestParser_Replace(t *testing.T) {
 		},
 	}
 
+	t.Run("map", func(t *testing.T) {
+		p := Parser{
+			doubleQuotes: doubleQuotesAtom,
+			lexer: Lexer{
+				input: newRuneRingBuffer(strings.NewReader(`[?].`)),
+			},
+		}
+		assert.NoError(t, p.SetPlaceholder(NewAtom("?"), map[string]interface{}{"name": "x", "tags": []interface{}{"a", 1}}))
+		term, err := p.Term()
+		assert.NoError(t, err)
+		d, ok := term.(Compound).Arg(0).(*dict)
+		assert.True(t, ok)
+		_, ok = d.tag().(Variable)
+		assert.True(t, ok)
+		assert.Equal(t, []Term{NewAtom("name"), NewAtom("x"), NewAtom("tags"), List(NewAtom("a"), Integer(1))}, d.args[1:])
+	})
+
+	t.Run("map with non-string keys", func(t *testing.T) {
+		var p Parser
+		m := map[int]string{1: "a"}
+		assert.NoError(t, p.SetPlaceholder(NewAtom("?"), m))
+		assert.Equal(t, m, p.args[0].(*Blob).Value)
+	})
+
+	t.Run("blob", func(t *testing.T) {
+		type handle struct{ name string }
+		h := &handle{name: "db"}
+
+		var p Parser
+		ch := make(chan int)
+		assert.NoError(t, p.SetPlaceholder(NewAtom("?"), h, ch, NewAtom("foo"), NewBlob(h)))
+		assert.Same(t, h, p.args[0].(*Blob).Value)
+		assert.Equal(t, ch, p.args[1].(*Blob).Value)
+		assert.Equal(t, NewAtom("foo"), p.args[2])
+		assert.Same(t, h, p.args[3].(*Blob).Value)
+
+		v := handle{name: "value"}
+		assert.NoError(t, p.SetPlaceholder(NewAtom("?"), v, v))
+		assert.Equal(t, v, p.args[0].(*Blob).Value)
+		assert.Equal(t, v, p.args[1].(*Blob).Value)
+		assert.NotZero(t, p.args[0].Compare(p.args[1], nil))
+	})
+
 	for _, tt := range tests {
 		t.Run(tt.title, func(t *testing.T) {
 			p := Parser{
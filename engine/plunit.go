@@ -0,0 +1,397 @@
+package engine
+
+import (
+	"context"
+	"errors"
+)
+
+// UnitTest is a test defined by a clause of test/1,2 between begin_tests/1 and end_tests/1 directives.
+//
+//	test(Name) :- Body.
+//	test(Name, Options) :- Body.
+//
+// Options is an option or a list of these options:
+//
+//	true(Goal): Body must succeed and then Goal must succeed. Goal can be written as A == B, A = B, or A =:= B without true/1.
+//	fail, false: Body must fail.
+//	throws(E): Body must raise an exception subsumed by E.
+//	error(E): Same as throws(error(E, _)).
+//	nondet: Body may succeed more than once.
+//	setup(Goal), cleanup(Goal): Goal runs before and after Body. Cleanup runs even if Body fails or raises an exception.
+//	forall(Generator): Body runs for each solution of Generator.
+//	blocked(Reason): the test doesn't run.
+type UnitTest struct {
+	// Unit is the name of the unit given to begin_tests/1.
+	Unit Atom
+
+	// Name is the first argument of test/1,2.
+	Name Term
+
+	// File and Pos are the source location of the clause.
+	File string
+	Pos  Position
+
+	// raw is (Options, Body) of the clause.
+	raw Term
+}
+
+// Term returns Unit:Name.
+func (t UnitTest) Term() Term {
+	return atomColon.Apply(t.Unit, t.Name)
+}
+
+// TestResult is the outcome of a UnitTest.
+type TestResult struct {
+	// Passed is true if the test passed.
+	Passed bool
+
+	// Blocked is true if the test didn't run because of blocked/1 option.
+	Blocked bool
+
+	// Messages are the failures and the warnings of the test which run_tests/0,1 prints with print_message/2.
+	Messages []Message
+}
+
+// UnitTests returns the tests of the units in the order of definition. Without units, it returns all the tests.
+func (vm *VM) UnitTests(units ...Atom) []UnitTest {
+	if len(units) == 0 {
+		return append([]UnitTest(nil), vm.unitTests...)
+	}
+	var ts []UnitTest
+	for _, t := range vm.unitTests {
+		for _, u := range units {
+			if t.Unit == u {
+				ts = append(ts, t)
+				break
+			}
+		}
+	}
+	return ts
+}
+
+// RunUnitTest runs the test and reports the result.
+// Exceptions raised by the test are reported as failures while the other errors such as HaltError are returned.
+// Unless nondet option is given, the test also looks for another solution of Body and warns if there's one.
+func (vm *VM) RunUnitTest(ctx context.Context, t UnitTest) (TestResult, error) {
+	var r TestResult
+	report := func(kind Atom, term Term) {
+		m := Message{Kind: kind, Term: term, File: t.File, Pos: t.Pos}
+		if lines, env, err := vm.translateMessage(ctx, term, nil); err == nil {
+			m.Lines, _ = formatMessageLines(lines, vm.messageWriteOptions(), env)
+		}
+		r.Messages = append(r.Messages, m)
+	}
+
+	raw, err := renamedCopy(t.raw, nil, nil)
+	if err != nil {
+		return r, err
+	}
+	c := raw.(Compound)
+	body := c.Arg(1)
+	opts, err := testOptions(c.Arg(0))
+	if err != nil {
+		var e Exception
+		if !errors.As(err, &e) {
+			return r, err
+		}
+		report(atomError, atomTestFailed.Apply(t.Term(), atomException.Apply(e.Term())))
+		return r, nil
+	}
+
+	if opts.blocked != nil {
+		r.Blocked = true
+		report(atomInformational, atomTestBlocked.Apply(t.Term(), opts.blocked))
+		return r, nil
+	}
+
+	envs := []*Env{nil}
+	if opts.forall != nil {
+		envs = nil
+		_, err := Call(vm, opts.forall, func(env *Env) *Promise {
+			envs = append(envs, env)
+			return Bool(false)
+		}, nil).Force(ctx)
+		if err != nil {
+			reason, err := testException(err)
+			if err != nil {
+				return r, err
+			}
+			report(atomError, atomTestFailed.Apply(t.Term(), reason))
+			return r, nil
+		}
+	}
+
+	passed := true
+	for _, env := range envs {
+		test := t.Term()
+		if opts.forall != nil {
+			test = atomForall.Apply(test, env.Simplify(opts.forall))
+		}
+		reason, nondet, err := vm.runTestBody(ctx, body, &opts, env)
+		if err != nil {
+			return r, err
+		}
+		if reason != nil {
+			passed = false
+			report(atomError, atomTestFailed.Apply(test, reason))
+			continue
+		}
+		if nondet {
+			report(atomWarning, atomTestNondet.Apply(test))
+		}
+	}
+	r.Passed = passed
+	return r, nil
+}
+
+// runTestBody runs the setup, the body, and the cleanup of the test and returns the reason of the failure if it fails.
+// nondet is true if the body succeeded more than once without nondet option.
+func (vm *VM) runTestBody(ctx context.Context, body Term, opts *testOpts, env *Env) (reason Term, nondet bool, err error) {
+	if opts.setup != nil {
+		ok, err := Call(vm, opts.setup, func(e *Env) *Promise {
+			env = e
+			return Bool(true)
+		}, env).Force(ctx)
+		if err != nil {
+			reason, err := testException(err)
+			return reason, false, err
+		}
+		if !ok {
+			return atomSetupFailed, false, nil
+		}
+	}
+
+	after := env
+	if opts.cleanup != nil {
+		defer func() {
+			_, _ = Call(vm, opts.cleanup, Success, after).Force(ctx)
+		}()
+	}
+
+	var n int
+	ok, err := Call(vm, body, func(e *Env) *Promise {
+		n++
+		if n == 1 {
+			after = e
+			return Bool(opts.nondet || opts.fail || opts.throws != nil)
+		}
+		return Bool(true)
+	}, env).Force(ctx)
+	switch {
+	case opts.throws != nil:
+		var e Exception
+		switch {
+		case errors.As(err, &e):
+			ok, err := SubsumesTerm(vm, opts.throws, e.Term(), Success, env).Force(ctx)
+			if err != nil {
+				return nil, false, err
+			}
+			if !ok {
+				return atomWrongException.Apply(env.Simplify(opts.throws), e.Term()), false, nil
+			}
+			return nil, false, nil
+		case err != nil:
+			return nil, false, err
+		case ok:
+			return atomNoException.Apply(env.Simplify(opts.throws)), false, nil
+		default:
+			return atomFailed, false, nil
+		}
+	case err != nil:
+		reason, err := testException(err)
+		return reason, false, err
+	case opts.fail:
+		if ok {
+			return atomSucceeded, false, nil
+		}
+		return nil, false, nil
+	case n == 0:
+		return atomFailed, false, nil
+	}
+
+	for _, g := range opts.checks {
+		ok, err := Call(vm, g, Success, after).Force(ctx)
+		if err != nil {
+			reason, err := testException(err)
+			return reason, false, err
+		}
+		if !ok {
+			return atomWrongAnswer.Apply(after.Simplify(g)), false, nil
+		}
+	}
+	return nil, n > 1, nil
+}
+
+// testException returns the reason of the failure for an exception or err itself for the other errors.
+func testException(err error) (Term, error) {
+	var e Exception
+	if !errors.As(err, &e) {
+		return nil, err
+	}
+	return atomException.Apply(e.Term()), nil
+}
+
+type testOpts struct {
+	checks         []Term
+	fail, nondet   bool
+	throws         Term
+	setup, cleanup Term
+	forall         Term
+	blocked        Term
+}
+
+func testOptions(options Term) (testOpts, error) {
+	var opts testOpts
+	iter := anyIterator{Any: options}
+	for iter.Next() {
+		switch o := iter.Current().(type) {
+		case Variable:
+			return opts, InstantiationError(nil)
+		case Atom:
+			switch o {
+			case atomEmptyList:
+				continue
+			case atomFail, atomFalse:
+				opts.fail = true
+			case atomNondet:
+				opts.nondet = true
+			default:
+				return opts, domainError(validDomainTestOption, o, nil)
+			}
+		case Compound:
+			switch pi := (procedureIndicator{name: o.Functor(), arity: Integer(o.Arity())}); pi {
+			case procedureIndicator{name: atomTrue, arity: 1}:
+				opts.checks = append(opts.checks, o.Arg(0))
+			case procedureIndicator{name: atomEqualEqual, arity: 2}, procedureIndicator{name: atomEqual, arity: 2}, procedureIndicator{name: atomEqualColonEqual, arity: 2}:
+				opts.checks = append(opts.checks, o)
+			case procedureIndicator{name: atomThrows, arity: 1}:
+				opts.throws = o.Arg(0)
+			case procedureIndicator{name: atomError, arity: 1}:
+				opts.throws = atomError.Apply(o.Arg(0), NewVariable())
+			case procedureIndicator{name: atomSetup, arity: 1}:
+				opts.setup = o.Arg(0)
+			case procedureIndicator{name: atomCleanup, arity: 1}:
+				opts.cleanup = o.Arg(0)
+			case procedureIndicator{name: atomForall, arity: 1}:
+				opts.forall = o.Arg(0)
+			case procedureIndicator{name: atomBlocked, arity: 1}:
+				opts.blocked = o.Arg(0)
+			default:
+				return opts, domainError(validDomainTestOption, o, nil)
+			}
+		default:
+			return opts, domainError(validDomainTestOption, o, nil)
+		}
+	}
+	return opts, iter.Err()
+}
+
+// RunAllTests runs all the unit tests. It fails if any of them fails.
+func RunAllTests(vm *VM, k Cont, env *Env) *Promise {
+	return vm.runTests(vm.UnitTests(), k, env)
+}
+
+// RunTests runs the unit tests indicated by spec. It fails if any of them fails.
+// spec is either a unit name, Unit:Name, or a list of them.
+func RunTests(vm *VM, spec Term, k Cont, env *Env) *Promise {
+	var tests []UnitTest
+	iter := anyIterator{Any: spec, Env: env}
+	for iter.Next() {
+		ts, err := vm.testSpec(iter.Current(), env)
+		if err != nil {
+			return Error(err)
+		}
+		tests = append(tests, ts...)
+	}
+	if err := iter.Err(); err != nil {
+		return Error(err)
+	}
+	return vm.runTests(tests, k, env)
+}
+
+func (vm *VM) testSpec(spec Term, env *Env) ([]UnitTest, error) {
+	unit, name := spec, Term(nil)
+	if c, ok := env.Resolve(spec).(Compound); ok && c.Functor() == atomColon && c.Arity() == 2 {
+		unit, name = c.Arg(0), c.Arg(1)
+	}
+	switch u := env.Resolve(unit).(type) {
+	case Variable:
+		return nil, InstantiationError(env)
+	case Atom:
+		tests := vm.UnitTests(u)
+		if len(tests) == 0 {
+			return nil, existenceError(objectTypeUnit, u, env)
+		}
+		if name == nil {
+			return tests, nil
+		}
+		var ts []UnitTest
+		for _, t := range tests {
+			if t.Name.Compare(name, env) == 0 {
+				ts = append(ts, t)
+			}
+		}
+		if len(ts) == 0 {
+			return nil, existenceError(objectTypeTest, spec, env)
+		}
+		return ts, nil
+	default:
+		return nil, typeError(validTypeAtom, unit, env)
+	}
+}
+
+func (vm *VM) runTests(tests []UnitTest, k Cont, env *Env) *Promise {
+	return Delay(func(ctx context.Context) *Promise {
+		var passed, failed int
+		for _, t := range tests {
+			r, err := vm.RunUnitTest(ctx, t)
+			if err != nil {
+				return Error(err)
+			}
+			for _, m := range r.Messages {
+				if err := vm.printMessage(ctx, m, nil); err != nil {
+					return Error(err)
+				}
+			}
+			switch {
+			case r.Blocked:
+				continue
+			case r.Passed:
+				passed++
+			default:
+				failed++
+			}
+		}
+
+		if failed > 0 {
+			if err := vm.printMessage(ctx, Message{Kind: atomError, Term: atomTestsFailed.Apply(Integer(failed), Integer(passed+failed))}, nil); err != nil {
+				return Error(err)
+			}
+			return Bool(false)
+		}
+		if err := vm.printMessage(ctx, Message{Kind: atomInformational, Term: atomTestsPassed.Apply(Integer(passed))}, nil); err != nil {
+			return Error(err)
+		}
+		return k(env)
+	})
+}
+
+// unitTest makes a UnitTest from a clause of test/1,2.
+func unitTest(unit Atom, clause Term, file string, pos Position) UnitTest {
+	head, body := clause, Term(atomTrue)
+	if c, ok := clause.(Compound); ok && c.Functor() == atomIf && c.Arity() == 2 {
+		head, body = c.Arg(0), c.Arg(1)
+	}
+	h := head.(Compound)
+	var opts Term = List()
+	if h.Arity() == 2 {
+		opts = h.Arg(1)
+	}
+	return UnitTest{
+		Unit: unit,
+		Name: h.Arg(0),
+		File: file,
+		Pos:  pos,
+		raw:  tuple(opts, body),
+	}
+}
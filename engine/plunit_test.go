@@ -0,0 +1,237 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVM_RunUnitTest(t *testing.T) {
+	var (
+		vm      VM
+		cleaned []Term
+	)
+	vm.operators.define(700, operatorSpecifierXFX, atomEqual)
+	vm.operators.define(200, operatorSpecifierXFY, atomColon)
+	vm.Register0(atomTrue, func(_ *VM, k Cont, env *Env) *Promise {
+		return k(env)
+	})
+	vm.Register0(atomFail, func(*VM, Cont, *Env) *Promise {
+		return Bool(false)
+	})
+	vm.Register2(atomEqual, Unify)
+	vm.Register1(NewAtom("throw"), Throw)
+	vm.Register1(NewAtom("cleaned"), func(_ *VM, t Term, k Cont, env *Env) *Promise {
+		cleaned = append(cleaned, env.Resolve(t))
+		return k(env)
+	})
+	vm.Register0(NewAtom("halt"), func(*VM, Cont, *Env) *Promise {
+		return Error(&HaltError{Code: 1})
+	})
+	assert.NoError(t, vm.Compile(context.Background(), `
+m(a).
+m(b).
+:-(begin_tests(u)).
+test(pass).
+:-(test(fail, fail), fail).
+:-(test(true, true(=(X, a))), =(X, a)).
+:-(test(comparison, =(X, a)), =(X, a)).
+:-(test(nondet, nondet), m(_)).
+:-(test(throws, throws(error(e, _))), throw(error(e, c))).
+:-(test(error, error(e)), throw(error(e, c))).
+:-(test(setup, [setup(=(X, a)), cleanup(cleaned(X))]), =(X, a)).
+:-(test(forall, forall(m(X))), m(X)).
+:-(test(blocked, blocked(todo)), fail).
+:-(test(failed), fail).
+:-(test(succeeded, false), true).
+:-(test(wrong_answer, true(=(X, b))), =(X, a)).
+:-(test(choicepoint), m(_)).
+:-(test(no_exception, throws(e)), true).
+:-(test(wrong_exception, throws(e)), throw(f)).
+:-(test(failed_throws, throws(e)), fail).
+:-(test(exception), throw(e)).
+test(setup_failed, setup(fail)).
+test(setup_exception, setup(throw(e))).
+:-(test(cleanup_after_failure, [setup(=(X, b)), cleanup(cleaned(X))]), fail).
+:-(test(forall_failure, forall(m(X))), =(X, a)).
+test(forall_exception, forall(throw(e))).
+test(check_exception, true(throw(e))).
+test(variable_option, _).
+test(unknown_option, foo).
+:-(test(halt), halt).
+:-(end_tests(u)).
+`))
+
+	u := NewAtom("u")
+	tests := vm.UnitTests(u)
+
+	for _, tt := range []struct {
+		name     string
+		passed   bool
+		blocked  bool
+		messages []string
+		err      error
+	}{
+		{name: "pass", passed: true},
+		{name: "fail", passed: true},
+		{name: "true", passed: true},
+		{name: "comparison", passed: true},
+		{name: "nondet", passed: true},
+		{name: "throws", passed: true},
+		{name: "error", passed: true},
+		{name: "setup", passed: true},
+		{name: "forall", passed: true},
+		{name: "blocked", blocked: true, messages: []string{"% 14:1: test u:blocked: blocked: todo"}},
+		{name: "failed", messages: []string{"ERROR: 15:1: test u:failed: failed"}},
+		{name: "succeeded", messages: []string{"ERROR: 16:1: test u:succeeded: must fail but succeeded"}},
+		{name: "wrong_answer", messages: []string{"ERROR: 17:1: test u:wrong_answer: wrong answer: a=b"}},
+		{name: "choicepoint", passed: true, messages: []string{"Warning: 18:1: test u:choicepoint succeeded with a choicepoint"}},
+		{name: "no_exception", messages: []string{"ERROR: 19:1: test u:no_exception: must raise e but succeeded"}},
+		{name: "wrong_exception", messages: []string{"ERROR: 20:1: test u:wrong_exception: must raise e but raised f"}},
+		{name: "failed_throws", messages: []string{"ERROR: 21:1: test u:failed_throws: failed"}},
+		{name: "exception", messages: []string{"ERROR: 22:1: test u:exception: raised e"}},
+		{name: "setup_failed", messages: []string{"ERROR: 23:1: test u:setup_failed: setup failed"}},
+		{name: "setup_exception", messages: []string{"ERROR: 24:1: test u:setup_exception: raised e"}},
+		{name: "cleanup_after_failure", messages: []string{"ERROR: 25:1: test u:cleanup_after_failure: failed"}},
+		{name: "forall_failure", messages: []string{"ERROR: 26:1: test u:forall_failure (forall m(b)): failed"}},
+		{name: "forall_exception", messages: []string{"ERROR: 27:1: test u:forall_exception: raised e"}},
+		{name: "check_exception", messages: []string{"ERROR: 28:1: test u:check_exception: raised e"}},
+		{name: "variable_option", messages: []string{"ERROR: 29:1: test u:variable_option: raised error(instantiation_error,root)"}},
+		{name: "unknown_option", messages: []string{"ERROR: 30:1: test u:unknown_option: raised error(domain_error(test_option,foo),root)"}},
+		{name: "halt", err: &HaltError{Code: 1}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var test *UnitTest
+			for i := range tests {
+				if tests[i].Name == NewAtom(tt.name) {
+					test = &tests[i]
+				}
+			}
+			if !assert.NotNil(t, test) {
+				return
+			}
+			assert.Equal(t, u, test.Unit)
+
+			r, err := vm.RunUnitTest(context.Background(), *test)
+			assert.Equal(t, tt.err, err)
+			assert.Equal(t, tt.passed, r.Passed)
+			assert.Equal(t, tt.blocked, r.Blocked)
+			var ms []string
+			for _, m := range r.Messages {
+				ms = append(ms, m.String())
+			}
+			assert.Equal(t, tt.messages, ms)
+		})
+	}
+
+	assert.Equal(t, []Term{NewAtom("a"), NewAtom("b")}, cleaned)
+}
+
+func TestRunTests(t *testing.T) {
+	var (
+		vm  VM
+		buf bytes.Buffer
+	)
+	vm.errOutput = &Stream{sink: &buf, mode: ioModeAppend}
+	vm.operators.define(200, operatorSpecifierXFY, atomColon)
+	vm.Register0(atomTrue, func(_ *VM, k Cont, env *Env) *Promise {
+		return k(env)
+	})
+	vm.Register0(atomFail, func(*VM, Cont, *Env) *Promise {
+		return Bool(false)
+	})
+	assert.NoError(t, vm.Compile(context.Background(), `
+:-(begin_tests(a)).
+test(x).
+test(y).
+:-(end_tests(a)).
+:-(begin_tests(b)).
+test(x).
+:-(test(y), fail).
+test(z, blocked(todo)).
+:-(end_tests(b)).
+`))
+
+	tests := []struct {
+		title  string
+		spec   Term
+		ok     bool
+		err    error
+		output string
+	}{
+		{title: "all", ok: false, output: `ERROR: 8:1: test b:y: failed
+% 9:1: test b:z: blocked: todo
+ERROR: 1 of 4 tests failed
+`},
+		{title: "unit", spec: NewAtom("a"), ok: true, output: "% All 2 tests passed\n"},
+		{title: "test", spec: atomColon.Apply(NewAtom("b"), NewAtom("x")), ok: true, output: "% All 1 tests passed\n"},
+		{title: "list", spec: List(NewAtom("a"), atomColon.Apply(NewAtom("b"), NewAtom("y"))), ok: false, output: "ERROR: 8:1: test b:y: failed\nERROR: 1 of 3 tests failed\n"},
+		{title: "variable", spec: NewVariable(), err: InstantiationError(nil)},
+		{title: "not a unit", spec: Integer(1), err: typeError(validTypeAtom, Integer(1), nil)},
+		{title: "unknown unit", spec: NewAtom("c"), err: existenceError(objectTypeUnit, NewAtom("c"), nil)},
+		{title: "unknown test", spec: atomColon.Apply(NewAtom("a"), NewAtom("z")), err: existenceError(objectTypeTest, atomColon.Apply(NewAtom("a"), NewAtom("z")), nil)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			buf.Reset()
+			var p *Promise
+			if tt.spec == nil {
+				p = RunAllTests(&vm, Success, nil)
+			} else {
+				p = RunTests(&vm, tt.spec, Success, nil)
+			}
+			ok, err := p.Force(context.Background())
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.err, err)
+			assert.Equal(t, tt.output, buf.String())
+		})
+	}
+}
+
+func TestVM_Compile_unitTests(t *testing.T) {
+	t.Run("tests are not procedures", func(t *testing.T) {
+		var vm VM
+		assert.NoError(t, vm.Compile(context.Background(), `
+test(outside).
+:-(begin_tests(u)).
+test(inside).
+helper.
+:-(end_tests(u)).
+`))
+		assert.Len(t, vm.UnitTests(), 1)
+		assert.Len(t, vm.procedures[procedureIndicator{name: atomTest, arity: 1}].(*userDefined).clauses, 1)
+		assert.Contains(t, vm.procedures, procedureIndicator{name: NewAtom("helper"), arity: 0})
+	})
+
+	tests := []struct {
+		title string
+		text  string
+		err   error
+	}{
+		{title: "variable unit", text: `:-(begin_tests(_)).`, err: InstantiationError(nil)},
+		{title: "not an atom", text: `:-(begin_tests(1)).`, err: typeError(validTypeAtom, Integer(1), nil)},
+		{title: "nested", text: `:-(begin_tests(a)). :-(begin_tests(b)).`, err: errors.New("begin_tests(b) inside begin_tests(a)")},
+		{title: "unclosed", text: `:-(begin_tests(a)).`, err: errors.New("begin_tests(a) without end_tests(a)")},
+		{title: "unopened", text: `:-(end_tests(a)).`, err: errors.New("end_tests(a) without begin_tests(a)")},
+		{title: "mismatched", text: `:-(begin_tests(a)). :-(end_tests(b)).`, err: errors.New("end_tests(b) without begin_tests(b)")},
+		{title: "variable end", text: `:-(end_tests(_)).`, err: InstantiationError(nil)},
+		{title: "end not an atom", text: `:-(end_tests(1)).`, err: typeError(validTypeAtom, Integer(1), nil)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			var vm VM
+			err := vm.Compile(context.Background(), tt.text)
+			if _, ok := tt.err.(Exception); ok {
+				assert.Equal(t, tt.err, err)
+			} else {
+				assert.EqualError(t, err, tt.err.Error())
+			}
+			assert.Empty(t, vm.UnitTests())
+		})
+	}
+}
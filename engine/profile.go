@@ -0,0 +1,460 @@
+package engine
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+var now = time.Now
+
+// Profile is the result of profiling.
+type Profile struct {
+	// Entries are the statistics of the called procedures in descending order of the exclusive time.
+	Entries  []ProfileEntry
+	Duration time.Duration
+
+	samples []*profileNode
+}
+
+// ProfileEntry is the statistics of a procedure.
+type ProfileEntry struct {
+	Name  Atom
+	Arity int
+
+	Calls      int
+	Redos      int
+	Fails      int
+	Exceptions int
+
+	// ChoicePoints is the number of times the procedure left alternative clauses to try on backtracking.
+	ChoicePoints int
+
+	// Inclusive is the time spent in the procedure including the procedures it called.
+	// Recursive calls are counted once.
+	Inclusive time.Duration
+
+	// Exclusive is the time spent in the procedure excluding the procedures it called.
+	Exclusive time.Duration
+}
+
+// Profile calls f while recording the time spent in each procedure and returns the result.
+func (vm *VM) Profile(f func()) *Profile {
+	p := profiler{
+		entries: map[procedureIndicator]*ProfileEntry{},
+		active:  map[*profileFrame]struct{}{},
+	}
+	prev := vm.profiler
+	vm.profiler = &p
+	vm.features |= featureProfile
+	start := now()
+	f()
+	vm.profiler = prev
+	vm.features.set(featureProfile, prev != nil)
+	return p.profile(now().Sub(start))
+}
+
+// ProfileGoal executes goal under profiling and writes the result to user_output. It succeeds at most once.
+func ProfileGoal(vm *VM, goal Term, k Cont, env *Env) *Promise {
+	return Delay(func(ctx context.Context) *Promise {
+		var (
+			ok  bool
+			err error
+		)
+		p := vm.Profile(func() {
+			ok, err = Call(vm, goal, func(e *Env) *Promise {
+				env = e
+				return Bool(true)
+			}, env).Force(ctx)
+		})
+		if w, err := vm.output.textWriter(); err == nil {
+			_ = p.WriteText(w)
+		}
+		if err != nil {
+			return Error(err)
+		}
+		if !ok {
+			return Bool(false)
+		}
+		return k(env)
+	})
+}
+
+// WriteText writes the entries in a human readable table.
+func (p *Profile) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+	_, _ = fmt.Fprintln(tw, "Predicate\tCalls\tRedos\tFails\tExceptions\tChoice points\tInclusive\tExclusive\t")
+	for _, e := range p.Entries {
+		_, _ = fmt.Fprintf(tw, "%s/%d\t%d\t%d\t%d\t%d\t%d\t%s\t%s\t\n", e.Name, e.Arity, e.Calls, e.Redos, e.Fails, e.Exceptions, e.ChoicePoints, e.Inclusive, e.Exclusive)
+	}
+	return tw.Flush()
+}
+
+// WritePprof writes the profile in the gzipped protocol buffer format of pprof so that it can be examined by `go tool pprof`.
+// Each sample is a call stack of procedures with the number of calls and the exclusive time.
+func (p *Profile) WritePprof(w io.Writer) error {
+	var (
+		b       protoBuffer
+		strs    = map[string]int64{}
+		strTab  []string
+		funcIDs = map[procedureIndicator]uint64{}
+		funcs   []procedureIndicator
+	)
+	str := func(s string) int64 {
+		if i, ok := strs[s]; ok {
+			return i
+		}
+		i := int64(len(strTab))
+		strs[s] = i
+		strTab = append(strTab, s)
+		return i
+	}
+	str("")
+
+	valueType := func(typ, unit string) []byte {
+		var v protoBuffer
+		v.int64(1, str(typ))
+		v.int64(2, str(unit))
+		return v
+	}
+	b.message(1, valueType("calls", "count")) // sample_type
+	b.message(1, valueType("time", "nanoseconds"))
+
+	for _, s := range p.samples {
+		var (
+			sample protoBuffer
+			stack  = s.stack()
+			ids    = make([]uint64, len(stack))
+		)
+		for i, pi := range stack {
+			id, ok := funcIDs[pi]
+			if !ok {
+				id = uint64(len(funcs) + 1)
+				funcIDs[pi] = id
+				funcs = append(funcs, pi)
+			}
+			ids[i] = id
+		}
+		sample.packedUint64(1, ids) // location_id
+		sample.packedInt64(2, []int64{int64(s.count), int64(s.duration)})
+		b.message(2, sample)
+	}
+
+	// Locations and functions correspond one to one. They share IDs.
+	for i := range funcs {
+		id := uint64(i + 1)
+		var line, loc protoBuffer
+		line.uint64(1, id) // function_id
+		loc.uint64(1, id)
+		loc.message(4, line)
+		b.message(4, loc) // location
+	}
+	for i, pi := range funcs {
+		var f protoBuffer
+		f.uint64(1, uint64(i+1))
+		f.int64(2, str(pi.String()))
+		f.int64(3, str(pi.String()))
+		b.message(5, f) // function
+	}
+
+	b.int64(10, int64(p.Duration)) // duration_nanos
+	b.message(11, valueType("time", "nanoseconds"))
+
+	var st protoBuffer
+	for _, s := range strTab {
+		st.bytes(6, []byte(s)) // string_table
+	}
+
+	gz := gzip.NewWriter(w)
+	if _, err := gz.Write(b); err != nil {
+		return err
+	}
+	if _, err := gz.Write(st); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+type profiler struct {
+	mu      sync.Mutex
+	entries map[procedureIndicator]*ProfileEntry
+
+	// root is the root of the call tree. It's not a procedure.
+	root profileNode
+
+	// current is the invocation which the execution is in.
+	current *profileFrame
+
+	active map[*profileFrame]struct{}
+}
+
+// profileNode is a call stack in the call tree. It's shared among the invocations with the same call stack.
+type profileNode struct {
+	pi       procedureIndicator
+	parent   *profileNode
+	children map[procedureIndicator]*profileNode
+
+	// recursive reports whether pi is also in the ancestors.
+	recursive bool
+
+	// count is the number of the invocations and duration is the exclusive time spent in them.
+	count    int
+	duration time.Duration
+}
+
+func (n *profileNode) child(pi procedureIndicator) *profileNode {
+	c, ok := n.children[pi]
+	if ok {
+		return c
+	}
+	c = &profileNode{pi: pi, parent: n}
+	for a := n; a.parent != nil; a = a.parent {
+		if a.pi == pi {
+			c.recursive = true
+			break
+		}
+	}
+	if n.children == nil {
+		n.children = map[procedureIndicator]*profileNode{}
+	}
+	n.children[pi] = c
+	return c
+}
+
+// stack returns the procedures from the leaf to the root.
+func (n *profileNode) stack() []procedureIndicator {
+	var ret []procedureIndicator
+	for ; n.parent != nil; n = n.parent {
+		ret = append(ret, n.pi)
+	}
+	return ret
+}
+
+// profileFrame is an invocation of a procedure.
+type profileFrame struct {
+	pi     procedureIndicator
+	parent *profileFrame
+	node   *profileNode
+
+	// start is when the execution entered the procedure through the call or redo port.
+	start time.Time
+
+	// children is the time spent in the procedures called since start.
+	children time.Duration
+
+	// sampled reports whether the invocation is counted in the call tree.
+	sampled bool
+}
+
+func (p *profiler) entry(pi procedureIndicator) *ProfileEntry {
+	e, ok := p.entries[pi]
+	if !ok {
+		e = &ProfileEntry{Name: pi.name, Arity: int(pi.arity)}
+		p.entries[pi] = e
+	}
+	return e
+}
+
+// enter makes f the current invocation. At the call port, the caller is the current invocation.
+func (p *profiler) enter(f *profileFrame, port Port) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	e := p.entry(f.pi)
+	switch port {
+	case PortCall:
+		e.Calls++
+		f.parent = p.current
+		if f.parent == nil {
+			f.node = p.root.child(f.pi)
+		} else {
+			f.node = f.parent.node.child(f.pi)
+		}
+	case PortRedo:
+		e.Redos++
+	}
+	f.start = now()
+	f.children = 0
+	p.active[f] = struct{}{}
+	p.current = f
+}
+
+// leave makes the caller of f the current invocation.
+func (p *profiler) leave(f *profileFrame, port Port) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.active[f]; !ok {
+		return
+	}
+	delete(p.active, f)
+	p.current = f.parent
+	e := p.entry(f.pi)
+	switch port {
+	case PortFail:
+		e.Fails++
+	case PortException:
+		e.Exceptions++
+	}
+	p.record(f, now().Sub(f.start))
+}
+
+func (p *profiler) record(f *profileFrame, d time.Duration) {
+	e := p.entry(f.pi)
+	e.Exclusive += d - f.children
+	if !f.node.recursive {
+		e.Inclusive += d
+	}
+	if f.parent != nil {
+		f.parent.children += d
+	}
+
+	f.node.duration += d - f.children
+	if !f.sampled {
+		f.node.count++
+		f.sampled = true
+	}
+}
+
+func (p *profiler) choicePoint(pi procedureIndicator) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.entry(pi).ChoicePoints++
+}
+
+func (p *profiler) profile(d time.Duration) *Profile {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// Close the invocations which are still active, e.g. ones which succeeded with alternatives left.
+	t := now()
+	var fs []*profileFrame
+	for f := range p.active {
+		fs = append(fs, f)
+	}
+	sort.Slice(fs, func(i, j int) bool { // leaves first
+		return fs[i].start.After(fs[j].start)
+	})
+	for _, f := range fs {
+		p.record(f, t.Sub(f.start))
+	}
+
+	ret := Profile{Duration: d}
+	for _, e := range p.entries {
+		ret.Entries = append(ret.Entries, *e)
+	}
+	sort.Slice(ret.Entries, func(i, j int) bool {
+		ei, ej := ret.Entries[i], ret.Entries[j]
+		if ei.Exclusive != ej.Exclusive {
+			return ei.Exclusive > ej.Exclusive
+		}
+		if ei.Name != ej.Name {
+			return ei.Name.String() < ej.Name.String()
+		}
+		return ei.Arity < ej.Arity
+	})
+	var walk func(n *profileNode)
+	walk = func(n *profileNode) {
+		for _, c := range n.children {
+			ret.samples = append(ret.samples, c)
+			walk(c)
+		}
+	}
+	walk(&p.root)
+	sort.Slice(ret.samples, func(i, j int) bool {
+		return ret.samples[i].duration > ret.samples[j].duration
+	})
+	return &ret
+}
+
+// profiled is a procedure which records the time spent in it.
+type profiled struct {
+	pi procedureIndicator
+	procedure
+}
+
+func (p profiled) call(vm *VM, args []Term, k Cont, env *Env) *Promise {
+	prof := vm.profiler
+	if prof == nil {
+		return p.procedure.call(vm, args, k, env)
+	}
+
+	f := profileFrame{pi: p.pi}
+	prof.enter(&f, PortCall)
+
+	return catch(func(err error) *Promise {
+		prof.leave(&f, PortException)
+		return nil
+	}, func(ctx context.Context) *Promise {
+		return Delay(func(ctx context.Context) *Promise {
+			return p.procedure.call(vm, args, func(env *Env) *Promise {
+				prof.leave(&f, PortExit)
+				return Delay(func(ctx context.Context) *Promise {
+					return k(env)
+				}, func(ctx context.Context) *Promise {
+					prof.enter(&f, PortRedo)
+					return Bool(false)
+				})
+			}, env)
+		}, func(ctx context.Context) *Promise {
+			prof.leave(&f, PortFail)
+			return Bool(false)
+		})
+	})
+}
+
+// protoBuffer encodes protocol buffers messages.
+type protoBuffer []byte
+
+func (b *protoBuffer) varint(x uint64) {
+	for x >= 0x80 {
+		*b = append(*b, byte(x)|0x80)
+		x >>= 7
+	}
+	*b = append(*b, byte(x))
+}
+
+func (b *protoBuffer) key(field int, wireType uint64) {
+	b.varint(uint64(field)<<3 | wireType)
+}
+
+func (b *protoBuffer) uint64(field int, x uint64) {
+	if x == 0 {
+		return
+	}
+	b.key(field, 0)
+	b.varint(x)
+}
+
+func (b *protoBuffer) int64(field int, x int64) {
+	b.uint64(field, uint64(x))
+}
+
+func (b *protoBuffer) bytes(field int, p []byte) {
+	b.key(field, 2)
+	b.varint(uint64(len(p)))
+	*b = append(*b, p...)
+}
+
+func (b *protoBuffer) message(field int, m protoBuffer) {
+	b.bytes(field, m)
+}
+
+func (b *protoBuffer) packedUint64(field int, xs []uint64) {
+	var p protoBuffer
+	for _, x := range xs {
+		p.varint(x)
+	}
+	b.bytes(field, p)
+}
+
+func (b *protoBuffer) packedInt64(field int, xs []int64) {
+	var p protoBuffer
+	for _, x := range xs {
+		p.varint(uint64(x))
+	}
+	b.bytes(field, p)
+}
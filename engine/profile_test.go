@@ -0,0 +1,143 @@
+package engine
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVM_Profile(t *testing.T) {
+	defer func(f func() time.Time) {
+		now = f
+	}(now)
+	var clock time.Time
+	now = func() time.Time {
+		clock = clock.Add(time.Millisecond)
+		return clock
+	}
+
+	var vm VM
+	vm.Register1(NewAtom("throw"), Throw)
+	vm.Register3(NewAtom("catch"), Catch)
+	vm.Register2(NewAtom("="), Unify)
+	assert.NoError(t, vm.Compile(context.Background(), `
+:-(foo(X), ','(bar(X), =(X, b))).
+bar(a).
+bar(b).
+:-(baz, throw(e)).
+`))
+
+	p := vm.Profile(func() {
+		ok, err := Call(&vm, NewAtom("foo").Apply(NewVariable()), Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+
+		ok, err = Call(&vm, NewAtom("catch").Apply(NewAtom("baz"), NewVariable(), NewAtom("=").Apply(Integer(1), Integer(1))), Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+
+	entries := map[string]ProfileEntry{}
+	for _, e := range p.Entries {
+		entries[procedureIndicator{name: e.Name, arity: Integer(e.Arity)}.String()] = e
+	}
+
+	foo := entries["foo/1"]
+	assert.Equal(t, 1, foo.Calls)
+	assert.Equal(t, 0, foo.Fails)
+	assert.True(t, foo.Inclusive > foo.Exclusive)
+
+	bar := entries["bar/1"]
+	assert.Equal(t, 1, bar.Calls)
+	assert.Equal(t, 1, bar.Redos)
+	assert.Equal(t, 1, bar.ChoicePoints)
+
+	eq := entries["=/2"]
+	assert.Equal(t, 3, eq.Calls)
+	assert.Equal(t, 1, eq.Fails)
+
+	baz := entries["baz/0"]
+	assert.Equal(t, 1, baz.Calls)
+	assert.Equal(t, 1, baz.Exceptions)
+
+	for i := 1; i < len(p.Entries); i++ {
+		assert.True(t, p.Entries[i-1].Exclusive >= p.Entries[i].Exclusive)
+	}
+
+	t.Run("call tree", func(t *testing.T) {
+		stacks := map[string]int{}
+		for _, s := range p.samples {
+			var ss []string
+			for _, pi := range s.stack() {
+				ss = append(ss, pi.String())
+			}
+			stacks[strings.Join(ss, ";")] = s.count
+		}
+		assert.Equal(t, map[string]int{
+			"foo/1":                 1,
+			"bar/1;foo/1":           1,
+			"=/2;foo/1":             2,
+			"catch/3":               1,
+			"baz/0;catch/3":         1,
+			"throw/1;baz/0;catch/3": 1,
+			"=/2;catch/3":           1,
+		}, stacks)
+	})
+
+	t.Run("text", func(t *testing.T) {
+		var buf bytes.Buffer
+		assert.NoError(t, p.WriteText(&buf))
+		assert.Contains(t, buf.String(), "Predicate")
+		assert.Contains(t, buf.String(), "foo/1")
+	})
+
+	t.Run("pprof", func(t *testing.T) {
+		var buf bytes.Buffer
+		assert.NoError(t, p.WritePprof(&buf))
+		r, err := gzip.NewReader(&buf)
+		assert.NoError(t, err)
+		b, err := io.ReadAll(r)
+		assert.NoError(t, err)
+		assert.Contains(t, string(b), "foo/1")
+		assert.Contains(t, string(b), "nanoseconds")
+	})
+}
+
+func TestVM_Profile_recursive(t *testing.T) {
+	defer func(f func() time.Time) {
+		now = f
+	}(now)
+	var clock time.Time
+	now = func() time.Time {
+		clock = clock.Add(time.Millisecond)
+		return clock
+	}
+
+	var vm VM
+	assert.NoError(t, vm.Compile(context.Background(), `
+:-(cnt(0), !).
+:-(cnt(N), ','(succ(M, N), cnt(M))).
+`))
+	vm.Register2(NewAtom("succ"), Succ)
+
+	p := vm.Profile(func() {
+		ok, err := Call(&vm, NewAtom("cnt").Apply(Integer(3)), Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+
+	for _, e := range p.Entries {
+		if e.Name != NewAtom("cnt") {
+			continue
+		}
+		assert.Equal(t, 4, e.Calls)
+		assert.True(t, e.Inclusive < 4*e.Exclusive, "recursive calls are counted once: %v", e)
+	}
+	assert.Len(t, p.samples, 7) // cnt/1 and succ/2 at each depth but the last.
+}
@@ -76,12 +76,23 @@ func catch(recover func(error) *Promise, k func(context.Context) *Promise) *Prom
 
 // Force enforces the delayed execution and returns the result. (i.e. trampoline)
 func (p *Promise) Force(ctx context.Context) (ok bool, err error) {
+	var limit int
+	if u, ok := usageOf(ctx); ok {
+		limit = u.limits.PromiseStack
+	}
 	stack := promiseStack{p}
 	for len(stack) > 0 {
 		select {
 		case <-ctx.Done():
 			return false, ctx.Err()
 		default:
+			if limit > 0 && len(stack) > limit {
+				if err := stack.recover(resourceError(resourcePromiseStack, nil)); err != nil {
+					return false, err
+				}
+				continue
+			}
+
 			p := stack.pop()
 
 			if len(p.delayed) == 0 {
@@ -0,0 +1,66 @@
+package engine
+
+// Snapshot is a copy of the states of a VM which directives such as op/3, char_conversion/2, and set_prolog_flag/2 change.
+// Tools which read many texts with one VM, e.g. a language server, can restore the VM to a snapshot before reading each text.
+type Snapshot struct {
+	operators            operators
+	charConversions      map[rune]rune
+	charConvEnabled      bool
+	doubleQuotes         doubleQuotes
+	unknown              unknownAction
+	discontiguousWarning bool
+	answerWriteOptions   Term
+	debug                bool
+	chrEnabled           bool
+}
+
+// Snapshot returns a copy of the operators, the character conversions, and the flags of the VM.
+func (vm *VM) Snapshot() Snapshot {
+	return Snapshot{
+		operators:            vm.operators.clone(),
+		charConversions:      cloneCharConversions(vm.charConversions),
+		charConvEnabled:      vm.charConvEnabled,
+		doubleQuotes:         vm.doubleQuotes,
+		unknown:              vm.unknown,
+		discontiguousWarning: vm.discontiguousWarning,
+		answerWriteOptions:   vm.answerWriteOptions,
+		debug:                vm.features.has(featureDebug),
+		chrEnabled:           vm.chrEnabled,
+	}
+}
+
+// Restore sets the operators, the character conversions, and the flags of the VM back to the snapshot.
+// The snapshot stays intact so that it can be restored again.
+func (vm *VM) Restore(s Snapshot) {
+	vm.operators = s.operators.clone()
+	vm.charConversions = cloneCharConversions(s.charConversions)
+	vm.charConvEnabled = s.charConvEnabled
+	vm.doubleQuotes = s.doubleQuotes
+	vm.unknown = s.unknown
+	vm.discontiguousWarning = s.discontiguousWarning
+	vm.answerWriteOptions = s.answerWriteOptions
+	vm.features.set(featureDebug, s.debug)
+	vm.chrEnabled = s.chrEnabled
+}
+
+func (ops operators) clone() operators {
+	if ops == nil {
+		return nil
+	}
+	ret := make(operators, len(ops))
+	for name, o := range ops {
+		ret[name] = o
+	}
+	return ret
+}
+
+func cloneCharConversions(m map[rune]rune) map[rune]rune {
+	if m == nil {
+		return nil
+	}
+	ret := make(map[rune]rune, len(m))
+	for k, v := range m {
+		ret[k] = v
+	}
+	return ret
+}
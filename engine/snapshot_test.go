@@ -0,0 +1,39 @@
+package engine
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVM_Snapshot(t *testing.T) {
+	var vm VM
+	vm.operators.define(500, operatorSpecifierYFX, atomPlus)
+	vm.charConversions = map[rune]rune{'a': 'b'}
+	vm.doubleQuotes = doubleQuotesChars
+	s := vm.Snapshot()
+
+	_, err := Op(&vm, Integer(700), atomXFX, NewAtom("===>"), Success, nil).Force(context.Background())
+	assert.NoError(t, err)
+	_, err = Op(&vm, Integer(0), atomYFX, atomPlus, Success, nil).Force(context.Background())
+	assert.NoError(t, err)
+	_, err = CharConversion(&vm, NewAtom("a"), NewAtom("c"), Success, nil).Force(context.Background())
+	assert.NoError(t, err)
+	_, err = SetPrologFlag(&vm, atomDoubleQuotes, atomAtom, Success, nil).Force(context.Background())
+	assert.NoError(t, err)
+	_, err = SetPrologFlag(&vm, atomUnknown, atomFail, Success, nil).Force(context.Background())
+	assert.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		vm.Restore(s)
+		assert.True(t, vm.operators.definedInClass(atomPlus, operatorClassInfix))
+		assert.False(t, vm.operators.defined(NewAtom("===>")))
+		assert.Equal(t, map[rune]rune{'a': 'b'}, vm.charConversions)
+		assert.Equal(t, doubleQuotesChars, vm.doubleQuotes)
+		assert.Equal(t, unknownError, vm.unknown)
+
+		vm.operators.define(700, operatorSpecifierXFX, NewAtom("===>"))
+		vm.charConversions['a'] = 'd'
+	}
+}
@@ -0,0 +1,379 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// tabling is a specification of a tabled predicate declared by table/1.
+type tabling struct {
+	pi procedureIndicator
+
+	// modes is nil for variant tabling.
+	// Otherwise, each element is a variable for an indexed argument or one of min, max, and lattice(PI) for a moded argument.
+	modes []Term
+}
+
+// table is an answer table for a variant of a tabled call.
+type table struct {
+	key        string
+	goal       Term
+	answers    []Term
+	index      map[string]int
+	complete   bool
+	evaluating bool
+	iteration  int
+}
+
+func (u *userDefined) call(vm *VM, args []Term, k Cont, env *Env) *Promise {
+	if u.tabling == nil {
+		return u.clauses.call(vm, args, k, env)
+	}
+	return vm.tabled(u, args, k, env)
+}
+
+// tabled answers a call to a tabled predicate from its answer table.
+// If the table is not complete yet, it evaluates the clauses until no new answers are found.
+func (vm *VM) tabled(u *userDefined, args []Term, k Cont, env *Env) *Promise {
+	pattern := make([]Term, len(args))
+	for i, a := range args {
+		if u.tabling.moded(i) {
+			a = NewVariable()
+		}
+		pattern[i] = a
+	}
+	goal, err := u.tabling.pi.Apply(pattern...)
+	if err != nil {
+		return Error(err)
+	}
+	head, err := u.tabling.pi.Apply(args...)
+	if err != nil {
+		return Error(err)
+	}
+
+	return Delay(func(ctx context.Context) *Promise {
+		key := variantKey(goal, env)
+		tb, ok := vm.tables[key]
+		if !ok {
+			g, err := renamedCopy(goal, nil, env)
+			if err != nil {
+				return Error(err)
+			}
+			tb = &table{key: key, goal: g, index: map[string]int{}}
+			if vm.tables == nil {
+				vm.tables = map[string]*table{}
+			}
+			vm.tables[key] = tb
+		}
+
+		if !tb.complete {
+			if err := vm.tableEvaluate(ctx, u, tb); err != nil {
+				return Error(err)
+			}
+		}
+
+		answers := tb.answers
+		ks := make([]func(context.Context) *Promise, len(answers))
+		for i := range answers {
+			a := answers[i]
+			ks[i] = func(context.Context) *Promise {
+				a, err := renamedCopy(a, nil, nil)
+				if err != nil {
+					return Error(err)
+				}
+				return Unify(vm, head, a, k, env)
+			}
+		}
+		return Delay(ks...)
+	})
+}
+
+// tableEvaluate evaluates tb. The first table to be evaluated becomes the leader and iterates until a fixpoint is reached.
+// The other tables evaluated meanwhile are evaluated at most once per iteration and completed along with the leader.
+func (vm *VM) tableEvaluate(ctx context.Context, u *userDefined, tb *table) (err error) {
+	if vm.tableLeader != nil {
+		if tb.evaluating || tb.iteration == vm.tableIteration {
+			return nil // Consumes the answers found so far. The leader will iterate if there are new answers.
+		}
+		if tb.iteration == 0 {
+			vm.tablePending = append(vm.tablePending, tb)
+		}
+		tb.iteration = vm.tableIteration
+		return vm.tableSolve(ctx, u, tb)
+	}
+
+	vm.tableLeader, vm.tablePending = tb, []*table{tb}
+	defer func() {
+		for _, p := range vm.tablePending {
+			p.complete = err == nil
+			if err != nil && vm.tables[p.key] == p {
+				delete(vm.tables, p.key)
+			}
+		}
+		vm.tableLeader, vm.tablePending = nil, nil
+	}()
+
+	for {
+		vm.tableIteration++
+		tb.iteration = vm.tableIteration
+		vm.tableChanged = false
+		if err := vm.tableSolve(ctx, u, tb); err != nil {
+			return err
+		}
+		if !vm.tableChanged {
+			return nil
+		}
+	}
+}
+
+func (vm *VM) tableSolve(ctx context.Context, u *userDefined, tb *table) error {
+	tb.evaluating = true
+	defer func() {
+		tb.evaluating = false
+	}()
+
+	goal, err := renamedCopy(tb.goal, nil, nil)
+	if err != nil {
+		return err
+	}
+	var args []Term
+	if c, ok := goal.(Compound); ok {
+		args = make([]Term, c.Arity())
+		for i := range args {
+			args[i] = c.Arg(i)
+		}
+	}
+
+	_, err = u.clauses.call(vm, args, func(env *Env) *Promise {
+		if err := vm.tableAdd(ctx, u.tabling, tb, goal, env); err != nil {
+			return Error(err)
+		}
+		return Bool(false)
+	}, nil).Force(ctx)
+	return err
+}
+
+// tableAdd adds an answer to tb. For mode-directed tabling, it aggregates the moded arguments of the answers with the same indexed arguments.
+func (vm *VM) tableAdd(ctx context.Context, t *tabling, tb *table, goal Term, env *Env) error {
+	answer, err := renamedCopy(goal, nil, env)
+	if err != nil {
+		return err
+	}
+
+	if t.modes == nil {
+		key := variantKey(answer, nil)
+		if _, ok := tb.index[key]; ok {
+			return nil
+		}
+		tb.index[key] = len(tb.answers)
+		tb.answers = append(tb.answers, answer)
+		vm.tableChanged = true
+		return nil
+	}
+
+	a := answer.(Compound)
+	indexed := make([]Term, 0, a.Arity())
+	for i := 0; i < a.Arity(); i++ {
+		if !t.moded(i) {
+			indexed = append(indexed, a.Arg(i))
+		}
+	}
+	key := variantKey(List(indexed...), nil)
+	n, ok := tb.index[key]
+	if !ok {
+		tb.index[key] = len(tb.answers)
+		tb.answers = append(tb.answers, answer)
+		vm.tableChanged = true
+		return nil
+	}
+
+	old := tb.answers[n].(Compound)
+	args := make([]Term, old.Arity())
+	updated := false
+	for i := range args {
+		args[i] = old.Arg(i)
+		if !t.moded(i) {
+			continue
+		}
+		v, err := vm.tableAggregate(ctx, t.modes[i], old.Arg(i), a.Arg(i))
+		if err != nil {
+			return err
+		}
+		if !variant(v, old.Arg(i), nil) {
+			args[i] = v
+			updated = true
+		}
+	}
+	if updated {
+		tb.answers[n] = old.Functor().Apply(args...)
+		vm.tableChanged = true
+	}
+	return nil
+}
+
+func (vm *VM) tableAggregate(ctx context.Context, mode, old, new Term) (Term, error) {
+	switch m := mode.(type) {
+	case Atom:
+		switch m {
+		case atomMin:
+			if new.Compare(old, nil) < 0 {
+				return new, nil
+			}
+		case atomMax:
+			if new.Compare(old, nil) > 0 {
+				return new, nil
+			}
+		}
+		return old, nil
+	default: // lattice(PI)
+		closure := m.(Compound).Arg(0)
+		if pi, ok := closure.(Compound); ok && pi.Functor() == atomSlash && pi.Arity() == 2 {
+			closure = pi.Arg(0)
+		}
+		joined := NewVariable()
+		ret := old
+		_, err := Call3(vm, closure, old, new, joined, func(env *Env) *Promise {
+			var err error
+			ret, err = renamedCopy(joined, nil, env)
+			if err != nil {
+				return Error(err)
+			}
+			return Bool(true)
+		}, nil).Force(ctx)
+		return ret, err
+	}
+}
+
+func (t *tabling) moded(i int) bool {
+	if t.modes == nil {
+		return false
+	}
+	_, ok := t.modes[i].(Variable)
+	return !ok
+}
+
+// table declares tabled predicates specified by either predicate indicators or mode-directed specifications like path(_, _, min).
+func (t *text) table(specs Term) error {
+	iter := anyIterator{Any: specs}
+	for iter.Next() {
+		var tb tabling
+		switch s := iter.Current().(type) {
+		case Variable:
+			return InstantiationError(nil)
+		case Atom:
+			tb.pi = procedureIndicator{name: s, arity: 0}
+		case Compound:
+			if s.Functor() == atomSlash && s.Arity() == 2 {
+				switch n := s.Arg(0).(type) {
+				case Variable:
+					return InstantiationError(nil)
+				case Atom:
+					switch a := s.Arg(1).(type) {
+					case Variable:
+						return InstantiationError(nil)
+					case Integer:
+						tb.pi = procedureIndicator{name: n, arity: a}
+					default:
+						return typeError(validTypePredicateIndicator, s, nil)
+					}
+				default:
+					return typeError(validTypePredicateIndicator, s, nil)
+				}
+				break
+			}
+
+			tb.pi = procedureIndicator{name: s.Functor(), arity: Integer(s.Arity())}
+			tb.modes = make([]Term, s.Arity())
+			for i := range tb.modes {
+				m := s.Arg(i)
+				if !validTableMode(m) {
+					return domainError(validDomainTableMode, m, nil)
+				}
+				tb.modes[i] = m
+			}
+		default:
+			return typeError(validTypeCallable, s, nil)
+		}
+
+		u, ok := t.clauses[tb.pi]
+		if !ok {
+			u = &userDefined{}
+			t.clauses[tb.pi] = u
+		}
+		u.tabling = &tb
+	}
+	return iter.Err()
+}
+
+func validTableMode(m Term) bool {
+	switch m := m.(type) {
+	case Variable:
+		return true
+	case Atom:
+		return m == atomMin || m == atomMax
+	case Compound:
+		if m.Functor() != atomLattice || m.Arity() != 1 {
+			return false
+		}
+		switch pi := m.Arg(0).(type) {
+		case Atom:
+			return true
+		case Compound:
+			if pi.Functor() != atomSlash || pi.Arity() != 2 {
+				return false
+			}
+			_, ok := pi.Arg(0).(Atom)
+			return ok && pi.Arg(1) == Integer(3)
+		default:
+			return false
+		}
+	default:
+		return false
+	}
+}
+
+// AbolishAllTables removes all the answer tables.
+func AbolishAllTables(vm *VM, k Cont, env *Env) *Promise {
+	vm.invalidateTables()
+	return k(env)
+}
+
+// invalidateTables discards the answer tables since the database has changed.
+// Dependencies between tables and procedures aren't tracked so that all the tables are discarded.
+func (vm *VM) invalidateTables() {
+	vm.tables = nil
+}
+
+// variantKey returns a string which is the same for variant terms.
+func variantKey(t Term, env *Env) string {
+	var sb strings.Builder
+	vars := map[Variable]int{}
+	var write func(Term)
+	write = func(t Term) {
+		switch t := env.Resolve(t).(type) {
+		case Variable:
+			n, ok := vars[t]
+			if !ok {
+				n = len(vars)
+				vars[t] = n
+			}
+			fmt.Fprintf(&sb, "_%d", n)
+		case Atom:
+			fmt.Fprintf(&sb, "%q", t.String())
+		case Compound:
+			fmt.Fprintf(&sb, "%q(", t.Functor().String())
+			for i := 0; i < t.Arity(); i++ {
+				if i > 0 {
+					sb.WriteByte(',')
+				}
+				write(t.Arg(i))
+			}
+			sb.WriteByte(')')
+		default:
+			fmt.Fprintf(&sb, "%T:%v", t, t)
+		}
+	}
+	write(t)
+	return sb.String()
+}
@@ -0,0 +1,118 @@
+package engine
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVM_tabled(t *testing.T) {
+	path := NewAtom("path")
+	a, b, c := NewAtom("a"), NewAtom("b"), NewAtom("c")
+
+	t.Run("left recursion", func(t *testing.T) {
+		var vm VM
+		assert.NoError(t, vm.Compile(context.Background(), `
+:-(table(/(path, 2))).
+:-(path(X, Y), ','(path(X, Z), edge(Z, Y))).
+:-(path(X, Y), edge(X, Y)).
+
+edge(a, b).
+edge(b, c).
+edge(c, a).
+`))
+
+		y := NewVariable()
+		var ys []Term
+		ok, err := Call(&vm, path.Apply(a, y), func(env *Env) *Promise {
+			ys = append(ys, env.Resolve(y))
+			return Bool(false)
+		}, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.False(t, ok)
+		assert.ElementsMatch(t, []Term{a, b, c}, ys)
+
+		assert.Len(t, vm.tables, 1)
+		for _, tb := range vm.tables {
+			assert.True(t, tb.complete)
+		}
+
+		ok, err = AbolishAllTables(&vm, Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.Empty(t, vm.tables)
+	})
+
+	t.Run("mode-directed", func(t *testing.T) {
+		var vm VM
+		vm.Register2(NewAtom("is"), Is)
+		assert.NoError(t, vm.Compile(context.Background(), `
+:-(table(path(_, _, min))).
+:-(path(X, Y, 1), edge(X, Y)).
+:-(path(X, Y, N), ','(path(X, Z, N0), ','(edge(Z, Y), is(N, +(N0, 1))))).
+
+edge(a, b).
+edge(b, c).
+edge(a, c).
+`))
+
+		n := NewVariable()
+		ok, err := Call(&vm, path.Apply(a, c, n), func(env *Env) *Promise {
+			assert.Equal(t, Integer(1), env.Resolve(n))
+			return Bool(true)
+		}, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		var vm VM
+		vm.Register1(NewAtom("throw"), Throw)
+		assert.NoError(t, vm.Compile(context.Background(), `
+:-(table(/(p, 1))).
+:-(p(X), throw(e)).
+`))
+
+		_, err := Call(&vm, NewAtom("p").Apply(NewVariable()), Success, nil).Force(context.Background())
+		assert.Error(t, err)
+		assert.Empty(t, vm.tables)
+		assert.Nil(t, vm.tableLeader)
+	})
+}
+
+func TestText_table(t *testing.T) {
+	tests := []struct {
+		title string
+		specs Term
+		err   error
+	}{
+		{title: "predicate indicator", specs: atomSlash.Apply(NewAtom("p"), Integer(2))},
+		{title: "modes", specs: NewAtom("p").Apply(NewVariable(), atomMin, atomMax, atomLattice.Apply(atomSlash.Apply(NewAtom("join"), Integer(3))))},
+		{title: "variable", specs: NewVariable(), err: InstantiationError(nil)},
+		{title: "invalid predicate indicator", specs: atomSlash.Apply(NewAtom("p"), NewAtom("q")), err: typeError(validTypePredicateIndicator, atomSlash.Apply(NewAtom("p"), NewAtom("q")), nil)},
+		{title: "invalid mode", specs: NewAtom("p").Apply(NewAtom("sum")), err: domainError(validDomainTableMode, NewAtom("sum"), nil)},
+		{title: "invalid lattice", specs: NewAtom("p").Apply(atomLattice.Apply(atomSlash.Apply(NewAtom("join"), Integer(2)))), err: domainError(validDomainTableMode, atomLattice.Apply(atomSlash.Apply(NewAtom("join"), Integer(2))), nil)},
+		{title: "not callable", specs: Integer(0), err: typeError(validTypeCallable, Integer(0), nil)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			txt := text{clauses: map[procedureIndicator]*userDefined{}}
+			assert.Equal(t, tt.err, txt.table(tt.specs))
+			for _, u := range txt.clauses {
+				assert.NotNil(t, u.tabling)
+			}
+		})
+	}
+}
+
+func TestVariantKey(t *testing.T) {
+	x, y := NewVariable(), NewVariable()
+	f := NewAtom("f")
+
+	assert.Equal(t, variantKey(f.Apply(x, y, x), nil), variantKey(f.Apply(y, x, y), nil))
+	assert.NotEqual(t, variantKey(f.Apply(x, y), nil), variantKey(f.Apply(x, x), nil))
+	assert.NotEqual(t, variantKey(f.Apply(NewAtom("1")), nil), variantKey(f.Apply(Integer(1)), nil))
+	assert.Equal(t, variantKey(f.Apply(NewAtom("a")), nil), variantKey(f.Apply(x), NewEnv().bind(x, NewAtom("a"))))
+}
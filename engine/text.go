@@ -4,7 +4,9 @@ import (
 	"context"
 	"fmt"
 	"io/fs"
+	"sort"
 	"strings"
+	"time"
 )
 
 // discontiguousError is an error that the user-defined predicate is defined by clauses which are not consecutive read-terms.
@@ -18,27 +20,80 @@ func (e *discontiguousError) Error() string {
 
 // Compile compiles the Prolog text and updates the DB accordingly.
 func (vm *VM) Compile(ctx context.Context, s string, args ...interface{}) error {
-	var t text
-	if err := vm.compile(ctx, &t, s, args...); err != nil {
+	return vm.compileFile(ctx, "", s, args...)
+}
+
+// compileFile compiles the Prolog text read from the file.
+func (vm *VM) compileFile(ctx context.Context, file string, s string, args ...interface{}) error {
+	if vm.loadDepth == 0 {
+		vm.unchecked = nil
+	}
+	vm.loadDepth++
+	defer func() {
+		vm.loadDepth--
+	}()
+
+	t := text{vm: vm}
+	if err := vm.compile(ctx, &t, file, s, args...); err != nil {
 		return err
 	}
 
-	if err := t.flush(); err != nil {
+	if err := t.flush(ctx); err != nil {
 		return err
 	}
 
+	if t.inUnit {
+		return fmt.Errorf("begin_tests(%s) without end_tests(%s)", t.unit, t.unit)
+	}
+	vm.unitTests = append(vm.unitTests, t.tests...)
+
+	if l, ok := vm.loaded[file]; ok {
+		l.modTimes = map[string]time.Time{}
+		for _, f := range append([]string{file}, t.includes...) {
+			l.modTimes[f] = vm.modTime(f)
+		}
+		l.goals = append(t.directives, t.goals...)
+	}
+
 	if vm.procedures == nil {
 		vm.procedures = map[procedureIndicator]procedure{}
 	}
 	for pi, u := range t.clauses {
-		if existing, ok := vm.procedures[pi].(*userDefined); ok && existing.multifile && u.multifile {
-			existing.clauses = append(existing.clauses, u.clauses...)
-			continue
+		u.file = file
+
+		for i := range u.clauses {
+			vm.unchecked = append(vm.unchecked, &u.clauses[i])
+		}
+
+		switch existing := vm.procedures[pi].(type) {
+		case nil:
+			break
+		case *userDefined:
+			if existing.multifile && u.multifile {
+				existing.clauses = append(existing.clauses, u.clauses...)
+				continue
+			}
+		default:
+			var c *clause
+			if len(u.clauses) > 0 {
+				c = &u.clauses[0]
+			}
+			vm.warn(ctx, atomRedefineBuiltIn.Apply(pi.Term()), c)
 		}
 
 		vm.procedures[pi] = u
 	}
+	vm.invalidateTables()
+
+	// Check undefined procedures once the outermost text is loaded since the included or loaded texts may call procedures defined later.
+	if vm.loadDepth == 1 {
+		vm.warnUndefined(ctx, vm.unchecked)
+		vm.unchecked = nil
+	}
 
+	if vm.SkipInitialization {
+		return nil
+	}
 	for _, g := range t.goals {
 		ok, err := Call(vm, g, Success, nil).Force(ctx)
 		if err != nil {
@@ -77,30 +132,32 @@ func Consult(vm *VM, files Term, k Cont, env *Env) *Promise {
 	})
 }
 
-func (vm *VM) compile(ctx context.Context, text *text, s string, args ...interface{}) error {
+func (vm *VM) compile(ctx context.Context, text *text, file string, s string, args ...interface{}) error {
 	if text.clauses == nil {
 		text.clauses = map[procedureIndicator]*userDefined{}
 	}
 
 	s = ignoreShebangLine(s)
 	p := NewParser(vm, strings.NewReader(s))
+	p.file = file
 	if err := p.SetPlaceholder(NewAtom("?"), args...); err != nil {
 		return err
 	}
 
 	for p.More() {
-		p.Vars = p.Vars[:]
+		p.Vars = p.Vars[:0]
+		p.argPos = map[Term][]Position{}
 		t, err := p.Term()
 		if err != nil {
 			return err
 		}
 
-		et, err := expand(vm, t, nil)
+		et, err := expand(ctx, vm, t, nil)
 		if err != nil {
 			return err
 		}
 
-		pi, arg, err := piArg(et, nil)
+		pi, arg, err := piArg(unqualify(et, 0, nil), nil)
 		if err != nil {
 			return err
 		}
@@ -111,14 +168,22 @@ func (vm *VM) compile(ctx context.Context, text *text, s string, args ...interfa
 			}
 			continue
 		case procedureIndicator{name: atomIf, arity: 2}: // Rule
-			pi, arg, err = piArg(arg(0), nil)
+			pi, arg, err = piArg(unqualify(arg(0), 0, nil), nil)
 			if err != nil {
 				return err
 			}
 			fallthrough
 		default:
+			if text.inUnit && pi.name == atomTest && (pi.arity == 1 || pi.arity == 2) {
+				text.tests = append(text.tests, unitTest(text.unit, et, file, p.pos))
+				if ns := singletons(p); len(ns) > 0 {
+					vm.warn(ctx, atomSingletons.Apply(pi.Term(), List(ns...)), &clause{file: file, pos: p.pos})
+				}
+				continue
+			}
+
 			if len(text.buf) > 0 && pi != text.buf[0].pi {
-				if err := text.flush(); err != nil {
+				if err := text.flush(ctx); err != nil {
 					return err
 				}
 			}
@@ -127,6 +192,18 @@ func (vm *VM) compile(ctx context.Context, text *text, s string, args ...interfa
 			if err != nil {
 				return err
 			}
+			goals := goalPositions(et, p.argPos)
+			for i := range cs {
+				cs[i].file = file
+				cs[i].pos = p.pos
+				cs[i].end = p.end
+				if len(goals) == len(cs) {
+					cs[i].goals = goals[i]
+				}
+			}
+			if ns := singletons(p); len(ns) > 0 {
+				vm.warn(ctx, atomSingletons.Apply(pi.Term(), List(ns...)), &cs[0])
+			}
 
 			text.buf = append(text.buf, cs...)
 		}
@@ -135,7 +212,7 @@ func (vm *VM) compile(ctx context.Context, text *text, s string, args ...interfa
 }
 
 func (vm *VM) directive(ctx context.Context, text *text, d Term) error {
-	if err := text.flush(); err != nil {
+	if err := text.flush(ctx); err != nil {
 		return err
 	}
 
@@ -157,15 +234,32 @@ func (vm *VM) directive(ctx context.Context, text *text, d Term) error {
 		text.goals = append(text.goals, arg(0))
 		return nil
 	case procedureIndicator{name: atomInclude, arity: 1}:
-		_, b, err := vm.open(arg(0), nil)
+		f, b, err := vm.open(arg(0), nil)
 		if err != nil {
 			return err
 		}
+		text.includes = append(text.includes, f)
 
-		return vm.compile(ctx, text, string(b))
+		return vm.compile(ctx, text, f, string(b))
 	case procedureIndicator{name: atomEnsureLoaded, arity: 1}:
 		return vm.ensureLoaded(ctx, arg(0), nil)
+	case procedureIndicator{name: atomCHRConstraint, arity: 1}:
+		return vm.chrConstraints(arg(0), nil)
+	case procedureIndicator{name: atomCHRRule, arity: 4}:
+		return vm.chrRule(arg(0), arg(1), arg(2), arg(3), nil)
+	case procedureIndicator{name: atomTableDirective, arity: 1}:
+		return text.table(arg(0))
+	case procedureIndicator{name: atomBeginTests, arity: 1}:
+		return text.beginTests(arg(0))
+	case procedureIndicator{name: atomEndTests, arity: 1}:
+		return text.endTests(arg(0))
+	case procedureIndicator{name: atomUseModule, arity: 1}:
+		if l, ok := arg(0).(Compound); ok && l.Functor() == atomLibrary && l.Arity() == 1 && l.Arg(0) == atomCHR {
+			vm.chrEnabled = true
+		}
+		fallthrough
 	default:
+		text.directives = append(text.directives, d)
 		ok, err := Call(vm, d, Success, nil).Force(ctx)
 		if err != nil {
 			return err
@@ -187,16 +281,114 @@ func (vm *VM) ensureLoaded(ctx context.Context, file Term, env *Env) error {
 	}
 
 	if vm.loaded == nil {
-		vm.loaded = map[string]struct{}{}
+		vm.loaded = map[string]*loadedFile{}
 	}
 	if _, ok := vm.loaded[f]; ok {
 		return nil
 	}
-	defer func() {
-		vm.loaded[f] = struct{}{}
-	}()
+	// Record the modification time beforehand so that Make reloads the file even if it fails to load.
+	vm.loaded[f] = &loadedFile{modTimes: map[string]time.Time{f: vm.modTime(f)}}
+
+	return vm.compileFile(ctx, f, string(b))
+}
+
+// loadedFile is a Prolog text loaded from a file.
+type loadedFile struct {
+	// modTimes is the modification times of the file and the files included by it when they were loaded.
+	modTimes map[string]time.Time
+
+	// goals is the directives and the initialization goals of the file. Xref treats them as entry points.
+	goals []Term
+}
+
+func (vm *VM) modTime(file string) time.Time {
+	fi, err := fs.Stat(vm.fs(), file)
+	if err != nil {
+		return time.Time{}
+	}
+	return fi.ModTime()
+}
+
+// Make reloads the loaded files which are modified since they were loaded, and returns the reloaded files.
+// Before reloading a file, it removes the clauses from the file and the files included by it including the ones for multifile procedures.
+// Operators, flags, and other states changed by directives in the file are kept as they are.
+func (vm *VM) Make(ctx context.Context) ([]string, error) {
+	var files []string
+	for f, l := range vm.loaded {
+		for i, t := range l.modTimes {
+			if !vm.modTime(i).Equal(t) {
+				files = append(files, f)
+				break
+			}
+		}
+	}
+	sort.Strings(files)
 
-	return vm.Compile(ctx, string(b))
+	var reloaded []string
+	for _, f := range files {
+		b, err := fs.ReadFile(vm.fs(), f)
+		if err != nil {
+			return reloaded, err
+		}
+		vm.unload(vm.loaded[f])
+		if err := vm.compileFile(ctx, f, string(b)); err != nil {
+			return reloaded, err
+		}
+		reloaded = append(reloaded, f)
+		if err := vm.printMessage(ctx, Message{Kind: atomInformational, Term: atomReloaded.Apply(NewAtom(f))}, nil); err != nil {
+			return reloaded, err
+		}
+	}
+	return reloaded, nil
+}
+
+// unload removes the procedures defined by the loaded file, the clauses and the unit tests from the file.
+func (vm *VM) unload(l *loadedFile) {
+	l.goals = nil
+	vm.invalidateTables()
+
+	var ts []UnitTest
+	for _, t := range vm.unitTests {
+		if _, ok := l.modTimes[t.File]; !ok {
+			ts = append(ts, t)
+		}
+	}
+	vm.unitTests = ts
+
+	for pi, p := range vm.procedures {
+		u, ok := p.(*userDefined)
+		if !ok {
+			continue
+		}
+		if _, ok := l.modTimes[u.file]; ok && !u.multifile {
+			delete(vm.procedures, pi)
+			continue
+		}
+		var cs clauses
+		for _, c := range u.clauses {
+			if _, ok := l.modTimes[c.file]; !ok {
+				cs = append(cs, c)
+			}
+		}
+		if len(cs) == len(u.clauses) {
+			continue
+		}
+		if len(cs) == 0 {
+			delete(vm.procedures, pi)
+			continue
+		}
+		u.clauses = cs
+	}
+}
+
+// Make reloads the modified files. See VM.Make for details.
+func Make(vm *VM, k Cont, env *Env) *Promise {
+	return Delay(func(ctx context.Context) *Promise {
+		if _, err := vm.Make(ctx); err != nil {
+			return Error(err)
+		}
+		return k(env)
+	})
 }
 
 func (vm *VM) open(file Term, env *Env) (string, []byte, error) {
@@ -206,7 +398,7 @@ func (vm *VM) open(file Term, env *Env) (string, []byte, error) {
 	case Atom:
 		s := f.String()
 		for _, f := range []string{s, s + ".pl"} {
-			b, err := fs.ReadFile(vm.FS, f)
+			b, err := fs.ReadFile(vm.fs(), f)
 			if err != nil {
 				continue
 			}
@@ -220,9 +412,49 @@ func (vm *VM) open(file Term, env *Env) (string, []byte, error) {
 }
 
 type text struct {
-	buf     clauses
-	clauses map[procedureIndicator]*userDefined
-	goals   []Term
+	vm       *VM
+	buf      clauses
+	clauses  map[procedureIndicator]*userDefined
+	goals    []Term
+	includes []string
+
+	// directives is the directives run while loading the text except the ones which change how it's loaded.
+	directives []Term
+
+	// unit is the name of the unit while inUnit is true, i.e. between begin_tests/1 and end_tests/1.
+	unit   Atom
+	inUnit bool
+	tests  []UnitTest
+}
+
+func (t *text) beginTests(unit Term) error {
+	switch u := unit.(type) {
+	case Variable:
+		return InstantiationError(nil)
+	case Atom:
+		if t.inUnit {
+			return fmt.Errorf("begin_tests(%s) inside begin_tests(%s)", u, t.unit)
+		}
+		t.unit, t.inUnit = u, true
+		return nil
+	default:
+		return typeError(validTypeAtom, unit, nil)
+	}
+}
+
+func (t *text) endTests(unit Term) error {
+	switch u := unit.(type) {
+	case Variable:
+		return InstantiationError(nil)
+	case Atom:
+		if !t.inUnit || u != t.unit {
+			return fmt.Errorf("end_tests(%s) without begin_tests(%s)", u, u)
+		}
+		t.inUnit = false
+		return nil
+	default:
+		return typeError(validTypeAtom, unit, nil)
+	}
 }
 
 func (t *text) forEachUserDefined(pi Term, f func(u *userDefined)) error {
@@ -263,7 +495,7 @@ func (t *text) forEachUserDefined(pi Term, f func(u *userDefined)) error {
 	return iter.Err()
 }
 
-func (t *text) flush() error {
+func (t *text) flush(ctx context.Context) error {
 	if len(t.buf) == 0 {
 		return nil
 	}
@@ -275,7 +507,10 @@ func (t *text) flush() error {
 		t.clauses[pi] = u
 	}
 	if len(u.clauses) > 0 && !u.discontiguous {
-		return &discontiguousError{pi: pi}
+		if t.vm == nil || !t.vm.discontiguousWarning {
+			return &discontiguousError{pi: pi}
+		}
+		t.vm.warn(ctx, atomDiscontiguous.Apply(pi.Term()), &t.buf[0])
 	}
 	u.clauses = append(u.clauses, t.buf...)
 	t.buf = t.buf[:0]
@@ -7,6 +7,8 @@ import (
 	"io"
 	"io/fs"
 	"testing"
+	"testing/fstest"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -42,6 +44,8 @@ foo(a).
 							{opcode: opGetConst, operand: NewAtom("a")},
 							{opcode: opExit},
 						},
+						pos: Position{Offset: 1, Line: 2, Column: 1},
+						end: Position{Offset: 7, Line: 2, Column: 7},
 					},
 				},
 			},
@@ -74,6 +78,8 @@ foo(b).
 							{opcode: opGetConst, operand: NewAtom("a")},
 							{opcode: opExit},
 						},
+						pos: Position{Offset: 1, Line: 2, Column: 1},
+						end: Position{Offset: 7, Line: 2, Column: 7},
 					},
 					{
 						pi:  procedureIndicator{name: NewAtom("foo"), arity: 1},
@@ -82,6 +88,8 @@ foo(b).
 							{opcode: opGetConst, operand: NewAtom("b")},
 							{opcode: opExit},
 						},
+						pos: Position{Offset: 9, Line: 3, Column: 1},
+						end: Position{Offset: 15, Line: 3, Column: 7},
 					},
 				},
 			},
@@ -113,6 +121,9 @@ bar(X, "abc", [a, b], [a, b|Y], f(a)) :- X, !, foo(X, "abc", [a, b], [a, b|Y], f
 							{opcode: opCall, operand: procedureIndicator{name: atomTrue, arity: 0}},
 							{opcode: opExit},
 						},
+						pos:   Position{Offset: 1, Line: 2, Column: 1},
+						end:   Position{Offset: 12, Line: 2, Column: 12},
+						goals: []Position{{Offset: 8, Line: 2, Column: 8}},
 					},
 				},
 			},
@@ -165,6 +176,9 @@ bar(X, "abc", [a, b], [a, b|Y], f(a)) :- X, !, foo(X, "abc", [a, b], [a, b|Y], f
 							{opcode: opCall, operand: procedureIndicator{name: NewAtom("foo"), arity: 5}},
 							{opcode: opExit},
 						},
+						pos:   Position{Offset: 14, Line: 3, Column: 1},
+						end:   Position{Offset: 98, Line: 3, Column: 85},
+						goals: []Position{{Offset: 55, Line: 3, Column: 42}, {Offset: 58, Line: 3, Column: 45}, {Offset: 61, Line: 3, Column: 48}},
 					},
 				},
 			},
@@ -185,6 +199,8 @@ foo(b).
 							{opcode: opGetConst, operand: NewAtom("a")},
 							{opcode: opExit},
 						},
+						pos: Position{Offset: 20, Line: 3, Column: 1},
+						end: Position{Offset: 26, Line: 3, Column: 7},
 					},
 					{
 						pi:  procedureIndicator{name: NewAtom("foo"), arity: 1},
@@ -193,6 +209,8 @@ foo(b).
 							{opcode: opGetConst, operand: NewAtom("b")},
 							{opcode: opExit},
 						},
+						pos: Position{Offset: 28, Line: 4, Column: 1},
+						end: Position{Offset: 34, Line: 4, Column: 7},
 					},
 				},
 			},
@@ -220,6 +238,8 @@ foo(b).
 							{opcode: opGetConst, operand: NewAtom("a")},
 							{opcode: opExit},
 						},
+						pos: Position{Offset: 22, Line: 3, Column: 1},
+						end: Position{Offset: 28, Line: 3, Column: 7},
 					},
 					{
 						pi:  procedureIndicator{name: NewAtom("foo"), arity: 1},
@@ -228,6 +248,8 @@ foo(b).
 							{opcode: opGetConst, operand: NewAtom("b")},
 							{opcode: opExit},
 						},
+						pos: Position{Offset: 30, Line: 4, Column: 1},
+						end: Position{Offset: 36, Line: 4, Column: 7},
 					},
 				},
 			},
@@ -248,6 +270,8 @@ foo(b).
 							{opcode: opGetConst, operand: NewAtom("a")},
 							{opcode: opExit},
 						},
+						pos: Position{Offset: 26, Line: 3, Column: 1},
+						end: Position{Offset: 32, Line: 3, Column: 7},
 					},
 					{
 						pi:  procedureIndicator{name: NewAtom("foo"), arity: 1},
@@ -256,6 +280,8 @@ foo(b).
 							{opcode: opGetConst, operand: NewAtom("b")},
 							{opcode: opExit},
 						},
+						pos: Position{Offset: 42, Line: 5, Column: 1},
+						end: Position{Offset: 48, Line: 5, Column: 7},
 					},
 				},
 			},
@@ -268,6 +294,8 @@ foo(b).
 							{opcode: opGetConst, operand: NewAtom("a")},
 							{opcode: opExit},
 						},
+						pos: Position{Offset: 34, Line: 4, Column: 1},
+						end: Position{Offset: 40, Line: 4, Column: 7},
 					},
 				},
 			},
@@ -283,6 +311,9 @@ foo(b).
 						bytecode: bytecode{
 							{opcode: opExit},
 						},
+						file: "testdata/foo.pl",
+						pos:  Position{Offset: 0, Line: 1, Column: 1},
+						end:  Position{Offset: 3, Line: 1, Column: 4},
 					},
 				},
 			},
@@ -304,6 +335,7 @@ foo(b).
 :- ensure_loaded('testdata/foo').
 `, result: map[procedureIndicator]procedure{
 			{name: NewAtom("foo"), arity: 0}: &userDefined{
+				file: "testdata/foo.pl",
 				clauses: clauses{
 					{
 						pi:  procedureIndicator{name: NewAtom("foo"), arity: 0},
@@ -311,6 +343,9 @@ foo(b).
 						bytecode: bytecode{
 							{opcode: opExit},
 						},
+						file: "testdata/foo.pl",
+						pos:  Position{Offset: 0, Line: 1, Column: 1},
+						end:  Position{Offset: 3, Line: 1, Column: 4},
 					},
 				},
 			},
@@ -368,7 +403,7 @@ foo(?).
 `, args: []interface{}{nil}, err: errors.New("can't convert to term: <invalid reflect.Value>")},
 		{title: "error: syntax error", text: `
 foo().
-`, err: unexpectedTokenError{actual: Token{kind: tokenClose, val: ")"}}},
+`, err: unexpectedTokenError{actual: Token{kind: TokenClose, val: ")"}, pos: Position{Offset: 5, Line: 2, Column: 5}, line: "foo()."}},
 		{title: "error: expansion error", text: `
 :- ensure_loaded('testdata/break_term_expansion').
 foo(a).
@@ -508,6 +543,169 @@ func TestVM_Consult(t *testing.T) {
 	}
 }
 
+func TestVM_Make(t *testing.T) {
+	foo, bar, baz, qux := NewAtom("foo"), NewAtom("bar"), NewAtom("baz"), NewAtom("qux")
+	t0 := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	fsys := fstest.MapFS{
+		"a.pl": &fstest.MapFile{Data: []byte(`
+:-(multifile(/(bar, 1))).
+:-(include(c)).
+foo(1).
+bar(a).
+qux.
+`), ModTime: t0},
+		"b.pl": &fstest.MapFile{Data: []byte(`
+:-(multifile(/(bar, 1))).
+bar(b).
+:-(begin_tests(b)).
+test(x).
+:-(end_tests(b)).
+`), ModTime: t0},
+		"c.pl": &fstest.MapFile{Data: []byte(`
+baz(1).
+`), ModTime: t0},
+	}
+
+	var messages []Message
+	vm := VM{FS: fsys, OnMessage: func(m Message) {
+		messages = append(messages, m)
+	}}
+	assert.NoError(t, vm.Compile(context.Background(), `:-(ensure_loaded(a)). :-(ensure_loaded(b)).`))
+
+	raws := func(name Atom, arity Integer) []Term {
+		u, ok := vm.procedures[procedureIndicator{name: name, arity: arity}].(*userDefined)
+		if !ok {
+			return nil
+		}
+		var ts []Term
+		for _, c := range u.clauses {
+			ts = append(ts, c.raw)
+		}
+		return ts
+	}
+
+	t.Run("not modified", func(t *testing.T) {
+		files, err := vm.Make(context.Background())
+		assert.NoError(t, err)
+		assert.Empty(t, files)
+		assert.Empty(t, messages)
+	})
+
+	t.Run("modified", func(t *testing.T) {
+		fsys["a.pl"] = &fstest.MapFile{Data: []byte(`
+:-(multifile(/(bar, 1))).
+:-(include(c)).
+foo(2).
+bar(c).
+`), ModTime: t0.Add(time.Second)}
+
+		files, err := vm.Make(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"a.pl"}, files)
+		assert.Equal(t, []Term{foo.Apply(Integer(2))}, raws(foo, 1))
+		assert.Equal(t, []Term{bar.Apply(NewAtom("b")), bar.Apply(NewAtom("c"))}, raws(bar, 1))
+		assert.Equal(t, []Term{baz.Apply(Integer(1))}, raws(baz, 1))
+		assert.Nil(t, raws(qux, 0))
+		assert.Equal(t, []Message{{Kind: atomInformational, Term: atomReloaded.Apply(NewAtom("a.pl")), Lines: []string{"Reloaded a.pl"}}}, messages)
+	})
+
+	t.Run("included file modified", func(t *testing.T) {
+		fsys["c.pl"] = &fstest.MapFile{Data: []byte(`
+baz(2).
+`), ModTime: t0.Add(time.Second)}
+
+		files, err := vm.Make(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"a.pl"}, files)
+		assert.Equal(t, []Term{baz.Apply(Integer(2))}, raws(baz, 1))
+		assert.Equal(t, []Term{foo.Apply(Integer(2))}, raws(foo, 1))
+	})
+
+	t.Run("multifile contribution", func(t *testing.T) {
+		fsys["b.pl"] = &fstest.MapFile{Data: []byte(`
+:-(multifile(/(bar, 1))).
+bar(d).
+:-(begin_tests(b)).
+test(y).
+:-(end_tests(b)).
+`), ModTime: t0.Add(time.Second)}
+
+		files, err := vm.Make(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"b.pl"}, files)
+		assert.Equal(t, []Term{bar.Apply(NewAtom("c")), bar.Apply(NewAtom("d"))}, raws(bar, 1))
+		ts := vm.UnitTests()
+		if assert.Len(t, ts, 1) {
+			assert.Equal(t, NewAtom("y"), ts[0].Name)
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		fsys["b.pl"] = &fstest.MapFile{Data: []byte(`bar(`), ModTime: t0.Add(2 * time.Second)}
+
+		_, err := vm.Make(context.Background())
+		assert.Error(t, err)
+	})
+
+	t.Run("removed", func(t *testing.T) {
+		delete(fsys, "b.pl")
+
+		_, err := vm.Make(context.Background())
+		assert.Error(t, err)
+	})
+}
+
+func TestMake(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.pl": &fstest.MapFile{Data: []byte(`foo(1).`)},
+	}
+	vm := VM{FS: fsys}
+	assert.NoError(t, vm.Compile(context.Background(), `:-(ensure_loaded(a)).`))
+
+	fsys["a.pl"] = &fstest.MapFile{Data: []byte(`foo(2).`), ModTime: time.Now()}
+	ok, err := Make(&vm, Success, nil).Force(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	u := vm.procedures[procedureIndicator{name: NewAtom("foo"), arity: 1}].(*userDefined)
+	assert.Equal(t, NewAtom("foo").Apply(Integer(2)), u.clauses[0].raw)
+
+	t.Run("failed to load", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			"b.pl": &fstest.MapFile{Data: []byte(`foo(`)},
+		}
+		vm := VM{FS: fsys}
+		assert.Error(t, vm.Compile(context.Background(), `:-(ensure_loaded(b)).`))
+
+		fsys["b.pl"] = &fstest.MapFile{Data: []byte(`foo(3).`), ModTime: time.Now()}
+		files, err := vm.Make(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"b.pl"}, files)
+
+		u := vm.procedures[procedureIndicator{name: NewAtom("foo"), arity: 1}].(*userDefined)
+		assert.Equal(t, NewAtom("foo").Apply(Integer(3)), u.clauses[0].raw)
+	})
+
+	t.Run("goals", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			"c.pl": &fstest.MapFile{Data: []byte(":-(p).\n")},
+		}
+		vm := VM{FS: fsys}
+		for _, a := range []Atom{NewAtom("p"), NewAtom("q")} {
+			vm.Register0(a, func(_ *VM, k Cont, env *Env) *Promise {
+				return k(env)
+			})
+		}
+		assert.NoError(t, vm.Compile(context.Background(), ":-(ensure_loaded(c)).\n:-(q).\n"))
+		assert.Equal(t, []Term{NewAtom("p")}, vm.loaded["c.pl"].goals)
+
+		fsys["c.pl"] = &fstest.MapFile{Data: []byte(":-(q).\n:-(initialization(p)).\n"), ModTime: time.Now()}
+		_, err := vm.Make(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, []Term{NewAtom("q"), NewAtom("p")}, vm.loaded["c.pl"].goals)
+	})
+}
+
 func TestDiscontiguousError_Error(t *testing.T) {
 	e := discontiguousError{pi: procedureIndicator{name: NewAtom("foo"), arity: 1}}
 	assert.Equal(t, "foo/1 is discontiguous", e.Error())
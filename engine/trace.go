@@ -0,0 +1,388 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+var varTraceDepth = NewVariable()
+
+// Port is a port of the procedure box model.
+type Port uint8
+
+// Port is one of these values.
+const (
+	PortCall Port = iota
+	PortExit
+	PortRedo
+	PortFail
+	PortException
+)
+
+var portAtoms = [...]Atom{
+	PortCall:      atomCall,
+	PortExit:      atomExit,
+	PortRedo:      atomRedo,
+	PortFail:      atomFail,
+	PortException: atomException,
+}
+
+// Term returns an Atom for the Port.
+func (p Port) Term() Term {
+	return portAtoms[p]
+}
+
+func (p Port) String() string {
+	return [...]string{
+		PortCall:      "Call",
+		PortExit:      "Exit",
+		PortRedo:      "Redo",
+		PortFail:      "Fail",
+		PortException: "Exception",
+	}[p]
+}
+
+// ports is a set of ports.
+type ports uint8
+
+const allPorts = ports(1<<PortCall | 1<<PortExit | 1<<PortRedo | 1<<PortFail | 1<<PortException)
+
+// defaultLeashed is the ports at which the tracer stops unless leash/1 changes them.
+const defaultLeashed = ports(1<<PortCall | 1<<PortExit | 1<<PortRedo | 1<<PortFail)
+
+func (ps ports) has(p Port) bool {
+	return ps&(1<<p) != 0
+}
+
+// TraceEvent is what a Tracer is notified of when the execution goes through a port of a traced goal.
+type TraceEvent struct {
+	Port Port
+
+	// Depth is the nesting level of the goal. The outermost traced goal is 1.
+	Depth int
+
+	// Goal is the goal of which bindings are in Env.
+	Goal Term
+	Env  *Env
+
+	// Err is the error which went through the exception port.
+	Err error
+
+	// Leashed reports whether an interactive tracer should stop at the port.
+	Leashed bool
+}
+
+// Tracer is notified of the traced goals going through the ports.
+// If Trace returns an error, the execution is aborted with the error.
+type Tracer interface {
+	Trace(vm *VM, e TraceEvent) error
+}
+
+// TracerFunc is a function which implements Tracer.
+type TracerFunc func(vm *VM, e TraceEvent) error
+
+// Trace calls f.
+func (f TracerFunc) Trace(vm *VM, e TraceEvent) error {
+	return f(vm, e)
+}
+
+// defaultTracer writes the events to user_output. At the leashed ports, it reads a command from user_input:
+// <enter> or c to creep, l to leap (stop tracing until a spy point), and n to leave debug mode.
+var defaultTracer = TracerFunc(func(vm *VM, e TraceEvent) error {
+	if vm.output == nil {
+		return nil
+	}
+	w, err := vm.output.textWriter()
+	if err != nil {
+		return nil
+	}
+
+	_, _ = fmt.Fprintf(w, "   %s: (%d) ", e.Port, e.Depth)
+	opts := WriteOptions{ops: vm.operators, priority: 1200, quoted: true}
+	if err := e.Env.Resolve(e.Goal).WriteTerm(w, &opts, e.Env); err != nil {
+		return err
+	}
+	if e.Err != nil {
+		_, _ = fmt.Fprintf(w, " %s", e.Err)
+	}
+
+	if !e.Leashed || vm.input == nil || vm.input.source == nil {
+		_, _ = fmt.Fprintln(w)
+		return nil
+	}
+
+	_, _ = fmt.Fprint(w, " ? ")
+	_ = vm.output.Flush()
+	var sb strings.Builder
+	for {
+		r, _, err := vm.input.ReadRune()
+		if err != nil || r == '\n' {
+			break
+		}
+		_, _ = sb.WriteRune(r)
+	}
+	switch strings.TrimSpace(sb.String()) {
+	case "l":
+		vm.tracing = false
+	case "n":
+		vm.features &^= featureDebug
+	}
+	return nil
+})
+
+// traced is a procedure which notifies the tracer when it goes through ports.
+type traced struct {
+	pi procedureIndicator
+	procedure
+}
+
+func (t traced) call(vm *VM, args []Term, k Cont, env *Env) *Promise {
+	if !vm.traceable(t.pi) {
+		return t.procedure.call(vm, args, k, env)
+	}
+
+	var depth Integer
+	if d, ok := env.lookup(varTraceDepth); ok {
+		depth = d.(Integer)
+	}
+	goal := t.pi.name.Apply(args...)
+	trace := func(p Port, err error, env *Env) *Promise {
+		if !vm.traceable(t.pi) {
+			return nil
+		}
+		if err := vm.trace(TraceEvent{Port: p, Depth: int(depth + 1), Goal: goal, Env: env, Err: err}); err != nil {
+			return Error(err)
+		}
+		return nil
+	}
+
+	if p := trace(PortCall, nil, env); p != nil {
+		return p
+	}
+
+	// Errors from the continuation also go through this promise. They're not the goal's exceptions.
+	var exited bool
+	return catch(func(err error) *Promise {
+		if exited {
+			return nil
+		}
+		return trace(PortException, err, env)
+	}, func(ctx context.Context) *Promise {
+		return Delay(func(ctx context.Context) *Promise {
+			return t.procedure.call(vm, args, func(env *Env) *Promise {
+				if p := trace(PortExit, nil, env); p != nil {
+					return p
+				}
+				exited = true
+				return Delay(func(ctx context.Context) *Promise {
+					return k(env.bind(varTraceDepth, depth))
+				}, func(ctx context.Context) *Promise {
+					exited = false
+					if p := trace(PortRedo, nil, env); p != nil {
+						return p
+					}
+					return Bool(false)
+				})
+			}, env.bind(varTraceDepth, depth+1))
+		}, func(ctx context.Context) *Promise {
+			if p := trace(PortFail, nil, env); p != nil {
+				return p
+			}
+			return Bool(false)
+		})
+	})
+}
+
+// traceable checks if the procedure is traced, i.e. in trace mode or a spy point while in debug mode.
+func (vm *VM) traceable(pi procedureIndicator) bool {
+	if !vm.features.has(featureDebug) {
+		return false
+	}
+	if vm.tracing {
+		return true
+	}
+	if _, ok := vm.spyPoints[pi]; ok {
+		return true
+	}
+	_, ok := vm.spyPoints[procedureIndicator{name: pi.name, arity: -1}]
+	return ok
+}
+
+func (vm *VM) trace(e TraceEvent) error {
+	if vm.invisible.has(e.Port) {
+		return nil
+	}
+	e.Leashed = vm.leashed().has(e.Port)
+	t := vm.Tracer
+	if t == nil {
+		t = defaultTracer
+	}
+	return t.Trace(vm, e)
+}
+
+// Trace turns on trace mode and debug mode.
+func Trace(vm *VM, k Cont, env *Env) *Promise {
+	vm.features |= featureDebug
+	vm.tracing = true
+	return k(env)
+}
+
+// NoTrace turns off trace mode. Debug mode stays on.
+func NoTrace(vm *VM, k Cont, env *Env) *Promise {
+	vm.tracing = false
+	return k(env)
+}
+
+// Spy sets spy points on the procedures specified by Name/Arity or Name, or a list of them, and turns on debug mode.
+func Spy(vm *VM, spec Term, k Cont, env *Env) *Promise {
+	if err := forEachSpySpec(spec, env, func(pi procedureIndicator) {
+		if vm.spyPoints == nil {
+			vm.spyPoints = map[procedureIndicator]struct{}{}
+		}
+		vm.spyPoints[pi] = struct{}{}
+	}); err != nil {
+		return Error(err)
+	}
+	vm.features |= featureDebug
+	return k(env)
+}
+
+// NoSpy removes spy points on the procedures specified by Name/Arity or Name, or a list of them.
+func NoSpy(vm *VM, spec Term, k Cont, env *Env) *Promise {
+	if err := forEachSpySpec(spec, env, func(pi procedureIndicator) {
+		delete(vm.spyPoints, pi)
+	}); err != nil {
+		return Error(err)
+	}
+	return k(env)
+}
+
+func forEachSpySpec(spec Term, env *Env, f func(pi procedureIndicator)) error {
+	iter := anyIterator{Any: spec, Env: env}
+	for iter.Next() {
+		switch s := env.Resolve(iter.Current()).(type) {
+		case Variable:
+			return InstantiationError(env)
+		case Atom:
+			if s == atomEmptyList {
+				continue
+			}
+			f(procedureIndicator{name: s, arity: -1})
+		case Compound:
+			if s.Functor() != atomSlash || s.Arity() != 2 {
+				return typeError(validTypePredicateIndicator, s, env)
+			}
+			switch n := env.Resolve(s.Arg(0)).(type) {
+			case Variable:
+				return InstantiationError(env)
+			case Atom:
+				switch a := env.Resolve(s.Arg(1)).(type) {
+				case Variable:
+					return InstantiationError(env)
+				case Integer:
+					f(procedureIndicator{name: n, arity: a})
+				default:
+					return typeError(validTypePredicateIndicator, s, env)
+				}
+			default:
+				return typeError(validTypePredicateIndicator, s, env)
+			}
+		default:
+			return typeError(validTypePredicateIndicator, s, env)
+		}
+	}
+	return iter.Err()
+}
+
+// Leash sets the ports at which the tracer stops. It's a port, all, none, or a list of them.
+// A port prefixed with + or - is added to or removed from the current leashed ports respectively.
+// By default, call, exit, redo, and fail are leashed.
+func Leash(vm *VM, ports Term, k Cont, env *Env) *Promise {
+	ps, err := portsArg(vm.leashed(), ports, env)
+	if err != nil {
+		return Error(err)
+	}
+	vm.leashToggled = ps ^ defaultLeashed
+	return k(env)
+}
+
+func (vm *VM) leashed() ports {
+	return vm.leashToggled ^ defaultLeashed
+}
+
+// Visible sets the ports which the tracer is notified of. It's a port, all, none, or a list of them.
+// A port prefixed with + or - is added to or removed from the current visible ports respectively.
+func Visible(vm *VM, ports Term, k Cont, env *Env) *Promise {
+	ps, err := portsArg(allPorts&^vm.invisible, ports, env)
+	if err != nil {
+		return Error(err)
+	}
+	vm.invisible = allPorts &^ ps
+	return k(env)
+}
+
+func portsArg(current ports, spec Term, env *Env) (ports, error) {
+	var (
+		set      ports
+		modified bool
+	)
+	iter := anyIterator{Any: spec, Env: env}
+	for iter.Next() {
+		s := env.Resolve(iter.Current())
+		op := atomEmptyList
+		if c, ok := s.(Compound); ok && c.Arity() == 1 && (c.Functor() == atomPlus || c.Functor() == atomMinus) {
+			op, s = c.Functor(), env.Resolve(c.Arg(0))
+		}
+
+		var ps ports
+		switch s := s.(type) {
+		case Variable:
+			return 0, InstantiationError(env)
+		case Atom:
+			switch s {
+			case atomEmptyList:
+				continue
+			case atomAll:
+				ps = allPorts
+			case atomNone:
+				ps = 0
+			default:
+				p, ok := portOf(s)
+				if !ok {
+					return 0, domainError(validDomainPort, s, env)
+				}
+				ps = 1 << p
+			}
+		default:
+			return 0, domainError(validDomainPort, s, env)
+		}
+
+		switch op {
+		case atomPlus:
+			current |= ps
+			modified = true
+		case atomMinus:
+			current &^= ps
+			modified = true
+		default:
+			set |= ps
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return 0, err
+	}
+	if modified {
+		return current | set, nil
+	}
+	return set, nil
+}
+
+func portOf(a Atom) (Port, bool) {
+	for p, pa := range portAtoms {
+		if pa == a {
+			return Port(p), true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,226 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVM_Trace(t *testing.T) {
+	foo, bar := NewAtom("foo"), NewAtom("bar")
+
+	tests := []struct {
+		title  string
+		text   string
+		setup  func(vm *VM)
+		goal   Term
+		ok     bool
+		err    error
+		events []string
+	}{
+		{title: "call/exit", text: `
+:-(foo(X), bar(X)).
+bar(a).
+`, setup: func(vm *VM) {
+			vm.features, vm.tracing = featureDebug, true
+		}, goal: foo.Apply(NewVariable()), ok: true, events: []string{
+			"Call: (1) foo",
+			"Call: (2) bar",
+			"Exit: (2) bar",
+			"Exit: (1) foo",
+		}},
+		{title: "redo/fail", text: `
+:-(foo(X), ','(bar(X), =(X, b))).
+bar(a).
+bar(b).
+`, setup: func(vm *VM) {
+			vm.features, vm.tracing = featureDebug, true
+		}, goal: foo.Apply(NewAtom("c")), events: []string{
+			"Call: (1) foo",
+			"Call: (2) bar",
+			"Fail: (2) bar",
+			"Fail: (1) foo",
+		}},
+		{title: "redo", text: `
+:-(foo(X), ','(bar(X), =(X, b))).
+bar(a).
+bar(b).
+`, setup: func(vm *VM) {
+			vm.features, vm.tracing = featureDebug, true
+		}, goal: foo.Apply(NewVariable()), ok: true, events: []string{
+			"Call: (1) foo",
+			"Call: (2) bar",
+			"Exit: (2) bar",
+			"Call: (2) =",
+			"Fail: (2) =",
+			"Redo: (2) bar",
+			"Exit: (2) bar",
+			"Call: (2) =",
+			"Exit: (2) =",
+			"Exit: (1) foo",
+		}},
+		{title: "exception", text: `
+:-(foo, bar).
+:-(bar, throw(e)).
+`, setup: func(vm *VM) {
+			vm.features, vm.tracing = featureDebug, true
+		}, goal: foo, err: Exception{term: NewAtom("e")}, events: []string{
+			"Call: (1) foo",
+			"Call: (2) bar",
+			"Call: (3) throw",
+			"Exception: (3) throw",
+			"Exception: (2) bar",
+			"Exception: (1) foo",
+		}},
+		{title: "spy", text: `
+:-(foo, bar).
+bar.
+`, setup: func(vm *VM) {
+			vm.features = featureDebug
+			vm.spyPoints = map[procedureIndicator]struct{}{{name: bar, arity: 0}: {}}
+		}, goal: foo, ok: true, events: []string{
+			"Call: (1) bar",
+			"Exit: (1) bar",
+		}},
+		{title: "invisible", text: `
+foo.
+`, setup: func(vm *VM) {
+			vm.features, vm.tracing = featureDebug, true
+			vm.invisible = 1 << PortCall
+		}, goal: foo, ok: true, events: []string{
+			"Exit: (1) foo",
+		}},
+		{title: "not debugging", text: `
+foo.
+`, setup: func(vm *VM) {
+			vm.tracing = true
+		}, goal: foo, ok: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			var events []string
+			var vm VM
+			vm.Register1(NewAtom("throw"), Throw)
+			vm.Register2(NewAtom("="), Unify)
+			assert.NoError(t, vm.Compile(context.Background(), tt.text))
+			vm.Tracer = TracerFunc(func(vm *VM, e TraceEvent) error {
+				name := e.Goal
+				if c, ok := e.Goal.(Compound); ok {
+					name = c.Functor()
+				}
+				events = append(events, fmt.Sprintf("%s: (%d) %s", e.Port, e.Depth, name))
+				return nil
+			})
+			tt.setup(&vm)
+			ok, err := Call(&vm, tt.goal, Success, nil).Force(context.Background())
+			assert.Equal(t, tt.ok, ok)
+			if tt.err == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.Equal(t, tt.err.(Exception).term, err.(Exception).term)
+			}
+			assert.Equal(t, tt.events, events)
+		})
+	}
+
+	t.Run("tracer error", func(t *testing.T) {
+		errAbort := errors.New("abort")
+		vm := VM{
+			Tracer: TracerFunc(func(vm *VM, e TraceEvent) error {
+				return errAbort
+			}),
+		}
+		assert.NoError(t, vm.Compile(context.Background(), `foo.`))
+		vm.features, vm.tracing = featureDebug, true
+		_, err := Call(&vm, foo, Success, nil).Force(context.Background())
+		assert.Equal(t, errAbort, err)
+	})
+}
+
+func TestSpy(t *testing.T) {
+	foo := NewAtom("foo")
+
+	t.Run("ok", func(t *testing.T) {
+		var vm VM
+		ok, err := Spy(&vm, List(foo, atomSlash.Apply(NewAtom("bar"), Integer(1))), Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.True(t, vm.features.has(featureDebug))
+		assert.True(t, vm.traceable(procedureIndicator{name: foo, arity: 2}))
+		assert.True(t, vm.traceable(procedureIndicator{name: NewAtom("bar"), arity: 1}))
+		assert.False(t, vm.traceable(procedureIndicator{name: NewAtom("bar"), arity: 2}))
+
+		ok, err = NoSpy(&vm, foo, Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.False(t, vm.traceable(procedureIndicator{name: foo, arity: 2}))
+	})
+
+	t.Run("instantiation error", func(t *testing.T) {
+		var vm VM
+		_, err := Spy(&vm, NewVariable(), Success, nil).Force(context.Background())
+		assert.Equal(t, InstantiationError(nil), err)
+	})
+
+	t.Run("type error", func(t *testing.T) {
+		var vm VM
+		_, err := Spy(&vm, Integer(1), Success, nil).Force(context.Background())
+		assert.Equal(t, typeError(validTypePredicateIndicator, Integer(1), nil), err)
+	})
+}
+
+func TestLeash(t *testing.T) {
+	tests := []struct {
+		title   string
+		current ports
+		ports   Term
+		leashed ports
+		err     error
+	}{
+		{title: "port", ports: atomCall, leashed: 1 << PortCall},
+		{title: "list", ports: List(atomCall, atomExit), leashed: 1<<PortCall | 1<<PortExit},
+		{title: "all", ports: atomAll, leashed: allPorts},
+		{title: "none", current: allPorts, ports: atomNone, leashed: 0},
+		{title: "add", current: 1 << PortCall, ports: atomPlus.Apply(atomFail), leashed: 1<<PortCall | 1<<PortFail},
+		{title: "remove", current: allPorts, ports: atomMinus.Apply(atomRedo), leashed: allPorts &^ (1 << PortRedo)},
+		{title: "unknown port", ports: NewAtom("foo"), err: domainError(validDomainPort, NewAtom("foo"), nil)},
+		{title: "variable", ports: NewVariable(), err: InstantiationError(nil)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			vm := VM{leashToggled: tt.current ^ defaultLeashed}
+			_, err := Leash(&vm, tt.ports, Success, nil).Force(context.Background())
+			assert.Equal(t, tt.err, err)
+			if err == nil {
+				assert.Equal(t, tt.leashed, vm.leashed())
+			}
+		})
+	}
+
+	t.Run("default", func(t *testing.T) {
+		var vm VM
+		assert.Equal(t, ports(1<<PortCall|1<<PortExit|1<<PortRedo|1<<PortFail), vm.leashed())
+
+		_, err := Leash(&vm, atomPlus.Apply(atomException), Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, allPorts, vm.leashed())
+	})
+}
+
+func TestVisible(t *testing.T) {
+	var vm VM
+	ok, err := Visible(&vm, List(atomCall, atomExit), Success, nil).Force(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, allPorts&^(1<<PortCall|1<<PortExit), vm.invisible)
+
+	ok, err = Visible(&vm, atomPlus.Apply(atomFail), Success, nil).Force(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, ports(1<<PortRedo|1<<PortException), vm.invisible)
+}
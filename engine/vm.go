@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"io/fs"
+	"sort"
 	"strings"
 )
 
@@ -49,15 +50,38 @@ func Failure(*Env) *Promise {
 // VM is the core of a Prolog interpreter. The zero value for VM is a valid VM without any builtin predicates.
 type VM struct {
 	// Unknown is a callback that is triggered when the VM reaches to an unknown predicate while current_prolog_flag(unknown, warning).
+	// If nil, the VM prints a warning message instead.
 	Unknown func(name Atom, args []Term, env *Env)
 
-	procedures map[procedureIndicator]procedure
-	unknown    unknownAction
+	// OnWarning is a callback that is triggered when the VM finds a problem in a Prolog text while compiling it.
+	// If nil, the VM prints a warning message instead.
+	OnWarning func(w Warning)
 
-	// FS is a file system that is referenced when the VM loads Prolog texts e.g. ensure_loaded/1.
-	// It has no effect on open/4 nor open/3 which always access the actual file system.
+	// OnMessage is a callback that is triggered when print_message/2 prints a message which message_hook/3 didn't intercept.
+	// If nil, the message is written to user_error.
+	OnMessage func(m Message)
+
+	procedures           map[procedureIndicator]procedure
+	unknown              unknownAction
+	discontiguousWarning bool
+	answerWriteOptions   Term
+
+	// loadDepth is the nesting level of the texts being loaded.
+	loadDepth int
+
+	// unchecked is the clauses loaded but not checked for calls to undefined procedures yet.
+	unchecked []*clause
+
+	// FS is a file system that is referenced when the VM loads Prolog texts e.g. ensure_loaded/1, or opens files by open/3,4.
+	// Files can be opened for writing only if it implements WritableFS. If nil, there are no files.
 	FS     fs.FS
-	loaded map[string]struct{}
+	loaded map[string]*loadedFile
+
+	// Argv is the program name and the arguments which current_prolog_flag(argv, L) reports as a list of atoms.
+	Argv []string
+
+	// SkipInitialization makes the VM load texts without running the goals of initialization/1 directives, e.g. for Xref.
+	SkipInitialization bool
 
 	// Internal/external expression
 	operators       operators
@@ -65,12 +89,71 @@ type VM struct {
 	charConvEnabled bool
 	doubleQuotes    doubleQuotes
 
+	// Constraint Handling Rules
+	chrRules []chrRule
+
+	// chrEnabled is set by use_module(library(chr)) or chr_constraint/1 so that CHR rules are expanded.
+	chrEnabled bool
+
+	// Unit tests defined between begin_tests/1 and end_tests/1.
+	unitTests []UnitTest
+
+	// Resource limits for each query run in a context made by WithLimits.
+	Limits Limits
+
+	// Tabling
+	tables         map[string]*table
+	tableLeader    *table
+	tablePending   []*table
+	tableIteration int
+	tableChanged   bool
+
 	// I/O
 	streams       streams
 	input, output *Stream
+	errOutput     *Stream
+
+	// Debugging
+	Tracer Tracer
+
+	// BacktraceDepth is the maximum number of frames recorded in exceptions. If it's 0, no backtraces are recorded.
+	BacktraceDepth int
+
+	tracing   bool
+	spyPoints map[procedureIndicator]struct{}
+	invisible ports
+	profiler  *profiler
+	coverage  *coverage
 
-	// Misc
-	debug bool
+	// leashToggled is the ports of which leashing differs from defaultLeashed so that the zero VM leashes the default ports.
+	leashToggled ports
+
+	// features is the set of the features which are on and wrap the procedure calls in VM.Arrive.
+	features features
+}
+
+// features is a set of the features which wrap the procedure calls.
+type features uint8
+
+const (
+	// featureWakeUp is on once any constraint solvers have watched variables. See VM.watch.
+	featureWakeUp features = 1 << iota
+	featureProfile
+	featureDebug
+	// featureLimits is on if VM.Limits were set when the context for the query was made by VM.WithLimits.
+	featureLimits
+)
+
+func (fs features) has(f features) bool {
+	return fs&f != 0
+}
+
+func (fs *features) set(f features, on bool) {
+	if on {
+		*fs |= f
+	} else {
+		*fs &^= f
+	}
 }
 
 // Register0 registers a predicate of arity 0.
@@ -145,6 +228,60 @@ func (vm *VM) Register8(name Atom, p Predicate8) {
 	vm.procedures[procedureIndicator{name: name, arity: 8}] = p
 }
 
+// Predicates returns the predicate indicators Name/Arity of the procedures in the VM in the standard order.
+func (vm *VM) Predicates() []Term {
+	pis := make([]procedureIndicator, 0, len(vm.procedures))
+	for pi := range vm.procedures {
+		pis = append(pis, pi)
+	}
+	sort.Slice(pis, func(i, j int) bool {
+		if pis[i].name != pis[j].name {
+			return pis[i].name.String() < pis[j].name.String()
+		}
+		return pis[i].arity < pis[j].arity
+	})
+	ts := make([]Term, len(pis))
+	for i, pi := range pis {
+		ts[i] = pi.Term()
+	}
+	return ts
+}
+
+// Unregister removes the procedure of name and arity.
+// User-defined procedures which call it directly or indirectly are also removed.
+func (vm *VM) Unregister(name Atom, arity int) {
+	pi := procedureIndicator{name: name, arity: Integer(arity)}
+	if _, ok := vm.procedures[pi]; !ok {
+		return
+	}
+	delete(vm.procedures, pi)
+	vm.invalidateTables()
+
+	removed := map[procedureIndicator]struct{}{pi: {}}
+	for changed := true; changed; {
+		changed = false
+		for pi, p := range vm.procedures {
+			u, ok := p.(*userDefined)
+			if !ok || !u.calls(removed) {
+				continue
+			}
+			delete(vm.procedures, pi)
+			removed[pi] = struct{}{}
+			changed = true
+		}
+	}
+}
+
+// MarkBuiltIn marks the user-defined procedures defined so far, e.g. the ones in the bootstrap program, as built-in.
+// listing/0 omits them and predicate_property/2 reports them as built_in.
+func (vm *VM) MarkBuiltIn() {
+	for _, p := range vm.procedures {
+		if u, ok := p.(*userDefined); ok {
+			u.builtIn = true
+		}
+	}
+}
+
 type unknownAction int
 
 const (
@@ -172,27 +309,67 @@ type Cont func(*Env) *Promise
 func (vm *VM) Arrive(name Atom, args []Term, k Cont, env *Env) (promise *Promise) {
 	defer ensurePromise(&promise)
 
-	if vm.Unknown == nil {
-		vm.Unknown = func(Atom, []Term, *Env) {}
-	}
-
 	pi := procedureIndicator{name: name, arity: Integer(len(args))}
 	p, ok := vm.procedures[pi]
 	if !ok {
-		switch vm.unknown {
-		case unknownWarning:
-			vm.Unknown(name, args, env)
-			fallthrough
-		case unknownFail:
-			return Bool(false)
-		default:
-			return Error(existenceError(objectTypeProcedure, pi.Term(), env))
-		}
+		return vm.unknownProcedure(pi, args, env)
 	}
 
 	// bind the special variable to inform the predicate about the context.
 	env = env.bind(varContext, pi.Term())
 
+	// Check the features at once so that they cost nothing while they're off.
+	if vm.features == 0 && vm.BacktraceDepth <= 0 {
+		return p.call(vm, args, k, env)
+	}
+	return vm.wrapped(pi, p, args, k, env)
+}
+
+// unknownProcedure handles a call to the undefined procedure pi according to the unknown flag.
+func (vm *VM) unknownProcedure(pi procedureIndicator, args []Term, env *Env) *Promise {
+	switch vm.unknown {
+	case unknownWarning:
+		if vm.Unknown != nil {
+			vm.Unknown(pi.name, args, env)
+			return Bool(false)
+		}
+		return Delay(func(ctx context.Context) *Promise {
+			m := Message{Kind: atomWarning, Term: atomError.Apply(atomExistenceError.Apply(atomProcedure, pi.Term()), NewVariable())}
+			if err := vm.printMessage(ctx, m, env); err != nil {
+				return Error(err)
+			}
+			return Bool(false)
+		})
+	case unknownFail:
+		return Bool(false)
+	default:
+		return Error(existenceError(objectTypeProcedure, pi.Term(), env))
+	}
+}
+
+// wrapped calls p through the wrappers of the features which are on.
+func (vm *VM) wrapped(pi procedureIndicator, p procedure, args []Term, k Cont, env *Env) *Promise {
+	// The procedure may bind the watched variables.
+	if vm.features.has(featureWakeUp) {
+		k = vm.wakeUp(k)
+	}
+
+	if vm.BacktraceDepth > 0 {
+		k, env = vm.pushFrame(pi, args, k, env)
+	}
+
+	if vm.features.has(featureProfile) {
+		p = profiled{pi: pi, procedure: p}
+	}
+
+	if vm.features.has(featureDebug) {
+		p = traced{pi: pi, procedure: p}
+	}
+
+	if vm.features.has(featureLimits) {
+		return vm.limited(p, args, k, env)
+	}
+
 	return p.call(vm, args, k, env)
 }
 
@@ -203,6 +380,9 @@ func (vm *VM) exec(pc bytecode, vars []Variable, cont Cont, args []Term, astack
 		arg Term
 	)
 	for ok {
+		if vm.coverage != nil && covered(pc[0].opcode) {
+			vm.coverage.hit(&pc[0])
+		}
 		op, pc = pc[0], pc[1:]
 		switch opcode, operand := op.opcode, op.operand; opcode {
 		case opGetConst:
@@ -302,6 +482,14 @@ func (vm *VM) SetUserOutput(s *Stream) {
 	vm.output = s
 }
 
+// SetUserError sets the given stream as user_error.
+func (vm *VM) SetUserError(s *Stream) {
+	s.vm = vm
+	s.alias = atomUserError
+	vm.streams.add(s)
+	vm.errOutput = s
+}
+
 // Predicate0 is a predicate of arity 0.
 type Predicate0 func(*VM, Cont, *Env) *Promise
 
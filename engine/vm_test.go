@@ -1,6 +1,7 @@
 package engine
 
 import (
+	"bytes"
 	"context"
 	"os"
 	"testing"
@@ -190,6 +191,50 @@ func TestVM_Register8(t *testing.T) {
 	})
 }
 
+func TestVM_Predicates(t *testing.T) {
+	var vm VM
+	vm.Register1(NewAtom("foo"), func(_ *VM, _ Term, k Cont, env *Env) *Promise {
+		return k(env)
+	})
+	assert.NoError(t, vm.Compile(context.Background(), `
+bar(a).
+foo.
+`))
+	assert.Equal(t, []Term{
+		atomSlash.Apply(NewAtom("bar"), Integer(1)),
+		atomSlash.Apply(NewAtom("foo"), Integer(0)),
+		atomSlash.Apply(NewAtom("foo"), Integer(1)),
+	}, vm.Predicates())
+}
+
+func TestVM_Unregister(t *testing.T) {
+	var vm VM
+	vm.Register0(NewAtom("foo"), func(_ *VM, k Cont, env *Env) *Promise {
+		return k(env)
+	})
+	vm.Register0(NewAtom("bar"), func(_ *VM, k Cont, env *Env) *Promise {
+		return k(env)
+	})
+	assert.NoError(t, vm.Compile(context.Background(), `
+:-(a, foo).
+:-(b, a).
+:-(c, bar).
+:-(d, undefined).
+`))
+
+	vm.Unregister(NewAtom("foo"), 0)
+	vm.Unregister(NewAtom("baz"), 0)
+
+	for _, name := range []string{"foo", "a", "b"} {
+		_, ok := vm.procedures[procedureIndicator{name: NewAtom(name), arity: 0}]
+		assert.False(t, ok, name)
+	}
+	for _, name := range []string{"bar", "c", "d"} {
+		_, ok := vm.procedures[procedureIndicator{name: NewAtom(name), arity: 0}]
+		assert.True(t, ok, name)
+	}
+}
+
 func TestVM_Arrive(t *testing.T) {
 	t.Run("success", func(t *testing.T) {
 		vm := VM{
@@ -234,6 +279,18 @@ func TestVM_Arrive(t *testing.T) {
 			assert.True(t, warned)
 		})
 
+		t.Run("warning: print_message", func(t *testing.T) {
+			var buf bytes.Buffer
+			vm := VM{
+				unknown: unknownWarning,
+			}
+			vm.SetUserError(NewOutputTextStream(&buf))
+			ok, err := vm.Arrive(NewAtom("foo"), []Term{NewAtom("a")}, Success, nil).Force(context.Background())
+			assert.NoError(t, err)
+			assert.False(t, ok)
+			assert.Equal(t, "Warning: Unknown procedure: foo/1\n", buf.String())
+		})
+
 		t.Run("fail", func(t *testing.T) {
 			vm := VM{
 				unknown: unknownFail,
@@ -0,0 +1,82 @@
+package engine
+
+import (
+	"context"
+	"sort"
+)
+
+// Warning is a problem found in a Prolog text which doesn't prevent it from being loaded.
+type Warning struct {
+	// Term describes the problem. It's one of these:
+	//	singletons(PI, Names): the clause of PI has variables which appear only once.
+	//	discontiguous(PI): the clauses of PI are not together while current_prolog_flag(discontiguous, warning).
+	//	redefine_built_in(PI): the text defines a built-in predicate PI.
+	//	undefined_procedure(PI, Caller): the clause of Caller calls PI which is not defined at the end of the load.
+	// VM.Xref also reports these:
+	//	arity_mismatch(PI, Caller, PIs): the clause of Caller calls PI which is not defined while PIs of the same name are.
+	//	unused(PI): PI is called from nowhere but itself.
+	Term Term
+
+	// File and Pos are the source location of the clause.
+	File string
+	Pos  Position
+}
+
+func (w Warning) String() string {
+	m := Message{Term: w.Term, File: w.File, Pos: w.Pos}
+	m.Lines, _ = formatMessageLines(messageLines(w.Term, nil), defaultWriteOptions, nil)
+	return m.String()
+}
+
+func (vm *VM) warn(ctx context.Context, term Term, c *clause) {
+	w := Warning{Term: term}
+	if c != nil {
+		w.File, w.Pos = c.file, c.pos
+	}
+	if vm.OnWarning != nil {
+		vm.OnWarning(w)
+		return
+	}
+	_ = vm.printMessage(ctx, Message{Kind: atomWarning, Term: w.Term, File: w.File, Pos: w.Pos}, nil)
+}
+
+// singletons returns the names of the variables which appear only once in the last term read by p.
+// Names starting with _ are excluded.
+func singletons(p *Parser) []Term {
+	var names []Term
+	for _, v := range p.Vars {
+		if v.Count != 1 || v.Name.String()[0] == '_' {
+			continue
+		}
+		names = append(names, v.Name)
+	}
+	return names
+}
+
+// warnUndefined warns the calls in cs to the procedures which are not defined.
+func (vm *VM) warnUndefined(ctx context.Context, cs []*clause) {
+	sort.SliceStable(cs, func(i, j int) bool {
+		if cs[i].file != cs[j].file {
+			return cs[i].file < cs[j].file
+		}
+		return cs[i].pos.Offset < cs[j].pos.Offset
+	})
+	warned := map[[2]procedureIndicator]struct{}{}
+	for _, c := range cs {
+		for _, op := range c.bytecode {
+			if op.opcode != opCall {
+				continue
+			}
+			pi := op.operand.(procedureIndicator)
+			if _, ok := vm.procedures[pi]; ok {
+				continue
+			}
+			key := [2]procedureIndicator{pi, c.pi}
+			if _, ok := warned[key]; ok {
+				continue
+			}
+			warned[key] = struct{}{}
+			vm.warn(ctx, atomUndefinedProcedure.Apply(pi.Term(), c.pi.Term()), c)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVM_OnWarning(t *testing.T) {
+	foo, bar := NewAtom("foo"), NewAtom("bar")
+
+	tests := []struct {
+		title         string
+		text          string
+		discontiguous bool
+		warnings      []Warning
+		err           error
+	}{
+		{title: "singletons", text: `
+:-(foo(X, Y, _Z), bar(Y)).
+bar(_).
+`, warnings: []Warning{
+			{Term: atomSingletons.Apply(atomSlash.Apply(foo, Integer(3)), List(NewAtom("X"))), Pos: Position{Offset: 1, Line: 2, Column: 1}},
+		}},
+		{title: "discontiguous: error", text: `
+foo(a).
+bar.
+foo(b).
+`, err: &discontiguousError{pi: procedureIndicator{name: foo, arity: 1}}},
+		{title: "discontiguous: warning", discontiguous: true, text: `
+foo(a).
+bar.
+foo(b).
+`, warnings: []Warning{
+			{Term: atomDiscontiguous.Apply(atomSlash.Apply(foo, Integer(1))), Pos: Position{Offset: 14, Line: 4, Column: 1}},
+		}},
+		{title: "redefine built-in", text: `
+call(_).
+`, warnings: []Warning{
+			{Term: atomRedefineBuiltIn.Apply(atomSlash.Apply(atomCall, Integer(1))), Pos: Position{Offset: 1, Line: 2, Column: 1}},
+		}},
+		{title: "undefined procedure", text: `
+:-(foo, ','(bar, ','(baz, bar))).
+bar.
+:-(bar(X), baz(X)).
+`, warnings: []Warning{
+			{Term: atomUndefinedProcedure.Apply(atomSlash.Apply(NewAtom("baz"), Integer(0)), atomSlash.Apply(foo, Integer(0))), Pos: Position{Offset: 1, Line: 2, Column: 1}},
+			{Term: atomUndefinedProcedure.Apply(atomSlash.Apply(NewAtom("baz"), Integer(1)), atomSlash.Apply(bar, Integer(1))), Pos: Position{Offset: 40, Line: 4, Column: 1}},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			var ws []Warning
+			vm := VM{
+				OnWarning: func(w Warning) {
+					ws = append(ws, w)
+				},
+				discontiguousWarning: tt.discontiguous,
+			}
+			vm.Register1(atomCall, Call)
+			assert.Equal(t, tt.err, vm.Compile(context.Background(), tt.text))
+			assert.Equal(t, tt.warnings, ws)
+		})
+	}
+
+	t.Run("nil", func(t *testing.T) {
+		var buf bytes.Buffer
+		var vm VM
+		vm.SetUserError(NewOutputTextStream(&buf))
+		assert.NoError(t, vm.Compile(context.Background(), `
+:-(foo(X), bar).
+`))
+		assert.Equal(t, `Warning: 2:1: Singleton variables [X] in foo/1
+Warning: 2:1: Undefined procedure bar/0 called from foo/1
+`, buf.String())
+	})
+}
+
+func TestWarning_String(t *testing.T) {
+	foo := atomSlash.Apply(NewAtom("foo"), Integer(1))
+	tests := []struct {
+		warning Warning
+		s       string
+	}{
+		{warning: Warning{Term: atomSingletons.Apply(foo, List(NewAtom("X"), NewAtom("Y"))), File: "foo.pl", Pos: Position{Line: 3, Column: 1}}, s: "foo.pl:3:1: Singleton variables [X,Y] in foo/1"},
+		{warning: Warning{Term: atomDiscontiguous.Apply(foo), Pos: Position{Line: 2, Column: 1}}, s: "2:1: Clauses of foo/1 are not together"},
+		{warning: Warning{Term: atomRedefineBuiltIn.Apply(foo)}, s: "Redefined built-in predicate foo/1"},
+		{warning: Warning{Term: atomUndefinedProcedure.Apply(atomSlash.Apply(NewAtom("bar"), Integer(0)), foo)}, s: "Undefined procedure bar/0 called from foo/1"},
+		{warning: Warning{Term: NewAtom("foo")}, s: "Unknown message: foo"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			assert.Equal(t, tt.s, tt.warning.String())
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package engine
+
+import (
+	"io"
+)
+
+// varWatches is a special variable bound to the watches of the constraint solvers.
+// Since Env is persistent, backtracking restores the previous watches for free.
+var varWatches = NewVariable()
+
+// watches is a list of the variables which constraint solvers watch for bindings.
+// Each solver identified by key has at most one entry.
+type watches struct {
+	key  Variable
+	vars []Variable
+
+	// wake is called when any of vars is bound to a non-variable or another variable.
+	// The entry is removed beforehand so that wake can watch the remaining variables again.
+	wake func(vm *VM, k Cont, env *Env) *Promise
+
+	next *watches
+}
+
+// WriteTerm outputs the watches to an io.Writer.
+func (w *watches) WriteTerm(iw io.Writer, _ *WriteOptions, _ *Env) error {
+	_, err := iw.Write([]byte("<watches>"))
+	return err
+}
+
+// Compare compares the watches with a Term.
+func (w *watches) Compare(t Term, env *Env) int {
+	return CompareAtomic[*watches](w, t, func(a, b *watches) int {
+		switch {
+		case a == b:
+			return 0
+		case a.key < b.key:
+			return -1
+		default:
+			return 1
+		}
+	}, env)
+}
+
+// without returns the list without the entry of key.
+func (w *watches) without(key Variable) *watches {
+	switch {
+	case w == nil:
+		return nil
+	case w.key == key:
+		return w.next
+	default:
+		ret := *w
+		ret.next = w.next.without(key)
+		return &ret
+	}
+}
+
+// bound reports whether any of the watched variables is bound.
+func (w *watches) bound(env *Env) bool {
+	for _, v := range w.vars {
+		if env.Resolve(v) != v {
+			return true
+		}
+	}
+	return false
+}
+
+// watch replaces the watch of the solver identified by key with the one on the free variables among vs.
+func (vm *VM) watch(key Variable, vs []Variable, wake func(vm *VM, k Cont, env *Env) *Promise, env *Env) *Env {
+	var (
+		free []Variable
+		seen = map[Variable]struct{}{}
+	)
+	for _, v := range vs {
+		r, ok := env.Resolve(v).(Variable)
+		if !ok {
+			continue
+		}
+		if _, ok := seen[r]; ok {
+			continue
+		}
+		seen[r] = struct{}{}
+		free = append(free, r)
+	}
+
+	ws, _ := env.Resolve(varWatches).(*watches)
+	ws = ws.without(key)
+	if len(free) > 0 {
+		vm.features |= featureWakeUp
+		ws = &watches{key: key, vars: free, wake: wake, next: ws}
+	}
+	return env.bind(varWatches, ws)
+}
+
+// wakeUp returns a continuation which wakes the solvers watching the variables bound so far before calling k.
+func (vm *VM) wakeUp(k Cont) Cont {
+	return func(env *Env) *Promise {
+		return vm.wake(k, env)
+	}
+}
+
+func (vm *VM) wake(k Cont, env *Env) *Promise {
+	ws, _ := env.Resolve(varWatches).(*watches)
+	for w := ws; w != nil; w = w.next {
+		if !w.bound(env) {
+			continue
+		}
+		return w.wake(vm, func(env *Env) *Promise {
+			return vm.wake(k, env)
+		}, env.bind(varWatches, ws.without(w.key)))
+	}
+	return k(env)
+}
@@ -0,0 +1,327 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Xref is a cross-reference of the user-defined procedures, i.e. a call graph.
+// It's built from the procedures called in the compiled clauses and the goals passed to meta-calls such as call/N and findall/3.
+type Xref struct {
+	vm *VM
+
+	// files is the files to report on. If it's empty, all the user-defined procedures are reported on.
+	files map[string]struct{}
+
+	// calls maps a caller to its callees and the first clause that calls each of them.
+	calls map[procedureIndicator]map[procedureIndicator]*clause
+
+	// roots is the procedures called from directives, initialization goals, and unit tests.
+	roots map[procedureIndicator]struct{}
+}
+
+// xrefMetaArg is an argument of a meta-predicate which is called as a goal with extra arguments.
+type xrefMetaArg struct {
+	arg, extra int
+}
+
+// xrefMetaArgs is the arguments of the control constructs and the built-in predicates which are goals.
+// call/N is handled separately.
+var xrefMetaArgs = map[procedureIndicator][]xrefMetaArg{
+	{name: atomComma, arity: 2}:           {{arg: 0}, {arg: 1}},
+	{name: atomSemiColon, arity: 2}:       {{arg: 0}, {arg: 1}},
+	{name: atomThen, arity: 2}:            {{arg: 0}, {arg: 1}},
+	{name: atomNegation, arity: 1}:        {{arg: 0}},
+	{name: NewAtom("once"), arity: 1}:     {{arg: 0}},
+	{name: NewAtom("ignore"), arity: 1}:   {{arg: 0}},
+	{name: NewAtom("forall"), arity: 2}:   {{arg: 0}, {arg: 1}},
+	{name: NewAtom("findall"), arity: 3}:  {{arg: 1}},
+	{name: NewAtom("findall"), arity: 4}:  {{arg: 1}},
+	{name: NewAtom("bagof"), arity: 3}:    {{arg: 1}},
+	{name: NewAtom("setof"), arity: 3}:    {{arg: 1}},
+	{name: NewAtom("catch"), arity: 3}:    {{arg: 0}, {arg: 2}},
+	{name: NewAtom("call_nth"), arity: 2}: {{arg: 0}},
+	{name: NewAtom("profile"), arity: 1}:  {{arg: 0}},
+	{name: atomPhrase, arity: 2}:          {{arg: 0, extra: 2}},
+	{name: atomPhrase, arity: 3}:          {{arg: 0, extra: 2}},
+	{name: NewAtom("maplist"), arity: 2}:  {{arg: 0, extra: 1}},
+	{name: NewAtom("maplist"), arity: 3}:  {{arg: 0, extra: 2}},
+	{name: NewAtom("maplist"), arity: 4}:  {{arg: 0, extra: 3}},
+	{name: NewAtom("maplist"), arity: 5}:  {{arg: 0, extra: 4}},
+	{name: NewAtom("maplist"), arity: 6}:  {{arg: 0, extra: 5}},
+	{name: NewAtom("maplist"), arity: 7}:  {{arg: 0, extra: 6}},
+}
+
+// xrefHooks is the procedures which are called by the system rather than the program.
+var xrefHooks = map[procedureIndicator]struct{}{
+	{name: atomTermExpansion, arity: 2}: {},
+	{name: atomMessage, arity: 3}:       {},
+	{name: atomMessageHook, arity: 3}:   {},
+}
+
+// Xref builds the cross-reference of the user-defined procedures.
+// With files, it reports only on the procedures defined in them although the calls from the other procedures are taken into account.
+func (vm *VM) Xref(files ...string) *Xref {
+	x := Xref{
+		vm:    vm,
+		calls: map[procedureIndicator]map[procedureIndicator]*clause{},
+		roots: map[procedureIndicator]struct{}{},
+	}
+	if len(files) > 0 {
+		x.files = make(map[string]struct{}, len(files))
+		for _, f := range files {
+			x.files[f] = struct{}{}
+		}
+	}
+
+	for pi, p := range vm.procedures {
+		u, ok := p.(*userDefined)
+		if !ok || u.builtIn {
+			continue
+		}
+		callees := map[procedureIndicator]*clause{}
+		for i := range u.clauses {
+			c := &u.clauses[i]
+			add := func(callee procedureIndicator) {
+				if _, ok := callees[callee]; !ok {
+					callees[callee] = c
+				}
+			}
+			for _, op := range c.bytecode {
+				if op.opcode == opCall {
+					add(op.operand.(procedureIndicator))
+				}
+			}
+			if r, ok := c.raw.(Compound); ok && r.Functor() == atomIf && r.Arity() == 2 {
+				xrefGoal(r.Arg(1), 0, add)
+			}
+		}
+		x.calls[pi] = callees
+	}
+
+	root := func(pi procedureIndicator) {
+		x.roots[pi] = struct{}{}
+	}
+	for _, l := range vm.loaded {
+		for _, g := range l.goals {
+			xrefGoal(g, 0, root)
+		}
+	}
+	for _, t := range vm.unitTests {
+		c := t.raw.(Compound)
+		xrefGoal(c.Arg(1), 0, root)
+		opts, _ := testOptions(c.Arg(0))
+		for _, g := range append(opts.checks, opts.setup, opts.cleanup, opts.forall) {
+			if g != nil {
+				xrefGoal(g, 0, root)
+			}
+		}
+	}
+
+	return &x
+}
+
+// xrefGoal calls f with the procedures called by goal including the ones called through meta-calls.
+// extra is the number of the arguments added by call/N or the meta-predicate.
+func xrefGoal(goal Term, extra int, f func(procedureIndicator)) {
+	var pi procedureIndicator
+	switch g := goal.(type) {
+	case Atom:
+		pi = procedureIndicator{name: g, arity: Integer(extra)}
+	case Compound:
+		pi = procedureIndicator{name: g.Functor(), arity: Integer(g.Arity() + extra)}
+		if extra > 0 {
+			break
+		}
+		if g.Functor() == atomCall {
+			xrefGoal(g.Arg(0), g.Arity()-1, f)
+			break
+		}
+		for _, m := range xrefMetaArgs[pi] {
+			arg := g.Arg(m.arg)
+			if pi.name == NewAtom("bagof") || pi.name == NewAtom("setof") {
+				for {
+					c, ok := arg.(Compound)
+					if !ok || c.Functor() != atomCaret || c.Arity() != 2 {
+						break
+					}
+					arg = c.Arg(1)
+				}
+			}
+			xrefGoal(arg, m.extra, f)
+		}
+	default:
+		return
+	}
+	f(pi)
+}
+
+// reported returns true if the procedure is subject to the report.
+func (x *Xref) reported(pi procedureIndicator) bool {
+	u, ok := x.vm.procedures[pi].(*userDefined)
+	if !ok || u.builtIn {
+		return false
+	}
+	if x.files == nil {
+		return true
+	}
+	if _, ok := x.files[u.file]; ok {
+		return true
+	}
+	for _, c := range u.clauses {
+		if _, ok := x.files[c.file]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (x *Xref) procedures() []procedureIndicator {
+	var pis []procedureIndicator
+	for pi := range x.calls {
+		if x.reported(pi) {
+			pis = append(pis, pi)
+		}
+	}
+	sortProcedureIndicators(pis)
+	return pis
+}
+
+func (x *Xref) callees(caller procedureIndicator) []procedureIndicator {
+	var pis []procedureIndicator
+	for pi := range x.calls[caller] {
+		pis = append(pis, pi)
+	}
+	sortProcedureIndicators(pis)
+	return pis
+}
+
+// Warnings returns the problems found in the call graph. The Term of each Warning is one of these:
+//
+//	undefined_procedure(PI, Caller): Caller calls PI which is not defined.
+//	arity_mismatch(PI, Caller, PIs): Caller calls PI which is not defined while the procedures of the same name PIs are defined.
+//	unused(PI): PI is called from nowhere but itself. Dynamic procedures and hooks such as term_expansion/2 are not reported.
+func (x *Xref) Warnings() []Warning {
+	arities := map[Atom][]procedureIndicator{}
+	for pi := range x.vm.procedures {
+		arities[pi.name] = append(arities[pi.name], pi)
+	}
+
+	var ws []Warning
+	warn := func(term Term, c *clause) {
+		ws = append(ws, Warning{Term: term, File: c.file, Pos: c.pos})
+	}
+
+	called := map[procedureIndicator]struct{}{}
+	for caller, callees := range x.calls {
+		for callee := range callees {
+			if callee != caller {
+				called[callee] = struct{}{}
+			}
+		}
+	}
+
+	for _, pi := range x.procedures() {
+		for _, callee := range x.callees(pi) {
+			if _, ok := x.vm.procedures[callee]; ok {
+				continue
+			}
+			c := x.calls[pi][callee]
+			if others := arities[callee.name]; len(others) > 0 {
+				sortProcedureIndicators(others)
+				ts := make([]Term, len(others))
+				for i, o := range others {
+					ts[i] = o.Term()
+				}
+				warn(atomArityMismatch.Apply(callee.Term(), pi.Term(), List(ts...)), c)
+				continue
+			}
+			warn(atomUndefinedProcedure.Apply(callee.Term(), pi.Term()), c)
+		}
+
+		u := x.vm.procedures[pi].(*userDefined)
+		if _, ok := called[pi]; ok || u.dynamic || len(u.clauses) == 0 {
+			continue
+		}
+		if _, ok := x.roots[pi]; ok {
+			continue
+		}
+		if _, ok := xrefHooks[pi]; ok {
+			continue
+		}
+		warn(atomUnused.Apply(pi.Term()), &u.clauses[0])
+	}
+
+	sort.SliceStable(ws, func(i, j int) bool {
+		if ws[i].File != ws[j].File {
+			return ws[i].File < ws[j].File
+		}
+		return ws[i].Pos.Offset < ws[j].Pos.Offset
+	})
+	return ws
+}
+
+// WriteDOT writes the call graph in the DOT language of Graphviz.
+// The nodes are the user-defined procedures and the undefined procedures they call. The undefined ones are dashed.
+func (x *Xref) WriteDOT(w io.Writer) error {
+	ew := errWriter{w: w}
+	_, _ = fmt.Fprint(&ew, "digraph xref {\n")
+	undefined := map[procedureIndicator]struct{}{}
+	for _, pi := range x.procedures() {
+		_, _ = fmt.Fprintf(&ew, "\t%s;\n", dotID(pi))
+		for _, callee := range x.callees(pi) {
+			switch p := x.vm.procedures[callee].(type) {
+			case nil:
+				undefined[callee] = struct{}{}
+			case *userDefined:
+				if p.builtIn {
+					continue
+				}
+			default:
+				continue
+			}
+			_, _ = fmt.Fprintf(&ew, "\t%s -> %s;\n", dotID(pi), dotID(callee))
+		}
+	}
+	var pis []procedureIndicator
+	for pi := range undefined {
+		pis = append(pis, pi)
+	}
+	sortProcedureIndicators(pis)
+	for _, pi := range pis {
+		_, _ = fmt.Fprintf(&ew, "\t%s [style=dashed];\n", dotID(pi))
+	}
+	_, _ = fmt.Fprint(&ew, "}\n")
+	return ew.err
+}
+
+func dotID(pi procedureIndicator) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(pi.String()) + `"`
+}
+
+// XrefSource loads the Prolog text in file unless it's loaded and prints the warnings of the cross-reference of the procedures defined in it.
+// If it loads the file, it doesn't print the warnings of undefined procedures since they're printed while loading.
+func XrefSource(vm *VM, file Term, k Cont, env *Env) *Promise {
+	return Delay(func(ctx context.Context) *Promise {
+		f, _, err := vm.open(file, env)
+		if err != nil {
+			return Error(err)
+		}
+		_, loaded := vm.loaded[f]
+		if err := vm.ensureLoaded(ctx, file, env); err != nil {
+			return Error(err)
+		}
+		for _, w := range vm.Xref(f).Warnings() {
+			if c, ok := w.Term.(Compound); !loaded && ok && c.Functor() == atomUndefinedProcedure {
+				continue
+			}
+			if err := vm.printMessage(ctx, Message{Kind: atomWarning, Term: w.Term, File: w.File, Pos: w.Pos}, nil); err != nil {
+				return Error(err)
+			}
+		}
+		return k(env)
+	})
+}
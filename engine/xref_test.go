@@ -0,0 +1,179 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestVM_Xref(t *testing.T) {
+	vm := VM{
+		FS: fstest.MapFS{
+			"a.pl": &fstest.MapFile{Data: []byte(`
+:- initialization(main).
+:- dynamic(counter/1).
+main :- greet, findall(X, helper(X), _), call(double, 1, _).
+greet :- missing.
+helper(1).
+helper(X) :- helper(X, 2).
+double(X, X).
+dead :- dead, bagof(X, Y^tested(X, Y), _).
+tested(a, b).
+odd :- call(foo, 1) ; baz.
+foo(_, _, _).
+`)},
+			"b.pl": &fstest.MapFile{Data: []byte(`
+baz.
+qux :- odd.
+tested_only.
+:- begin_tests(b).
+test(t) :- tested_only.
+:- end_tests(b).
+`)},
+		},
+		SkipInitialization: true,
+		OnWarning:          func(Warning) {},
+	}
+	vm.operators.define(1200, operatorSpecifierXFX, atomIf)
+	vm.operators.define(1200, operatorSpecifierFX, atomIf)
+	vm.operators.define(1100, operatorSpecifierXFY, atomSemiColon)
+	vm.operators.define(1000, operatorSpecifierXFY, atomComma)
+	vm.operators.define(400, operatorSpecifierYFX, atomSlash)
+	vm.operators.define(200, operatorSpecifierXFY, atomCaret)
+	vm.Register3(NewAtom("findall"), FindAll)
+	vm.Register3(NewAtom("bagof"), BagOf)
+	vm.Register1(atomCall, Call)
+	vm.Register2(atomCall, Call1)
+	vm.Register3(atomCall, Call2)
+	vm.Register2(atomComma, func(_ *VM, _, _ Term, k Cont, env *Env) *Promise {
+		return k(env)
+	})
+	vm.Register2(atomSemiColon, func(_ *VM, _, _ Term, k Cont, env *Env) *Promise {
+		return k(env)
+	})
+	assert.NoError(t, vm.Compile(context.Background(), `
+:- ensure_loaded(a).
+:- ensure_loaded(b).
+`))
+
+	t.Run("all", func(t *testing.T) {
+		var ss []string
+		for _, w := range vm.Xref().Warnings() {
+			ss = append(ss, w.String())
+		}
+		assert.Equal(t, []string{
+			"a.pl:5:1: Undefined procedure missing/0 called from greet/0",
+			"a.pl:7:1: Undefined procedure helper/2 called from helper/1; defined with other arities: [helper/1]",
+			"a.pl:9:1: dead/0 is not called",
+			"a.pl:11:1: Undefined procedure foo/1 called from odd/0; defined with other arities: [foo/3]",
+			"a.pl:12:1: foo/3 is not called",
+			"b.pl:3:1: qux/0 is not called",
+		}, ss)
+	})
+
+	t.Run("files", func(t *testing.T) {
+		var ss []string
+		for _, w := range vm.Xref("b.pl").Warnings() {
+			ss = append(ss, w.String())
+		}
+		assert.Equal(t, []string{
+			"b.pl:3:1: qux/0 is not called",
+		}, ss)
+	})
+
+	t.Run("dot", func(t *testing.T) {
+		var buf bytes.Buffer
+		assert.NoError(t, vm.Xref().WriteDOT(&buf))
+		assert.Equal(t, `digraph xref {
+	"baz/0";
+	"counter/1";
+	"dead/0";
+	"dead/0" -> "dead/0";
+	"dead/0" -> "tested/2";
+	"double/2";
+	"foo/3";
+	"greet/0";
+	"greet/0" -> "missing/0";
+	"helper/1";
+	"helper/1" -> "helper/2";
+	"main/0";
+	"main/0" -> "double/2";
+	"main/0" -> "greet/0";
+	"main/0" -> "helper/1";
+	"odd/0";
+	"odd/0" -> "baz/0";
+	"odd/0" -> "foo/1";
+	"qux/0";
+	"qux/0" -> "odd/0";
+	"tested/2";
+	"tested_only/0";
+	"foo/1" [style=dashed];
+	"helper/2" [style=dashed];
+	"missing/0" [style=dashed];
+}
+`, buf.String())
+	})
+
+	t.Run("write error", func(t *testing.T) {
+		var m mockWriter
+		m.On("Write", mock.Anything).Return(0, errors.New("failed"))
+		assert.Error(t, vm.Xref().WriteDOT(&m))
+	})
+}
+
+func TestXrefSource(t *testing.T) {
+	var messages []Message
+	vm := VM{
+		FS: fstest.MapFS{
+			"a.pl": &fstest.MapFile{Data: []byte(`
+p :- q.
+r :- p.
+`)},
+		},
+		OnMessage: func(m Message) {
+			messages = append(messages, m)
+		},
+	}
+	vm.operators.define(1200, operatorSpecifierXFX, atomIf)
+	vm.operators.define(400, operatorSpecifierYFX, atomSlash)
+
+	t.Run("not loaded", func(t *testing.T) {
+		messages = nil
+		ok, err := XrefSource(&vm, NewAtom("a"), Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		var ss []string
+		for _, m := range messages {
+			ss = append(ss, m.String())
+		}
+		assert.Equal(t, []string{
+			"Warning: a.pl:2:1: Undefined procedure q/0 called from p/0",
+			"Warning: a.pl:3:1: r/0 is not called",
+		}, ss)
+	})
+
+	t.Run("loaded", func(t *testing.T) {
+		messages = nil
+		ok, err := XrefSource(&vm, NewAtom("a.pl"), Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		var ss []string
+		for _, m := range messages {
+			ss = append(ss, m.String())
+		}
+		assert.Equal(t, []string{
+			"Warning: a.pl:2:1: Undefined procedure q/0 called from p/0",
+			"Warning: a.pl:3:1: r/0 is not called",
+		}, ss)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		_, err := XrefSource(&vm, NewAtom("b"), Success, nil).Force(context.Background())
+		assert.Equal(t, existenceError(objectTypeSourceSink, NewAtom("b"), nil), err)
+	})
+}
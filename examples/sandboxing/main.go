@@ -11,6 +11,10 @@ func main() {
 	// Instantiates a new Prolog interpreter without any builtin predicates nor operators.
 	p := new(prolog.Interpreter)
 
+	// File access such as consult/1 and open/4 goes through p.FS which is nil, i.e. no files at all, unless set.
+	// To give it some files, set an in-memory file system or wrap another one with engine.ReadOnlyFS.
+	p.FS = &engine.MemFS{}
+
 	// In this vanilla interpreter, even the infix operator `:-` is not defined.
 	// Instead of writing `:-(mortal(X), human(X)).`, you may want to define the infix operator first.
 
@@ -6,7 +6,6 @@ import (
 	"errors"
 	"github.com/ichiban/prolog/engine"
 	"io"
-	"io/fs"
 	"os"
 	"strings"
 )
@@ -22,10 +21,28 @@ type Interpreter struct {
 
 // New creates a new Prolog interpreter with predefined predicates/operators.
 func New(in io.Reader, out io.Writer) *Interpreter {
+	return NewWithOptions(UserInput(in), UserOutput(out))
+}
+
+// NewWithOptions creates a new Prolog interpreter with the predefined predicates/operators of the allowed capabilities.
+// Without Allow, all the capabilities are allowed.
+func NewWithOptions(opts ...Option) *Interpreter {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
 	var i Interpreter
-	i.FS = defaultFS{}
-	i.SetUserInput(engine.NewInputTextStream(in))
-	i.SetUserOutput(engine.NewOutputTextStream(out))
+	i.FS = engine.OSFS{}
+	i.SetUserInput(engine.NewInputTextStream(o.in))
+	i.SetUserOutput(engine.NewOutputTextStream(o.out))
+	if o.err == nil {
+		o.err = os.Stderr
+		if !o.allowed(CapabilityIOWrite) {
+			o.err = io.Discard
+		}
+	}
+	i.SetUserError(engine.NewOutputTextStream(o.err))
 
 	// Control constructs
 	i.Register1(engine.NewAtom("call"), engine.Call)
@@ -71,6 +88,8 @@ func New(in io.Reader, out io.Writer) *Interpreter {
 	// Clause retrieval and information
 	i.Register2(engine.NewAtom("clause"), engine.Clause)
 	i.Register1(engine.NewAtom("current_predicate"), engine.CurrentPredicate)
+	i.Register2(engine.NewAtom("predicate_property"), engine.PredicateProperty)
+	i.Register2(engine.NewAtom("clause_property"), engine.ClauseProperty)
 
 	// Clause creation and destruction
 	i.Register1(engine.NewAtom("asserta"), engine.Asserta)
@@ -140,6 +159,7 @@ func New(in io.Reader, out io.Writer) *Interpreter {
 
 	// Consult
 	i.Register1(engine.NewAtom("consult"), engine.Consult)
+	i.Register0(engine.NewAtom("make"), engine.Make)
 
 	// Definite clause grammar
 	i.Register3(engine.NewAtom("phrase"), engine.Phrase)
@@ -154,7 +174,60 @@ func New(in io.Reader, out io.Writer) *Interpreter {
 	i.Register3(engine.NewAtom("nth1"), engine.Nth1)
 	i.Register2(engine.NewAtom("call_nth"), engine.CallNth)
 
+	// Boolean constraints
+	i.Register1(engine.NewAtom("sat"), engine.Sat)
+	i.Register2(engine.NewAtom("taut"), engine.Taut)
+	i.Register1(engine.NewAtom("labeling"), engine.Labeling)
+	i.Register2(engine.NewAtom("sat_count"), engine.SatCount)
+
+	// Constraint Handling Rules
+	i.Register1(engine.NewAtom("find_chr_constraint"), engine.FindCHRConstraint)
+
+	// Tabling
+	i.Register0(engine.NewAtom("abolish_all_tables"), engine.AbolishAllTables)
+
+	// Dicts
+	i.Register3(engine.NewAtom("get_dict"), engine.GetDict)
+	i.Register4(engine.NewAtom("put_dict"), engine.PutDict)
+	i.Register3(engine.NewAtom("dict_pairs"), engine.DictPairs)
+
+	// Messages
+	i.Register2(engine.NewAtom("print_message"), engine.PrintMessage)
+	i.Register3(engine.NewAtom("message_to_codes"), engine.MessageToCodes)
+
+	// Debugging
+	i.Register0(engine.NewAtom("trace"), engine.Trace)
+	i.Register0(engine.NewAtom("notrace"), engine.NoTrace)
+	i.Register1(engine.NewAtom("spy"), engine.Spy)
+	i.Register1(engine.NewAtom("nospy"), engine.NoSpy)
+	i.Register1(engine.NewAtom("leash"), engine.Leash)
+	i.Register1(engine.NewAtom("visible"), engine.Visible)
+	i.Register1(engine.NewAtom("profile"), engine.ProfileGoal)
+	i.Register0(engine.NewAtom("listing"), engine.ListingAll)
+	i.Register1(engine.NewAtom("listing"), engine.Listing)
+	i.Register2(engine.NewAtom("portray_clause"), engine.PortrayClause)
+
+	// Unit tests
+	i.Register0(engine.NewAtom("run_tests"), engine.RunAllTests)
+	i.Register1(engine.NewAtom("run_tests"), engine.RunTests)
+
+	// Cross-reference
+	i.Register1(engine.NewAtom("xref_source"), engine.XrefSource)
+
 	_ = i.Exec(bootstrap)
+	i.MarkBuiltIn()
+
+	for _, c := range allCapabilities {
+		if o.allowed(c) {
+			continue
+		}
+		for _, pi := range capabilityPredicates[c] {
+			i.Unregister(engine.NewAtom(pi.name), pi.arity)
+		}
+	}
+	if !o.allowed(CapabilityFiles) {
+		i.FS = &engine.MemFS{}
+	}
 
 	return &i
 }
@@ -166,7 +239,7 @@ func (i *Interpreter) Exec(query string, args ...interface{}) error {
 
 // ExecContext executes a prolog program with context.
 func (i *Interpreter) ExecContext(ctx context.Context, query string, args ...interface{}) error {
-	return i.Compile(ctx, query, args...)
+	return i.Compile(i.WithLimits(ctx), query, args...)
 }
 
 // Query executes a prolog query and returns *Solutions.
@@ -188,6 +261,7 @@ func (i *Interpreter) QueryContext(ctx context.Context, query string, args ...in
 
 	var env *engine.Env
 
+	ctx = i.WithLimits(ctx)
 	more := make(chan bool, 1)
 	next := make(chan *engine.Env)
 	sols := Solutions{
@@ -237,9 +311,3 @@ func (i *Interpreter) QuerySolutionContext(ctx context.Context, query string, ar
 
 	return &Solution{sols: sols, err: sols.Close()}
 }
-
-type defaultFS struct{}
-
-func (d defaultFS) Open(name string) (fs.File, error) {
-	return os.Open(name)
-}
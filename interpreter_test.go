@@ -10,6 +10,7 @@ import (
 	"io"
 	"os"
 	"regexp"
+	"strings"
 	"testing"
 	"time"
 )
@@ -209,6 +210,318 @@ func TestNew(t *testing.T) {
 		assert.NoError(t, p.QuerySolution(`\+call_nth(1, 0).`).Err())
 		assert.NoError(t, p.QuerySolution(`\+call_nth(V, 0).`).Err())
 	})
+
+	t.Run("clpb", func(t *testing.T) {
+		p := New(nil, nil)
+		assert.NoError(t, p.QuerySolution(`\+current_op(_, _, #), \+current_op(_, _, ~).`).Err())
+		assert.NoError(t, p.Exec(`:- use_module(library(clpb)).`))
+
+		assert.NoError(t, p.QuerySolution(`sat(X*Y), X == 1, Y == 1.`).Err())
+		assert.NoError(t, p.QuerySolution(`\+ (sat(X+Y), X = 0, Y = 0).`).Err())
+		assert.NoError(t, p.QuerySolution(`sat(X+Y), X = 0, Y == 1.`).Err())
+		assert.NoError(t, p.QuerySolution(`\+sat(X * ~X).`).Err())
+		assert.NoError(t, p.QuerySolution(`taut(X + ~X, 1).`).Err())
+		assert.NoError(t, p.QuerySolution(`sat(X =< Y), taut(X * ~Y, 0).`).Err())
+		assert.NoError(t, p.QuerySolution(`findall(X-Y, (sat(X # Y), labeling([X, Y])), [0-1, 1-0]).`).Err())
+		assert.NoError(t, p.QuerySolution(`sat_count(X + Y + Z, 7).`).Err())
+		assert.NoError(t, p.QuerySolution(`catch(sat(foo), error(type_error(boolean_expression, foo), _), true).`).Err())
+	})
+
+	t.Run("chr", func(t *testing.T) {
+		p := New(nil, nil)
+		assert.NoError(t, p.QuerySolution(`\+current_op(_, _, <=>), \+current_op(_, _, chr_constraint).`).Err())
+		assert.NoError(t, p.Exec(`
+:- use_module(library(chr)).
+:- chr_constraint gcd/1, leq/2.
+
+gcd(0) <=> true.
+gcd(N) \ gcd(M) <=> N =< M | L is M mod N, gcd(L).
+
+reflexivity @ leq(X, X) <=> true.
+antisymmetry @ leq(X, Y), leq(Y, X) <=> X = Y.
+idempotence @ leq(X, Y) \ leq(X, Y) <=> true.
+transitivity @ leq(X, Y), leq(Y, Z) ==> leq(X, Z).
+`))
+
+		assert.NoError(t, p.QuerySolution(`gcd(9), gcd(6), findall(X, find_chr_constraint(gcd(X)), [3]).`).Err())
+		assert.NoError(t, p.QuerySolution(`leq(A, B), leq(B, C), leq(C, A), A == B, B == C.`).Err())
+		assert.NoError(t, p.QuerySolution(`(gcd(4), fail; true), \+find_chr_constraint(_).`).Err())
+		assert.NoError(t, p.QuerySolution(`leq(A, B), leq(B, C), A = C, A == B.`).Err())
+	})
+
+	t.Run("tabling", func(t *testing.T) {
+		p := New(nil, nil)
+		assert.NoError(t, p.Exec(`
+:- table path/2.
+path(X, Y) :- path(X, Z), edge(Z, Y).
+path(X, Y) :- edge(X, Y).
+
+edge(a, b).
+edge(b, c).
+edge(c, a).
+edge(c, d).
+
+:- table fib/2.
+fib(0, 0).
+fib(1, 1).
+fib(N, F) :- N > 1, N1 is N - 1, N2 is N - 2, fib(N1, F1), fib(N2, F2), F is F1 + F2.
+
+:- table conn(_, _, min).
+conn(X, Y, 1) :- edge(X, Y).
+conn(X, Y, N) :- conn(X, Z, N0), edge(Z, Y), N is N0 + 1.
+
+:- table route(_, _, lattice(shorter/3)).
+route(X, Y, [X, Y]) :- edge(X, Y).
+route(X, Y, P) :- route(X, Z, P0), edge(Z, Y), append(P0, [Y], P).
+shorter(P1, P2, P) :- length(P1, N1), length(P2, N2), (N2 < N1 -> P = P2; P = P1).
+`))
+
+		assert.NoError(t, p.QuerySolution(`findall(Y, path(a, Y), Ys), sort(Ys, [a, b, c, d]).`).Err())
+		assert.NoError(t, p.QuerySolution(`findall(X-Y, path(X, Y), Ps), length(Ps, 12).`).Err())
+		assert.NoError(t, p.QuerySolution(`fib(50, 12586269025).`).Err())
+		assert.NoError(t, p.QuerySolution(`conn(a, d, N), N == 3.`).Err())
+		assert.NoError(t, p.QuerySolution(`findall(Y-N, conn(a, Y, N), Ps), sort(Ps, [a-3, b-1, c-2, d-3]).`).Err())
+		assert.NoError(t, p.QuerySolution(`abolish_all_tables, findall(Y, path(d, Y), []).`).Err())
+		assert.NoError(t, p.QuerySolution(`route(a, d, P), P == [a, b, c, d].`).Err())
+
+		assert.NoError(t, p.Exec(`
+:- dynamic(link/2).
+link(a, b).
+
+:- table reach/2.
+reach(X, Y) :- link(X, Y).
+reach(X, Y) :- reach(X, Z), link(Z, Y).
+`))
+		assert.NoError(t, p.QuerySolution(`findall(Y, reach(a, Y), [b]).`).Err())
+		assert.NoError(t, p.QuerySolution(`assertz(link(b, c)), findall(Y, reach(a, Y), [b, c]).`).Err())
+		assert.NoError(t, p.QuerySolution(`retract(link(a, b)), findall(Y, reach(a, Y), []).`).Err())
+	})
+
+	t.Run("dicts", func(t *testing.T) {
+		var out bytes.Buffer
+		p := New(nil, &out)
+		assert.NoError(t, p.Exec(`config(_{name: foo, port: 8080}).`))
+
+		assert.NoError(t, p.QuerySolution(`config(C), get_dict(port, C, 8080).`).Err())
+		assert.NoError(t, p.QuerySolution(`point{x: 1, y: Y} = point{y: 2, x: X}, X == 1, Y == 2.`).Err())
+		assert.NoError(t, p.QuerySolution(`\+ point{x: 1} = point{x: 1, y: 2}.`).Err())
+		assert.NoError(t, p.QuerySolution(`put_dict(z, point{x: 1}, 3, D), dict_pairs(D, point, [x-1, z-3]).`).Err())
+		assert.NoError(t, p.QuerySolution(`dict_pairs(D, t, [b-2, a-1]), get_dict(K, D, 1), K == a.`).Err())
+		assert.NoError(t, p.QuerySolution(`catch(dict_pairs(_, t, [a-1, a-2]), error(duplicate_key(a), _), true).`).Err())
+		assert.NoError(t, p.QuerySolution(`get_dict(name, ?, N), N == "x".`, map[string]interface{}{"name": "x"}).Err())
+		assert.NoError(t, p.QuerySolution(`X = _{a: 1}, X \= dict(_, _, _), X \== dict(_, a, 1).`).Err())
+		assert.NoError(t, p.QuerySolution(`catch((functor(_{a: 1}, _, _), fail), error(type_error(compound, _), _), true).`).Err())
+		assert.NoError(t, p.QuerySolution(`X =.. [dict, t, a, 1], catch(get_dict(a, X, _), error(type_error(dict, _), _), true).`).Err())
+
+		assert.NoError(t, p.QuerySolution(`config(C), copy_term(C, C2), write(C2).`).Err())
+		assert.Equal(t, `_{name:foo,port:8080}`, regexp.MustCompile(`_[0-9]+`).ReplaceAllString(out.String(), "_"))
+	})
+
+	t.Run("blobs", func(t *testing.T) {
+		type conn struct{ name string }
+		c := &conn{name: "db"}
+
+		p := New(nil, nil)
+		p.Register2(engine.NewAtom("conn_name"), func(vm *engine.VM, handle, name engine.Term, k engine.Cont, env *engine.Env) *engine.Promise {
+			b, ok := env.Resolve(handle).(*engine.Blob)
+			if !ok {
+				return engine.Bool(false)
+			}
+			c, ok := b.Value.(*conn)
+			if !ok {
+				return engine.Bool(false)
+			}
+			return engine.Unify(vm, name, engine.NewAtom(c.name), k, env)
+		})
+		assert.NoError(t, p.QuerySolution(`conn_name(?, db).`, c).Err())
+		assert.NoError(t, p.QuerySolution(`X = ?, atomic(X), X == X.`, c).Err())
+		assert.NoError(t, p.QuerySolution(`X = ?, Y = ?, X == Y.`, c, c).Err())
+		assert.NoError(t, p.QuerySolution(`X = ?, Y = ?, X \== Y.`, c, &conn{name: "db"}).Err())
+		assert.NoError(t, p.Exec(`conn(?).`, c))
+		assert.NoError(t, p.QuerySolution(`conn(?).`, c).Err())
+		assert.NoError(t, p.QuerySolution(`conn(X), ? == X.`, c).Err())
+		assert.NoError(t, p.QuerySolution(`X = ?, Y = ?, X \== Y.`, *c, *c).Err())
+
+		var v struct{ X conn }
+		assert.NoError(t, p.QuerySolution(`X = ?, atomic(X).`, *c).Scan(&v))
+		assert.Equal(t, *c, v.X)
+
+		var s struct {
+			C *conn
+		}
+		assert.NoError(t, p.QuerySolution(`C = ?, atomic(C).`, c).Scan(&s))
+		assert.Same(t, c, s.C)
+	})
+
+	t.Run("limits", func(t *testing.T) {
+		p := New(nil, nil)
+		assert.NoError(t, p.Exec(`p :- p, p.`))
+		p.Limits = engine.Limits{Inferences: 1000}
+
+		err := p.QuerySolution(`p.`).Err()
+		var e engine.Exception
+		assert.True(t, errors.As(err, &e))
+		assert.Equal(t, engine.NewAtom("resource_error").Apply(engine.NewAtom("inferences")), e.Term().(engine.Compound).Arg(0))
+
+		assert.NoError(t, p.QuerySolution(`length(L, 10).`).Err())
+	})
+
+	t.Run("fs", func(t *testing.T) {
+		var fsys engine.MemFS
+		assert.NoError(t, fsys.WriteFile("foo.pl", []byte("foo(a).\n")))
+
+		p := New(nil, nil)
+		p.FS = &fsys
+		assert.NoError(t, p.QuerySolution(`consult(foo), foo(a).`).Err())
+		assert.NoError(t, p.QuerySolution(`open(bar, write, S), write(S, baz), write(S, '.'), close(S).`).Err())
+		assert.NoError(t, p.QuerySolution(`open(bar, read, S), read(S, T), close(S), T == baz.`).Err())
+		assert.NoError(t, p.QuerySolution(`catch(open('/etc/passwd', read, _), error(existence_error(source_sink, _), _), true).`).Err())
+
+		p.FS = engine.ReadOnlyFS{FS: &fsys}
+		assert.NoError(t, p.QuerySolution(`catch(open(bar, append, _), error(permission_error(open, source_sink, bar), _), true).`).Err())
+	})
+
+	t.Run("halt", func(t *testing.T) {
+		p := New(nil, nil)
+		assert.Equal(t, &engine.HaltError{Code: 0}, p.QuerySolution(`halt.`).Err())
+		assert.Equal(t, &engine.HaltError{Code: 3}, p.QuerySolution(`catch(halt(3), _, true).`).Err())
+		assert.Equal(t, &engine.HaltError{Code: 1}, p.Exec(`:- initialization(halt(1)).`))
+
+		sols, err := p.Query(`member(X, [a, b]), (X == b -> halt(2); true).`)
+		assert.NoError(t, err)
+		assert.True(t, sols.Next())
+		assert.False(t, sols.Next())
+		assert.Equal(t, &engine.HaltError{Code: 2}, sols.Err())
+		assert.NoError(t, sols.Close())
+	})
+
+	t.Run("trace", func(t *testing.T) {
+		var out bytes.Buffer
+		p := New(nil, &out)
+		assert.NoError(t, p.Exec(`
+foo(X) :- bar(X).
+bar(a).
+`))
+		assert.NoError(t, p.QuerySolution(`trace, foo(a), notrace.`).Err())
+		assert.Equal(t, `   Call: (1) foo(a)
+   Call: (2) bar(a)
+   Exit: (2) bar(a)
+   Exit: (1) foo(a)
+   Call: (1) notrace
+`, out.String())
+
+		out.Reset()
+		p = New(strings.NewReader("\n\nl\n"), &out)
+		assert.NoError(t, p.Exec(`
+foo(X) :- bar(X).
+bar(a).
+`))
+		assert.NoError(t, p.QuerySolution(`trace, foo(a).`).Err())
+		assert.Equal(t, `   Call: (1) foo(a) ?    Call: (2) bar(a) ?    Exit: (2) bar(a) ? `, out.String())
+	})
+
+	t.Run("profile", func(t *testing.T) {
+		var out bytes.Buffer
+		p := New(nil, &out)
+		assert.NoError(t, p.Exec(`
+foo(X) :- member(X, [a, b, c]), X == b.
+`))
+		sol := p.QuerySolution(`profile(foo(X)).`)
+		assert.NoError(t, sol.Err())
+		var s struct{ X string }
+		assert.NoError(t, sol.Scan(&s))
+		assert.Equal(t, "b", s.X)
+		assert.Contains(t, out.String(), "Predicate")
+		assert.Contains(t, out.String(), "foo/1")
+		assert.Contains(t, out.String(), "member/2")
+
+		assert.NoError(t, p.QuerySolution(`\+ profile(fail).`).Err())
+	})
+
+	t.Run("print_message", func(t *testing.T) {
+		var out, errOut bytes.Buffer
+		p := NewWithOptions(UserOutput(&out), UserError(&errOut))
+		assert.NoError(t, p.Exec(`
+:- dynamic(log/2).
+prolog:message(greeting(Name)) --> ['Hello, ~w!'-[Name]].
+user:message_hook(secret(_), Kind, Lines) :- assertz(log(Kind, Lines)).
+color:red.
+color:blue.
+`))
+		sol := p.QuerySolution(`findall(X, color:X, L), \+current_predicate(color/1).`)
+		var c struct{ L []string }
+		assert.NoError(t, sol.Scan(&c))
+		assert.Equal(t, []string{"red", "blue"}, c.L)
+
+		assert.NoError(t, p.QuerySolution(`print_message(informational, greeting(world)).`).Err())
+		assert.NoError(t, p.QuerySolution(`print_message(error, secret(x)).`).Err())
+		assert.NoError(t, p.QuerySolution(`catch(atom_length(_, _), E, (print_message(error, E), true)).`).Err())
+		assert.NoError(t, p.QuerySolution(`log(error, _).`).Err())
+
+		sol = p.QuerySolution(`message_to_codes(greeting(you), warning, Cs), atom_codes(A, Cs).`)
+		var s struct{ A string }
+		assert.NoError(t, sol.Scan(&s))
+		assert.Equal(t, "Warning: Hello, you!", s.A)
+
+		assert.NoError(t, p.Exec(`foo(X) :- bar.`))
+		assert.Equal(t, `% Hello, world!
+ERROR: atom_length/2: Arguments are not sufficiently instantiated
+Warning: 1:1: Singleton variables [X] in foo/1
+Warning: 1:1: Undefined procedure bar/0 called from foo/1
+`, errOut.String())
+		assert.Empty(t, out.String())
+	})
+
+	t.Run("source locations", func(t *testing.T) {
+		fsys := &engine.MemFS{}
+		assert.NoError(t, fsys.WriteFile("foo.pl", []byte(`
+foo(a).
+foo(b) :-
+	true.
+`)))
+		assert.NoError(t, fsys.WriteFile("bar.pl", []byte(`bar(a).
+bar(b) :- ).
+`)))
+		p := New(nil, nil)
+		p.FS = fsys
+		assert.NoError(t, p.Exec(`:- consult(foo).`))
+
+		var s struct {
+			File string
+			Line int
+		}
+		sol := p.QuerySolution(`predicate_property(foo(_), file(File)), clause_property(foo(b), line_count(Line)).`)
+		assert.NoError(t, sol.Scan(&s))
+		assert.Equal(t, "foo.pl", s.File)
+		assert.Equal(t, 3, s.Line)
+
+		err := p.Exec(`:- consult(bar).`)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "bar.pl:2:11: unexpected token: close())")
+	})
+
+	t.Run("backtrace", func(t *testing.T) {
+		p := New(nil, nil)
+		p.BacktraceDepth = 10
+		assert.NoError(t, p.Exec(`
+foo(X) :- bar(X).
+bar(X) :- Y is X + 1, write(Y).
+`))
+		err := p.QuerySolution(`foo(a).`).Err()
+		e, ok := err.(engine.Exception)
+		assert.True(t, ok)
+
+		var frames []string
+		for _, f := range e.Backtrace() {
+			frames = append(frames, f.String())
+		}
+		assert.Len(t, frames, 3)
+		assert.Contains(t, frames[0], "is(")
+		assert.Equal(t, []string{
+			"bar(a) at 3:1",
+			"foo(a) at 2:1",
+		}, frames[1:])
+	})
 }
 
 func TestNew_variableNames(t *testing.T) {
@@ -1602,13 +1915,6 @@ func ExampleNew_arg() {
 	// error(type_error(compound,3),arg/3)
 }
 
-func TestDefaultFS_Open(t *testing.T) {
-	var fs defaultFS
-	f, err := fs.Open("interpreter.go")
-	assert.NoError(t, err)
-	assert.NotNil(t, f)
-}
-
 type readFn func(p []byte) (n int, err error)
 
 func (f readFn) Read(p []byte) (n int, err error) {
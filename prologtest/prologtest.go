@@ -0,0 +1,71 @@
+// Package prologtest runs unit tests written in Prolog as Go tests.
+package prologtest
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/ichiban/prolog"
+	"github.com/ichiban/prolog/engine"
+)
+
+// Run runs the unit tests of the interpreter as subtests of t named Unit/Name.
+// Without units, it runs all the tests loaded into the interpreter.
+// Failed tests are reported with t.Error, blocked tests are skipped, and warnings are logged.
+func Run(t *testing.T, p *prolog.Interpreter, units ...string) {
+	t.Helper()
+
+	us := make([]engine.Atom, len(units))
+	for i, u := range units {
+		us[i] = engine.NewAtom(u)
+	}
+	tests := p.UnitTests(us...)
+	if len(tests) == 0 {
+		t.Fatalf("no tests found")
+	}
+
+	for len(tests) > 0 {
+		unit := tests[0].Unit
+		n := 1
+		for n < len(tests) && tests[n].Unit == unit {
+			n++
+		}
+		ts := tests[:n]
+		tests = tests[n:]
+
+		t.Run(unit.String(), func(t *testing.T) {
+			for _, ut := range ts {
+				ut := ut
+				t.Run(name(ut.Name), func(t *testing.T) {
+					run(t, p, ut)
+				})
+			}
+		})
+	}
+}
+
+func run(t *testing.T, p *prolog.Interpreter, ut engine.UnitTest) {
+	t.Helper()
+
+	r, err := p.RunUnitTest(context.Background(), ut)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range r.Messages {
+		switch {
+		case r.Blocked:
+			t.Skip(m.String())
+		case m.Kind == engine.NewAtom("error"):
+			t.Error(m.String())
+		default:
+			t.Log(m.String())
+		}
+	}
+}
+
+func name(t engine.Term) string {
+	var sb strings.Builder
+	_ = t.WriteTerm(&sb, &engine.WriteOptions{}, nil)
+	return sb.String()
+}
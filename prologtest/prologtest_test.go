@@ -0,0 +1,46 @@
+package prologtest
+
+import (
+	"testing"
+
+	"github.com/ichiban/prolog"
+)
+
+func TestRun(t *testing.T) {
+	p := prolog.New(nil, nil)
+	if err := p.Exec(`
+:- begin_tests(lists).
+
+test(member, nondet) :-
+    member(b, [a, b, c]).
+test(append, L == [a, b, c]) :-
+    append([a], [b, c], L).
+test(length, [forall(member(L-N, [[]-0, [a]-1])), true(M =:= N)]) :-
+    length(L, M).
+test(nth0, fail) :-
+    nth0(3, [a, b, c], _).
+test(atom_length, error(type_error(integer, a))) :-
+    atom_length(abc, a).
+test(sort, blocked(todo)) :-
+    sort([b, a], [b, a]).
+
+:- end_tests(lists).
+
+:- begin_tests(arith).
+
+test(is, X =:= 3) :-
+    X is 1 + 2.
+
+:- end_tests(arith).
+`); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("all", func(t *testing.T) {
+		Run(t, p)
+	})
+
+	t.Run("unit", func(t *testing.T) {
+		Run(t, p, "arith")
+	})
+}
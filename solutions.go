@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"reflect"
 	"strings"
 
@@ -100,6 +101,12 @@ func (s *Solutions) Scan(dest interface{}) error {
 	}
 }
 
+// WriteAnswer writes the current solution in the way the top level shows it.
+// The variables bound to the same term are grouped, the other variables are named _A, _B, ..., and the residual goals follow.
+func (s *Solutions) WriteAnswer(w io.Writer) error {
+	return s.vm.WriteAnswer(w, s.vars, s.env)
+}
+
 var atomEmptyList = engine.NewAtom("[]")
 
 func convertAssign(dest interface{}, vm *engine.VM, t engine.Term, env *engine.Env) error {
@@ -125,6 +132,9 @@ func convertAssign(dest interface{}, vm *engine.VM, t engine.Term, env *engine.E
 	case Scanner:
 		return d.Scan(vm, t, env)
 	default:
+		if b, ok := env.Resolve(t).(*engine.Blob); ok {
+			return convertAssignBlob(d, b)
+		}
 		return convertAssignSlice(d, vm, t, env)
 	}
 }
@@ -147,6 +157,9 @@ func convertAssignAny(d *interface{}, vm *engine.VM, t engine.Term, env *engine.
 	case engine.Float:
 		*d = float64(t)
 		return nil
+	case *engine.Blob:
+		*d = t.Value
+		return nil
 	case engine.Compound:
 		var s []interface{}
 		iter := engine.ListIterator{List: t, Env: env}
@@ -246,6 +259,16 @@ func convertAssignFloat64(d *float64, t engine.Term, env *engine.Env) error {
 	}
 }
 
+func convertAssignBlob(d interface{}, b *engine.Blob) error {
+	v := reflect.ValueOf(d).Elem()
+	bv := reflect.ValueOf(b.Value)
+	if !bv.IsValid() || !bv.Type().AssignableTo(v.Type()) {
+		return errConversion
+	}
+	v.Set(bv)
+	return nil
+}
+
 func convertAssignSlice(d interface{}, vm *engine.VM, t engine.Term, env *engine.Env) error {
 	v := reflect.ValueOf(d).Elem()
 
@@ -3,6 +3,7 @@ package prolog
 import (
 	"errors"
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/ichiban/prolog/engine"
@@ -37,6 +38,10 @@ func TestSolutions_Next(t *testing.T) {
 	})
 }
 
+type blobHandle struct {
+	name string
+}
+
 func TestSolutions_Scan(t *testing.T) {
 	sols := func(m map[string]engine.Term) Solutions {
 		env := engine.NewEnv()
@@ -100,6 +105,18 @@ func TestSolutions_Scan(t *testing.T) {
 		{title: "struct: interface, unknown", sols: sols(map[string]engine.Term{
 			"X": nil,
 		}), dest: &struct{ X interface{} }{}, err: errConversion},
+		{title: "struct: interface, blob", sols: sols(map[string]engine.Term{
+			"X": engine.NewBlob(&blobHandle{name: "foo"}),
+		}), dest: &struct{ X interface{} }{}, result: &struct{ X interface{} }{X: &blobHandle{name: "foo"}}},
+		{title: "struct: pointer, blob", sols: sols(map[string]engine.Term{
+			"X": engine.NewBlob(&blobHandle{name: "foo"}),
+		}), dest: &struct{ X *blobHandle }{}, result: &struct{ X *blobHandle }{X: &blobHandle{name: "foo"}}},
+		{title: "struct: pointer, blob of another type", sols: sols(map[string]engine.Term{
+			"X": engine.NewBlob(1),
+		}), dest: &struct{ X *blobHandle }{}, err: errConversion},
+		{title: "struct: pointer, non-blob", sols: sols(map[string]engine.Term{
+			"X": engine.NewAtom("foo"),
+		}), dest: &struct{ X *blobHandle }{}, err: errConversion},
 
 		{title: "struct: string, atom", sols: sols(map[string]engine.Term{
 			"X": engine.NewAtom("foo"),
@@ -218,6 +235,38 @@ func TestSolutions_Scan(t *testing.T) {
 	}
 }
 
+func TestSolutions_WriteAnswer(t *testing.T) {
+	p := New(nil, nil)
+	tests := []struct {
+		query  string
+		output string
+	}{
+		{query: `true.`, output: `true`},
+		{query: `X = f(Y).`, output: `X = f(Y)`},
+		{query: `X = Y, copy_term(f(A, A, _), Z).`, output: "X = Y,\nZ = f(_A,_A,_)"},
+		{query: `X = 'a b', Y = 'a b'.`, output: "X = Y,\nY = 'a b'"},
+		{query: `X = a + b.`, output: `X = a+b`},
+		{query: `sat(X + Y).`, output: `sat(X+Y)`},
+		{query: `length(L, 11).`, output: `L = [_,_,_,_,_,_,_,_,_,_|...]`},
+		{query: `set_prolog_flag(answer_write_options, [quoted(false)]), X = 'a b'.`, output: `X = a b`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			sols, err := p.Query(tt.query)
+			assert.NoError(t, err)
+			defer func() {
+				assert.NoError(t, sols.Close())
+			}()
+			assert.True(t, sols.Next())
+
+			var sb strings.Builder
+			assert.NoError(t, sols.WriteAnswer(&sb))
+			assert.Equal(t, tt.output, sb.String())
+		})
+	}
+}
+
 func TestSolutions_Err(t *testing.T) {
 	err := errors.New("ng")
 	sols := Solutions{err: err}